@@ -0,0 +1,68 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmsTypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+)
+
+// The target account must be able to use the KMS key of the source instance, in order to copy its snapshot.
+// Snapshots encrypted with an AWS managed key can not be shared at all.
+func (c *Controller) isSrcKMSKeyUsableByTargetAccount(instance *rdsTypes.DBInstance) (bool, error) {
+	input := &kms.DescribeKeyInput{
+		KeyId: instance.KmsKeyId,
+	}
+
+	// Any error means the key is not visible from the target account, e.g. access is denied by the key policy.
+	output, err := c.dstKMSClient.DescribeKey(*c.configuration.Context, input)
+	if err != nil {
+		log.Errorf(
+			"Target account: '%s' can not use the KMS key: '%s'. %s",
+			c.GetTargetAccountID(),
+			*instance.KmsKeyId,
+			err.Error(),
+		)
+		return false, nil
+	}
+
+	if output.KeyMetadata.KeyManager != kmsTypes.KeyManagerTypeCustomer {
+		log.Errorf("KMS key: '%s' is managed by AWS and can not be shared with another account!", *instance.KmsKeyId)
+		return false, nil
+	}
+
+	if output.KeyMetadata.KeyState != kmsTypes.KeyStateEnabled {
+		log.Errorf("KMS key: '%s' is in state: '%s'!", *instance.KmsKeyId, output.KeyMetadata.KeyState)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (c *Controller) IsValidTargetAccount(instance *rdsTypes.DBInstance) (bool, error) {
+	if c.configuration.Items.Upgrade.TargetAccountRoleArn == "" {
+		return true, nil
+	}
+
+	if !c.IsCrossAccount() {
+		log.Errorf("Provided target account role: '%s' is not a valid ARN!", c.configuration.Items.Upgrade.TargetAccountRoleArn)
+		return false, nil
+	}
+
+	if !instance.StorageEncrypted {
+		return true, nil
+	}
+
+	return c.isSrcKMSKeyUsableByTargetAccount(instance)
+}
@@ -0,0 +1,284 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"fmt"
+	"strings"
+)
+
+const (
+	RDS_METRIC_NAMESPACE         string = "AWS/RDS"
+	DB_INSTANCE_METRIC_DIMENSION string = "DBInstanceIdentifier"
+	ALARM_ACTIONS_BATCH_SIZE     int    = 100
+)
+
+type ClonedAlarm struct {
+	SrcAlarmName *string
+	AlarmName    *string
+	// Instance the cloned alarm is scoped to.
+	DBInstanceIdentifier string
+}
+
+// Alarms and their actions, e.g. SNS topics, belong to the region and the account of the source instance.
+func (c *Controller) AlarmCloningEnabled() bool {
+	return c.configuration.Items.Upgrade.CloneAlarms && !c.IsCrossRegion() && !c.IsCrossAccount()
+}
+
+// Maps the source instance and its read replicas to the instances that replace them.
+// Replicas of other regions are skipped, since their alarms belong to another region.
+func (c *Controller) buildAlarmDBInstanceMapping(srcInstance *rdsTypes.DBInstance, dstInstance *rdsTypes.DBInstance) (map[string]string, error) {
+	mapping := map[string]string{
+		*srcInstance.DBInstanceIdentifier: *dstInstance.DBInstanceIdentifier,
+	}
+
+	if !c.configuration.Items.Upgrade.ReadReplicas || len(srcInstance.ReadReplicaDBInstanceIdentifiers) == 0 {
+		return mapping, nil
+	}
+
+	srcReadReplicas, err := c.DescribeReadReplicas(srcInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range srcReadReplicas {
+		if srcReadReplicas[idx].Region != "" {
+			continue
+		}
+		mapping[*srcReadReplicas[idx].Instance.DBInstanceIdentifier] = c.buildReadReplicaIdentifier(srcReadReplicas[idx].Instance)
+	}
+
+	return mapping, nil
+}
+
+// Returns the first instance of the mapping the dimensions are scoped to, or an empty string.
+func findMappedDBInstance(namespace *string, dimensions []cwTypes.Dimension, mapping map[string]string) string {
+	if a.ToString(namespace) != RDS_METRIC_NAMESPACE {
+		return ""
+	}
+
+	for _, dimension := range dimensions {
+		if a.ToString(dimension.Name) != DB_INSTANCE_METRIC_DIMENSION {
+			continue
+		}
+		if _, ok := mapping[a.ToString(dimension.Value)]; ok {
+			return a.ToString(dimension.Value)
+		}
+	}
+
+	return ""
+}
+
+// Both the plain alarms and the metric math ones are scoped by the dimensions of their metrics.
+func findAlarmDBInstance(alarm *cwTypes.MetricAlarm, mapping map[string]string) string {
+	if instance := findMappedDBInstance(alarm.Namespace, alarm.Dimensions, mapping); instance != "" {
+		return instance
+	}
+
+	for _, query := range alarm.Metrics {
+		if query.MetricStat == nil || query.MetricStat.Metric == nil {
+			continue
+		}
+		metric := query.MetricStat.Metric
+		if instance := findMappedDBInstance(metric.Namespace, metric.Dimensions, mapping); instance != "" {
+			return instance
+		}
+	}
+
+	return ""
+}
+
+func replaceDimensions(dimensions []cwTypes.Dimension, mapping map[string]string) []cwTypes.Dimension {
+	replaced := []cwTypes.Dimension{}
+	for _, dimension := range dimensions {
+		if a.ToString(dimension.Name) == DB_INSTANCE_METRIC_DIMENSION {
+			if instance, ok := mapping[a.ToString(dimension.Value)]; ok {
+				dimension.Value = a.String(instance)
+			}
+		}
+		replaced = append(replaced, dimension)
+	}
+
+	return replaced
+}
+
+func replaceMetricDataQueries(queries []cwTypes.MetricDataQuery, mapping map[string]string) []cwTypes.MetricDataQuery {
+	if len(queries) == 0 {
+		return nil
+	}
+
+	replaced := []cwTypes.MetricDataQuery{}
+	for _, query := range queries {
+		if query.MetricStat != nil && query.MetricStat.Metric != nil {
+			metricStat := *query.MetricStat
+			metric := *metricStat.Metric
+			metric.Dimensions = replaceDimensions(metric.Dimensions, mapping)
+			metricStat.Metric = &metric
+			query.MetricStat = &metricStat
+		}
+		replaced = append(replaced, query)
+	}
+
+	return replaced
+}
+
+// The name of the source instance is replaced with the new one if the alarm is named after it, e.g. 'test-db-cpu' -> 'test-db-v14-cpu'.
+func buildClonedAlarmName(alarmName string, srcInstanceID string, dstInstanceID string) string {
+	if strings.Contains(alarmName, srcInstanceID) {
+		return strings.Replace(alarmName, srcInstanceID, dstInstanceID, 1)
+	}
+
+	return fmt.Sprintf("%s-%s", alarmName, dstInstanceID)
+}
+
+func buildClonedAlarmInput(alarm *cwTypes.MetricAlarm, alarmName string, mapping map[string]string) *cloudwatch.PutMetricAlarmInput {
+	input := &cloudwatch.PutMetricAlarmInput{
+		AlarmName:                        a.String(alarmName),
+		ComparisonOperator:               alarm.ComparisonOperator,
+		EvaluationPeriods:                alarm.EvaluationPeriods,
+		ActionsEnabled:                   alarm.ActionsEnabled,
+		AlarmActions:                     alarm.AlarmActions,
+		AlarmDescription:                 alarm.AlarmDescription,
+		DatapointsToAlarm:                alarm.DatapointsToAlarm,
+		Dimensions:                       replaceDimensions(alarm.Dimensions, mapping),
+		EvaluateLowSampleCountPercentile: alarm.EvaluateLowSampleCountPercentile,
+		ExtendedStatistic:                alarm.ExtendedStatistic,
+		InsufficientDataActions:          alarm.InsufficientDataActions,
+		MetricName:                       alarm.MetricName,
+		Metrics:                          replaceMetricDataQueries(alarm.Metrics, mapping),
+		Namespace:                        alarm.Namespace,
+		OKActions:                        alarm.OKActions,
+		Period:                           alarm.Period,
+		Statistic:                        alarm.Statistic,
+		Threshold:                        alarm.Threshold,
+		ThresholdMetricId:                alarm.ThresholdMetricId,
+		TreatMissingData:                 alarm.TreatMissingData,
+		Unit:                             alarm.Unit,
+	}
+	if len(input.Dimensions) == 0 {
+		input.Dimensions = nil
+	}
+
+	return input
+}
+
+// Returns the metric alarms scoped to any instance of the mapping.
+func (c *Controller) describeDBInstanceAlarms(mapping map[string]string) ([]cwTypes.MetricAlarm, error) {
+	input := &cloudwatch.DescribeAlarmsInput{
+		AlarmTypes: []cwTypes.AlarmType{cwTypes.AlarmTypeMetricAlarm},
+	}
+
+	alarms := []cwTypes.MetricAlarm{}
+	paginator := cloudwatch.NewDescribeAlarmsPaginator(c.cwClient, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		for idx := range output.MetricAlarms {
+			if findAlarmDBInstance(&output.MetricAlarms[idx], mapping) != "" {
+				alarms = append(alarms, output.MetricAlarms[idx])
+			}
+		}
+	}
+
+	return alarms, nil
+}
+
+// Alarms are copied with the same thresholds and actions, scoped to the new instance and its read replicas.
+// Cloning an alarm again overwrites the previous copy.
+func (c *Controller) CloneDBInstanceAlarms(srcInstance *rdsTypes.DBInstance, dstInstance *rdsTypes.DBInstance) ([]*ClonedAlarm, error) {
+	if !c.configuration.Items.Upgrade.CloneAlarms {
+		return nil, nil
+	}
+
+	if !c.AlarmCloningEnabled() {
+		log.Warnln("CloudWatch alarms are not cloned to another region or account, since their actions belong to the source one.")
+		return nil, nil
+	}
+
+	mapping, err := c.buildAlarmDBInstanceMapping(srcInstance, dstInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	alarms, err := c.describeDBInstanceAlarms(mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	clonedAlarms := []*ClonedAlarm{}
+	for idx := range alarms {
+		srcInstanceID := findAlarmDBInstance(&alarms[idx], mapping)
+		alarmName := buildClonedAlarmName(*alarms[idx].AlarmName, srcInstanceID, mapping[srcInstanceID])
+
+		log.Infof("Cloning CloudWatch alarm: '%s' as '%s'", *alarms[idx].AlarmName, alarmName)
+		_, err = c.cwClient.PutMetricAlarm(*c.configuration.Context, buildClonedAlarmInput(&alarms[idx], alarmName, mapping))
+		if err != nil {
+			return nil, err
+		}
+
+		clonedAlarms = append(clonedAlarms, &ClonedAlarm{
+			SrcAlarmName:         alarms[idx].AlarmName,
+			AlarmName:            a.String(alarmName),
+			DBInstanceIdentifier: mapping[srcInstanceID],
+		})
+	}
+
+	return clonedAlarms, nil
+}
+
+// Only the actions are disabled, so the alarms still show the state of the old instance.
+func (c *Controller) DisableSrcDBInstanceAlarms(srcInstance *rdsTypes.DBInstance) ([]string, error) {
+	mapping := map[string]string{
+		*srcInstance.DBInstanceIdentifier: *srcInstance.DBInstanceIdentifier,
+	}
+	for _, replicaIdentifier := range srcInstance.ReadReplicaDBInstanceIdentifiers {
+		mapping[replicaIdentifier] = replicaIdentifier
+	}
+
+	alarms, err := c.describeDBInstanceAlarms(mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	alarmNames := []string{}
+	for idx := range alarms {
+		if a.ToBool(alarms[idx].ActionsEnabled) {
+			alarmNames = append(alarmNames, *alarms[idx].AlarmName)
+		}
+	}
+
+	for start := 0; start < len(alarmNames); start += ALARM_ACTIONS_BATCH_SIZE {
+		end := start + ALARM_ACTIONS_BATCH_SIZE
+		if end > len(alarmNames) {
+			end = len(alarmNames)
+		}
+
+		input := &cloudwatch.DisableAlarmActionsInput{
+			AlarmNames: alarmNames[start:end],
+		}
+		_, err = c.cwClient.DisableAlarmActions(*c.configuration.Context, input)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return alarmNames, nil
+}
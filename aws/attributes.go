@@ -0,0 +1,252 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	UNSET_ATTRIBUTE_VALUE string = "<unset>"
+)
+
+// Backup, monitoring and Performance Insights settings are not accepted by the restore call.
+func (c *Controller) applyTargetDBInstanceAttributes(instance *rdsTypes.DBInstance, configuration *targetDBConfiguration) error {
+	if instance.DBClusterIdentifier != nil {
+		return c.applyTargetDBClusterAttributes(instance, configuration)
+	}
+
+	log.Infof("Applying the remaining attributes to an instance: '%s'", *instance.DBInstanceIdentifier)
+	instanceInput := &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier:               instance.DBInstanceIdentifier,
+		ApplyImmediately:                   true,
+		BackupRetentionPeriod:              configuration.backupRetentionPeriod,
+		PreferredBackupWindow:              configuration.backupWindow,
+		PreferredMaintenanceWindow:         configuration.maintenanceWindow,
+		MaxAllocatedStorage:                configuration.maxAllocatedStorage,
+		MonitoringInterval:                 configuration.monitoringInterval,
+		MonitoringRoleArn:                  configuration.monitoringRoleArn,
+		EnablePerformanceInsights:          configuration.performanceInsightsEnabled,
+		PerformanceInsightsKMSKeyId:        configuration.performanceInsightsKMSKeyID,
+		PerformanceInsightsRetentionPeriod: configuration.performanceInsightsRetentionPeriod,
+		ManageMasterUserPassword:           configuration.manageMasterUserPassword,
+		MasterUserSecretKmsKeyId:           configuration.masterUserSecretKMSKeyID,
+	}
+	_, err := c.dstRDSClient.ModifyDBInstance(*c.configuration.Context, instanceInput)
+	if err != nil {
+		return err
+	}
+
+	log.Infoln("Waiting for an instance to become available.")
+	waitParams := &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: instance.DBInstanceIdentifier,
+	}
+	waiter := c.newDBInstanceAvailableWaiterForClient(c.dstRDSClient)
+
+	duration, err := c.getTimeout(OPERATION_DB_INSTANCE_MODIFY)
+	if err != nil {
+		return err
+	}
+	stopProgressReport := c.startProgressReport(c.dstRDSClient, rdsTypes.SourceTypeDbInstance, instance.DBInstanceIdentifier)
+	err = waiter.Wait(*c.configuration.Context, waitParams, duration)
+	stopProgressReport()
+	if err != nil {
+		return err
+	}
+
+	for idx := range configuration.iamRoles {
+		log.Infof(
+			"Associating IAM role: '%s' for feature: '%s'",
+			*configuration.iamRoles[idx].RoleArn,
+			*configuration.iamRoles[idx].FeatureName,
+		)
+		roleInput := &rds.AddRoleToDBInstanceInput{
+			DBInstanceIdentifier: instance.DBInstanceIdentifier,
+			FeatureName:          configuration.iamRoles[idx].FeatureName,
+			RoleArn:              configuration.iamRoles[idx].RoleArn,
+		}
+		_, err = c.dstRDSClient.AddRoleToDBInstance(*c.configuration.Context, roleInput)
+		if err != nil {
+			var apiError *rdsTypes.DBInstanceRoleAlreadyExistsFault
+			if !errors.As(err, &apiError) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func formatStringAttribute(value *string) string {
+	if value == nil || *value == "" {
+		return UNSET_ATTRIBUTE_VALUE
+	}
+	return *value
+}
+
+func formatInt32Attribute(value *int32) string {
+	if value == nil {
+		return UNSET_ATTRIBUTE_VALUE
+	}
+	return fmt.Sprintf("%d", *value)
+}
+
+func formatBoolAttribute(value *bool) string {
+	if value == nil {
+		return UNSET_ATTRIBUTE_VALUE
+	}
+	return fmt.Sprintf("%t", *value)
+}
+
+func formatStringSliceAttribute(values []string) string {
+	if len(values) == 0 {
+		return UNSET_ATTRIBUTE_VALUE
+	}
+	sortedValues := append([]string{}, values...)
+	sort.Strings(sortedValues)
+	return strings.Join(sortedValues, ",")
+}
+
+func formatIAMRolesAttribute(roles []rdsTypes.DBInstanceRole) string {
+	values := []string{}
+	for idx := range roles {
+		values = append(values, fmt.Sprintf(
+			"%s%s%s",
+			a.ToString(roles[idx].FeatureName),
+			IAM_ROLE_OVERRIDE_SEPARATOR,
+			a.ToString(roles[idx].RoleArn),
+		))
+	}
+	return formatStringSliceAttribute(values)
+}
+
+// Only attributes with an expected value are compared, so the ones left to AWS defaults are skipped.
+func findTargetDBInstanceAttributeDifferences(instance *rdsTypes.DBInstance, configuration *targetDBConfiguration) []string {
+	differences := []string{}
+	compare := func(name string, expected string, actual string) {
+		if expected != UNSET_ATTRIBUTE_VALUE && expected != actual {
+			differences = append(differences, fmt.Sprintf("%s: expected '%s', got '%s'", name, expected, actual))
+		}
+	}
+
+	var port *int32
+	if instance.Endpoint != nil {
+		port = a.Int32(instance.Endpoint.Port)
+	}
+
+	optionGroupNames := []string{}
+	for idx := range instance.OptionGroupMemberships {
+		optionGroupNames = append(optionGroupNames, a.ToString(instance.OptionGroupMemberships[idx].OptionGroupName))
+	}
+
+	roles := []rdsTypes.DBInstanceRole{}
+	for idx := range instance.AssociatedRoles {
+		roles = append(roles, rdsTypes.DBInstanceRole{
+			FeatureName: instance.AssociatedRoles[idx].FeatureName,
+			RoleArn:     instance.AssociatedRoles[idx].RoleArn,
+		})
+	}
+
+	compare("option group", formatStringAttribute(configuration.optionGroupName), formatStringSliceAttribute(optionGroupNames))
+	compare("port", formatInt32Attribute(configuration.port), formatInt32Attribute(port))
+	compare("publicly accessible", formatBoolAttribute(configuration.publiclyAccessible), formatBoolAttribute(&instance.PubliclyAccessible))
+	compare(
+		"CloudWatch logs exports",
+		formatStringSliceAttribute(configuration.cloudwatchLogsExports),
+		formatStringSliceAttribute(instance.EnabledCloudwatchLogsExports),
+	)
+	compare(
+		"backup retention period",
+		formatInt32Attribute(configuration.backupRetentionPeriod),
+		formatInt32Attribute(&instance.BackupRetentionPeriod),
+	)
+	compare("backup window", formatStringAttribute(configuration.backupWindow), formatStringAttribute(instance.PreferredBackupWindow))
+	compare(
+		"maintenance window",
+		formatStringAttribute(configuration.maintenanceWindow),
+		formatStringAttribute(instance.PreferredMaintenanceWindow),
+	)
+	compare(
+		"max allocated storage",
+		formatInt32Attribute(configuration.maxAllocatedStorage),
+		formatInt32Attribute(instance.MaxAllocatedStorage),
+	)
+	compare(
+		"monitoring interval",
+		formatInt32Attribute(configuration.monitoringInterval),
+		formatInt32Attribute(instance.MonitoringInterval),
+	)
+	compare("monitoring role", formatStringAttribute(configuration.monitoringRoleArn), formatStringAttribute(instance.MonitoringRoleArn))
+	compare(
+		"Performance Insights",
+		formatBoolAttribute(configuration.performanceInsightsEnabled),
+		formatBoolAttribute(a.Bool(a.ToBool(instance.PerformanceInsightsEnabled))),
+	)
+	compare(
+		"Performance Insights KMS key",
+		formatStringAttribute(configuration.performanceInsightsKMSKeyID),
+		formatStringAttribute(instance.PerformanceInsightsKMSKeyId),
+	)
+	compare(
+		"Performance Insights retention period",
+		formatInt32Attribute(configuration.performanceInsightsRetentionPeriod),
+		formatInt32Attribute(instance.PerformanceInsightsRetentionPeriod),
+	)
+	compare("IAM roles", formatIAMRolesAttribute(configuration.iamRoles), formatIAMRolesAttribute(roles))
+	compare(
+		"managed master user password",
+		formatBoolAttribute(configuration.manageMasterUserPassword),
+		formatBoolAttribute(a.Bool(instance.MasterUserSecret != nil)),
+	)
+
+	return differences
+}
+
+// Differences are reported, but do not stop the upgrade, since the new instance is fully functional.
+func (c *Controller) reportTargetDBInstanceAttributeDifferences(instance *rdsTypes.DBInstance, configuration *targetDBConfiguration) error {
+	instances, err := c.DescribeDBInstanceInDstRegion(instance.DBInstanceIdentifier)
+	if err != nil {
+		return err
+	}
+
+	if len(instances) == 0 {
+		return errors.New(fmt.Sprintf("Failed to find DB instance: '%s'!", *instance.DBInstanceIdentifier))
+	}
+
+	if instances[0].DBClusterIdentifier != nil {
+		cluster, err := c.getDBClusterOfInstance(&instances[0])
+		if err != nil {
+			return err
+		}
+		mergeDBClusterAttributes(&instances[0], cluster)
+	}
+
+	differences := findTargetDBInstanceAttributeDifferences(&instances[0], configuration)
+	if len(differences) == 0 {
+		log.Infoln("All of the carried over attributes are in place on the new instance.")
+		return nil
+	}
+
+	for idx := range differences {
+		log.Warnf("New instance attribute differs from the expected one: %s", differences[idx])
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/types"
+	"testing"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetIAMRoles(t *testing.T) {
+	instance := &rdsTypes.DBInstance{
+		AssociatedRoles: []rdsTypes.DBInstanceRole{
+			{FeatureName: a.String("s3Import"), RoleArn: a.String("arn:aws:iam::123456789012:role/src"), Status: a.String("ACTIVE")},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		overrides     []string
+		expectedRoles []rdsTypes.DBInstanceRole
+		expectedError bool
+	}{
+		{
+			name: "Roles are copied from the source instance.",
+			expectedRoles: []rdsTypes.DBInstanceRole{
+				{FeatureName: a.String("s3Import"), RoleArn: a.String("arn:aws:iam::123456789012:role/src")},
+			},
+		},
+		{
+			name:      "Overrides replace the source instance roles.",
+			overrides: []string{"s3Export=arn:aws:iam::123456789012:role/dst"},
+			expectedRoles: []rdsTypes.DBInstanceRole{
+				{FeatureName: a.String("s3Export"), RoleArn: a.String("arn:aws:iam::123456789012:role/dst")},
+			},
+		},
+		{
+			name:      "Empty overrides remove all roles.",
+			overrides: []string{},
+		},
+		{
+			name:          "Override without a role ARN is rejected.",
+			overrides:     []string{"s3Export"},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			configuration := targetDBConfiguration{}
+			err := configuration.setIAMRoles(&types.UpgradeDetails{IAMRoles: test.overrides}, instance)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedRoles, configuration.iamRoles)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestFindTargetDBInstanceAttributeDifferences(t *testing.T) {
+	tests := []struct {
+		name                string
+		configuration       targetDBConfiguration
+		instance            rdsTypes.DBInstance
+		expectedDifferences []string
+	}{
+		{
+			name: "Matching attributes are not reported.",
+			configuration: targetDBConfiguration{
+				port:                  a.Int32(5432),
+				backupRetentionPeriod: a.Int32(7),
+				cloudwatchLogsExports: []string{"upgrade", "postgresql"},
+				iamRoles: []rdsTypes.DBInstanceRole{
+					{FeatureName: a.String("s3Import"), RoleArn: a.String("arn:aws:iam::123456789012:role/src")},
+				},
+			},
+			instance: rdsTypes.DBInstance{
+				Endpoint:                     &rdsTypes.Endpoint{Port: 5432},
+				BackupRetentionPeriod:        7,
+				EnabledCloudwatchLogsExports: []string{"postgresql", "upgrade"},
+				AssociatedRoles: []rdsTypes.DBInstanceRole{
+					{FeatureName: a.String("s3Import"), RoleArn: a.String("arn:aws:iam::123456789012:role/src"), Status: a.String("ACTIVE")},
+				},
+			},
+			expectedDifferences: []string{},
+		},
+		{
+			name:                "Attributes without an expected value are skipped.",
+			configuration:       targetDBConfiguration{},
+			instance:            rdsTypes.DBInstance{MonitoringInterval: a.Int32(60), PreferredBackupWindow: a.String("03:00-03:30")},
+			expectedDifferences: []string{},
+		},
+		{
+			name: "Mismatching attributes are reported.",
+			configuration: targetDBConfiguration{
+				publiclyAccessible:         a.Bool(false),
+				monitoringInterval:         a.Int32(30),
+				performanceInsightsEnabled: a.Bool(true),
+			},
+			instance: rdsTypes.DBInstance{
+				PubliclyAccessible: true,
+			},
+			expectedDifferences: []string{
+				"publicly accessible: expected 'false', got 'true'",
+				"monitoring interval: expected '30', got '<unset>'",
+				"Performance Insights: expected 'true', got 'false'",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			differences := findTargetDBInstanceAttributeDifferences(&test.instance, &test.configuration)
+			assert.Equal(t, test.expectedDifferences, differences)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
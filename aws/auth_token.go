@@ -0,0 +1,76 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const (
+	AUTH_TOKEN_SERVICE string        = "rds-db"
+	AUTH_TOKEN_EXPIRY  time.Duration = 15 * time.Minute
+	// SHA-256 of an empty payload, the token is a presigned GET request.
+	EMPTY_PAYLOAD_HASH string = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Same as the auth token of the SDK: a presigned 'connect' request without the scheme, used as the password.
+func buildAuthToken(ctx context.Context, endpoint string, region string, user string, credentialsProvider a.CredentialsProvider, now time.Time) (string, error) {
+	credentials, err := credentialsProvider.Retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequest(http.MethodGet, "https://"+endpoint+"/", nil)
+	if err != nil {
+		return "", err
+	}
+
+	values := request.URL.Query()
+	values.Set("Action", "connect")
+	values.Set("DBUser", user)
+	values.Set("X-Amz-Expires", strconv.Itoa(int(AUTH_TOKEN_EXPIRY.Seconds())))
+	request.URL.RawQuery = values.Encode()
+
+	signedURI, _, err := v4.NewSigner().PresignHTTP(ctx, credentials, request, EMPTY_PAYLOAD_HASH, AUTH_TOKEN_SERVICE, region, now)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimPrefix(signedURI, "https://"), nil
+}
+
+func (c *Controller) buildAuthTokenWithSession(session *a.Config, host string, port string, user string) (string, error) {
+	if session == nil || session.Credentials == nil {
+		return "", errors.New(fmt.Sprintf("No AWS credentials to build an auth token for host: '%s'!", host))
+	}
+
+	return buildAuthToken(*c.configuration.Context, net.JoinHostPort(host, port), session.Region, user, session.Credentials, time.Now().UTC())
+}
+
+// Tokens are built locally and valid for 15 minutes, so a new one is built for every connection.
+func (c *Controller) BuildSourceAuthToken(host string, port string, user string) (string, error) {
+	return c.buildAuthTokenWithSession(c.session, host, port, user)
+}
+
+// Signed in the region and with the credentials of the account the destination instance is created in.
+func (c *Controller) BuildDestinationAuthToken(host string, port string, user string) (string, error) {
+	return c.buildAuthTokenWithSession(c.dstSession, host, port, user)
+}
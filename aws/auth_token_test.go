@@ -0,0 +1,47 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildAuthToken(t *testing.T) {
+	credentialsProvider := credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "")
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	token, err := buildAuthToken(context.TODO(), "test-db.abc.us-east-1.rds.amazonaws.com:5432", "us-east-1", "ops", credentialsProvider, now)
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(token, "test-db.abc.us-east-1.rds.amazonaws.com:5432/?"), "token must not contain the scheme")
+	assert.Contains(t, token, "Action=connect")
+	assert.Contains(t, token, "DBUser=ops")
+	assert.Contains(t, token, "X-Amz-Expires=900")
+	assert.Contains(t, token, "X-Amz-Credential=AKIDEXAMPLE%2F20230102%2Fus-east-1%2Frds-db%2Faws4_request")
+	assert.Contains(t, token, "X-Amz-Signature=")
+
+	later, err := buildAuthToken(context.TODO(), "test-db.abc.us-east-1.rds.amazonaws.com:5432", "us-east-1", "ops", credentialsProvider, now.Add(10*time.Minute))
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, later, "a token built later must be a new one")
+}
+
+func TestBuildAuthTokenWithoutSession(t *testing.T) {
+	c := &Controller{}
+
+	_, err := c.BuildDestinationAuthToken("test-db", "5432", "ops")
+	assert.Error(t, err)
+}
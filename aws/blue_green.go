@@ -0,0 +1,327 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	STRATEGY_SNAPSHOT                      string        = "snapshot"
+	STRATEGY_BLUE_GREEN                    string        = "blue_green"
+	BLUE_GREEN_DEPLOYMENT_NAME_SUFFIX      string        = "-blue-green"
+	BLUE_GREEN_STATUS_PROVISIONING         string        = "PROVISIONING"
+	BLUE_GREEN_STATUS_AVAILABLE            string        = "AVAILABLE"
+	BLUE_GREEN_STATUS_SWITCHOVER_PROGRESS  string        = "SWITCHOVER_IN_PROGRESS"
+	BLUE_GREEN_STATUS_SWITCHOVER_COMPLETED string        = "SWITCHOVER_COMPLETED"
+	BLUE_GREEN_DEPLOYMENT_CREATE_TIMEOUT   string        = "1440m"
+	BLUE_GREEN_REPLICATION_LAG_TIMEOUT     string        = "60m"
+	BLUE_GREEN_CHECK_INTERVAL              time.Duration = 30  // seconds
+	BLUE_GREEN_SWITCHOVER_DEFAULT_TIMEOUT  time.Duration = 300 // seconds
+	BLUE_GREEN_SWITCHOVER_ROLLBACK_MARGIN  time.Duration = 300 // seconds
+	DB_INSTANCE_FINAL_SNAPSHOT_SUFFIX      string        = "-final"
+)
+
+func (c *Controller) GetStrategy() string {
+	if c.configuration.Items.Upgrade.Strategy == "" {
+		return STRATEGY_SNAPSHOT
+	}
+
+	return c.configuration.Items.Upgrade.Strategy
+}
+
+func (c *Controller) IsBlueGreenStrategy() bool {
+	return c.GetStrategy() == STRATEGY_BLUE_GREEN
+}
+
+func buildBlueGreenDeploymentName(instance *rdsTypes.DBInstance) string {
+	return *instance.DBInstanceIdentifier + BLUE_GREEN_DEPLOYMENT_NAME_SUFFIX
+}
+
+// Blue/green deployments only upgrade the engine version and the parameter group in place,
+// so the relocation to another region, account or engine is left to the snapshot strategy.
+func (c *Controller) IsValidStrategy(instance *rdsTypes.DBInstance) (bool, error) {
+	switch c.GetStrategy() {
+	case STRATEGY_SNAPSHOT:
+		return true, nil
+	case STRATEGY_BLUE_GREEN:
+	default:
+		log.Errorf(
+			"Provided strategy: '%s' is invalid. Available strategies: %v",
+			c.GetStrategy(),
+			[]string{STRATEGY_SNAPSHOT, STRATEGY_BLUE_GREEN},
+		)
+		return false, nil
+	}
+
+	if c.IsCrossRegion() || c.IsCrossAccount() || c.IsAuroraTarget() {
+		log.Errorln("Blue/green strategy can not be combined with another target region, account or engine!")
+		return false, nil
+	}
+
+	deployment, err := c.DescribeBlueGreenDeployment(instance)
+	if err != nil {
+		return false, err
+	}
+
+	if deployment != nil {
+		log.Errorf(
+			"Blue/green deployment: '%s' already exists with status: '%s'!",
+			*deployment.BlueGreenDeploymentName,
+			*deployment.Status,
+		)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Returns nil if there is no deployment for the instance.
+func (c *Controller) DescribeBlueGreenDeployment(instance *rdsTypes.DBInstance) (*rdsTypes.BlueGreenDeployment, error) {
+	input := &rds.DescribeBlueGreenDeploymentsInput{
+		Filters: []rdsTypes.Filter{
+			{
+				Name:   a.String("blue-green-deployment-name"),
+				Values: []string{buildBlueGreenDeploymentName(instance)},
+			},
+		},
+	}
+
+	output, err := c.rdsClient.DescribeBlueGreenDeployments(*c.configuration.Context, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.BlueGreenDeployments) == 0 {
+		return nil, nil
+	}
+
+	return &output.BlueGreenDeployments[0], nil
+}
+
+func (c *Controller) describeBlueGreenDeploymentByID(deploymentID *string) (*rdsTypes.BlueGreenDeployment, error) {
+	input := &rds.DescribeBlueGreenDeploymentsInput{
+		BlueGreenDeploymentIdentifier: deploymentID,
+	}
+
+	output, err := c.rdsClient.DescribeBlueGreenDeployments(*c.configuration.Context, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.BlueGreenDeployments) == 0 {
+		return nil, errors.New(fmt.Sprintf("Failed to find blue/green deployment: '%s'!", *deploymentID))
+	}
+
+	return &output.BlueGreenDeployments[0], nil
+}
+
+// No waiter available for blue/green deployments.
+// Any status other than the pending and the desired ones, e.g. 'INVALID_CONFIGURATION', fails the wait.
+func (c *Controller) waitForBlueGreenDeployment(deploymentID *string, pendingStatus string, desiredStatus string, waitTimeout time.Duration) (*rdsTypes.BlueGreenDeployment, error) {
+	startTime := time.Now()
+
+	checkInterval := time.Second * BLUE_GREEN_CHECK_INTERVAL
+	if c.waiterDelay > 0 {
+		checkInterval = c.waiterDelay
+	}
+
+	for {
+		deployment, err := c.describeBlueGreenDeploymentByID(deploymentID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch *deployment.Status {
+		case desiredStatus:
+			return deployment, nil
+		case pendingStatus:
+			log.Debugf("Blue/green deployment: '%s' is in status: '%s'", *deploymentID, *deployment.Status)
+		default:
+			return nil, errors.New(fmt.Sprintf(
+				"Blue/green deployment: '%s' has reached an unexpected status: '%s'. Details: '%s'!",
+				*deploymentID,
+				*deployment.Status,
+				a.ToString(deployment.StatusDetails),
+			))
+		}
+
+		if time.Since(startTime) > waitTimeout {
+			return nil, errors.New(fmt.Sprintf(
+				"Reached a timeout '%s', while waiting for blue/green deployment: '%s' to become: '%s'!",
+				waitTimeout.String(),
+				*deploymentID,
+				desiredStatus,
+			))
+		}
+
+		time.Sleep(checkInterval)
+	}
+}
+
+// Deployment members are referenced by their ARN, e.g. 'arn:aws:rds:us-east-1:123456789012:db:test-db-green-abc123'.
+func parseDBInstanceArn(instanceArn string) (string, error) {
+	parsedArn, err := arn.Parse(instanceArn)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(parsedArn.Resource, "db:") {
+		return "", errors.New(fmt.Sprintf("Resource: '%s' is not a DB instance!", instanceArn))
+	}
+
+	return strings.TrimPrefix(parsedArn.Resource, "db:"), nil
+}
+
+func (c *Controller) describeBlueGreenMember(memberArn *string) (*rdsTypes.DBInstance, error) {
+	instanceID, err := parseDBInstanceArn(a.ToString(memberArn))
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := c.DescribeDBInstance(&instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, errors.New(fmt.Sprintf("Failed to find DB instance: '%s'!", instanceID))
+	}
+
+	return &instances[0], nil
+}
+
+// Before the switchover the target is the green instance, which is only reachable by its own endpoint.
+func (c *Controller) DescribeBlueGreenTargetDBInstance(deployment *rdsTypes.BlueGreenDeployment) (*rdsTypes.DBInstance, error) {
+	return c.describeBlueGreenMember(deployment.Target)
+}
+
+func (c *Controller) CreateBlueGreenDeployment(instance *rdsTypes.DBInstance) (*rdsTypes.BlueGreenDeployment, error) {
+	deploymentName := buildBlueGreenDeploymentName(instance)
+	log.Infof("Creating a blue/green deployment: '%s'", deploymentName)
+
+	input := &rds.CreateBlueGreenDeploymentInput{
+		BlueGreenDeploymentName:    &deploymentName,
+		Source:                     instance.DBInstanceArn,
+		TargetEngineVersion:        &c.configuration.Items.Upgrade.EngineVersion,
+		TargetDBParameterGroupName: &c.configuration.Items.Upgrade.ParameterGroup,
+		Tags:                       instance.TagList,
+	}
+
+	output, err := c.rdsClient.CreateBlueGreenDeployment(*c.configuration.Context, input)
+	if err != nil {
+		return nil, err
+	}
+
+	waitTimeout, err := c.getTimeout(OPERATION_BLUE_GREEN_CREATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.waitForBlueGreenDeployment(
+		output.BlueGreenDeployment.BlueGreenDeploymentIdentifier,
+		BLUE_GREEN_STATUS_PROVISIONING,
+		BLUE_GREEN_STATUS_AVAILABLE,
+		waitTimeout,
+	)
+}
+
+// The lag is measured with a heartbeat record on the green instance, since the replication slot metrics of the blue one
+// also include the slots of other consumers.
+func (c *Controller) GetBlueGreenReplicationTimeout() (time.Duration, error) {
+	return c.getTimeout(OPERATION_BLUE_GREEN_REPLICATION)
+}
+
+// RDS rolls the switchover back once its timeout is reached, so the wait lasts until the rollback has been reported as well.
+func (c *Controller) getBlueGreenSwitchoverWaitTimeout() time.Duration {
+	switchoverTimeout := c.configuration.Items.Upgrade.BlueGreenSwitchoverTimeout
+	if switchoverTimeout <= 0 {
+		switchoverTimeout = time.Second * BLUE_GREEN_SWITCHOVER_DEFAULT_TIMEOUT
+	}
+
+	return switchoverTimeout + time.Second*BLUE_GREEN_SWITCHOVER_ROLLBACK_MARGIN
+}
+
+// The switchover is rolled back by RDS if it does not complete within the timeout, which fails the wait.
+func (c *Controller) SwitchoverBlueGreenDeployment(deployment *rdsTypes.BlueGreenDeployment) (*rdsTypes.BlueGreenDeployment, error) {
+	switchoverTimeout := c.configuration.Items.Upgrade.BlueGreenSwitchoverTimeout
+	log.Infof(
+		"Switching over blue/green deployment: '%s' with a timeout: '%s'",
+		*deployment.BlueGreenDeploymentName,
+		switchoverTimeout,
+	)
+
+	input := &rds.SwitchoverBlueGreenDeploymentInput{
+		BlueGreenDeploymentIdentifier: deployment.BlueGreenDeploymentIdentifier,
+	}
+	if switchoverTimeout > 0 {
+		input.SwitchoverTimeout = a.Int32(int32(switchoverTimeout.Seconds()))
+	}
+
+	_, err := c.rdsClient.SwitchoverBlueGreenDeployment(*c.configuration.Context, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.waitForBlueGreenDeployment(
+		deployment.BlueGreenDeploymentIdentifier,
+		BLUE_GREEN_STATUS_SWITCHOVER_PROGRESS,
+		BLUE_GREEN_STATUS_SWITCHOVER_COMPLETED,
+		c.getBlueGreenSwitchoverWaitTimeout(),
+	)
+}
+
+// Only the deployment itself is deleted. Once switched over, the green instance serves the production traffic.
+func (c *Controller) DeleteBlueGreenDeployment(deployment *rdsTypes.BlueGreenDeployment) error {
+	log.Infof("Deleting blue/green deployment: '%s'", *deployment.BlueGreenDeploymentName)
+
+	input := &rds.DeleteBlueGreenDeploymentInput{
+		BlueGreenDeploymentIdentifier: deployment.BlueGreenDeploymentIdentifier,
+		DeleteTarget:                  a.Bool(false),
+	}
+	_, err := c.rdsClient.DeleteBlueGreenDeployment(*c.configuration.Context, input)
+
+	return err
+}
+
+// After the switchover the source of the deployment is the old blue instance, renamed by RDS, e.g. 'test-db-old1'.
+// A final snapshot is taken, so the old instance can still be restored.
+func (c *Controller) DeleteBlueGreenSourceDBInstance(deployment *rdsTypes.BlueGreenDeployment) error {
+	instance, err := c.describeBlueGreenMember(deployment.Source)
+	if err != nil {
+		return err
+	}
+
+	finalSnapshotIdentifier := *instance.DBInstanceIdentifier + DB_INSTANCE_FINAL_SNAPSHOT_SUFFIX
+	log.Infof(
+		"Deleting the old instance: '%s' with a final snapshot: '%s'",
+		*instance.DBInstanceIdentifier,
+		finalSnapshotIdentifier,
+	)
+
+	input := &rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier:      instance.DBInstanceIdentifier,
+		FinalDBSnapshotIdentifier: &finalSnapshotIdentifier,
+	}
+	_, err = c.rdsClient.DeleteDBInstance(*c.configuration.Context, input)
+
+	return err
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBlueGreenSwitchoverWaitTimeout(t *testing.T) {
+	tests := []struct {
+		name              string
+		switchoverTimeout time.Duration
+		expectedTimeout   time.Duration
+	}{
+		{
+			name:              "configured timeout",
+			switchoverTimeout: time.Minute * 15,
+			expectedTimeout:   time.Minute * 20,
+		},
+		{
+			name:            "RDS default timeout",
+			expectedTimeout: time.Minute * 10,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			c := &Controller{
+				configuration: &types.Configuration{
+					Items: &types.Items{
+						Upgrade: &types.UpgradeDetails{BlueGreenSwitchoverTimeout: test.switchoverTimeout},
+					},
+				},
+			}
+
+			assert.Equal(t, test.expectedTimeout, c.getBlueGreenSwitchoverWaitTimeout())
+		}
+		t.Run(test.name, testFunction)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// RDSAPI lists all the RDS calls made by the controller, including the ones made by paginators and waiters.
+type RDSAPI interface {
+	rds.DescribeBlueGreenDeploymentsAPIClient
+	rds.DescribeDBClustersAPIClient
+	rds.DescribeDBClusterParametersAPIClient
+	rds.DescribeDBInstancesAPIClient
+	rds.DescribeDBSnapshotsAPIClient
+	rds.DescribeCertificatesAPIClient
+	rds.DescribeDBEngineVersionsAPIClient
+	rds.DescribeDBLogFilesAPIClient
+	rds.DescribeDBParametersAPIClient
+	rds.DescribeDBSubnetGroupsAPIClient
+	rds.DescribeEngineDefaultParametersAPIClient
+	rds.DescribeEventsAPIClient
+	rds.DescribeOrderableDBInstanceOptionsAPIClient
+	rds.DescribePendingMaintenanceActionsAPIClient
+	rds.DownloadDBLogFilePortionAPIClient
+
+	AddRoleToDBCluster(context.Context, *rds.AddRoleToDBClusterInput, ...func(*rds.Options)) (*rds.AddRoleToDBClusterOutput, error)
+	AddRoleToDBInstance(context.Context, *rds.AddRoleToDBInstanceInput, ...func(*rds.Options)) (*rds.AddRoleToDBInstanceOutput, error)
+	AddTagsToResource(context.Context, *rds.AddTagsToResourceInput, ...func(*rds.Options)) (*rds.AddTagsToResourceOutput, error)
+	ApplyPendingMaintenanceAction(context.Context, *rds.ApplyPendingMaintenanceActionInput, ...func(*rds.Options)) (*rds.ApplyPendingMaintenanceActionOutput, error)
+	CopyDBSnapshot(context.Context, *rds.CopyDBSnapshotInput, ...func(*rds.Options)) (*rds.CopyDBSnapshotOutput, error)
+	CreateBlueGreenDeployment(context.Context, *rds.CreateBlueGreenDeploymentInput, ...func(*rds.Options)) (*rds.CreateBlueGreenDeploymentOutput, error)
+	CreateDBClusterParameterGroup(context.Context, *rds.CreateDBClusterParameterGroupInput, ...func(*rds.Options)) (*rds.CreateDBClusterParameterGroupOutput, error)
+	CreateDBInstance(context.Context, *rds.CreateDBInstanceInput, ...func(*rds.Options)) (*rds.CreateDBInstanceOutput, error)
+	CreateDBInstanceReadReplica(context.Context, *rds.CreateDBInstanceReadReplicaInput, ...func(*rds.Options)) (*rds.CreateDBInstanceReadReplicaOutput, error)
+	CreateDBParameterGroup(context.Context, *rds.CreateDBParameterGroupInput, ...func(*rds.Options)) (*rds.CreateDBParameterGroupOutput, error)
+	CreateDBSnapshot(context.Context, *rds.CreateDBSnapshotInput, ...func(*rds.Options)) (*rds.CreateDBSnapshotOutput, error)
+	DeleteBlueGreenDeployment(context.Context, *rds.DeleteBlueGreenDeploymentInput, ...func(*rds.Options)) (*rds.DeleteBlueGreenDeploymentOutput, error)
+	DeleteDBInstance(context.Context, *rds.DeleteDBInstanceInput, ...func(*rds.Options)) (*rds.DeleteDBInstanceOutput, error)
+	DeleteDBSnapshot(context.Context, *rds.DeleteDBSnapshotInput, ...func(*rds.Options)) (*rds.DeleteDBSnapshotOutput, error)
+	DescribeDBClusterParameterGroups(context.Context, *rds.DescribeDBClusterParameterGroupsInput, ...func(*rds.Options)) (*rds.DescribeDBClusterParameterGroupsOutput, error)
+	DescribeDBParameterGroups(context.Context, *rds.DescribeDBParameterGroupsInput, ...func(*rds.Options)) (*rds.DescribeDBParameterGroupsOutput, error)
+	DescribeEngineDefaultClusterParameters(context.Context, *rds.DescribeEngineDefaultClusterParametersInput, ...func(*rds.Options)) (*rds.DescribeEngineDefaultClusterParametersOutput, error)
+	DescribeValidDBInstanceModifications(context.Context, *rds.DescribeValidDBInstanceModificationsInput, ...func(*rds.Options)) (*rds.DescribeValidDBInstanceModificationsOutput, error)
+	ModifyDBCluster(context.Context, *rds.ModifyDBClusterInput, ...func(*rds.Options)) (*rds.ModifyDBClusterOutput, error)
+	ModifyDBClusterParameterGroup(context.Context, *rds.ModifyDBClusterParameterGroupInput, ...func(*rds.Options)) (*rds.ModifyDBClusterParameterGroupOutput, error)
+	ModifyDBInstance(context.Context, *rds.ModifyDBInstanceInput, ...func(*rds.Options)) (*rds.ModifyDBInstanceOutput, error)
+	ModifyDBParameterGroup(context.Context, *rds.ModifyDBParameterGroupInput, ...func(*rds.Options)) (*rds.ModifyDBParameterGroupOutput, error)
+	ModifyDBSnapshot(context.Context, *rds.ModifyDBSnapshotInput, ...func(*rds.Options)) (*rds.ModifyDBSnapshotOutput, error)
+	ModifyDBSnapshotAttribute(context.Context, *rds.ModifyDBSnapshotAttributeInput, ...func(*rds.Options)) (*rds.ModifyDBSnapshotAttributeOutput, error)
+	RebootDBInstance(context.Context, *rds.RebootDBInstanceInput, ...func(*rds.Options)) (*rds.RebootDBInstanceOutput, error)
+	RemoveTagsFromResource(context.Context, *rds.RemoveTagsFromResourceInput, ...func(*rds.Options)) (*rds.RemoveTagsFromResourceOutput, error)
+	RestoreDBClusterFromSnapshot(context.Context, *rds.RestoreDBClusterFromSnapshotInput, ...func(*rds.Options)) (*rds.RestoreDBClusterFromSnapshotOutput, error)
+	RestoreDBInstanceFromDBSnapshot(context.Context, *rds.RestoreDBInstanceFromDBSnapshotInput, ...func(*rds.Options)) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error)
+	StopDBInstance(context.Context, *rds.StopDBInstanceInput, ...func(*rds.Options)) (*rds.StopDBInstanceOutput, error)
+	SwitchoverBlueGreenDeployment(context.Context, *rds.SwitchoverBlueGreenDeploymentInput, ...func(*rds.Options)) (*rds.SwitchoverBlueGreenDeploymentOutput, error)
+}
+
+type CloudWatchAPI interface {
+	cloudwatch.DescribeAlarmsAPIClient
+	cloudwatch.GetMetricDataAPIClient
+
+	DisableAlarmActions(context.Context, *cloudwatch.DisableAlarmActionsInput, ...func(*cloudwatch.Options)) (*cloudwatch.DisableAlarmActionsOutput, error)
+	PutMetricAlarm(context.Context, *cloudwatch.PutMetricAlarmInput, ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricAlarmOutput, error)
+	PutMetricData(context.Context, *cloudwatch.PutMetricDataInput, ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+type EC2API interface {
+	ec2.DescribeInstanceTypesAPIClient
+	ec2.DescribeNetworkAclsAPIClient
+	ec2.DescribeSecurityGroupsAPIClient
+	ec2.DescribeSubnetsAPIClient
+	ec2.DescribeVpcsAPIClient
+}
+
+type KMSAPI interface {
+	kms.ListAliasesAPIClient
+	kms.ListKeysAPIClient
+
+	DescribeKey(context.Context, *kms.DescribeKeyInput, ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+}
+
+type Route53API interface {
+	route53.GetChangeAPIClient
+
+	ChangeResourceRecordSets(context.Context, *route53.ChangeResourceRecordSetsInput, ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
+	ListResourceRecordSets(context.Context, *route53.ListResourceRecordSetsInput, ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error)
+}
+
+type SecretsManagerAPI interface {
+	GetSecretValue(context.Context, *secretsmanager.GetSecretValueInput, ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+type Clients struct {
+	RDS        RDSAPI
+	CloudWatch CloudWatchAPI
+	EC2        EC2API
+	KMS        KMSAPI
+	Route53    Route53API
+	// Reads the master user passwords RDS manages in Secrets Manager.
+	SecretsManager SecretsManagerAPI
+	// Clients for the destination region. The main ones are used if not set.
+	TargetRDS            RDSAPI
+	TargetEC2            EC2API
+	TargetKMS            KMSAPI
+	TargetSecretsManager SecretsManagerAPI
+	// RDS clients for other regions keyed by the region name, e.g. 'eu-west-1'.
+	RegionalRDS map[string]RDSAPI
+	// Overrides the delay between waiter attempts. SDK defaults are used if zero.
+	WaiterDelay time.Duration
+}
+
+func (c *Controller) newDBInstanceAvailableWaiter() *rds.DBInstanceAvailableWaiter {
+	return c.newDBInstanceAvailableWaiterForClient(c.rdsClient)
+}
+
+func (c *Controller) newDBInstanceAvailableWaiterForClient(client RDSAPI) *rds.DBInstanceAvailableWaiter {
+	return rds.NewDBInstanceAvailableWaiter(client, func(options *rds.DBInstanceAvailableWaiterOptions) {
+		if c.waiterDelay > 0 {
+			options.MinDelay = c.waiterDelay
+			options.MaxDelay = c.waiterDelay
+		}
+	})
+}
+
+func (c *Controller) newDBClusterAvailableWaiterForClient(client RDSAPI) *rds.DBClusterAvailableWaiter {
+	return rds.NewDBClusterAvailableWaiter(client, func(options *rds.DBClusterAvailableWaiterOptions) {
+		if c.waiterDelay > 0 {
+			options.MinDelay = c.waiterDelay
+			options.MaxDelay = c.waiterDelay
+		}
+	})
+}
+
+func (c *Controller) newDBSnapshotAvailableWaiter() *rds.DBSnapshotAvailableWaiter {
+	return c.newDBSnapshotAvailableWaiterForClient(c.rdsClient)
+}
+
+func (c *Controller) newDBSnapshotAvailableWaiterForClient(client RDSAPI) *rds.DBSnapshotAvailableWaiter {
+	return rds.NewDBSnapshotAvailableWaiter(client, func(options *rds.DBSnapshotAvailableWaiterOptions) {
+		if c.waiterDelay > 0 {
+			options.MinDelay = c.waiterDelay
+			options.MaxDelay = c.waiterDelay
+		}
+	})
+}
+
+func (c *Controller) newResourceRecordSetsChangedWaiter() *route53.ResourceRecordSetsChangedWaiter {
+	return route53.NewResourceRecordSetsChangedWaiter(c.route53Client, func(options *route53.ResourceRecordSetsChangedWaiterOptions) {
+		if c.waiterDelay > 0 {
+			options.MinDelay = c.waiterDelay
+			options.MaxDelay = c.waiterDelay
+		}
+	})
+}
@@ -12,6 +12,7 @@ package aws
 
 import (
 	"db_relocate/log"
+	"fmt"
 	"time"
 
 	a "github.com/aws/aws-sdk-go-v2/aws"
@@ -21,8 +22,9 @@ import (
 )
 
 const (
-	CW_METRIC_PERIOD         int32   = 600
-	DISK_SPACE_LOW_WATERMARK float64 = 10 // GB
+	CW_METRIC_PERIOD          int32   = 600
+	DISK_SPACE_LOW_WATERMARK  float64 = 10 // GB
+	FREE_STORAGE_SPACE_METRIC string  = "FreeStorageSpace"
 )
 
 func calculateAverage(items []float64) (float64, error) {
@@ -43,7 +45,7 @@ func buildDimensionsForDBInstance(instance *rdsTypes.DBInstance) []cwTypes.Dimen
 	}
 }
 
-func buildMetricDataQueryForDBInstance(instance *rdsTypes.DBInstance) []cwTypes.MetricDataQuery {
+func buildMetricDataQueryForDBInstance(instance *rdsTypes.DBInstance, metricName string) []cwTypes.MetricDataQuery {
 	dimensions := buildDimensionsForDBInstance(instance)
 
 	return []cwTypes.MetricDataQuery{
@@ -51,7 +53,7 @@ func buildMetricDataQueryForDBInstance(instance *rdsTypes.DBInstance) []cwTypes.
 			Id: a.String("upgrade"),
 			MetricStat: &cwTypes.MetricStat{
 				Metric: &cwTypes.Metric{
-					MetricName: a.String("FreeStorageSpace"),
+					MetricName: a.String(metricName),
 					Namespace:  a.String("AWS/RDS"),
 					Dimensions: dimensions,
 				},
@@ -63,11 +65,11 @@ func buildMetricDataQueryForDBInstance(instance *rdsTypes.DBInstance) []cwTypes.
 	}
 }
 
-func (c *Controller) getAvailableDiskSpaceForDBInstance(instance *rdsTypes.DBInstance, now *time.Time) (float64, error) {
+func (c *Controller) getMetricAverageForDBInstance(instance *rdsTypes.DBInstance, metricName string, now *time.Time) (float64, error) {
 	end := now.Round(5 * time.Minute)
 	start := end.Add(-time.Duration(CW_METRIC_PERIOD) * time.Second)
 
-	metricDataQuery := buildMetricDataQueryForDBInstance(instance)
+	metricDataQuery := buildMetricDataQueryForDBInstance(instance, metricName)
 
 	input := &cloudwatch.GetMetricDataInput{
 		EndTime:           &end,
@@ -98,6 +100,72 @@ func (c *Controller) getAvailableDiskSpaceForDBInstance(instance *rdsTypes.DBIns
 	return value, nil
 }
 
+// Statistics of a single metric of a DB instance over time, as returned by CloudWatch.
+type metricSeries struct {
+	timestamps []time.Time
+	values     []float64
+}
+
+type metricStatistic struct {
+	metricName string
+	stat       string
+}
+
+// Fetches the full history of every metric in a single paginated call, keyed by the metric name.
+func (c *Controller) getMetricSeriesForDBInstance(instance *rdsTypes.DBInstance, metricStatistics []metricStatistic, start *time.Time, end *time.Time, period int32) (map[string]*metricSeries, error) {
+	metricDataQueries := []cwTypes.MetricDataQuery{}
+	metricNames := make(map[string]string)
+	for idx := range metricStatistics {
+		id := fmt.Sprintf("m%d", idx)
+		metricNames[id] = metricStatistics[idx].metricName
+
+		metricDataQueries = append(metricDataQueries, cwTypes.MetricDataQuery{
+			Id: a.String(id),
+			MetricStat: &cwTypes.MetricStat{
+				Metric: &cwTypes.Metric{
+					MetricName: a.String(metricStatistics[idx].metricName),
+					Namespace:  a.String(RDS_METRIC_NAMESPACE),
+					Dimensions: buildDimensionsForDBInstance(instance),
+				},
+				Stat:   a.String(metricStatistics[idx].stat),
+				Period: a.Int32(period),
+			},
+			ReturnData: a.Bool(true),
+		})
+	}
+
+	input := &cloudwatch.GetMetricDataInput{
+		StartTime:         start,
+		EndTime:           end,
+		MetricDataQueries: metricDataQueries,
+		ScanBy:            cwTypes.ScanByTimestampAscending,
+	}
+
+	series := make(map[string]*metricSeries)
+	paginator := cloudwatch.NewGetMetricDataPaginator(c.cwClient, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range output.MetricDataResults {
+			metricName := metricNames[a.ToString(result.Id)]
+			if _, ok := series[metricName]; !ok {
+				series[metricName] = &metricSeries{}
+			}
+			series[metricName].timestamps = append(series[metricName].timestamps, result.Timestamps...)
+			series[metricName].values = append(series[metricName].values, result.Values...)
+		}
+	}
+
+	return series, nil
+}
+
+func (c *Controller) getAvailableDiskSpaceForDBInstance(instance *rdsTypes.DBInstance, now *time.Time) (float64, error) {
+	return c.getMetricAverageForDBInstance(instance, FREE_STORAGE_SPACE_METRIC, now)
+}
+
 func (c *Controller) IsEnoughOfAvailableDiskSpaceForDBInstance(instance *rdsTypes.DBInstance, now *time.Time) (bool, error) {
 	availableDiskSpace, err := c.getAvailableDiskSpaceForDBInstance(instance, now)
 	if err != nil {
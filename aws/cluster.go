@@ -0,0 +1,302 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"errors"
+	"fmt"
+)
+
+const (
+	TARGET_ENGINE_POSTGRES             string = "postgres"
+	TARGET_ENGINE_AURORA_POSTGRESQL    string = "aurora-postgresql"
+	DB_CLUSTER_IDENTIFIER_SUFFIX       string = "-cluster"
+	DB_CLUSTER_INSTANCE_CREATE_TIMEOUT string = "1440m"
+)
+
+func (c *Controller) GetTargetEngine() string {
+	if c.configuration.Items.Upgrade.TargetEngine == "" {
+		return TARGET_ENGINE_POSTGRES
+	}
+
+	return c.configuration.Items.Upgrade.TargetEngine
+}
+
+func (c *Controller) IsAuroraTarget() bool {
+	return c.GetTargetEngine() == TARGET_ENGINE_AURORA_POSTGRESQL
+}
+
+func (c *Controller) IsValidTargetEngine() bool {
+	switch c.GetTargetEngine() {
+	case TARGET_ENGINE_POSTGRES, TARGET_ENGINE_AURORA_POSTGRESQL:
+		return true
+	}
+
+	log.Errorf(
+		"Provided target engine: '%s' is invalid. Available target engines: %v",
+		c.GetTargetEngine(),
+		[]string{TARGET_ENGINE_POSTGRES, TARGET_ENGINE_AURORA_POSTGRESQL},
+	)
+
+	return false
+}
+
+// The writer instance keeps the configured destination identifier, so the cluster is named after it.
+func buildDBClusterIdentifier(instanceIdentifier string) string {
+	return instanceIdentifier + DB_CLUSTER_IDENTIFIER_SUFFIX
+}
+
+func (c *Controller) describeDBCluster(client RDSAPI, clusterID *string) ([]rdsTypes.DBCluster, error) {
+	input := &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: clusterID,
+	}
+
+	output, err := client.DescribeDBClusters(*c.configuration.Context, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.DBClusters, nil
+}
+
+func (c *Controller) getDBClusterOfInstance(instance *rdsTypes.DBInstance) (*rdsTypes.DBCluster, error) {
+	clusters, err := c.describeDBCluster(c.getRDSClientForInstance(instance), instance.DBClusterIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clusters) == 0 {
+		return nil, errors.New(fmt.Sprintf("Failed to find DB cluster: '%s'!", *instance.DBClusterIdentifier))
+	}
+
+	return &clusters[0], nil
+}
+
+func (c *Controller) waitForDBCluster(clusterID *string, operation string) error {
+	waitParams := &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: clusterID,
+	}
+	waiter := c.newDBClusterAvailableWaiterForClient(c.dstRDSClient)
+
+	duration, err := c.getTimeout(operation)
+	if err != nil {
+		return err
+	}
+
+	stopProgressReport := c.startProgressReport(c.dstRDSClient, rdsTypes.SourceTypeDbCluster, clusterID)
+	err = waiter.Wait(*c.configuration.Context, waitParams, duration)
+	stopProgressReport()
+
+	return err
+}
+
+// A cluster can only be restored from a DB instance snapshot by its ARN.
+// The restored cluster has no instances, so the writer is created right after it.
+func (c *Controller) restoreDBCluster(snapshot *rdsTypes.DBSnapshot, instance *rdsTypes.DBInstance) (*rdsTypes.DBInstance, *targetDBConfiguration, error) {
+	log.Infoln("Restoring a snapshot to an Aurora cluster!")
+	configuration, err := c.sanitizeTargetDBInstanceConfiguration(instance, snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clusterInput := &rds.RestoreDBClusterFromSnapshotInput{
+		DBClusterIdentifier:             configuration.clusterIdentifier,
+		Engine:                          a.String(TARGET_ENGINE_AURORA_POSTGRESQL),
+		EngineVersion:                   &c.configuration.Items.Upgrade.EngineVersion,
+		SnapshotIdentifier:              snapshot.DBSnapshotArn,
+		CopyTagsToSnapshot:              &instance.CopyTagsToSnapshot,
+		DBClusterParameterGroupName:     configuration.clusterParameterGroupName,
+		DBSubnetGroupName:               configuration.subnetGroupName,
+		DeletionProtection:              &instance.DeletionProtection,
+		EnableCloudwatchLogsExports:     configuration.cloudwatchLogsExports,
+		EnableIAMDatabaseAuthentication: &instance.IAMDatabaseAuthenticationEnabled,
+		Port:                            configuration.port,
+		Tags:                            withoutRunTags(snapshot.TagList),
+		VpcSecurityGroupIds:             configuration.vpcSecurityGroupIDs,
+	}
+	_, err = c.dstRDSClient.RestoreDBClusterFromSnapshot(*c.configuration.Context, clusterInput)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Infoln("Waiting for a cluster to become available.")
+	err = c.waitForDBCluster(configuration.clusterIdentifier, OPERATION_SNAPSHOT_RESTORE)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Infof("Creating a writer instance: '%s'", *configuration.instanceIdentifier)
+	instanceInput := &rds.CreateDBInstanceInput{
+		DBInstanceIdentifier:               configuration.instanceIdentifier,
+		DBClusterIdentifier:                configuration.clusterIdentifier,
+		DBInstanceClass:                    configuration.instanceClass,
+		Engine:                             a.String(TARGET_ENGINE_AURORA_POSTGRESQL),
+		AutoMinorVersionUpgrade:            &instance.AutoMinorVersionUpgrade,
+		DBParameterGroupName:               configuration.parameterGroupName,
+		PubliclyAccessible:                 configuration.publiclyAccessible,
+		MonitoringInterval:                 configuration.monitoringInterval,
+		MonitoringRoleArn:                  configuration.monitoringRoleArn,
+		EnablePerformanceInsights:          configuration.performanceInsightsEnabled,
+		PerformanceInsightsKMSKeyId:        configuration.performanceInsightsKMSKeyID,
+		PerformanceInsightsRetentionPeriod: configuration.performanceInsightsRetentionPeriod,
+		Tags:                               withoutRunTags(snapshot.TagList),
+	}
+	_, err = c.dstRDSClient.CreateDBInstance(*c.configuration.Context, instanceInput)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Infoln("Waiting for an instance to become available.")
+	waitParams := &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: configuration.instanceIdentifier,
+	}
+	waiter := c.newDBInstanceAvailableWaiterForClient(c.dstRDSClient)
+
+	duration, err := c.getTimeout(OPERATION_DB_CLUSTER_INSTANCE)
+	if err != nil {
+		return nil, nil, err
+	}
+	stopProgressReport := c.startProgressReport(c.dstRDSClient, rdsTypes.SourceTypeDbInstance, configuration.instanceIdentifier)
+	output, err := waiter.WaitForOutput(*c.configuration.Context, waitParams, duration)
+	stopProgressReport()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &output.DBInstances[0], configuration, nil
+}
+
+// Backup settings and IAM roles belong to the cluster. Everything else has been set on the writer instance already.
+func (c *Controller) applyTargetDBClusterAttributes(instance *rdsTypes.DBInstance, configuration *targetDBConfiguration) error {
+	log.Infof("Applying the remaining attributes to a cluster: '%s'", *instance.DBClusterIdentifier)
+	clusterInput := &rds.ModifyDBClusterInput{
+		DBClusterIdentifier:        instance.DBClusterIdentifier,
+		ApplyImmediately:           true,
+		BackupRetentionPeriod:      configuration.backupRetentionPeriod,
+		PreferredBackupWindow:      configuration.backupWindow,
+		PreferredMaintenanceWindow: configuration.maintenanceWindow,
+		ManageMasterUserPassword:   configuration.manageMasterUserPassword,
+		MasterUserSecretKmsKeyId:   configuration.masterUserSecretKMSKeyID,
+	}
+	_, err := c.dstRDSClient.ModifyDBCluster(*c.configuration.Context, clusterInput)
+	if err != nil {
+		return err
+	}
+
+	log.Infoln("Waiting for a cluster to become available.")
+	err = c.waitForDBCluster(instance.DBClusterIdentifier, OPERATION_DB_INSTANCE_MODIFY)
+	if err != nil {
+		return err
+	}
+
+	for idx := range configuration.iamRoles {
+		log.Infof(
+			"Associating IAM role: '%s' for feature: '%s'",
+			*configuration.iamRoles[idx].RoleArn,
+			*configuration.iamRoles[idx].FeatureName,
+		)
+		roleInput := &rds.AddRoleToDBClusterInput{
+			DBClusterIdentifier: instance.DBClusterIdentifier,
+			FeatureName:         configuration.iamRoles[idx].FeatureName,
+			RoleArn:             configuration.iamRoles[idx].RoleArn,
+		}
+		_, err = c.dstRDSClient.AddRoleToDBCluster(*c.configuration.Context, roleInput)
+		if err != nil {
+			var apiError *rdsTypes.DBClusterRoleAlreadyExistsFault
+			if !errors.As(err, &apiError) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Cluster level attributes are copied over the instance ones, so both targets are compared the same way.
+func mergeDBClusterAttributes(instance *rdsTypes.DBInstance, cluster *rdsTypes.DBCluster) {
+	if instance.Endpoint != nil && cluster.Port != nil {
+		instance.Endpoint.Port = *cluster.Port
+	}
+	instance.EnabledCloudwatchLogsExports = cluster.EnabledCloudwatchLogsExports
+	instance.BackupRetentionPeriod = a.ToInt32(cluster.BackupRetentionPeriod)
+	instance.PreferredBackupWindow = cluster.PreferredBackupWindow
+	instance.PreferredMaintenanceWindow = cluster.PreferredMaintenanceWindow
+	instance.MasterUserSecret = cluster.MasterUserSecret
+
+	instance.AssociatedRoles = []rdsTypes.DBInstanceRole{}
+	for idx := range cluster.AssociatedRoles {
+		instance.AssociatedRoles = append(instance.AssociatedRoles, rdsTypes.DBInstanceRole{
+			FeatureName: cluster.AssociatedRoles[idx].FeatureName,
+			RoleArn:     cluster.AssociatedRoles[idx].RoleArn,
+			Status:      cluster.AssociatedRoles[idx].Status,
+		})
+	}
+}
+
+// Connections go through the cluster endpoint, so they follow the writer after a failover.
+func (c *Controller) setDBClusterEndpoint(instance *rdsTypes.DBInstance) error {
+	if instance.DBClusterIdentifier == nil {
+		return nil
+	}
+
+	cluster, err := c.getDBClusterOfInstance(instance)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Using the writer endpoint: '%s' of cluster: '%s'", a.ToString(cluster.Endpoint), *cluster.DBClusterIdentifier)
+	instance.Endpoint = &rdsTypes.Endpoint{
+		Address:      cluster.Endpoint,
+		HostedZoneId: cluster.HostedZoneId,
+		Port:         a.ToInt32(cluster.Port),
+	}
+
+	return nil
+}
+
+// Read replicas of the source become reader instances of the cluster.
+func (c *Controller) buildDBClusterReaderInput(readReplica *ReadReplica, dstInstance *rdsTypes.DBInstance) *rds.CreateDBInstanceInput {
+	replica := readReplica.Instance
+
+	input := &rds.CreateDBInstanceInput{
+		DBInstanceIdentifier:    a.String(c.buildReadReplicaIdentifier(replica)),
+		DBClusterIdentifier:     dstInstance.DBClusterIdentifier,
+		DBInstanceClass:         replica.DBInstanceClass,
+		Engine:                  a.String(TARGET_ENGINE_AURORA_POSTGRESQL),
+		AutoMinorVersionUpgrade: &replica.AutoMinorVersionUpgrade,
+		MonitoringInterval:      replica.MonitoringInterval,
+		MonitoringRoleArn:       replica.MonitoringRoleArn,
+		PubliclyAccessible:      &replica.PubliclyAccessible,
+		Tags:                    replica.TagList,
+	}
+
+	if len(dstInstance.DBParameterGroups) > 0 {
+		input.DBParameterGroupName = dstInstance.DBParameterGroups[0].DBParameterGroupName
+	}
+
+	// Zones of the source region do not exist in the target one and zone names differ between accounts.
+	if !replica.MultiAZ && !c.isMovedReadReplica(readReplica) {
+		input.AvailabilityZone = replica.AvailabilityZone
+	}
+
+	if a.ToBool(replica.PerformanceInsightsEnabled) {
+		input.EnablePerformanceInsights = replica.PerformanceInsightsEnabled
+		input.PerformanceInsightsRetentionPeriod = replica.PerformanceInsightsRetentionPeriod
+	}
+
+	return input
+}
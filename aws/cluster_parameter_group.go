@@ -0,0 +1,256 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"errors"
+	"fmt"
+)
+
+func (c *Controller) getCurrentDBClusterParameters(client RDSAPI, parameterGroupName *string) (map[string]*rdsTypes.Parameter, error) {
+	parameters := make(map[string]*rdsTypes.Parameter)
+
+	input := &rds.DescribeDBClusterParametersInput{
+		DBClusterParameterGroupName: parameterGroupName,
+		MaxRecords:                  a.Int32(100),
+	}
+
+	paginator := rds.NewDescribeDBClusterParametersPaginator(client, input)
+	for paginator.HasMorePages() {
+		parameterGroup, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+		addModifiableDBParameters(parameters, parameterGroup.Parameters)
+	}
+
+	return parameters, nil
+}
+
+func (c *Controller) getDBClusterParameterGroup(parameterGroupName *string) ([]rdsTypes.DBClusterParameterGroup, error) {
+	input := &rds.DescribeDBClusterParameterGroupsInput{
+		DBClusterParameterGroupName: parameterGroupName,
+	}
+
+	output, err := c.dstRDSClient.DescribeDBClusterParameterGroups(*c.configuration.Context, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.DBClusterParameterGroups, nil
+}
+
+func (c *Controller) IsValidDBClusterParameterGroup(parameterGroupName *string, engineVersion *string) (bool, error) {
+	parameterGroups, err := c.getDBClusterParameterGroup(parameterGroupName)
+	if err != nil {
+		var apiError *rdsTypes.DBParameterGroupNotFoundFault
+		if !errors.As(err, &apiError) {
+			return false, err
+		}
+	}
+
+	if len(parameterGroups) == 0 {
+		log.Errorf("Failed to find a cluster parameter group with a name: %s", *parameterGroupName)
+		return false, nil
+	}
+
+	groupFamily := c.engineVersionToGroupFamily(engineVersion)
+	if *groupFamily != *parameterGroups[0].DBParameterGroupFamily {
+		log.Errorf(
+			"Found specified cluster parameter group: '%s', "+
+				"but it belongs to an incorrect group family '%s', "+
+				"while it should belong to: '%s'!",
+			*parameterGroupName,
+			*parameterGroups[0].DBParameterGroupFamily,
+			*groupFamily,
+		)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// No paginator is available for the engine default cluster parameters.
+func (c *Controller) getEngineDefaultDBClusterParameters(groupFamily *string) (map[string]rdsTypes.Parameter, error) {
+	parameters := make(map[string]rdsTypes.Parameter)
+
+	input := &rds.DescribeEngineDefaultClusterParametersInput{
+		DBParameterGroupFamily: groupFamily,
+		MaxRecords:             a.Int32(100),
+	}
+
+	for {
+		output, err := c.dstRDSClient.DescribeEngineDefaultClusterParameters(*c.configuration.Context, input)
+		if err != nil {
+			return nil, err
+		}
+		if output.EngineDefaults == nil {
+			break
+		}
+
+		for idx := range output.EngineDefaults.Parameters {
+			parameters[*output.EngineDefaults.Parameters[idx].ParameterName] = output.EngineDefaults.Parameters[idx]
+		}
+
+		if a.ToString(output.EngineDefaults.Marker) == "" {
+			break
+		}
+		input.Marker = output.EngineDefaults.Marker
+	}
+
+	return parameters, nil
+}
+
+func (c *Controller) ensureDBClusterParameterGroup(parameterGroupName *string, groupFamily *string, srcParameterGroupName *string) error {
+	parameterGroups, err := c.getDBClusterParameterGroup(parameterGroupName)
+	if err != nil {
+		var apiError *rdsTypes.DBParameterGroupNotFoundFault
+		if !errors.As(err, &apiError) {
+			return err
+		}
+	}
+
+	if len(parameterGroups) > 0 {
+		if *parameterGroups[0].DBParameterGroupFamily != *groupFamily {
+			return errors.New(fmt.Sprintf(
+				"Cluster parameter group: '%s' already exists, but belongs to an incorrect group family: '%s'!",
+				*parameterGroupName,
+				*parameterGroups[0].DBParameterGroupFamily,
+			))
+		}
+
+		log.Infof("Cluster parameter group: '%s' already exists. Updating its parameters.", *parameterGroupName)
+		return nil
+	}
+
+	log.Infof("Creating cluster parameter group: '%s' in family: '%s'", *parameterGroupName, *groupFamily)
+
+	input := &rds.CreateDBClusterParameterGroupInput{
+		DBClusterParameterGroupName: parameterGroupName,
+		DBParameterGroupFamily:      groupFamily,
+		Description:                 a.String(fmt.Sprintf("Generated from '%s' by db_relocate", *srcParameterGroupName)),
+	}
+	_, err = c.dstRDSClient.CreateDBClusterParameterGroup(*c.configuration.Context, input)
+
+	return err
+}
+
+// ModifyDBClusterParameterGroup accepts a limited number of parameters per call.
+func (c *Controller) modifyDBClusterParameterGroup(client RDSAPI, parameterGroupName *string, parameters []rdsTypes.Parameter) error {
+	for start := 0; start < len(parameters); start += MODIFY_DB_PARAMETERS_BATCH_SIZE {
+		end := start + MODIFY_DB_PARAMETERS_BATCH_SIZE
+		if end > len(parameters) {
+			end = len(parameters)
+		}
+
+		input := &rds.ModifyDBClusterParameterGroupInput{
+			DBClusterParameterGroupName: parameterGroupName,
+			Parameters:                  parameters[start:end],
+		}
+		_, err := client.ModifyDBClusterParameterGroup(*c.configuration.Context, input)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Creates a cluster parameter group with all the custom parameters of the source instance, which exist on the cluster level.
+// The generated name is stored in the configuration, so the restored cluster picks it up.
+func (c *Controller) GenerateTargetDBClusterParameterGroup(instance *rdsTypes.DBInstance) error {
+	srcParameterGroupName := instance.DBParameterGroups[0].DBParameterGroupName
+	groupFamily := c.engineVersionToGroupFamily(&c.configuration.Items.Upgrade.EngineVersion)
+	parameterGroupName := buildDBClusterIdentifier(c.buildTargetDBParameterGroupName(instance, groupFamily))
+
+	srcParameters, err := c.getUserDBParameters(srcParameterGroupName)
+	if err != nil {
+		return err
+	}
+
+	targetDefaults, err := c.getEngineDefaultDBClusterParameters(groupFamily)
+	if err != nil {
+		return err
+	}
+
+	targetParameters := c.buildTargetDBParameters(srcParameters, targetDefaults)
+
+	err = c.ensureDBClusterParameterGroup(&parameterGroupName, groupFamily, srcParameterGroupName)
+	if err != nil {
+		return err
+	}
+
+	err = c.modifyDBClusterParameterGroup(c.dstRDSClient, &parameterGroupName, targetParameters)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"Cluster parameter group: '%s' has been generated with %d parameters from: '%s'",
+		parameterGroupName,
+		len(targetParameters),
+		*srcParameterGroupName,
+	)
+	c.configuration.Items.Upgrade.ClusterParameterGroup = parameterGroupName
+
+	return nil
+}
+
+// Cluster parameters are applied to every instance of the cluster, but only the writer has to be rebooted,
+// since readers are created afterwards.
+func (c *Controller) ensureDBClusterParameters(instance *rdsTypes.DBInstance, desiredParameters map[string]*rdsTypes.Parameter) error {
+	rebootRequired := c.isRebootRequired(instance)
+
+	cluster, err := c.getDBClusterOfInstance(instance)
+	if err != nil {
+		return err
+	}
+
+	client := c.getRDSClientForInstance(instance)
+	existingParameters, err := c.getCurrentDBClusterParameters(client, cluster.DBClusterParameterGroup)
+	if err != nil {
+		return err
+	}
+
+	parametersNeeded := c.diffDBParameters(existingParameters, desiredParameters)
+	if len(parametersNeeded) > 0 {
+		log.Debugln("Applying DB cluster parameters!")
+		parameters := []rdsTypes.Parameter{}
+		for _, value := range parametersNeeded {
+			parameters = append(parameters, rdsTypes.Parameter{
+				ParameterName:  value.ParameterName,
+				ParameterValue: value.ParameterValue,
+				ApplyMethod:    value.ApplyMethod,
+			})
+		}
+
+		err = c.modifyDBClusterParameterGroup(client, cluster.DBClusterParameterGroup, parameters)
+		if err != nil {
+			return err
+		}
+		rebootRequired = true
+	}
+
+	if rebootRequired {
+		err = c.rebootDBInstance(instance)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -12,36 +12,60 @@ package aws
 
 import (
 	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	c "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 
 	"db_relocate/log"
 	"db_relocate/types"
 
 	"context"
+	"errors"
+	"fmt"
 
 	"os"
+	"time"
 )
 
 type Controller struct {
 	session       *a.Config
-	rdsClient     *rds.Client
-	cwClient      *cloudwatch.Client
-	ec2Client     *ec2.Client
-	kmsClient     *kms.Client
+	rdsClient     RDSAPI
+	cwClient      CloudWatchAPI
+	ec2Client     EC2API
+	kmsClient     KMSAPI
+	route53Client Route53API
+	smClient      SecretsManagerAPI
+	// Clients for the region and the account the destination instance is created in.
+	// Same as the main ones, unless relocating to another region or account.
+	dstRDSClient RDSAPI
+	dstEC2Client EC2API
+	dstKMSClient KMSAPI
+	dstSMClient  SecretsManagerAPI
+	dstSession   *a.Config
+	waiterDelay  time.Duration
+	// RDS clients for the regions other than the configured one, e.g. for cross-region read replicas.
+	regionalRDSClients map[string]RDSAPI
+	// Value of the CNAME record before the switchover, used to roll it back.
+	previousDNSRecordValue *string
+	// Identifies the resources created by this run, e.g. the snapshots.
+	runID         string
 	errorChannel  chan error
 	configuration *types.Configuration
 }
 
-func initSession(profile *string, region *string, context *context.Context) (*a.Config, error) {
+func initSession(profile *string, region *string, retryDetails *types.RetryDetails, context *context.Context) (*a.Config, error) {
 	if *profile != "" {
 		log.Infof("Using AWS profile with name: '%s'", *profile)
 		os.Setenv("AWS_PROFILE", *profile)
-		config, err := c.LoadDefaultConfig(*context, c.WithRegion(*region))
+		config, err := c.LoadDefaultConfig(*context, c.WithRegion(*region), c.WithRetryer(newRetryer(retryDetails)))
 		if err != nil {
 			return nil, err
 		}
@@ -49,7 +73,7 @@ func initSession(profile *string, region *string, context *context.Context) (*a.
 		return &config, nil
 	} else {
 		log.Infof("Using AWS EC2 instance profile")
-		config, err := c.LoadDefaultConfig(*context, c.WithRegion(*region), c.WithCredentialsProvider(ec2rolecreds.New()))
+		config, err := c.LoadDefaultConfig(*context, c.WithRegion(*region), c.WithCredentialsProvider(ec2rolecreds.New()), c.WithRetryer(newRetryer(retryDetails)))
 		if err != nil {
 			return nil, err
 		}
@@ -62,6 +86,7 @@ func NewController(configuration *types.Configuration, errorChannel chan error)
 	session, err := initSession(
 		&configuration.AWSProfile,
 		&configuration.AWSRegion,
+		configuration.AWSRetry,
 		configuration.Context,
 	)
 	if err != nil {
@@ -69,23 +94,150 @@ func NewController(configuration *types.Configuration, errorChannel chan error)
 	}
 
 	controller := Controller{
-		session:       session,
-		errorChannel:  errorChannel,
-		configuration: configuration,
+		session:            session,
+		regionalRDSClients: make(map[string]RDSAPI),
+		runID:              newRunID(),
+		errorChannel:       errorChannel,
+		configuration:      configuration,
 	}
 	controller.initRDSClient()
 	controller.initCWClient()
 	controller.initEC2Client()
 	controller.initKMSClient()
+	controller.initRoute53Client()
+	controller.initSMClient()
+	controller.initDstClients()
 
 	return &controller, nil
 }
 
+// Allows to run the controller against any implementation of the AWS APIs, e.g. an in-memory fake.
+func NewControllerWithClients(configuration *types.Configuration, clients *Clients, errorChannel chan error) *Controller {
+	controller := &Controller{
+		rdsClient:     clients.RDS,
+		cwClient:      clients.CloudWatch,
+		ec2Client:     clients.EC2,
+		kmsClient:     clients.KMS,
+		route53Client: clients.Route53,
+		smClient:      clients.SecretsManager,
+		dstRDSClient:  clients.TargetRDS,
+		dstEC2Client:  clients.TargetEC2,
+		dstKMSClient:  clients.TargetKMS,
+		dstSMClient:   clients.TargetSecretsManager,
+		waiterDelay:   clients.WaiterDelay,
+		runID:         newRunID(),
+		errorChannel:  errorChannel,
+		configuration: configuration,
+	}
+
+	if controller.dstRDSClient == nil {
+		controller.dstRDSClient = controller.rdsClient
+	}
+	if controller.dstEC2Client == nil {
+		controller.dstEC2Client = controller.ec2Client
+	}
+	if controller.dstKMSClient == nil {
+		controller.dstKMSClient = controller.kmsClient
+	}
+	if controller.dstSMClient == nil {
+		controller.dstSMClient = controller.smClient
+	}
+
+	controller.regionalRDSClients = make(map[string]RDSAPI)
+	for region, client := range clients.RegionalRDS {
+		controller.regionalRDSClients[region] = client
+	}
+
+	return controller
+}
+
 func (c *Controller) initRDSClient() {
 	client := rds.NewFromConfig(*c.session)
 	c.rdsClient = client
 }
 
+// Clients for other regions are created on demand and share the credentials of the main session.
+func (c *Controller) getRDSClientForRegion(region string) (RDSAPI, error) {
+	if region == "" || region == c.configuration.AWSRegion {
+		return c.rdsClient, nil
+	}
+
+	if region == c.GetTargetRegion() {
+		return c.dstRDSClient, nil
+	}
+
+	if client, ok := c.regionalRDSClients[region]; ok {
+		return client, nil
+	}
+
+	if c.session == nil {
+		return nil, errors.New(fmt.Sprintf("No RDS client configured for region: '%s'!", region))
+	}
+
+	client := rds.NewFromConfig(*c.session, func(options *rds.Options) {
+		options.Region = region
+	})
+	c.regionalRDSClients[region] = client
+
+	return client, nil
+}
+
+// Region the destination instance is created in.
+func (c *Controller) GetTargetRegion() string {
+	if c.configuration.Items.Upgrade.TargetRegion == "" {
+		return c.configuration.AWSRegion
+	}
+
+	return c.configuration.Items.Upgrade.TargetRegion
+}
+
+func (c *Controller) IsCrossRegion() bool {
+	return c.GetTargetRegion() != c.configuration.AWSRegion
+}
+
+// Account the destination instance is created in. Empty for the source account.
+func (c *Controller) GetTargetAccountID() string {
+	roleArn, err := arn.Parse(c.configuration.Items.Upgrade.TargetAccountRoleArn)
+	if err != nil {
+		return ""
+	}
+
+	return roleArn.AccountID
+}
+
+func (c *Controller) IsCrossAccount() bool {
+	return c.GetTargetAccountID() != ""
+}
+
+// The destination gets its own session, which shares the credentials of the main one.
+// For another account the role of that account is assumed with these credentials.
+func (c *Controller) initDstClients() {
+	if !c.IsCrossRegion() && !c.IsCrossAccount() {
+		c.dstRDSClient = c.rdsClient
+		c.dstEC2Client = c.ec2Client
+		c.dstKMSClient = c.kmsClient
+		c.dstSMClient = c.smClient
+		c.dstSession = c.session
+		return
+	}
+
+	dstSession := c.session.Copy()
+	dstSession.Region = c.GetTargetRegion()
+	if c.IsCrossAccount() {
+		log.Infof("Assuming role: '%s' in the target account", c.configuration.Items.Upgrade.TargetAccountRoleArn)
+		dstSession.Credentials = a.NewCredentialsCache(stscreds.NewAssumeRoleProvider(
+			sts.NewFromConfig(*c.session),
+			c.configuration.Items.Upgrade.TargetAccountRoleArn,
+		))
+	}
+
+	c.dstRDSClient = rds.NewFromConfig(dstSession)
+	c.dstEC2Client = ec2.NewFromConfig(dstSession)
+	c.dstKMSClient = kms.NewFromConfig(dstSession)
+	c.dstSMClient = secretsmanager.NewFromConfig(dstSession, c.smOptions()...)
+	c.dstSession = &dstSession
+}
+
 func (c *Controller) initCWClient() {
 	client := cloudwatch.NewFromConfig(*c.session)
 	c.cwClient = client
@@ -100,3 +252,33 @@ func (c *Controller) initKMSClient() {
 	client := kms.NewFromConfig(*c.session)
 	c.kmsClient = client
 }
+
+// Endpoint can be overridden to run against a local Route53 stand-in.
+func (c *Controller) initRoute53Client() {
+	optFns := []func(*route53.Options){}
+	if c.configuration.AWSRoute53.Endpoint != "" {
+		optFns = append(optFns, route53.WithEndpointResolver(
+			route53.EndpointResolverFromURL(c.configuration.AWSRoute53.Endpoint),
+		))
+	}
+
+	client := route53.NewFromConfig(*c.session, optFns...)
+	c.route53Client = client
+}
+
+// Endpoint can be overridden to run against a local Secrets Manager stand-in.
+func (c *Controller) smOptions() []func(*secretsmanager.Options) {
+	optFns := []func(*secretsmanager.Options){}
+	if c.configuration.AWSSecrets != nil && c.configuration.AWSSecrets.Endpoint != "" {
+		optFns = append(optFns, secretsmanager.WithEndpointResolver(
+			secretsmanager.EndpointResolverFromURL(c.configuration.AWSSecrets.Endpoint),
+		))
+	}
+
+	return optFns
+}
+
+func (c *Controller) initSMClient() {
+	client := secretsmanager.NewFromConfig(*c.session, c.smOptions()...)
+	c.smClient = client
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"context"
+	"db_relocate/testing/fakeaws"
+	"db_relocate/types"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+const (
+	TEST_INSTANCE_ID            string = "test-db"
+	TEST_MASTER_USER_SECRET_ARN string = "arn:aws:secretsmanager:us-east-1:123456789012:secret:rds!db-test"
+)
+
+func setupFakeCloud() *fakeaws.Cloud {
+	cloud := fakeaws.NewCloud()
+
+	cloud.Instances[TEST_INSTANCE_ID] = &rdsTypes.DBInstance{
+		DBInstanceIdentifier: a.String(TEST_INSTANCE_ID),
+		DBInstanceClass:      a.String("db.t3.micro"),
+		DBInstanceStatus:     a.String(fakeaws.STATUS_AVAILABLE),
+		Engine:               a.String("postgres"),
+		EngineVersion:        a.String("13.7"),
+		Endpoint: &rdsTypes.Endpoint{
+			Address: a.String("test-db.fake.rds.amazonaws.com"),
+			Port:    5432,
+		},
+	}
+
+	return cloud
+}
+
+// The destination clients fall back to the source ones, so both sides are served by the same fake cloud.
+func setupFakeCloudController(cloud *fakeaws.Cloud) *Controller {
+	cont := context.TODO()
+
+	configuration := &types.Configuration{
+		Context: &cont,
+		Items: &types.Items{
+			Src:     &types.DBInstanceDetails{InstanceID: TEST_INSTANCE_ID},
+			Dst:     &types.DBInstanceDetails{},
+			Upgrade: &types.UpgradeDetails{EngineVersion: "14.7"},
+			Sizing:  &types.SizingDetails{Lookback: time.Hour * 24 * 14, Horizon: time.Hour * 24 * 90},
+		},
+		AWSRegion: fakeaws.DEFAULT_REGION,
+	}
+
+	return NewControllerWithClients(configuration, &Clients{
+		RDS:            cloud,
+		CloudWatch:     cloud,
+		EC2:            cloud,
+		SecretsManager: cloud,
+		WaiterDelay:    time.Millisecond,
+	}, nil)
+}
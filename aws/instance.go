@@ -12,12 +12,14 @@ package aws
 
 import (
 	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 
 	"db_relocate/log"
 
-	"time"
+	"errors"
+	"fmt"
 )
 
 const (
@@ -28,14 +30,14 @@ const (
 	DB_INSTANCE_MAX_STORAGE_THROUGHTPUT int32  = 4000
 )
 
-func (c *Controller) DescribeDBInstance(instanceID *string) ([]rdsTypes.DBInstance, error) {
+func (c *Controller) describeDBInstance(client RDSAPI, instanceID *string) ([]rdsTypes.DBInstance, error) {
 	log.Debugf("Looking for an instance with ID: %s", *instanceID)
 
 	input := &rds.DescribeDBInstancesInput{
 		DBInstanceIdentifier: instanceID,
 	}
 
-	result, err := c.rdsClient.DescribeDBInstances(*c.configuration.Context, input)
+	result, err := client.DescribeDBInstances(*c.configuration.Context, input)
 	if err != nil {
 		return nil, err
 	}
@@ -43,16 +45,91 @@ func (c *Controller) DescribeDBInstance(instanceID *string) ([]rdsTypes.DBInstan
 	return result.DBInstances, nil
 }
 
+func (c *Controller) DescribeDBInstance(instanceID *string) ([]rdsTypes.DBInstance, error) {
+	return c.describeDBInstance(c.rdsClient, instanceID)
+}
+
+// Same as DescribeDBInstance, but looks up the instance in the region and the account the destination instance is created in.
+func (c *Controller) DescribeDBInstanceInDstRegion(instanceID *string) ([]rdsTypes.DBInstance, error) {
+	return c.describeDBInstance(c.dstRDSClient, instanceID)
+}
+
+// Instances without a valid ARN are assumed to be in the configured region.
+func (c *Controller) getDBInstanceRegion(instance *rdsTypes.DBInstance) string {
+	if instance.DBInstanceArn == nil {
+		return c.configuration.AWSRegion
+	}
+
+	instanceArn, err := arn.Parse(*instance.DBInstanceArn)
+	if err != nil {
+		return c.configuration.AWSRegion
+	}
+
+	return instanceArn.Region
+}
+
+func (c *Controller) getDBInstanceAccountID(instance *rdsTypes.DBInstance) string {
+	if instance.DBInstanceArn == nil {
+		return ""
+	}
+
+	instanceArn, err := arn.Parse(*instance.DBInstanceArn)
+	if err != nil {
+		return ""
+	}
+
+	return instanceArn.AccountID
+}
+
+// Picks the client by the region and the account of the instance, so the same helpers work for the source and the destination.
+func (c *Controller) getRDSClientForInstance(instance *rdsTypes.DBInstance) RDSAPI {
+	if c.getDBInstanceRegion(instance) != c.GetTargetRegion() {
+		return c.rdsClient
+	}
+
+	if c.IsCrossAccount() && c.getDBInstanceAccountID(instance) != c.GetTargetAccountID() {
+		return c.rdsClient
+	}
+
+	return c.dstRDSClient
+}
+
+func (c *Controller) DescribeDstDBInstance(srcInstance *rdsTypes.DBInstance) (*rdsTypes.DBInstance, error) {
+	configuration := targetDBConfiguration{}
+	configuration.setDBInstanceIdentifier(c.configuration.Items, srcInstance)
+
+	instances, err := c.DescribeDBInstanceInDstRegion(configuration.instanceIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, errors.New(fmt.Sprintf(
+			"Failed to find destination DB instance: '%s'!",
+			*configuration.instanceIdentifier,
+		))
+	}
+
+	err = c.setDBClusterEndpoint(&instances[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &instances[0], nil
+}
+
 func (c *Controller) rebootDBInstance(instance *rdsTypes.DBInstance) error {
 	log.Debugf("Rebooting an instance with an ID: %s", *instance.DBInstanceIdentifier)
 
 	input := &rds.RebootDBInstanceInput{
 		DBInstanceIdentifier: instance.DBInstanceIdentifier,
 	}
-	if instance.MultiAZ {
+	// Aurora instances fail over within the cluster instead.
+	if instance.MultiAZ && instance.DBClusterIdentifier == nil {
 		input.ForceFailover = a.Bool(true)
 	}
-	_, err := c.rdsClient.RebootDBInstance(*c.configuration.Context, input)
+	client := c.getRDSClientForInstance(instance)
+	_, err := client.RebootDBInstance(*c.configuration.Context, input)
 	if err != nil {
 		return err
 	}
@@ -60,13 +137,15 @@ func (c *Controller) rebootDBInstance(instance *rdsTypes.DBInstance) error {
 	waitParams := &rds.DescribeDBInstancesInput{
 		DBInstanceIdentifier: instance.DBInstanceIdentifier,
 	}
-	waiter := rds.NewDBInstanceAvailableWaiter(c.rdsClient)
+	waiter := c.newDBInstanceAvailableWaiterForClient(client)
 
-	duration, err := time.ParseDuration(DB_INSTANCE_REBOOT_TIMEOUT)
+	duration, err := c.getTimeout(OPERATION_DB_INSTANCE_REBOOT)
 	if err != nil {
 		return err
 	}
+	stopProgressReport := c.startProgressReport(client, rdsTypes.SourceTypeDbInstance, instance.DBInstanceIdentifier)
 	err = waiter.Wait(*c.configuration.Context, waitParams, duration)
+	stopProgressReport()
 
 	return err
 }
@@ -110,11 +189,11 @@ func (c *Controller) getValidInstanceClasses(engineVersion *string) (map[string]
 	validInstanceClasses := make(map[string]bool)
 
 	input := &rds.DescribeOrderableDBInstanceOptionsInput{
-		Engine:        a.String("postgres"),
+		Engine:        a.String(c.GetTargetEngine()),
 		EngineVersion: engineVersion,
 	}
 
-	paginator := rds.NewDescribeOrderableDBInstanceOptionsPaginator(c.rdsClient, input)
+	paginator := rds.NewDescribeOrderableDBInstanceOptionsPaginator(c.dstRDSClient, input)
 	for paginator.HasMorePages() {
 		orderableDBInstanceOptions, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -160,7 +239,8 @@ func (c *Controller) setCAIdentifier(instance *rdsTypes.DBInstance, caIdentifier
 		CACertificateIdentifier: caIdentifier,
 		ApplyImmediately:        true,
 	}
-	_, err := c.rdsClient.ModifyDBInstance(*c.configuration.Context, instanceInput)
+	client := c.getRDSClientForInstance(instance)
+	_, err := client.ModifyDBInstance(*c.configuration.Context, instanceInput)
 	if err != nil {
 		return err
 	}
@@ -169,13 +249,15 @@ func (c *Controller) setCAIdentifier(instance *rdsTypes.DBInstance, caIdentifier
 	waitParams := &rds.DescribeDBInstancesInput{
 		DBInstanceIdentifier: instance.DBInstanceIdentifier,
 	}
-	waiter := rds.NewDBInstanceAvailableWaiter(c.rdsClient)
+	waiter := c.newDBInstanceAvailableWaiterForClient(client)
 
-	duration, err := time.ParseDuration(DB_INSTANCE_MODIFY_TIMEOUT)
+	duration, err := c.getTimeout(OPERATION_DB_INSTANCE_MODIFY)
 	if err != nil {
 		return err
 	}
+	stopProgressReport := c.startProgressReport(client, rdsTypes.SourceTypeDbInstance, instance.DBInstanceIdentifier)
 	err = waiter.Wait(*c.configuration.Context, waitParams, duration)
+	stopProgressReport()
 	if err != nil {
 		return err
 	}
@@ -190,7 +272,7 @@ func (c *Controller) getValidCAIdentifiers() ([]rdsTypes.Certificate, error) {
 
 	input := &rds.DescribeCertificatesInput{}
 
-	paginator := rds.NewDescribeCertificatesPaginator(c.rdsClient, input)
+	paginator := rds.NewDescribeCertificatesPaginator(c.dstRDSClient, input)
 	for paginator.HasMorePages() {
 		caIdentifiers, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -329,6 +411,26 @@ func (c *Controller) IsValidStorageThroughput() (bool, error) {
 	return false, nil
 }
 
+func (c *Controller) tagDBInstance(instance *rdsTypes.DBInstance, key string, value string) error {
+	input := &rds.AddTagsToResourceInput{
+		ResourceName: instance.DBInstanceArn,
+		Tags:         []rdsTypes.Tag{{Key: a.String(key), Value: a.String(value)}},
+	}
+	_, err := c.getRDSClientForInstance(instance).AddTagsToResource(*c.configuration.Context, input)
+
+	return err
+}
+
+func (c *Controller) untagDBInstance(instance *rdsTypes.DBInstance, key string) error {
+	input := &rds.RemoveTagsFromResourceInput{
+		ResourceName: instance.DBInstanceArn,
+		TagKeys:      []string{key},
+	}
+	_, err := c.getRDSClientForInstance(instance).RemoveTagsFromResource(*c.configuration.Context, input)
+
+	return err
+}
+
 func (c *Controller) StopSrcDBInstance(instance *rdsTypes.DBInstance) error {
 	input := &rds.StopDBInstanceInput{
 		DBInstanceIdentifier: instance.DBInstanceIdentifier,
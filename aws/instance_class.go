@@ -0,0 +1,407 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+const (
+	CPU_UTILIZATION_METRIC             string  = "CPUUtilization"
+	FREEABLE_MEMORY_METRIC             string  = "FreeableMemory"
+	DATABASE_CONNECTIONS_METRIC        string  = "DatabaseConnections"
+	NETWORK_RECEIVE_THROUGHPUT_METRIC  string  = "NetworkReceiveThroughput"
+	NETWORK_TRANSMIT_THROUGHPUT_METRIC string  = "NetworkTransmitThroughput"
+	CPU_UTILIZATION_TARGET             float64 = 70 // percent
+	// RDS derives the default max_connections from the memory of the instance class with the same divisor.
+	MEMORY_PER_CONNECTION     float64 = 9531392 // bytes
+	BURSTABLE_INSTANCE_FAMILY string  = "t"
+	INSTANCE_CLASS_PREFIX     string  = "db."
+	// DescribeInstanceTypes accepts at most 100 instance types per call.
+	INSTANCE_TYPES_PER_CALL int     = 100
+	BITS_PER_GBIT           float64 = 1000 * 1000 * 1000
+)
+
+// Splits an instance class like 'db.m7g.large' into the family 'm', the generation 7, the attributes 'g' and the size 'large'.
+var instanceClassRegexp = regexp.MustCompile(`^db\.([a-z]+)([0-9]+)([a-z-]*)\.([0-9a-z]+)$`)
+
+// Network performance like '10 Gigabit' or 'Up to 12.5 Gigabit'. Descriptions like 'Moderate' are not comparable.
+var networkPerformanceRegexp = regexp.MustCompile(`([0-9.]+) Gigabit`)
+
+type instanceClassSpecs struct {
+	instanceClass string
+	family        string
+	generation    int
+	attributes    string
+	vCPUs         int32
+	memory        float64 // GB
+	network       float64 // Gbps, 0 if unknown
+}
+
+// Peaks of the instance over the look-back period.
+type instanceUsage struct {
+	peakCPUUtilization float64 // percent
+	usedMemory         float64 // GB
+	peakConnections    float64
+	peakNetwork        float64 // Gbps in either direction
+}
+
+// What the new instance needs to serve the observed peaks with headroom.
+type instanceNeeds struct {
+	vCPUs   int32
+	memory  float64 // GB
+	network float64 // Gbps
+}
+
+type InstanceClassRecommendation struct {
+	InstanceClass  string
+	Justifications []string
+}
+
+func (icr *InstanceClassRecommendation) justify(format string, args ...interface{}) {
+	icr.Justifications = append(icr.Justifications, fmt.Sprintf(format, args...))
+}
+
+func parseNetworkPerformance(networkPerformance string) float64 {
+	match := networkPerformanceRegexp.FindStringSubmatch(networkPerformance)
+	if match == nil {
+		return 0
+	}
+
+	network, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0
+	}
+
+	return network
+}
+
+func buildInstanceClassSpecs(instanceClass string, instanceTypeInfo *ec2Types.InstanceTypeInfo) *instanceClassSpecs {
+	match := instanceClassRegexp.FindStringSubmatch(instanceClass)
+	if match == nil || instanceTypeInfo.VCpuInfo == nil || instanceTypeInfo.MemoryInfo == nil {
+		return nil
+	}
+
+	generation, err := strconv.Atoi(match[2])
+	if err != nil {
+		return nil
+	}
+
+	specs := &instanceClassSpecs{
+		instanceClass: instanceClass,
+		family:        match[1],
+		generation:    generation,
+		attributes:    match[3],
+		vCPUs:         a.ToInt32(instanceTypeInfo.VCpuInfo.DefaultVCpus),
+		memory:        float64(a.ToInt64(instanceTypeInfo.MemoryInfo.SizeInMiB)) / 1024,
+	}
+
+	if instanceTypeInfo.NetworkInfo != nil {
+		specs.network = parseNetworkPerformance(a.ToString(instanceTypeInfo.NetworkInfo.NetworkPerformance))
+	}
+
+	return specs
+}
+
+// Instance classes are looked up as EC2 instance types without the 'db.' prefix. Classes which don't map to one, e.g. 'db.serverless', are left out.
+func (c *Controller) getInstanceClassSpecs(instanceClasses []string) (map[string]*instanceClassSpecs, error) {
+	instanceTypes := []ec2Types.InstanceType{}
+	for idx := range instanceClasses {
+		if instanceClassRegexp.MatchString(instanceClasses[idx]) {
+			instanceTypes = append(instanceTypes, ec2Types.InstanceType(strings.TrimPrefix(instanceClasses[idx], INSTANCE_CLASS_PREFIX)))
+		}
+	}
+
+	specs := make(map[string]*instanceClassSpecs)
+	for start := 0; start < len(instanceTypes); start += INSTANCE_TYPES_PER_CALL {
+		end := start + INSTANCE_TYPES_PER_CALL
+		if end > len(instanceTypes) {
+			end = len(instanceTypes)
+		}
+
+		input := &ec2.DescribeInstanceTypesInput{
+			InstanceTypes: instanceTypes[start:end],
+		}
+
+		paginator := ec2.NewDescribeInstanceTypesPaginator(c.dstEC2Client, input)
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(*c.configuration.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			for idx := range output.InstanceTypes {
+				instanceClass := INSTANCE_CLASS_PREFIX + string(output.InstanceTypes[idx].InstanceType)
+				if instanceClassSpecs := buildInstanceClassSpecs(instanceClass, &output.InstanceTypes[idx]); instanceClassSpecs != nil {
+					specs[instanceClass] = instanceClassSpecs
+				}
+			}
+		}
+	}
+
+	return specs, nil
+}
+
+func (c *Controller) getInstanceUsage(instance *rdsTypes.DBInstance, specs *instanceClassSpecs, now *time.Time) (*instanceUsage, error) {
+	start := now.Add(-c.configuration.Items.Sizing.Lookback)
+
+	series, err := c.getMetricSeriesForDBInstance(
+		instance,
+		[]metricStatistic{
+			{metricName: CPU_UTILIZATION_METRIC, stat: "Maximum"},
+			{metricName: FREEABLE_MEMORY_METRIC, stat: "Minimum"},
+			{metricName: DATABASE_CONNECTIONS_METRIC, stat: "Maximum"},
+			{metricName: NETWORK_RECEIVE_THROUGHPUT_METRIC, stat: "Maximum"},
+			{metricName: NETWORK_TRANSMIT_THROUGHPUT_METRIC, stat: "Maximum"},
+		},
+		&start,
+		now,
+		SIZING_METRIC_PERIOD,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cpuUtilization := series[CPU_UTILIZATION_METRIC]
+	if cpuUtilization == nil || len(cpuUtilization.values) == 0 {
+		return nil, errors.New(fmt.Sprintf(
+			"Failed to find '%s' metric of DB instance: '%s' within the last %s!",
+			CPU_UTILIZATION_METRIC,
+			*instance.DBInstanceIdentifier,
+			c.configuration.Items.Sizing.Lookback,
+		))
+	}
+
+	usage := &instanceUsage{
+		peakCPUUtilization: peakOfSummedSeries(cpuUtilization),
+		peakConnections:    peakOfSummedSeries(series[DATABASE_CONNECTIONS_METRIC]),
+		peakNetwork: math.Max(
+			peakOfSummedSeries(series[NETWORK_RECEIVE_THROUGHPUT_METRIC]),
+			peakOfSummedSeries(series[NETWORK_TRANSMIT_THROUGHPUT_METRIC]),
+		) * 8 / BITS_PER_GBIT,
+	}
+
+	if freeableMemory := series[FREEABLE_MEMORY_METRIC]; freeableMemory != nil && len(freeableMemory.values) != 0 {
+		minFreeableMemory := freeableMemory.values[0]
+		for idx := range freeableMemory.values {
+			minFreeableMemory = math.Min(minFreeableMemory, freeableMemory.values[idx])
+		}
+		usage.usedMemory = math.Max(0, specs.memory-minFreeableMemory/BYTES_PER_GB)
+	}
+
+	return usage, nil
+}
+
+// A newer generation is usually faster per vCPU, which is left as extra headroom.
+func calculateInstanceNeeds(specs *instanceClassSpecs, usage *instanceUsage) *instanceNeeds {
+	return &instanceNeeds{
+		vCPUs: int32(math.Ceil(float64(specs.vCPUs) * usage.peakCPUUtilization / CPU_UTILIZATION_TARGET)),
+		memory: math.Max(
+			usage.usedMemory*STORAGE_HEADROOM_RATIO,
+			usage.peakConnections*MEMORY_PER_CONNECTION/BYTES_PER_GB,
+		),
+		network: usage.peakNetwork * STORAGE_HEADROOM_RATIO,
+	}
+}
+
+// Lists what the instance class lacks to serve the observed peaks. Unknown network performance is not compared.
+func findInstanceClassShortfalls(specs *instanceClassSpecs, needs *instanceNeeds) []string {
+	shortfalls := []string{}
+	if specs.vCPUs < needs.vCPUs {
+		shortfalls = append(shortfalls, fmt.Sprintf("%d vCPUs are needed, '%s' has %d", needs.vCPUs, specs.instanceClass, specs.vCPUs))
+	}
+
+	if specs.memory < needs.memory {
+		shortfalls = append(shortfalls, fmt.Sprintf("%.1f GB of memory are needed, '%s' has %.1f GB", needs.memory, specs.instanceClass, specs.memory))
+	}
+
+	if specs.network != 0 && specs.network < needs.network {
+		shortfalls = append(shortfalls, fmt.Sprintf("%.2f Gbps of network are needed, '%s' has %.2f Gbps", needs.network, specs.instanceClass, specs.network))
+	}
+
+	return shortfalls
+}
+
+// Candidates of the same family come first, then the smallest ones and the newest generation among them.
+// Plain classes are preferred over ones with extras like local storage at the same size.
+func sortInstanceClassCandidates(candidates []*instanceClassSpecs, family string) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		first, second := candidates[i], candidates[j]
+		if (first.family == family) != (second.family == family) {
+			return first.family == family
+		}
+		if first.vCPUs != second.vCPUs {
+			return first.vCPUs < second.vCPUs
+		}
+		if first.memory != second.memory {
+			return first.memory < second.memory
+		}
+		if first.generation != second.generation {
+			return first.generation > second.generation
+		}
+		if len(first.attributes) != len(second.attributes) {
+			return len(first.attributes) < len(second.attributes)
+		}
+		return first.instanceClass < second.instanceClass
+	})
+}
+
+// Specs of the instance classes, the peak usage of the instance and what the new instance needs.
+type instanceSizing struct {
+	specs    map[string]*instanceClassSpecs
+	srcSpecs *instanceClassSpecs
+	usage    *instanceUsage
+	needs    *instanceNeeds
+}
+
+func (c *Controller) getInstanceSizing(instance *rdsTypes.DBInstance, instanceClasses []string, now *time.Time) (*instanceSizing, error) {
+	instanceClass := a.ToString(instance.DBInstanceClass)
+
+	// DescribeInstanceTypes fails on duplicates.
+	if !containsInstanceClass(instanceClasses, instanceClass) {
+		instanceClasses = append(instanceClasses, instanceClass)
+	}
+
+	specs, err := c.getInstanceClassSpecs(instanceClasses)
+	if err != nil {
+		return nil, err
+	}
+
+	srcSpecs, ok := specs[instanceClass]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Failed to find the specs of instance class: '%s'!", instanceClass))
+	}
+
+	usage, err := c.getInstanceUsage(instance, srcSpecs, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instanceSizing{
+		specs:    specs,
+		srcSpecs: srcSpecs,
+		usage:    usage,
+		needs:    calculateInstanceNeeds(srcSpecs, usage),
+	}, nil
+}
+
+func containsInstanceClass(instanceClasses []string, instanceClass string) bool {
+	for idx := range instanceClasses {
+		if instanceClasses[idx] == instanceClass {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Recommends the smallest instance class valid for the target engine version which serves the peaks of the old instance with some headroom.
+func (c *Controller) RecommendDBInstanceClass(instance *rdsTypes.DBInstance, now *time.Time) (*InstanceClassRecommendation, error) {
+	validInstanceClasses, err := c.getValidInstanceClasses(&c.configuration.Items.Upgrade.EngineVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceClasses := []string{}
+	for instanceClass := range validInstanceClasses {
+		instanceClasses = append(instanceClasses, instanceClass)
+	}
+
+	sizing, err := c.getInstanceSizing(instance, instanceClasses, now)
+	if err != nil {
+		return nil, err
+	}
+	srcSpecs, usage, needs := sizing.srcSpecs, sizing.usage, sizing.needs
+
+	recommendation := &InstanceClassRecommendation{}
+	recommendation.justify(
+		"Peak usage of '%s' within the last %s: %.0f%% of %d vCPUs, %.1f of %.1f GB of memory, %.0f connections and %.2f Gbps of network.",
+		srcSpecs.instanceClass,
+		c.configuration.Items.Sizing.Lookback,
+		usage.peakCPUUtilization,
+		srcSpecs.vCPUs,
+		usage.usedMemory,
+		srcSpecs.memory,
+		usage.peakConnections,
+		usage.peakNetwork,
+	)
+	recommendation.justify(
+		"%d vCPUs at %.0f%% utilization, %.1f GB of memory and %.2f Gbps of network are needed with headroom.",
+		needs.vCPUs,
+		CPU_UTILIZATION_TARGET,
+		needs.memory,
+		needs.network,
+	)
+
+	// Burstable classes run out of CPU credits under sustained load, so they are only kept.
+	candidates := []*instanceClassSpecs{}
+	for instanceClass := range validInstanceClasses {
+		candidate, ok := sizing.specs[instanceClass]
+		if !ok || (candidate.family == BURSTABLE_INSTANCE_FAMILY && srcSpecs.family != BURSTABLE_INSTANCE_FAMILY) {
+			continue
+		}
+
+		if len(findInstanceClassShortfalls(candidate, needs)) == 0 {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, errors.New(fmt.Sprintf(
+			"Failed to find an instance class for engine version: '%s' which serves the peak usage of: '%s'!",
+			c.configuration.Items.Upgrade.EngineVersion,
+			*instance.DBInstanceIdentifier,
+		))
+	}
+
+	sortInstanceClassCandidates(candidates, srcSpecs.family)
+	recommendation.InstanceClass = candidates[0].instanceClass
+
+	recommendation.justify(
+		"'%s' is the smallest valid class of the newest generation with enough capacity: %d vCPUs and %.1f GB of memory.",
+		recommendation.InstanceClass,
+		candidates[0].vCPUs,
+		candidates[0].memory,
+	)
+
+	if candidates[0].family != srcSpecs.family {
+		recommendation.justify("No class of the '%s' family is valid for the target engine version or big enough.", srcSpecs.family)
+	}
+
+	return recommendation, nil
+}
+
+// Compares the instance class against the peak usage of the instance. An empty list means it is big enough.
+func (c *Controller) GetInstanceClassShortfalls(instance *rdsTypes.DBInstance, instanceClass string, now *time.Time) ([]string, error) {
+	sizing, err := c.getInstanceSizing(instance, []string{instanceClass}, now)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceClassSpecs, ok := sizing.specs[instanceClass]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Failed to find the specs of instance class: '%s'!", instanceClass))
+	}
+
+	return findInstanceClassShortfalls(instanceClassSpecs, sizing.needs), nil
+}
@@ -0,0 +1,233 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/testing/fakeaws"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInstanceClassSpecs(t *testing.T) {
+	tests := []struct {
+		name               string
+		instanceClass      string
+		networkPerformance string
+		expectedSpecs      *instanceClassSpecs
+	}{
+		{
+			name:               "graviton class with burst network",
+			instanceClass:      "db.m7g.large",
+			networkPerformance: "Up to 12.5 Gigabit",
+			expectedSpecs: &instanceClassSpecs{
+				instanceClass: "db.m7g.large",
+				family:        "m",
+				generation:    7,
+				attributes:    "g",
+				vCPUs:         2,
+				memory:        8,
+				network:       12.5,
+			},
+		},
+		{
+			name:               "class with several attributes",
+			instanceClass:      "db.r6idn.2xlarge",
+			networkPerformance: "40 Gigabit",
+			expectedSpecs: &instanceClassSpecs{
+				instanceClass: "db.r6idn.2xlarge",
+				family:        "r",
+				generation:    6,
+				attributes:    "idn",
+				vCPUs:         2,
+				memory:        8,
+				network:       40,
+			},
+		},
+		{
+			name:               "network performance which is not comparable",
+			instanceClass:      "db.m4.large",
+			networkPerformance: "Moderate",
+			expectedSpecs: &instanceClassSpecs{
+				instanceClass: "db.m4.large",
+				family:        "m",
+				generation:    4,
+				vCPUs:         2,
+				memory:        8,
+			},
+		},
+		{
+			name:          "serverless is not an instance type",
+			instanceClass: "db.serverless",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			instanceTypeInfo := &ec2Types.InstanceTypeInfo{
+				VCpuInfo:    &ec2Types.VCpuInfo{DefaultVCpus: a.Int32(2)},
+				MemoryInfo:  &ec2Types.MemoryInfo{SizeInMiB: a.Int64(8192)},
+				NetworkInfo: &ec2Types.NetworkInfo{NetworkPerformance: a.String(test.networkPerformance)},
+			}
+
+			assert.Equal(t, test.expectedSpecs, buildInstanceClassSpecs(test.instanceClass, instanceTypeInfo))
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func buildInstanceTypeInfo(instanceType string, vCPUs int32, memory int64, networkPerformance string) ec2Types.InstanceTypeInfo {
+	return ec2Types.InstanceTypeInfo{
+		InstanceType: ec2Types.InstanceType(instanceType),
+		VCpuInfo:     &ec2Types.VCpuInfo{DefaultVCpus: a.Int32(vCPUs)},
+		MemoryInfo:   &ec2Types.MemoryInfo{SizeInMiB: a.Int64(memory)},
+		NetworkInfo:  &ec2Types.NetworkInfo{NetworkPerformance: a.String(networkPerformance)},
+	}
+}
+
+func setupInstanceClasses(cloud *fakeaws.Cloud) {
+	cloud.InstanceClasses = []string{
+		"db.t3.micro",
+		"db.t3.small",
+		"db.m5.large",
+		"db.m5.xlarge",
+		"db.m7g.large",
+		"db.m7gd.large",
+		"db.m7g.xlarge",
+		"db.r7g.large",
+	}
+	cloud.InstanceTypes = []ec2Types.InstanceTypeInfo{
+		buildInstanceTypeInfo("t3.micro", 2, 1024, "Up to 5 Gigabit"),
+		buildInstanceTypeInfo("t3.small", 2, 2048, "Up to 5 Gigabit"),
+		buildInstanceTypeInfo("m5.large", 2, 8192, "Up to 10 Gigabit"),
+		buildInstanceTypeInfo("m5.xlarge", 4, 16384, "Up to 10 Gigabit"),
+		buildInstanceTypeInfo("m7g.large", 2, 8192, "Up to 12.5 Gigabit"),
+		buildInstanceTypeInfo("m7gd.large", 2, 8192, "Up to 12.5 Gigabit"),
+		buildInstanceTypeInfo("m7g.xlarge", 4, 16384, "Up to 12.5 Gigabit"),
+		buildInstanceTypeInfo("r7g.large", 2, 16384, "Up to 12.5 Gigabit"),
+	}
+}
+
+func setupInstanceMetricHistory(cloud *fakeaws.Cloud, cpuUtilization float64, freeableMemory float64, connections float64) {
+	if cloud.MetricHistory == nil {
+		cloud.MetricHistory = make(map[string][]float64)
+	}
+
+	cloud.MetricHistory["CPUUtilization"] = []float64{cpuUtilization / 2, cpuUtilization}
+	cloud.MetricHistory["FreeableMemory"] = []float64{freeableMemory * 1024 * 1024 * 1024}
+	cloud.MetricHistory["DatabaseConnections"] = []float64{connections}
+	cloud.MetricHistory["NetworkReceiveThroughput"] = []float64{10 * 1024 * 1024}
+	cloud.MetricHistory["NetworkTransmitThroughput"] = []float64{20 * 1024 * 1024}
+}
+
+func TestRecommendDBInstanceClass(t *testing.T) {
+	tests := []struct {
+		name                  string
+		instanceClass         string
+		cpuUtilization        float64
+		freeableMemory        float64 // GB
+		connections           float64
+		expectedInstanceClass string
+		expectedError         bool
+	}{
+		{
+			name:                  "newest generation of the same size",
+			instanceClass:         "db.m5.large",
+			cpuUtilization:        50,
+			freeableMemory:        4,
+			connections:           100,
+			expectedInstanceClass: "db.m7g.large",
+		},
+		{
+			name:                  "burstable classes are left out for other families",
+			instanceClass:         "db.m5.large",
+			cpuUtilization:        10,
+			freeableMemory:        7.5,
+			connections:           10,
+			expectedInstanceClass: "db.m7g.large",
+		},
+		{
+			name:                  "more vCPUs for the peak CPU utilization",
+			instanceClass:         "db.m5.large",
+			cpuUtilization:        90,
+			freeableMemory:        4,
+			connections:           100,
+			expectedInstanceClass: "db.m7g.xlarge",
+		},
+		{
+			name:                  "more memory for the peak connections",
+			instanceClass:         "db.m5.large",
+			cpuUtilization:        50,
+			freeableMemory:        4,
+			connections:           1000,
+			expectedInstanceClass: "db.m7g.xlarge",
+		},
+		{
+			name:                  "burstable class is kept",
+			instanceClass:         "db.t3.micro",
+			cpuUtilization:        20,
+			freeableMemory:        0.5,
+			connections:           50,
+			expectedInstanceClass: "db.t3.micro",
+		},
+		{
+			name:           "no class is big enough",
+			instanceClass:  "db.m5.xlarge",
+			cpuUtilization: 100,
+			freeableMemory: 1,
+			connections:    100,
+			expectedError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			now := time.Now().UTC()
+			cloud := setupFakeCloud()
+			setupInstanceClasses(cloud)
+			setupInstanceMetricHistory(cloud, test.cpuUtilization, test.freeableMemory, test.connections)
+			cloud.Instances[TEST_INSTANCE_ID].DBInstanceClass = a.String(test.instanceClass)
+			c := setupFakeCloudController(cloud)
+
+			recommendation, err := c.RecommendDBInstanceClass(cloud.Instances[TEST_INSTANCE_ID], &now)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expectedInstanceClass, recommendation.InstanceClass)
+				assert.NotEmpty(t, recommendation.Justifications)
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestGetInstanceClassShortfalls(t *testing.T) {
+	now := time.Now().UTC()
+	cloud := setupFakeCloud()
+	setupInstanceClasses(cloud)
+	setupInstanceMetricHistory(cloud, 90, 4, 100)
+	cloud.Instances[TEST_INSTANCE_ID].DBInstanceClass = a.String("db.m5.large")
+	c := setupFakeCloudController(cloud)
+
+	shortfalls, err := c.GetInstanceClassShortfalls(cloud.Instances[TEST_INSTANCE_ID], "db.m7g.large", &now)
+	assert.NoError(t, err)
+	assert.Len(t, shortfalls, 1, "only the vCPUs fall short")
+
+	shortfalls, err = c.GetInstanceClassShortfalls(cloud.Instances[TEST_INSTANCE_ID], "db.m7g.xlarge", &now)
+	assert.NoError(t, err)
+	assert.Empty(t, shortfalls)
+}
@@ -23,7 +23,7 @@ func (c *Controller) getKMSKeyByAlias(alias string) (*string, error) {
 
 	input := &kms.ListAliasesInput{}
 
-	paginator := kms.NewListAliasesPaginator(c.kmsClient, input)
+	paginator := kms.NewListAliasesPaginator(c.dstKMSClient, input)
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -50,7 +50,7 @@ func (c *Controller) getKMSKeyByAlias(alias string) (*string, error) {
 func (c *Controller) isKMSKeyExists(kmsKeyID *string) (bool, error) {
 	input := &kms.ListKeysInput{}
 
-	paginator := kms.NewListKeysPaginator(c.kmsClient, input)
+	paginator := kms.NewListKeysPaginator(c.dstKMSClient, input)
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -40,7 +40,7 @@ func (c *Controller) searchLogFileForLatestUnhealthyLSN(
 		DBInstanceIdentifier: instance.DBInstanceIdentifier,
 		LogFileName:          logFileName,
 	}
-	paginator := rds.NewDownloadDBLogFilePortionPaginator(c.rdsClient, input, func(opts *rds.DownloadDBLogFilePortionPaginatorOptions) {
+	paginator := rds.NewDownloadDBLogFilePortionPaginator(c.getRDSClientForInstance(instance), input, func(opts *rds.DownloadDBLogFilePortionPaginatorOptions) {
 		opts.StopOnDuplicateToken = true
 	})
 
@@ -84,7 +84,7 @@ func (c *Controller) SearchLogFilesForEarliestUnhealthyLSN(instance *rdsTypes.DB
 		FileLastWritten:      timeBeforeSnapshot.UnixMilli(),
 	}
 
-	paginator := rds.NewDescribeDBLogFilesPaginator(c.rdsClient, input)
+	paginator := rds.NewDescribeDBLogFilesPaginator(c.getRDSClientForInstance(instance), input)
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -11,20 +11,41 @@
 package aws
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"db_relocate/log"
 
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 )
 
 const (
 	SERVICE_WINDOW_LOW_THRESHOLD  int = 2  // hours
 	SERVICE_WINDOW_HIGH_THRESHOLD int = 10 // minutes
+
+	SERVICE_WINDOW_TIME_LAYOUT string = "15:04"
+	BACKUP_WINDOW_NAME         string = "backup window"
+	MAINTENANCE_WINDOW_NAME    string = "maintenance window"
+
+	PENDING_MAINTENANCE_FAIL             string = "fail"
+	PENDING_MAINTENANCE_APPLY            string = "apply"
+	PENDING_MAINTENANCE_DEFER            string = "defer"
+	PENDING_MAINTENANCE_OPT_IN_IMMEDIATE string = "immediate"
+	PENDING_MAINTENANCE_APPLY_TIMEOUT    string = "120m"
+	PENDING_MAINTENANCE_CHECK_INTERVAL   int    = 30 // seconds
 )
 
+type ServiceWindow struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
 func (c *Controller) isInServiceWindow(now *time.Time, serviceWindowStart *time.Time, serviceWindowEnd *time.Time) bool {
 	if (now.Equal(*serviceWindowStart) || now.After(*serviceWindowStart)) && (now.Equal(*serviceWindowEnd) || now.Before(*serviceWindowEnd)) {
 		log.Errorf("Current time %s is within the service window time range!", now.String())
@@ -46,125 +67,324 @@ func (c *Controller) isInServiceWindow(now *time.Time, serviceWindowStart *time.
 	return false
 }
 
-func (c *Controller) IsDBInstanceInBackupWindow(instance *rdsTypes.DBInstance, now *time.Time) (bool, error) {
-	log.Debugf("Check if the process will be affected by a backup window: '%s'", *instance.PreferredBackupWindow)
-	backupWindowRange := strings.Split(*instance.PreferredBackupWindow, "-")
-
-	backupWindowStartTimeString := fmt.Sprintf(
-		"%v-%02d-%02dT%s:00Z",
-		now.Year(),
-		int(now.Month()),
-		now.Day(),
-		backupWindowRange[0],
-	)
-	backupWindowStart, err := time.Parse(time.RFC3339, backupWindowStartTimeString)
+// Parses a time of day, e.g: 04:30
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	timeOfDay, err := time.Parse(SERVICE_WINDOW_TIME_LAYOUT, value)
 	if err != nil {
-		return false, err
+		return 0, err
+	}
+
+	return time.Duration(timeOfDay.Hour())*time.Hour + time.Duration(timeOfDay.Minute())*time.Minute, nil
+}
+
+func ParseWeekday(value string) (time.Weekday, error) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(weekday.String()[:3], value) {
+			return weekday, nil
+		}
+	}
+
+	return time.Sunday, errors.New(fmt.Sprintf("Invalid weekday: '%s'!", value))
+}
+
+// Parses a weekly time, e.g: thu:04:30, into an offset from the start of the week.
+func parseServiceWindowWeekTime(value string) (time.Duration, error) {
+	weekTime := strings.SplitN(value, ":", 2)
+	if len(weekTime) != 2 {
+		return 0, errors.New(fmt.Sprintf("Invalid maintenance window time: '%s'!", value))
 	}
 
-	backupWindowEndTimeString := fmt.Sprintf(
-		"%v-%02d-%02dT%s:00Z",
-		now.Year(),
-		int(now.Month()),
-		now.Day(),
-		backupWindowRange[1],
-	)
-	backupWindowEnd, err := time.Parse(time.RFC3339, backupWindowEndTimeString)
+	weekday, err := ParseWeekday(weekTime[0])
 	if err != nil {
-		return false, err
+		return 0, err
+	}
+
+	timeOfDay, err := ParseTimeOfDay(weekTime[1])
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(weekday)*time.Hour*24 + timeOfDay, nil
+}
+
+func splitServiceWindow(serviceWindow string) ([]string, error) {
+	serviceWindowRange := strings.Split(serviceWindow, "-")
+	if len(serviceWindowRange) != 2 {
+		return nil, errors.New(fmt.Sprintf("Invalid service window: '%s'!", serviceWindow))
+	}
+
+	return serviceWindowRange, nil
+}
+
+// Builds every occurrence of a repeating window which overlaps [from, to].
+// Windows which end before they start, e.g: 23:30-00:15, wrap over the period boundary.
+func buildServiceWindowOccurrences(name string, periodStart time.Time, period time.Duration, startOffset time.Duration, endOffset time.Duration, from *time.Time, to *time.Time) []ServiceWindow {
+	if endOffset <= startOffset {
+		endOffset += period
+	}
+
+	occurrences := []ServiceWindow{}
+	for ; !periodStart.After(*to); periodStart = periodStart.Add(period) {
+		occurrence := ServiceWindow{
+			Name:  name,
+			Start: periodStart.Add(startOffset),
+			End:   periodStart.Add(endOffset),
+		}
+		if occurrence.End.Before(*from) || occurrence.Start.After(*to) {
+			continue
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	return occurrences
+}
+
+// Daily window in UTC, e.g: 23:30-00:15
+func (c *Controller) getBackupWindowOccurrences(backupWindow string, from *time.Time, to *time.Time) ([]ServiceWindow, error) {
+	backupWindowRange, err := splitServiceWindow(backupWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	startOffset, err := ParseTimeOfDay(backupWindowRange[0])
+	if err != nil {
+		return nil, err
+	}
+
+	endOffset, err := ParseTimeOfDay(backupWindowRange[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// Starting a day earlier covers the occurrence which began yesterday and wraps over midnight.
+	periodStart := from.UTC().Truncate(time.Hour * 24).Add(-time.Hour * 24)
+
+	return buildServiceWindowOccurrences(BACKUP_WINDOW_NAME, periodStart, time.Hour*24, startOffset, endOffset, from, to), nil
+}
+
+// Weekly window in UTC, e.g: sun:23:30-mon:00:15
+func (c *Controller) getMaintenanceWindowOccurrences(maintenanceWindow string, from *time.Time, to *time.Time) ([]ServiceWindow, error) {
+	maintenanceWindowRange, err := splitServiceWindow(maintenanceWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	startOffset, err := parseServiceWindowWeekTime(maintenanceWindowRange[0])
+	if err != nil {
+		return nil, err
+	}
+
+	endOffset, err := parseServiceWindowWeekTime(maintenanceWindowRange[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// Starting a week earlier covers the occurrence which began last week and wraps over the week boundary.
+	startOfTheDay := from.UTC().Truncate(time.Hour * 24)
+	periodStart := startOfTheDay.Add(-time.Duration(startOfTheDay.Weekday())*time.Hour*24 - time.Hour*24*7)
+
+	return buildServiceWindowOccurrences(MAINTENANCE_WINDOW_NAME, periodStart, time.Hour*24*7, startOffset, endOffset, from, to), nil
+}
+
+// Returns backup and maintenance windows of an instance which overlap [from, to], sorted by their start.
+func (c *Controller) GetDBInstanceServiceWindows(instance *rdsTypes.DBInstance, from *time.Time, to *time.Time) ([]ServiceWindow, error) {
+	serviceWindows := []ServiceWindow{}
+
+	if instance.PreferredBackupWindow != nil {
+		backupWindows, err := c.getBackupWindowOccurrences(*instance.PreferredBackupWindow, from, to)
+		if err != nil {
+			return nil, err
+		}
+		serviceWindows = append(serviceWindows, backupWindows...)
 	}
-	inBackupWindow := c.isInServiceWindow(now, &backupWindowStart, &backupWindowEnd)
-	if inBackupWindow {
-		return true, nil
+
+	if instance.PreferredMaintenanceWindow != nil {
+		maintenanceWindows, err := c.getMaintenanceWindowOccurrences(*instance.PreferredMaintenanceWindow, from, to)
+		if err != nil {
+			return nil, err
+		}
+		serviceWindows = append(serviceWindows, maintenanceWindows...)
+	}
+
+	sort.Slice(serviceWindows, func(i, j int) bool {
+		return serviceWindows[i].Start.Before(serviceWindows[j].Start)
+	})
+
+	return serviceWindows, nil
+}
+
+func (c *Controller) isInAnyServiceWindow(now *time.Time, serviceWindows []ServiceWindow) bool {
+	for idx := range serviceWindows {
+		if c.isInServiceWindow(now, &serviceWindows[idx].Start, &serviceWindows[idx].End) {
+			return true
+		}
 	}
 
-	return false, nil
+	return false
 }
 
-func (c *Controller) getMaintenanceWindowWeekday(weekday *string) string {
-	// TODO: optimize this
-	switch *weekday {
-	case "mon":
-		return "Monday"
-	case "tue":
-		return "Tuesday"
-	case "wed":
-		return "Wednesday"
-	case "thu":
-		return "Thursday"
-	case "fri":
-		return "Friday"
-	case "sat":
-		return "Saturday"
-	case "sun":
-		return "Sunday"
-	default:
-		return "Invalid input"
+// Occurrences around the current time are checked, so windows crossing midnight are handled as well.
+func (c *Controller) IsDBInstanceInBackupWindow(instance *rdsTypes.DBInstance, now *time.Time) (bool, error) {
+	log.Debugf("Check if the process will be affected by a backup window: '%s'", *instance.PreferredBackupWindow)
+
+	from := now.Add(-time.Hour * 24)
+	to := now.Add(time.Hour * 24)
+	backupWindows, err := c.getBackupWindowOccurrences(*instance.PreferredBackupWindow, &from, &to)
+	if err != nil {
+		return false, err
 	}
+
+	return c.isInAnyServiceWindow(now, backupWindows), nil
 }
 
+// Occurrences around the current time are checked, so windows crossing a week boundary are handled as well.
 func (c *Controller) IsDBInstanceInMaintenanceWindow(instance *rdsTypes.DBInstance, now *time.Time) (bool, error) {
 	log.Debugf("Check if the process will be affected by a maintenance window: '%s'", *instance.PreferredMaintenanceWindow)
 
-	// One day a week, e.g: thu:4:00-thu:4:45
-	maintenanceWindowRange := strings.Split(*instance.PreferredMaintenanceWindow, "-")
-	maintenanceWindowStart := strings.Split(maintenanceWindowRange[0], ":")
-	maintenanceWindowEnd := strings.Split(maintenanceWindowRange[1], ":")
-
-	// The idea here is to calculate maintenance window start and end time.
-	//
-	// Because AWS returns it in a weird format we also need to compare current weekday to maintenance window weekdays.
-	// If current time is close to the maintenance window or is inside maintenance window we should fail the pre-flight check!
-	maintenanceWindowStartTimeString := fmt.Sprintf(
-		"%v-%02d-%02dT%s:%s:00Z",
-		now.Year(),
-		int(now.Month()),
-		now.Day(),
-		maintenanceWindowStart[1],
-		maintenanceWindowStart[2],
-	)
-	maintenanceWindowStartTime, err := time.Parse(time.RFC3339, maintenanceWindowStartTimeString)
+	from := now.Add(-time.Hour * 24 * 7)
+	to := now.Add(time.Hour * 24 * 7)
+	maintenanceWindows, err := c.getMaintenanceWindowOccurrences(*instance.PreferredMaintenanceWindow, &from, &to)
 	if err != nil {
 		return false, err
 	}
-	maintenanceWindowStartWeekday := c.getMaintenanceWindowWeekday(&maintenanceWindowStart[0])
-
-	maintenanceWindowEndTimeString := fmt.Sprintf(
-		"%v-%02d-%02dT%s:%s:00Z",
-		now.Year(),
-		int(now.Month()),
-		now.Day(),
-		maintenanceWindowEnd[1],
-		maintenanceWindowEnd[2],
-	)
-	maintenanceWindowEndTime, err := time.Parse(time.RFC3339, maintenanceWindowEndTimeString)
+
+	return c.isInAnyServiceWindow(now, maintenanceWindows), nil
+}
+
+func (c *Controller) describePendingMaintenanceActions(instance *rdsTypes.DBInstance) ([]rdsTypes.PendingMaintenanceAction, error) {
+	pendingMaintenanceActions := []rdsTypes.PendingMaintenanceAction{}
+
+	input := &rds.DescribePendingMaintenanceActionsInput{
+		ResourceIdentifier: instance.DBInstanceArn,
+	}
+
+	paginator := rds.NewDescribePendingMaintenanceActionsPaginator(c.rdsClient, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+		for idx := range output.PendingMaintenanceActions {
+			pendingMaintenanceActions = append(
+				pendingMaintenanceActions,
+				output.PendingMaintenanceActions[idx].PendingMaintenanceActionDetails...,
+			)
+		}
+	}
+
+	return pendingMaintenanceActions, nil
+}
+
+// Actions are applied outside of the preferred maintenance window once any of these dates is reached.
+func (c *Controller) isUrgentPendingMaintenanceAction(action *rdsTypes.PendingMaintenanceAction, deadline *time.Time) bool {
+	for _, applyDate := range []*time.Time{action.CurrentApplyDate, action.AutoAppliedAfterDate, action.ForcedApplyDate} {
+		if applyDate != nil && applyDate.Before(*deadline) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns pending maintenance actions which might be applied before the whole process is expected to finish.
+func (c *Controller) GetUrgentPendingMaintenanceActions(instance *rdsTypes.DBInstance, now *time.Time) ([]rdsTypes.PendingMaintenanceAction, error) {
+	log.Debugf("Check if the process will be affected by pending maintenance actions of an instance: '%s'", *instance.DBInstanceIdentifier)
+
+	pendingMaintenanceActions, err := c.describePendingMaintenanceActions(instance)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	maintenanceWindowEndWeekday := c.getMaintenanceWindowWeekday(&maintenanceWindowEnd[0])
 
-	// This covers an edge case when maintenance weekdays are the same as our current weekday.
-	if now.Weekday().String() == maintenanceWindowStartWeekday || now.Weekday().String() == maintenanceWindowEndWeekday {
-		inMaintenanceWindow := c.isInServiceWindow(now, &maintenanceWindowStartTime, &maintenanceWindowEndTime)
-		if inMaintenanceWindow {
-			return true, nil
+	deadline := now.Add(c.configuration.Items.Upgrade.ExpectedDuration)
+	urgentPendingMaintenanceActions := []rdsTypes.PendingMaintenanceAction{}
+	for idx := range pendingMaintenanceActions {
+		if c.isUrgentPendingMaintenanceAction(&pendingMaintenanceActions[idx], &deadline) {
+			urgentPendingMaintenanceActions = append(urgentPendingMaintenanceActions, pendingMaintenanceActions[idx])
 		}
 	}
 
-	// Adding 24 hours so we can cover an edge case when current time is too close to the end of the day, e.g: Mon 23:50
-	// And the next maintenance window is too close to the beginning of the next day, e.g: Tue 00:10.
-	maintenanceWindowStartTime = maintenanceWindowStartTime.Add(time.Hour * 24)
-	maintenanceWindowEndTime = maintenanceWindowEndTime.Add(time.Hour * 24)
+	return urgentPendingMaintenanceActions, nil
+}
 
-	if now.Weekday().String() == maintenanceWindowStartWeekday || now.Weekday().String() == maintenanceWindowEndWeekday {
-		inMaintenanceWindow := c.isInServiceWindow(now, &maintenanceWindowStartTime, &maintenanceWindowEndTime)
-		if inMaintenanceWindow {
-			return true, nil
+func (c *Controller) ApplyPendingMaintenanceActions(instance *rdsTypes.DBInstance, actions []rdsTypes.PendingMaintenanceAction) error {
+	for idx := range actions {
+		log.Infof("Applying pending maintenance action: '%s' to an instance: '%s'", *actions[idx].Action, *instance.DBInstanceIdentifier)
+		input := &rds.ApplyPendingMaintenanceActionInput{
+			ResourceIdentifier: instance.DBInstanceArn,
+			ApplyAction:        actions[idx].Action,
+			OptInType:          a.String(PENDING_MAINTENANCE_OPT_IN_IMMEDIATE),
+		}
+		_, err := c.rdsClient.ApplyPendingMaintenanceAction(*c.configuration.Context, input)
+		if err != nil {
+			return err
 		}
 	}
 
-	return false, nil
+	duration, err := c.getTimeout(OPERATION_PENDING_MAINTENANCE_APPLY)
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+
+	stopProgressReport := c.startProgressReport(c.rdsClient, rdsTypes.SourceTypeDbInstance, instance.DBInstanceIdentifier)
+	defer stopProgressReport()
+
+	err = c.waitForPendingMaintenanceActions(instance, actions, duration)
+	if err != nil {
+		return err
+	}
+
+	log.Infoln("Waiting for an instance to become available.")
+	waitParams := &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: instance.DBInstanceIdentifier,
+	}
+	waiter := c.newDBInstanceAvailableWaiter()
+
+	return waiter.Wait(*c.configuration.Context, waitParams, duration-time.Since(startTime))
 }
 
-// TODO: add check for urgent maintenance actions which might be applied outside of preferred maintenance windows.
-// See: PendingMaintenanceAction type.
+// The instance stays 'available' until an applied action starts, so the actions have to leave the pending list first.
+func (c *Controller) waitForPendingMaintenanceActions(instance *rdsTypes.DBInstance, actions []rdsTypes.PendingMaintenanceAction, waitTimeout time.Duration) error {
+	startTime := time.Now()
+
+	checkInterval := time.Second * time.Duration(PENDING_MAINTENANCE_CHECK_INTERVAL)
+	if c.waiterDelay > 0 {
+		checkInterval = c.waiterDelay
+	}
+
+	appliedActions := make(map[string]bool)
+	for idx := range actions {
+		appliedActions[*actions[idx].Action] = true
+	}
+
+	for {
+		pendingMaintenanceActions, err := c.describePendingMaintenanceActions(instance)
+		if err != nil {
+			return err
+		}
+
+		remainingActions := []string{}
+		for idx := range pendingMaintenanceActions {
+			if appliedActions[a.ToString(pendingMaintenanceActions[idx].Action)] {
+				remainingActions = append(remainingActions, *pendingMaintenanceActions[idx].Action)
+			}
+		}
+
+		if len(remainingActions) == 0 {
+			return nil
+		}
+
+		log.Debugf("Pending maintenance actions: '%s' have not started yet.", strings.Join(remainingActions, ", "))
+
+		if time.Since(startTime) > waitTimeout {
+			return errors.New(fmt.Sprintf(
+				"Reached a timeout '%s', while waiting for pending maintenance actions: '%s' to start on an instance: '%s'!",
+				waitTimeout.String(),
+				strings.Join(remainingActions, ", "),
+				*instance.DBInstanceIdentifier,
+			))
+		}
+
+		time.Sleep(checkInterval)
+	}
+}
@@ -11,9 +11,12 @@
 package aws
 
 import (
+	"db_relocate/testing/fakeaws"
 	"testing"
 	"time"
 
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -146,3 +149,245 @@ func TestIsInServiceWindow(t *testing.T) {
 		t.Run(test.name, testFunction)
 	}
 }
+
+func TestIsUrgentPendingMaintenanceAction(t *testing.T) {
+	c := &Controller{}
+	deadline := startOfTheDayTestTimestamp.Add(time.Hour * 6)
+
+	tests := []struct {
+		name     string
+		action   rdsTypes.PendingMaintenanceAction
+		expected bool
+	}{
+		{
+			name:     "Action without any apply date is not urgent.",
+			action:   rdsTypes.PendingMaintenanceAction{},
+			expected: false,
+		},
+		{
+			name:     "Action auto applied after the deadline is not urgent.",
+			action:   rdsTypes.PendingMaintenanceAction{AutoAppliedAfterDate: a.Time(deadline.Add(time.Hour))},
+			expected: false,
+		},
+		{
+			name:     "Action auto applied before the deadline is urgent.",
+			action:   rdsTypes.PendingMaintenanceAction{AutoAppliedAfterDate: a.Time(deadline.Add(-time.Hour))},
+			expected: true,
+		},
+		{
+			name: "Action forced before the deadline is urgent.",
+			action: rdsTypes.PendingMaintenanceAction{
+				AutoAppliedAfterDate: a.Time(deadline.Add(time.Hour * 24)),
+				ForcedApplyDate:      a.Time(deadline.Add(-time.Minute)),
+			},
+			expected: true,
+		},
+		{
+			name:     "Action opted in to be applied before the deadline is urgent.",
+			action:   rdsTypes.PendingMaintenanceAction{CurrentApplyDate: a.Time(startOfTheDayTestTimestamp)},
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			result := c.isUrgentPendingMaintenanceAction(&test.action, &deadline)
+			assert.Equal(t, test.expected, result, "received result must match expected result")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestGetServiceWindowOccurrences(t *testing.T) {
+	c := &Controller{}
+
+	// 2000-01-01 is a Saturday.
+	tests := []struct {
+		name              string
+		backupWindow      string
+		maintenanceWindow string
+		from              time.Time
+		to                time.Time
+		expected          []ServiceWindow
+	}{
+		{
+			name:         "Backup window crossing midnight started on the previous day.",
+			backupWindow: "23:30-00:15",
+			from:         startOfTheDayTestTimestamp,
+			to:           startOfTheDayTestTimestamp.Add(time.Hour),
+			expected: []ServiceWindow{
+				{
+					Name:  BACKUP_WINDOW_NAME,
+					Start: startOfTheDayTestTimestamp.Add(-time.Minute * 30),
+					End:   startOfTheDayTestTimestamp.Add(time.Minute * 15),
+				},
+			},
+		},
+		{
+			name:         "Backup window repeats every day.",
+			backupWindow: "03:00-03:30",
+			from:         startOfTheDayTestTimestamp,
+			to:           startOfTheDayTestTimestamp.Add(time.Hour * 28),
+			expected: []ServiceWindow{
+				{
+					Name:  BACKUP_WINDOW_NAME,
+					Start: startOfTheDayTestTimestamp.Add(time.Hour * 3),
+					End:   startOfTheDayTestTimestamp.Add(time.Hour*3 + time.Minute*30),
+				},
+				{
+					Name:  BACKUP_WINDOW_NAME,
+					Start: startOfTheDayTestTimestamp.Add(time.Hour * 27),
+					End:   startOfTheDayTestTimestamp.Add(time.Hour*27 + time.Minute*30),
+				},
+			},
+		},
+		{
+			name:              "Maintenance window crossing the week boundary.",
+			maintenanceWindow: "sat:23:30-sun:00:30",
+			from:              ensOfTheDayTestTimestamp,
+			to:                ensOfTheDayTestTimestamp.Add(time.Hour),
+			expected: []ServiceWindow{
+				{
+					Name:  MAINTENANCE_WINDOW_NAME,
+					Start: startOfTheDayTestTimestamp.Add(time.Hour*23 + time.Minute*30),
+					End:   startOfTheDayTestTimestamp.Add(time.Hour*24 + time.Minute*30),
+				},
+			},
+		},
+		{
+			name:              "Maintenance window ending before it starts wraps over the week boundary.",
+			maintenanceWindow: "sun:00:10-sun:00:00",
+			from:              startOfTheDayTestTimestamp,
+			to:                startOfTheDayTestTimestamp.Add(time.Hour),
+			expected: []ServiceWindow{
+				{
+					Name:  MAINTENANCE_WINDOW_NAME,
+					Start: startOfTheDayTestTimestamp.Add(-time.Hour*24*6 + time.Minute*10),
+					End:   startOfTheDayTestTimestamp.Add(time.Hour * 24),
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			instance := &rdsTypes.DBInstance{}
+			if test.backupWindow != "" {
+				instance.PreferredBackupWindow = a.String(test.backupWindow)
+			}
+			if test.maintenanceWindow != "" {
+				instance.PreferredMaintenanceWindow = a.String(test.maintenanceWindow)
+			}
+
+			serviceWindows, err := c.GetDBInstanceServiceWindows(instance, &test.from, &test.to)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, serviceWindows, "received service windows must match expected ones")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestIsDBInstanceInServiceWindowAcrossBoundaries(t *testing.T) {
+	c := &Controller{}
+
+	tests := []struct {
+		name              string
+		backupWindow      string
+		maintenanceWindow string
+		now               time.Time
+		expected          bool
+	}{
+		{
+			name:         "Backup window started before midnight is still in progress.",
+			backupWindow: "23:30-00:30",
+			now:          startOfTheDayTestTimestamp.Add(time.Minute * 10),
+			expected:     true,
+		},
+		{
+			name:         "Backup window starts shortly after midnight.",
+			backupWindow: "00:30-01:00",
+			now:          ensOfTheDayTestTimestamp,
+			expected:     true,
+		},
+		{
+			name:         "Backup window is on a safe distance.",
+			backupWindow: "12:00-12:30",
+			now:          startOfTheDayTestTimestamp,
+			expected:     false,
+		},
+		{
+			name:              "Maintenance window started on Saturday is still in progress on Sunday.",
+			maintenanceWindow: "sat:23:30-sun:00:30",
+			now:               startOfTheDayTestTimestamp.Add(time.Hour*24 + time.Minute*10),
+			expected:          true,
+		},
+		{
+			name:              "Maintenance window starts shortly after the week boundary.",
+			maintenanceWindow: "sun:00:30-sun:01:00",
+			now:               ensOfTheDayTestTimestamp,
+			expected:          true,
+		},
+		{
+			name:              "Maintenance window is on another day.",
+			maintenanceWindow: "wed:00:30-wed:01:00",
+			now:               ensOfTheDayTestTimestamp,
+			expected:          false,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			var result bool
+			var err error
+			if test.backupWindow != "" {
+				result, err = c.IsDBInstanceInBackupWindow(&rdsTypes.DBInstance{PreferredBackupWindow: a.String(test.backupWindow)}, &test.now)
+			} else {
+				result, err = c.IsDBInstanceInMaintenanceWindow(&rdsTypes.DBInstance{PreferredMaintenanceWindow: a.String(test.maintenanceWindow)}, &test.now)
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result, "received result must match expected result")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestApplyPendingMaintenanceActions(t *testing.T) {
+	tests := []struct {
+		name          string
+		timeout       string
+		expectedError bool
+	}{
+		{
+			name:    "applied action has started before the instance is available",
+			timeout: "1m",
+		},
+		{
+			name:          "applied action has not started within the timeout",
+			timeout:       "1ns",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud()
+			instanceArn := "arn:aws:rds:" + fakeaws.DEFAULT_REGION + ":123456789012:db:" + TEST_INSTANCE_ID
+			cloud.Instances[TEST_INSTANCE_ID].DBInstanceArn = a.String(instanceArn)
+			action := rdsTypes.PendingMaintenanceAction{Action: a.String("system-update")}
+			cloud.PendingMaintenanceActions[instanceArn] = []rdsTypes.PendingMaintenanceAction{action}
+
+			c := setupFakeCloudController(cloud)
+			c.configuration.AWSTimeouts = map[string]string{OPERATION_PENDING_MAINTENANCE_APPLY: test.timeout}
+
+			err := c.ApplyPendingMaintenanceActions(cloud.Instances[TEST_INSTANCE_ID], []rdsTypes.PendingMaintenanceAction{action})
+			if test.expectedError {
+				assert.Error(t, err, "error must be raised")
+			} else {
+				assert.NoError(t, err, "no error must be raised")
+				assert.Empty(t, cloud.PendingMaintenanceActions[instanceArn], "applied action must have started")
+				assert.Equal(t, fakeaws.STATUS_AVAILABLE, *cloud.Instances[TEST_INSTANCE_ID].DBInstanceStatus)
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
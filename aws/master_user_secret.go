@@ -0,0 +1,131 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"db_relocate/log"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Shape of the secret RDS keeps the master user credentials in.
+type masterUserCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Nil if RDS does not manage the password, or the user is not the master user.
+func getMasterUserSecret(masterUsername *string, secret *rdsTypes.MasterUserSecret, user string) *rdsTypes.MasterUserSecret {
+	if secret == nil || a.ToString(masterUsername) != user {
+		return nil
+	}
+
+	return secret
+}
+
+// Members of a cluster have no secret of their own, the cluster one is used.
+func (c *Controller) getDBInstanceMasterUserSecret(client RDSAPI, instance *rdsTypes.DBInstance, user string) (*rdsTypes.MasterUserSecret, error) {
+	if instance.DBClusterIdentifier == nil {
+		return getMasterUserSecret(instance.MasterUsername, instance.MasterUserSecret, user), nil
+	}
+
+	clusters, err := c.describeDBCluster(client, instance.DBClusterIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clusters) == 0 {
+		return nil, errors.New(fmt.Sprintf("Failed to find DB cluster: '%s'!", *instance.DBClusterIdentifier))
+	}
+
+	return getMasterUserSecret(clusters[0].MasterUsername, clusters[0].MasterUserSecret, user), nil
+}
+
+// The secret is read on every call, so a password rotated by RDS is picked up.
+func (c *Controller) readMasterUserPassword(client SecretsManagerAPI, secret *rdsTypes.MasterUserSecret) (string, error) {
+	log.Infof("Reading the master user password managed by RDS from secret: '%s'", *secret.SecretArn)
+	output, err := client.GetSecretValue(*c.configuration.Context, &secretsmanager.GetSecretValueInput{
+		SecretId: secret.SecretArn,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	credentials := masterUserCredentials{}
+	if err := json.Unmarshal([]byte(a.ToString(output.SecretString)), &credentials); err != nil {
+		return "", errors.New(fmt.Sprintf("Secret: '%s' is not a JSON object!", *secret.SecretArn))
+	}
+
+	if credentials.Password == "" {
+		return "", errors.New(fmt.Sprintf("Secret: '%s' has no password!", *secret.SecretArn))
+	}
+	log.AddSensitiveValue(credentials.Password)
+
+	return credentials.Password, nil
+}
+
+// Managed is false if RDS does not manage the password of the user, so the configured one is used.
+func (c *Controller) ReadSourceMasterUserPassword(user string) (string, bool, error) {
+	if c.configuration.Items.Src.InstanceID == "" {
+		return "", false, nil
+	}
+
+	instances, err := c.DescribeDBInstance(&c.configuration.Items.Src.InstanceID)
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(instances) == 0 {
+		return "", false, errors.New(fmt.Sprintf("Failed to find DB instance: '%s'!", c.configuration.Items.Src.InstanceID))
+	}
+
+	secret, err := c.getDBInstanceMasterUserSecret(c.rdsClient, &instances[0], user)
+	if err != nil || secret == nil {
+		return "", false, err
+	}
+
+	password, err := c.readMasterUserPassword(c.smClient, secret)
+	if err != nil {
+		return "", false, err
+	}
+
+	return password, true, nil
+}
+
+// Same as ReadSourceMasterUserPassword, but for the destination instance, or its cluster, in the destination region and account.
+func (c *Controller) ReadDestinationMasterUserPassword(instanceID string, user string) (string, bool, error) {
+	instances, err := c.describeDBInstance(c.dstRDSClient, &instanceID)
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(instances) == 0 {
+		return "", false, errors.New(fmt.Sprintf("Failed to find DB instance: '%s'!", instanceID))
+	}
+
+	secret, err := c.getDBInstanceMasterUserSecret(c.dstRDSClient, &instances[0], user)
+	if err != nil || secret == nil {
+		return "", false, err
+	}
+
+	password, err := c.readMasterUserPassword(c.dstSMClient, secret)
+	if err != nil {
+		return "", false, err
+	}
+
+	return password, true, nil
+}
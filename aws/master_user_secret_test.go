@@ -0,0 +1,148 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/testing/fakeaws"
+	"fmt"
+	"testing"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupMasterUserSecret(cloud *fakeaws.Cloud, password string) {
+	cloud.Instances[TEST_INSTANCE_ID].MasterUsername = a.String("postgres")
+	cloud.Instances[TEST_INSTANCE_ID].MasterUserSecret = &rdsTypes.MasterUserSecret{
+		SecretArn:    a.String(TEST_MASTER_USER_SECRET_ARN),
+		KmsKeyId:     a.String(TEST_KMS_KEY_ARN),
+		SecretStatus: a.String("active"),
+	}
+	cloud.Secrets[TEST_MASTER_USER_SECRET_ARN] = fmt.Sprintf(`{"username":"postgres","password":"%s"}`, password)
+}
+
+func TestReadSourceMasterUserPassword(t *testing.T) {
+	tests := []struct {
+		name             string
+		user             string
+		managed          bool
+		expectedManaged  bool
+		expectedPassword string
+	}{
+		{
+			name:             "master user of an instance with a managed password",
+			user:             "postgres",
+			managed:          true,
+			expectedManaged:  true,
+			expectedPassword: "initial-password",
+		},
+		{
+			name:    "another user of an instance with a managed password",
+			user:    "ops",
+			managed: true,
+		},
+		{
+			name: "master user of an instance without a managed password",
+			user: "postgres",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud()
+			setupMasterUserSecret(cloud, "initial-password")
+			if !test.managed {
+				cloud.Instances[TEST_INSTANCE_ID].MasterUserSecret = nil
+			}
+			c := setupFakeCloudController(cloud)
+
+			password, managed, err := c.ReadSourceMasterUserPassword(test.user)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedManaged, managed)
+			assert.Equal(t, test.expectedPassword, password)
+			if !test.expectedManaged {
+				assert.NotContains(t, cloud.Calls(), "GetSecretValue")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestReadSourceMasterUserPasswordAfterRotation(t *testing.T) {
+	cloud := setupFakeCloud()
+	setupMasterUserSecret(cloud, "initial-password")
+	c := setupFakeCloudController(cloud)
+
+	password, _, err := c.ReadSourceMasterUserPassword("postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "initial-password", password)
+
+	cloud.Secrets[TEST_MASTER_USER_SECRET_ARN] = `{"username":"postgres","password":"rotated-password"}`
+
+	password, _, err = c.ReadSourceMasterUserPassword("postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated-password", password, "the secret must be read again")
+}
+
+func TestReadDestinationMasterUserPassword(t *testing.T) {
+	tests := []struct {
+		name             string
+		instanceID       string
+		expectedManaged  bool
+		expectedPassword string
+	}{
+		{
+			name:             "instance",
+			instanceID:       TEST_INSTANCE_ID,
+			expectedManaged:  true,
+			expectedPassword: "instance-password",
+		},
+		{
+			name:             "member of a cluster",
+			instanceID:       "test-cluster-instance",
+			expectedManaged:  true,
+			expectedPassword: "cluster-password",
+		},
+		{
+			name:       "instance without a managed password",
+			instanceID: "test-unmanaged-db",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud()
+			setupMasterUserSecret(cloud, "instance-password")
+			cloud.Clusters["test-cluster"] = &rdsTypes.DBCluster{
+				DBClusterIdentifier: a.String("test-cluster"),
+				MasterUsername:      a.String("postgres"),
+				MasterUserSecret:    &rdsTypes.MasterUserSecret{SecretArn: a.String("test-cluster-secret")},
+			}
+			cloud.Instances["test-cluster-instance"] = &rdsTypes.DBInstance{
+				DBInstanceIdentifier: a.String("test-cluster-instance"),
+				DBClusterIdentifier:  a.String("test-cluster"),
+			}
+			cloud.Instances["test-unmanaged-db"] = &rdsTypes.DBInstance{
+				DBInstanceIdentifier: a.String("test-unmanaged-db"),
+				MasterUsername:       a.String("postgres"),
+			}
+			cloud.Secrets["test-cluster-secret"] = `{"username":"postgres","password":"cluster-password"}`
+			c := setupFakeCloudController(cloud)
+
+			password, managed, err := c.ReadDestinationMasterUserPassword(test.instanceID, "postgres")
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedManaged, managed)
+			assert.Equal(t, test.expectedPassword, password)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+const (
+	RELOCATION_PHASE_METRIC          string = "RelocationPhase"
+	PHASE_ELAPSED_TIME_METRIC        string = "PhaseElapsedTime"
+	REPLICATION_BYTE_LAG_METRIC      string = "ReplicationByteLag"
+	REPLICATION_TIME_LAG_METRIC      string = "ReplicationTimeLag"
+	RETAINED_WAL_METRIC              string = "RetainedWAL"
+	HEARTBEATS_SENT_METRIC           string = "HeartbeatsSent"
+	HEARTBEATS_RECEIVED_METRIC       string = "HeartbeatsReceived"
+	HEARTBEATS_MISSING_METRIC        string = "HeartbeatsMissing"
+	SRC_DB_INSTANCE_METRIC_DIMENSION string = "SourceDBInstanceIdentifier"
+	DST_DB_INSTANCE_METRIC_DIMENSION string = "DestinationDBInstanceIdentifier"
+	PHASE_METRIC_DIMENSION           string = "Phase"
+)
+
+// A snapshot of the relocation progress published as custom metrics.
+type RelocationMetrics struct {
+	Phase            int
+	PhaseName        string
+	PhaseElapsedTime time.Duration
+	// Heartbeats are only counted while the health check table exists.
+	HeartbeatsSent     *int
+	HeartbeatsReceived *int
+	// Replication lag is only known while the replication slot exists.
+	ReplicationByteLag *int64
+	ReplicationTimeLag *float64
+	RetainedWAL        *int64
+}
+
+func (c *Controller) MetricsEnabled() bool {
+	return c.configuration.AWSMetrics.Enabled && c.configuration.AWSMetrics.Namespace != ""
+}
+
+func (c *Controller) buildRelocationMetricDimensions() []cwTypes.Dimension {
+	srcInstanceID := c.configuration.Items.Src.InstanceID
+
+	return []cwTypes.Dimension{
+		{
+			Name:  a.String(SRC_DB_INSTANCE_METRIC_DIMENSION),
+			Value: a.String(srcInstanceID),
+		},
+		{
+			Name:  a.String(DST_DB_INSTANCE_METRIC_DIMENSION),
+			Value: a.String(buildDstDBInstanceIdentifier(c.configuration.Items, srcInstanceID)),
+		},
+	}
+}
+
+func buildMetricDatum(metricName string, dimensions []cwTypes.Dimension, value float64, unit cwTypes.StandardUnit, timestamp *time.Time) cwTypes.MetricDatum {
+	return cwTypes.MetricDatum{
+		MetricName: a.String(metricName),
+		Dimensions: dimensions,
+		Value:      a.Float64(value),
+		Unit:       unit,
+		Timestamp:  timestamp,
+	}
+}
+
+func (c *Controller) buildRelocationMetricData(metrics *RelocationMetrics, now *time.Time) []cwTypes.MetricDatum {
+	dimensions := c.buildRelocationMetricDimensions()
+	// The elapsed time is kept apart per phase, so a stalled phase can be told from a slow one.
+	phaseDimensions := append([]cwTypes.Dimension{
+		{
+			Name:  a.String(PHASE_METRIC_DIMENSION),
+			Value: a.String(metrics.PhaseName),
+		},
+	}, dimensions...)
+
+	metricData := []cwTypes.MetricDatum{
+		buildMetricDatum(RELOCATION_PHASE_METRIC, dimensions, float64(metrics.Phase), cwTypes.StandardUnitNone, now),
+		buildMetricDatum(PHASE_ELAPSED_TIME_METRIC, phaseDimensions, metrics.PhaseElapsedTime.Seconds(), cwTypes.StandardUnitSeconds, now),
+	}
+
+	if metrics.HeartbeatsSent != nil && metrics.HeartbeatsReceived != nil {
+		missing := *metrics.HeartbeatsSent - *metrics.HeartbeatsReceived
+		if missing < 0 {
+			missing = 0
+		}
+
+		metricData = append(metricData,
+			buildMetricDatum(HEARTBEATS_SENT_METRIC, dimensions, float64(*metrics.HeartbeatsSent), cwTypes.StandardUnitCount, now),
+			buildMetricDatum(HEARTBEATS_RECEIVED_METRIC, dimensions, float64(*metrics.HeartbeatsReceived), cwTypes.StandardUnitCount, now),
+			buildMetricDatum(HEARTBEATS_MISSING_METRIC, dimensions, float64(missing), cwTypes.StandardUnitCount, now),
+		)
+	}
+
+	if metrics.ReplicationByteLag != nil {
+		metricData = append(metricData, buildMetricDatum(REPLICATION_BYTE_LAG_METRIC, dimensions, float64(*metrics.ReplicationByteLag), cwTypes.StandardUnitBytes, now))
+	}
+
+	if metrics.ReplicationTimeLag != nil {
+		metricData = append(metricData, buildMetricDatum(REPLICATION_TIME_LAG_METRIC, dimensions, *metrics.ReplicationTimeLag, cwTypes.StandardUnitSeconds, now))
+	}
+
+	if metrics.RetainedWAL != nil {
+		metricData = append(metricData, buildMetricDatum(RETAINED_WAL_METRIC, dimensions, float64(*metrics.RetainedWAL), cwTypes.StandardUnitBytes, now))
+	}
+
+	return metricData
+}
+
+// Metrics are published in the region of the source instance, next to its own RDS metrics.
+func (c *Controller) PublishRelocationMetrics(metrics *RelocationMetrics) error {
+	now := time.Now().UTC()
+
+	input := &cloudwatch.PutMetricDataInput{
+		Namespace:  a.String(c.configuration.AWSMetrics.Namespace),
+		MetricData: c.buildRelocationMetricData(metrics, &now),
+	}
+
+	_, err := c.cwClient.PutMetricData(*c.configuration.Context, input)
+
+	return err
+}
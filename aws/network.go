@@ -25,7 +25,7 @@ func (c *Controller) getVPCSecurityGroupsByID(securityGroupIDs []string) ([]ec2T
 		GroupIds: securityGroupIDs,
 	}
 
-	paginator := ec2.NewDescribeSecurityGroupsPaginator(c.ec2Client, input)
+	paginator := ec2.NewDescribeSecurityGroupsPaginator(c.dstEC2Client, input)
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -40,6 +40,10 @@ func (c *Controller) getVPCSecurityGroupsByID(securityGroupIDs []string) ([]ec2T
 
 func (c *Controller) IsValidSecurityGroups(instance *rdsTypes.DBInstance) (bool, error) {
 	if len(c.configuration.Items.Upgrade.SecurityGroupIDs) == 0 {
+		if c.IsCrossRegion() || c.IsCrossAccount() {
+			log.Errorf("Security groups must be provided when relocating to another region or account!")
+			return false, nil
+		}
 		if *instance.DBSubnetGroup.VpcId != c.configuration.Items.Upgrade.VPCID {
 			// If not specified, security groups will be copied from the existing instance.
 			// We need to make sure they belong to the correct VPC.
@@ -81,7 +85,7 @@ func (c *Controller) getVPCByID(vpcID *string) ([]ec2Types.Vpc, error) {
 		VpcIds: []string{*vpcID},
 	}
 
-	paginator := ec2.NewDescribeVpcsPaginator(c.ec2Client, input)
+	paginator := ec2.NewDescribeVpcsPaginator(c.dstEC2Client, input)
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -96,6 +100,10 @@ func (c *Controller) getVPCByID(vpcID *string) ([]ec2Types.Vpc, error) {
 
 func (c *Controller) IsValidVPC(instance *rdsTypes.DBInstance, vpcID *string) (bool, error) {
 	if *vpcID == "" {
+		if c.IsCrossRegion() || c.IsCrossAccount() {
+			log.Errorf("VPC must be provided when relocating to another region or account!")
+			return false, nil
+		}
 		c.configuration.Items.Upgrade.VPCID = *instance.DBSubnetGroup.VpcId
 		return true, nil
 	}
@@ -0,0 +1,315 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	PARAMETER_SOURCE_USER           string = "user"
+	PARAMETER_APPLY_TYPE_STATIC     string = "static"
+	MODIFY_DB_PARAMETERS_BATCH_SIZE int    = 20
+)
+
+// Allowed range of a numeric parameter like '0-2147483647' or '-1-2147483647'.
+var parameterRangeRegexp = regexp.MustCompile(`^(-?[\d.]+)-(-?[\d.]+)$`)
+
+// Parameters which are required by the destination instance regardless of the source settings.
+var requiredTargetDBParameters = []rdsTypes.Parameter{
+	{
+		ParameterName:  a.String("track_commit_timestamp"),
+		ParameterValue: a.String("1"),
+		ApplyMethod:    rdsTypes.ApplyMethodPendingReboot,
+	},
+}
+
+// Reverse replication decodes the WAL of the destination instance, so it needs logical replication enabled as well.
+func (c *Controller) getRequiredTargetDBParameters() []rdsTypes.Parameter {
+	parameters := append([]rdsTypes.Parameter{}, requiredTargetDBParameters...)
+
+	if c.configuration.Items.Upgrade.ReverseReplication {
+		parameters = append(parameters, rdsTypes.Parameter{
+			ParameterName:  a.String("rds.logical_replication"),
+			ParameterValue: a.String("1"),
+			ApplyMethod:    rdsTypes.ApplyMethodPendingReboot,
+		})
+	}
+
+	return parameters
+}
+
+// Allowed values are either a comma separated list of values, ranges or both, e.g: '0-2147483647' or 'off,on'.
+// List parameters, like 'shared_preload_libraries', must have every element allowed.
+// Formulas, e.g: '{DBInstanceClassMemory/32768}', can not be validated and are always allowed.
+func isAllowedParameterValue(value string, allowedValues *string) bool {
+	if allowedValues == nil || *allowedValues == "" || strings.HasPrefix(value, "{") {
+		return true
+	}
+
+	allowedItems := strings.Split(*allowedValues, ",")
+
+	for _, valueItem := range strings.Split(value, ",") {
+		valueItem = strings.TrimSpace(valueItem)
+		allowed := false
+
+		for _, allowedItem := range allowedItems {
+			allowedItem = strings.TrimSpace(allowedItem)
+
+			if strings.EqualFold(valueItem, allowedItem) {
+				allowed = true
+				break
+			}
+
+			bounds := parameterRangeRegexp.FindStringSubmatch(allowedItem)
+			if len(bounds) == 0 {
+				continue
+			}
+
+			number, err := strconv.ParseFloat(valueItem, 64)
+			if err != nil {
+				continue
+			}
+			low, lowErr := strconv.ParseFloat(bounds[1], 64)
+			high, highErr := strconv.ParseFloat(bounds[2], 64)
+			if lowErr == nil && highErr == nil && number >= low && number <= high {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Controller) getUserDBParameters(parameterGroupName *string) ([]rdsTypes.Parameter, error) {
+	parameters := []rdsTypes.Parameter{}
+
+	input := &rds.DescribeDBParametersInput{
+		DBParameterGroupName: parameterGroupName,
+		Source:               a.String(PARAMETER_SOURCE_USER),
+		MaxRecords:           a.Int32(100),
+	}
+
+	paginator := rds.NewDescribeDBParametersPaginator(c.rdsClient, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, output.Parameters...)
+	}
+
+	return parameters, nil
+}
+
+func (c *Controller) getEngineDefaultDBParameters(groupFamily *string) (map[string]rdsTypes.Parameter, error) {
+	parameters := make(map[string]rdsTypes.Parameter)
+
+	input := &rds.DescribeEngineDefaultParametersInput{
+		DBParameterGroupFamily: groupFamily,
+		MaxRecords:             a.Int32(100),
+	}
+
+	paginator := rds.NewDescribeEngineDefaultParametersPaginator(c.dstRDSClient, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+		for idx := range output.EngineDefaults.Parameters {
+			parameters[*output.EngineDefaults.Parameters[idx].ParameterName] = output.EngineDefaults.Parameters[idx]
+		}
+	}
+
+	return parameters, nil
+}
+
+// Only the parameters which still exist and accept the same value in the target family are carried over.
+// Everything else is reported, so it can be reviewed by hand.
+func (c *Controller) buildTargetDBParameters(srcParameters []rdsTypes.Parameter, targetDefaults map[string]rdsTypes.Parameter) []rdsTypes.Parameter {
+	parameters := make(map[string]rdsTypes.Parameter)
+
+	for idx := range srcParameters {
+		name := *srcParameters[idx].ParameterName
+		value := a.ToString(srcParameters[idx].ParameterValue)
+
+		targetDefault, ok := targetDefaults[name]
+		if !ok {
+			log.Warnf("Parameter: '%s' does not exist in the new family. Skipping it.", name)
+			continue
+		}
+
+		if !targetDefault.IsModifiable {
+			log.Warnf("Parameter: '%s' is not modifiable in the new family. Skipping it.", name)
+			continue
+		}
+
+		if a.ToString(srcParameters[idx].AllowedValues) != a.ToString(targetDefault.AllowedValues) {
+			log.Warnf(
+				"Allowed values of parameter: '%s' have changed from: '%s' to: '%s'.",
+				name,
+				a.ToString(srcParameters[idx].AllowedValues),
+				a.ToString(targetDefault.AllowedValues),
+			)
+		}
+
+		if !isAllowedParameterValue(value, targetDefault.AllowedValues) {
+			log.Warnf(
+				"Value: '%s' of parameter: '%s' is not allowed in the new family: '%s'. Skipping it.",
+				value,
+				name,
+				a.ToString(targetDefault.AllowedValues),
+			)
+			continue
+		}
+
+		applyMethod := rdsTypes.ApplyMethodImmediate
+		if a.ToString(targetDefault.ApplyType) == PARAMETER_APPLY_TYPE_STATIC {
+			applyMethod = rdsTypes.ApplyMethodPendingReboot
+		}
+
+		parameters[name] = rdsTypes.Parameter{
+			ParameterName:  srcParameters[idx].ParameterName,
+			ParameterValue: srcParameters[idx].ParameterValue,
+			ApplyMethod:    applyMethod,
+		}
+	}
+
+	for _, parameter := range c.getRequiredTargetDBParameters() {
+		parameters[*parameter.ParameterName] = parameter
+	}
+
+	// Sorted, so the batches are deterministic.
+	targetParameters := []rdsTypes.Parameter{}
+	for _, parameter := range parameters {
+		targetParameters = append(targetParameters, parameter)
+	}
+	sort.Slice(targetParameters, func(i, j int) bool {
+		return *targetParameters[i].ParameterName < *targetParameters[j].ParameterName
+	})
+
+	return targetParameters
+}
+
+func (c *Controller) ensureDBParameterGroup(parameterGroupName *string, groupFamily *string, srcParameterGroupName *string) error {
+	parameterGroups, err := c.getDBParameterGroup(parameterGroupName)
+	if err != nil {
+		var apiError *rdsTypes.DBParameterGroupNotFoundFault
+		if !errors.As(err, &apiError) {
+			return err
+		}
+	}
+
+	if len(parameterGroups) > 0 {
+		if *parameterGroups[0].DBParameterGroupFamily != *groupFamily {
+			return errors.New(fmt.Sprintf(
+				"Parameter group: '%s' already exists, but belongs to an incorrect group family: '%s'!",
+				*parameterGroupName,
+				*parameterGroups[0].DBParameterGroupFamily,
+			))
+		}
+
+		log.Infof("Parameter group: '%s' already exists. Updating its parameters.", *parameterGroupName)
+		return nil
+	}
+
+	log.Infof("Creating parameter group: '%s' in family: '%s'", *parameterGroupName, *groupFamily)
+
+	input := &rds.CreateDBParameterGroupInput{
+		DBParameterGroupName:   parameterGroupName,
+		DBParameterGroupFamily: groupFamily,
+		Description:            a.String(fmt.Sprintf("Generated from '%s' by db_relocate", *srcParameterGroupName)),
+	}
+	_, err = c.dstRDSClient.CreateDBParameterGroup(*c.configuration.Context, input)
+
+	return err
+}
+
+// ModifyDBParameterGroup accepts a limited number of parameters per call.
+func (c *Controller) modifyDBParameterGroup(parameterGroupName *string, parameters []rdsTypes.Parameter) error {
+	for start := 0; start < len(parameters); start += MODIFY_DB_PARAMETERS_BATCH_SIZE {
+		end := start + MODIFY_DB_PARAMETERS_BATCH_SIZE
+		if end > len(parameters) {
+			end = len(parameters)
+		}
+
+		input := &rds.ModifyDBParameterGroupInput{
+			DBParameterGroupName: parameterGroupName,
+			Parameters:           parameters[start:end],
+		}
+		_, err := c.dstRDSClient.ModifyDBParameterGroup(*c.configuration.Context, input)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) buildTargetDBParameterGroupName(instance *rdsTypes.DBInstance, groupFamily *string) string {
+	return fmt.Sprintf("%s-%s", *instance.DBInstanceIdentifier, *groupFamily)
+}
+
+// Creates a parameter group in the target family with all the custom parameters of the source instance.
+// The generated name is stored in the configuration, so the restored instance picks it up.
+func (c *Controller) GenerateTargetDBParameterGroup(instance *rdsTypes.DBInstance) error {
+	srcParameterGroupName := instance.DBParameterGroups[0].DBParameterGroupName
+	groupFamily := c.engineVersionToGroupFamily(&c.configuration.Items.Upgrade.EngineVersion)
+	parameterGroupName := c.buildTargetDBParameterGroupName(instance, groupFamily)
+
+	srcParameters, err := c.getUserDBParameters(srcParameterGroupName)
+	if err != nil {
+		return err
+	}
+
+	targetDefaults, err := c.getEngineDefaultDBParameters(groupFamily)
+	if err != nil {
+		return err
+	}
+
+	targetParameters := c.buildTargetDBParameters(srcParameters, targetDefaults)
+
+	err = c.ensureDBParameterGroup(&parameterGroupName, groupFamily, srcParameterGroupName)
+	if err != nil {
+		return err
+	}
+
+	err = c.modifyDBParameterGroup(&parameterGroupName, targetParameters)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"Parameter group: '%s' has been generated with %d parameters from: '%s'",
+		parameterGroupName,
+		len(targetParameters),
+		*srcParameterGroupName,
+	)
+	c.configuration.Items.Upgrade.ParameterGroup = parameterGroupName
+
+	return nil
+}
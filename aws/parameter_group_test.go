@@ -0,0 +1,141 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/types"
+	"testing"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAllowedParameterValue(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		allowedValues *string
+		expected      bool
+	}{
+		{
+			name:          "No allowed values are defined.",
+			value:         "anything",
+			allowedValues: nil,
+			expected:      true,
+		},
+		{
+			name:          "Value is within the range.",
+			value:         "8192",
+			allowedValues: a.String("64-2147483647"),
+			expected:      true,
+		},
+		{
+			name:          "Value is outside of the range.",
+			value:         "32",
+			allowedValues: a.String("64-2147483647"),
+			expected:      false,
+		},
+		{
+			name:          "Value is within a range with a negative lower bound.",
+			value:         "-1",
+			allowedValues: a.String("-1-2147483647"),
+			expected:      true,
+		},
+		{
+			name:          "Value is one of the listed values.",
+			value:         "on",
+			allowedValues: a.String("off,on"),
+			expected:      true,
+		},
+		{
+			name:          "Value is not one of the listed values.",
+			value:         "maybe",
+			allowedValues: a.String("off,on"),
+			expected:      false,
+		},
+		{
+			name:          "Every element of a list value is allowed.",
+			value:         "pg_stat_statements,pg_hint_plan",
+			allowedValues: a.String("auto_explain,pg_hint_plan,pg_stat_statements"),
+			expected:      true,
+		},
+		{
+			name:          "One element of a list value is not allowed.",
+			value:         "pg_stat_statements,timescaledb",
+			allowedValues: a.String("auto_explain,pg_hint_plan,pg_stat_statements"),
+			expected:      false,
+		},
+		{
+			name:          "Formula values are always allowed.",
+			value:         "{DBInstanceClassMemory/32768}",
+			allowedValues: a.String("6-8388607"),
+			expected:      true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			allowed := isAllowedParameterValue(test.value, test.allowedValues)
+			assert.Equal(t, test.expected, allowed)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestBuildTargetDBParameters(t *testing.T) {
+	c := &Controller{configuration: &types.Configuration{Items: &types.Items{Upgrade: &types.UpgradeDetails{}}}}
+
+	srcParameters := []rdsTypes.Parameter{
+		{ParameterName: a.String("work_mem"), ParameterValue: a.String("8192"), AllowedValues: a.String("64-2147483647")},
+		{ParameterName: a.String("removed_parameter"), ParameterValue: a.String("1")},
+		{ParameterName: a.String("max_connections"), ParameterValue: a.String("1"), AllowedValues: a.String("1-8388607")},
+		{ParameterName: a.String("rds.force_ssl"), ParameterValue: a.String("1"), AllowedValues: a.String("0,1")},
+	}
+	targetDefaults := map[string]rdsTypes.Parameter{
+		"work_mem": {
+			ParameterName: a.String("work_mem"),
+			AllowedValues: a.String("64-2147483647"),
+			ApplyType:     a.String("dynamic"),
+			IsModifiable:  true,
+		},
+		"max_connections": {
+			ParameterName: a.String("max_connections"),
+			AllowedValues: a.String("6-8388607"),
+			ApplyType:     a.String("static"),
+			IsModifiable:  true,
+		},
+		"rds.force_ssl": {
+			ParameterName: a.String("rds.force_ssl"),
+			AllowedValues: a.String("0,1"),
+			ApplyType:     a.String("dynamic"),
+			IsModifiable:  false,
+		},
+	}
+
+	expected := []rdsTypes.Parameter{
+		{ParameterName: a.String("track_commit_timestamp"), ParameterValue: a.String("1"), ApplyMethod: rdsTypes.ApplyMethodPendingReboot},
+		{ParameterName: a.String("work_mem"), ParameterValue: a.String("8192"), ApplyMethod: rdsTypes.ApplyMethodImmediate},
+	}
+
+	parameters := c.buildTargetDBParameters(srcParameters, targetDefaults)
+	assert.Equal(t, expected, parameters)
+
+	// Reverse replication needs logical replication on the new instance as well.
+	c.configuration.Items.Upgrade.ReverseReplication = true
+	expected = append(
+		[]rdsTypes.Parameter{{ParameterName: a.String("rds.logical_replication"), ParameterValue: a.String("1"), ApplyMethod: rdsTypes.ApplyMethodPendingReboot}},
+		expected...,
+	)
+
+	parameters = c.buildTargetDBParameters(srcParameters, targetDefaults)
+	assert.Equal(t, expected, parameters)
+}
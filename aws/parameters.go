@@ -28,7 +28,7 @@ const (
 	DEFAULT_DB_PARAMETER_GROUP_NAME string = "default.postgres"
 )
 
-func (c *Controller) getCurrentDBParameters(parameterGroupName *string) (map[string]*rdsTypes.Parameter, error) {
+func (c *Controller) getCurrentDBParameters(client RDSAPI, parameterGroupName *string) (map[string]*rdsTypes.Parameter, error) {
 	parameters := make(map[string]*rdsTypes.Parameter)
 
 	input := &rds.DescribeDBParametersInput{
@@ -36,26 +36,30 @@ func (c *Controller) getCurrentDBParameters(parameterGroupName *string) (map[str
 		MaxRecords:           a.Int32(100),
 	}
 
-	paginator := rds.NewDescribeDBParametersPaginator(c.rdsClient, input)
+	paginator := rds.NewDescribeDBParametersPaginator(client, input)
 	for paginator.HasMorePages() {
 		parameterGroup, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
 			return nil, err
 		}
-		for idx := range parameterGroup.Parameters {
-			if parameterGroup.Parameters[idx].IsModifiable {
-				if _, ok := parameters[*parameterGroup.Parameters[idx].ParameterName]; !ok {
-					if parameterGroup.Parameters[idx].ParameterValue != nil {
-						parameters[*parameterGroup.Parameters[idx].ParameterName] = &parameterGroup.Parameters[idx]
-					} else {
-						parameters[*parameterGroup.Parameters[idx].ParameterName] = &rdsTypes.Parameter{ParameterValue: a.String("nil")}
-					}
+		addModifiableDBParameters(parameters, parameterGroup.Parameters)
+	}
+
+	return parameters, nil
+}
+
+func addModifiableDBParameters(parameters map[string]*rdsTypes.Parameter, pageParameters []rdsTypes.Parameter) {
+	for idx := range pageParameters {
+		if pageParameters[idx].IsModifiable {
+			if _, ok := parameters[*pageParameters[idx].ParameterName]; !ok {
+				if pageParameters[idx].ParameterValue != nil {
+					parameters[*pageParameters[idx].ParameterName] = &pageParameters[idx]
+				} else {
+					parameters[*pageParameters[idx].ParameterName] = &rdsTypes.Parameter{ParameterValue: a.String("nil")}
 				}
 			}
 		}
 	}
-
-	return parameters, nil
 }
 
 func (c *Controller) diffDBParameters(existingParameters map[string]*rdsTypes.Parameter, desiredParameters map[string]*rdsTypes.Parameter) map[string]*rdsTypes.Parameter {
@@ -79,7 +83,9 @@ func (c *Controller) waitForDBParameterGroupUpdate(instance *rdsTypes.DBInstance
 	waitTimeout := time.Minute * 15
 	checkInterval := time.Second * 30
 
-	instances, err := c.DescribeDBInstance(instance.DBInstanceIdentifier)
+	client := c.getRDSClientForInstance(instance)
+
+	instances, err := c.describeDBInstance(client, instance.DBInstanceIdentifier)
 	if err != nil {
 		return err
 	}
@@ -96,7 +102,7 @@ func (c *Controller) waitForDBParameterGroupUpdate(instance *rdsTypes.DBInstance
 
 		time.Sleep(checkInterval)
 
-		instances, err = c.DescribeDBInstance(instance.DBInstanceIdentifier)
+		instances, err = c.describeDBInstance(client, instance.DBInstanceIdentifier)
 		if err != nil {
 			return err
 		}
@@ -122,7 +128,7 @@ func (c *Controller) addDBParameters(instance *rdsTypes.DBInstance, dbParameters
 		Parameters:           parameters,
 	}
 
-	_, err := c.rdsClient.ModifyDBParameterGroup(*c.configuration.Context, input)
+	_, err := c.getRDSClientForInstance(instance).ModifyDBParameterGroup(*c.configuration.Context, input)
 	if err != nil {
 		return err
 	}
@@ -144,7 +150,7 @@ func (c *Controller) getDBParameterGroup(parameterGroupName *string) ([]rdsTypes
 		DBParameterGroupName: parameterGroupName,
 	}
 
-	output, err := c.rdsClient.DescribeDBParameterGroups(*c.configuration.Context, input)
+	output, err := c.dstRDSClient.DescribeDBParameterGroups(*c.configuration.Context, input)
 	if err != nil {
 		return nil, err
 	}
@@ -154,7 +160,7 @@ func (c *Controller) getDBParameterGroup(parameterGroupName *string) ([]rdsTypes
 
 func (c *Controller) engineVersionToGroupFamily(engineVersion *string) *string {
 	majorVersion := strings.Split(*engineVersion, ".")[0]
-	groupFamily := fmt.Sprintf("postgres%s", majorVersion)
+	groupFamily := fmt.Sprintf("%s%s", c.GetTargetEngine(), majorVersion)
 
 	return &groupFamily
 }
@@ -192,9 +198,16 @@ func (c *Controller) IsValidDBParameterGroup(parameterGroupName *string, engineV
 }
 
 func (c *Controller) EnsureParameters(instance *rdsTypes.DBInstance, desiredParameters map[string]*rdsTypes.Parameter) error {
+	if instance.DBClusterIdentifier != nil {
+		return c.ensureDBClusterParameters(instance, desiredParameters)
+	}
+
 	rebootRequired := c.isRebootRequired(instance)
 
-	existingParameters, err := c.getCurrentDBParameters(instance.DBParameterGroups[0].DBParameterGroupName)
+	existingParameters, err := c.getCurrentDBParameters(
+		c.getRDSClientForInstance(instance),
+		instance.DBParameterGroups[0].DBParameterGroupName,
+	)
 	if err != nil {
 		return err
 	}
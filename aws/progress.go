@@ -0,0 +1,157 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"time"
+)
+
+// Reports the progress of a resource that is being waited for: its status,
+// the percentage done for snapshots and the RDS events emitted since the wait has begun.
+type progressReporter struct {
+	controller  *Controller
+	client      RDSAPI
+	sourceType  rdsTypes.SourceType
+	identifier  *string
+	status      string
+	progress    int32
+	eventsSince time.Time
+	ticker      *time.Ticker
+	doneChannel chan bool
+}
+
+// Returns a function that stops the reporting. It does nothing if the progress interval is not set.
+func (c *Controller) startProgressReport(client RDSAPI, sourceType rdsTypes.SourceType, identifier *string) func() {
+	if c.configuration.AWSProgressInterval <= 0 {
+		return func() {}
+	}
+
+	reporter := &progressReporter{
+		controller:  c,
+		client:      client,
+		sourceType:  sourceType,
+		identifier:  identifier,
+		progress:    -1,
+		eventsSince: time.Now().UTC(),
+		ticker:      time.NewTicker(c.configuration.AWSProgressInterval),
+		doneChannel: make(chan bool),
+	}
+	reporter.report()
+
+	go func() {
+		for {
+			select {
+			case <-reporter.doneChannel:
+				return
+			case <-reporter.ticker.C:
+				reporter.report()
+			}
+		}
+	}()
+
+	return reporter.stop
+}
+
+func (r *progressReporter) stop() {
+	r.ticker.Stop()
+	r.doneChannel <- true
+}
+
+// Failing to report the progress never fails the wait itself.
+func (r *progressReporter) report() {
+	err := r.reportStatus()
+	if err != nil {
+		log.Debugf("Failed to describe: '%s'. Received an error: '%s'", *r.identifier, err)
+	}
+
+	err = r.reportEvents()
+	if err != nil {
+		log.Debugf("Failed to describe events of: '%s'. Received an error: '%s'", *r.identifier, err)
+	}
+}
+
+func (r *progressReporter) reportStatus() error {
+	context := *r.controller.configuration.Context
+	status := ""
+	progress := int32(-1)
+
+	switch r.sourceType {
+	case rdsTypes.SourceTypeDbSnapshot:
+		output, err := r.client.DescribeDBSnapshots(context, &rds.DescribeDBSnapshotsInput{DBSnapshotIdentifier: r.identifier})
+		if err != nil {
+			return err
+		}
+		if len(output.DBSnapshots) > 0 {
+			status = a.ToString(output.DBSnapshots[0].Status)
+			progress = output.DBSnapshots[0].PercentProgress
+		}
+	case rdsTypes.SourceTypeDbCluster:
+		output, err := r.client.DescribeDBClusters(context, &rds.DescribeDBClustersInput{DBClusterIdentifier: r.identifier})
+		if err != nil {
+			return err
+		}
+		if len(output.DBClusters) > 0 {
+			status = a.ToString(output.DBClusters[0].Status)
+		}
+	default:
+		output, err := r.client.DescribeDBInstances(context, &rds.DescribeDBInstancesInput{DBInstanceIdentifier: r.identifier})
+		if err != nil {
+			return err
+		}
+		if len(output.DBInstances) > 0 {
+			status = a.ToString(output.DBInstances[0].DBInstanceStatus)
+		}
+	}
+
+	if status != r.status {
+		log.Infof("Status of %s: '%s' is '%s'", r.sourceType, *r.identifier, status)
+		r.status = status
+	}
+
+	if r.sourceType == rdsTypes.SourceTypeDbSnapshot && progress != r.progress {
+		log.Infof("Progress of %s: '%s' is %d%%", r.sourceType, *r.identifier, progress)
+		r.progress = progress
+	}
+
+	return nil
+}
+
+func (r *progressReporter) reportEvents() error {
+	input := &rds.DescribeEventsInput{
+		SourceIdentifier: r.identifier,
+		SourceType:       r.sourceType,
+		StartTime:        a.Time(r.eventsSince),
+	}
+
+	paginator := rds.NewDescribeEventsPaginator(r.client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*r.controller.configuration.Context)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range output.Events {
+			if event.Date == nil || !event.Date.After(r.eventsSince) {
+				continue
+			}
+			log.Infof("Event of %s: '%s': %s", r.sourceType, *r.identifier, a.ToString(event.Message))
+			r.eventsSince = *event.Date
+		}
+	}
+
+	return nil
+}
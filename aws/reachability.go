@@ -0,0 +1,417 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+)
+
+const (
+	ALL_PROTOCOLS string = "-1"
+	TCP_PROTOCOL  string = "tcp"
+	// Network ACLs name the protocols by their number.
+	TCP_PROTOCOL_NUMBER string = "6"
+	// Ports the PostgreSQL client of the destination instance connects from. Network ACLs are stateless,
+	// so the responses to these ports must be allowed on the way back as well.
+	EPHEMERAL_PORT_LOW  int32  = 32768
+	EPHEMERAL_PORT_HIGH int32  = 60999
+	NETWORK_ACL_ALLOW   string = "allow"
+)
+
+// Network the replication connection runs between. Security groups of the destination are the configured ones,
+// or the ones of the source instance, the subnets are the ones of its subnet group.
+type networkSide struct {
+	securityGroups []ec2Types.SecurityGroup
+	subnets        []ec2Types.Subnet
+	// Network ACLs keyed by the ID of the subnet they are associated with.
+	networkACLs map[string]ec2Types.NetworkAcl
+}
+
+func (ns *networkSide) securityGroupIDs() map[string]bool {
+	groupIDs := make(map[string]bool)
+	for idx := range ns.securityGroups {
+		groupIDs[a.ToString(ns.securityGroups[idx].GroupId)] = true
+	}
+
+	return groupIDs
+}
+
+func cidrContains(outer *net.IPNet, inner *net.IPNet) bool {
+	outerOnes, _ := outer.Mask.Size()
+	innerOnes, _ := inner.Mask.Size()
+
+	return outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+func cidrOverlaps(first *net.IPNet, second *net.IPNet) bool {
+	return first.Contains(second.IP) || second.Contains(first.IP)
+}
+
+func parseCIDR(value *string) *net.IPNet {
+	_, cidr, err := net.ParseCIDR(a.ToString(value))
+	if err != nil {
+		return nil
+	}
+
+	return cidr
+}
+
+// Ports of a permission are only meaningful for TCP and UDP, all of them are allowed with every protocol.
+func permissionCoversPorts(permission *ec2Types.IpPermission, fromPort int32, toPort int32) bool {
+	switch a.ToString(permission.IpProtocol) {
+	case ALL_PROTOCOLS:
+		return true
+	case TCP_PROTOCOL, TCP_PROTOCOL_NUMBER:
+		return a.ToInt32(permission.FromPort) <= fromPort && a.ToInt32(permission.ToPort) >= toPort
+	}
+
+	return false
+}
+
+// Security groups only allow, so a single permission covering all of the peer addresses is enough.
+// Prefix lists can not be resolved here and are assumed to include the peer.
+func securityGroupsAllow(securityGroups []ec2Types.SecurityGroup, egress bool, peer *net.IPNet, peerGroupIDs map[string]bool, port int32) bool {
+	for groupIdx := range securityGroups {
+		permissions := securityGroups[groupIdx].IpPermissions
+		if egress {
+			permissions = securityGroups[groupIdx].IpPermissionsEgress
+		}
+
+		for idx := range permissions {
+			permission := &permissions[idx]
+			if !permissionCoversPorts(permission, port, port) {
+				continue
+			}
+
+			for rangeIdx := range permission.IpRanges {
+				cidr := parseCIDR(permission.IpRanges[rangeIdx].CidrIp)
+				if cidr != nil && cidrContains(cidr, peer) {
+					return true
+				}
+			}
+
+			for pairIdx := range permission.UserIdGroupPairs {
+				if peerGroupIDs[a.ToString(permission.UserIdGroupPairs[pairIdx].GroupId)] {
+					return true
+				}
+			}
+
+			if len(permission.PrefixListIds) > 0 {
+				log.Warnf(
+					"Security group: '%s' refers to a prefix list, which is assumed to include: '%s'.",
+					a.ToString(securityGroups[groupIdx].GroupId),
+					peer.String(),
+				)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func networkACLEntryCoversPorts(entry *ec2Types.NetworkAclEntry, fromPort int32, toPort int32) bool {
+	switch a.ToString(entry.Protocol) {
+	case ALL_PROTOCOLS:
+		return true
+	case TCP_PROTOCOL_NUMBER:
+		return entry.PortRange != nil && a.ToInt32(entry.PortRange.From) <= fromPort && a.ToInt32(entry.PortRange.To) >= toPort
+	}
+
+	return false
+}
+
+func networkACLEntryOverlapsPorts(entry *ec2Types.NetworkAclEntry, fromPort int32, toPort int32) bool {
+	switch a.ToString(entry.Protocol) {
+	case ALL_PROTOCOLS:
+		return true
+	case TCP_PROTOCOL_NUMBER:
+		return entry.PortRange != nil && a.ToInt32(entry.PortRange.From) <= toPort && a.ToInt32(entry.PortRange.To) >= fromPort
+	}
+
+	return false
+}
+
+// Entries are evaluated in the order of their rule numbers and the first matching one decides. The traffic comes
+// from a whole subnet, so a deny of any part of it blocks, and an allow of only a part of it lets later entries decide.
+// Without a matching entry the traffic is denied, the same way the default '*' entry does.
+func networkACLAllows(acl *ec2Types.NetworkAcl, egress bool, peer *net.IPNet, fromPort int32, toPort int32) bool {
+	entries := []ec2Types.NetworkAclEntry{}
+	for idx := range acl.Entries {
+		if a.ToBool(acl.Entries[idx].Egress) == egress && acl.Entries[idx].CidrBlock != nil {
+			entries = append(entries, acl.Entries[idx])
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return a.ToInt32(entries[i].RuleNumber) < a.ToInt32(entries[j].RuleNumber)
+	})
+
+	for idx := range entries {
+		cidr := parseCIDR(entries[idx].CidrBlock)
+		if cidr == nil || !cidrOverlaps(cidr, peer) || !networkACLEntryOverlapsPorts(&entries[idx], fromPort, toPort) {
+			continue
+		}
+
+		if string(entries[idx].RuleAction) != NETWORK_ACL_ALLOW {
+			return false
+		}
+
+		if cidrContains(cidr, peer) && networkACLEntryCoversPorts(&entries[idx], fromPort, toPort) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatSubnet(subnet *ec2Types.Subnet) string {
+	return fmt.Sprintf("'%s' (%s)", a.ToString(subnet.SubnetId), a.ToString(subnet.CidrBlock))
+}
+
+// Every subnet of the destination may hold the new instance, and the source one may fail over to any of its subnets,
+// so each pair of them has to be able to connect.
+func findReplicationNetworkProblems(src *networkSide, dst *networkSide, port int32) []string {
+	problems := []string{}
+	srcGroupIDs := src.securityGroupIDs()
+	dstGroupIDs := dst.securityGroupIDs()
+
+	for srcIdx := range src.subnets {
+		srcCIDR := parseCIDR(src.subnets[srcIdx].CidrBlock)
+		if srcCIDR != nil && !securityGroupsAllow(dst.securityGroups, true, srcCIDR, srcGroupIDs, port) {
+			problems = append(problems, fmt.Sprintf(
+				"Security groups of the destination instance do not allow outbound TCP port %d to subnet: %s",
+				port,
+				formatSubnet(&src.subnets[srcIdx]),
+			))
+		}
+	}
+
+	for dstIdx := range dst.subnets {
+		dstSubnet := &dst.subnets[dstIdx]
+		dstCIDR := parseCIDR(dstSubnet.CidrBlock)
+		if dstCIDR == nil {
+			continue
+		}
+
+		if !securityGroupsAllow(src.securityGroups, false, dstCIDR, dstGroupIDs, port) {
+			problems = append(problems, fmt.Sprintf(
+				"Security groups of the source instance do not allow inbound TCP port %d from subnet: %s",
+				port,
+				formatSubnet(dstSubnet),
+			))
+		}
+
+		for srcIdx := range src.subnets {
+			srcSubnet := &src.subnets[srcIdx]
+			srcCIDR := parseCIDR(srcSubnet.CidrBlock)
+			if srcCIDR == nil {
+				continue
+			}
+
+			if acl, ok := src.networkACLs[a.ToString(srcSubnet.SubnetId)]; ok {
+				if !networkACLAllows(&acl, false, dstCIDR, port, port) {
+					problems = append(problems, fmt.Sprintf(
+						"Network ACL: '%s' of source subnet: %s does not allow inbound TCP port %d from subnet: %s",
+						a.ToString(acl.NetworkAclId), formatSubnet(srcSubnet), port, formatSubnet(dstSubnet),
+					))
+				}
+				if !networkACLAllows(&acl, true, dstCIDR, EPHEMERAL_PORT_LOW, EPHEMERAL_PORT_HIGH) {
+					problems = append(problems, fmt.Sprintf(
+						"Network ACL: '%s' of source subnet: %s does not allow outbound TCP ports %d-%d to subnet: %s",
+						a.ToString(acl.NetworkAclId), formatSubnet(srcSubnet), EPHEMERAL_PORT_LOW, EPHEMERAL_PORT_HIGH, formatSubnet(dstSubnet),
+					))
+				}
+			}
+
+			if acl, ok := dst.networkACLs[a.ToString(dstSubnet.SubnetId)]; ok {
+				if !networkACLAllows(&acl, true, srcCIDR, port, port) {
+					problems = append(problems, fmt.Sprintf(
+						"Network ACL: '%s' of destination subnet: %s does not allow outbound TCP port %d to subnet: %s",
+						a.ToString(acl.NetworkAclId), formatSubnet(dstSubnet), port, formatSubnet(srcSubnet),
+					))
+				}
+				if !networkACLAllows(&acl, false, srcCIDR, EPHEMERAL_PORT_LOW, EPHEMERAL_PORT_HIGH) {
+					problems = append(problems, fmt.Sprintf(
+						"Network ACL: '%s' of destination subnet: %s does not allow inbound TCP ports %d-%d from subnet: %s",
+						a.ToString(acl.NetworkAclId), formatSubnet(dstSubnet), EPHEMERAL_PORT_LOW, EPHEMERAL_PORT_HIGH, formatSubnet(srcSubnet),
+					))
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+func (c *Controller) describeSecurityGroups(client EC2API, groupIDs []string) ([]ec2Types.SecurityGroup, error) {
+	securityGroups := []ec2Types.SecurityGroup{}
+	if len(groupIDs) == 0 {
+		return securityGroups, nil
+	}
+
+	paginator := ec2.NewDescribeSecurityGroupsPaginator(client, &ec2.DescribeSecurityGroupsInput{GroupIds: groupIDs})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+		securityGroups = append(securityGroups, output.SecurityGroups...)
+	}
+
+	return securityGroups, nil
+}
+
+func (c *Controller) describeSubnets(client EC2API, subnetIDs []string) ([]ec2Types.Subnet, error) {
+	subnets := []ec2Types.Subnet{}
+	if len(subnetIDs) == 0 {
+		return subnets, nil
+	}
+
+	paginator := ec2.NewDescribeSubnetsPaginator(client, &ec2.DescribeSubnetsInput{SubnetIds: subnetIDs})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, output.Subnets...)
+	}
+
+	return subnets, nil
+}
+
+func (c *Controller) describeNetworkACLs(client EC2API, subnetIDs []string) (map[string]ec2Types.NetworkAcl, error) {
+	networkACLs := make(map[string]ec2Types.NetworkAcl)
+	if len(subnetIDs) == 0 {
+		return networkACLs, nil
+	}
+
+	input := &ec2.DescribeNetworkAclsInput{
+		Filters: []ec2Types.Filter{{Name: a.String("association.subnet-id"), Values: subnetIDs}},
+	}
+	paginator := ec2.NewDescribeNetworkAclsPaginator(client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		for idx := range output.NetworkAcls {
+			for associationIdx := range output.NetworkAcls[idx].Associations {
+				networkACLs[a.ToString(output.NetworkAcls[idx].Associations[associationIdx].SubnetId)] = output.NetworkAcls[idx]
+			}
+		}
+	}
+
+	return networkACLs, nil
+}
+
+func (c *Controller) describeNetworkSide(ec2Client EC2API, groupIDs []string, subnetGroup *rdsTypes.DBSubnetGroup) (*networkSide, error) {
+	securityGroups, err := c.describeSecurityGroups(ec2Client, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	subnetIDs := []string{}
+	if subnetGroup != nil {
+		for idx := range subnetGroup.Subnets {
+			subnetIDs = append(subnetIDs, a.ToString(subnetGroup.Subnets[idx].SubnetIdentifier))
+		}
+	}
+
+	subnets, err := c.describeSubnets(ec2Client, subnetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	networkACLs, err := c.describeNetworkACLs(ec2Client, subnetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &networkSide{
+		securityGroups: securityGroups,
+		subnets:        subnets,
+		networkACLs:    networkACLs,
+	}, nil
+}
+
+func (c *Controller) getDstSubnetGroup(instance *rdsTypes.DBInstance) (*rdsTypes.DBSubnetGroup, error) {
+	if c.configuration.Items.Upgrade.SubnetGroupName == "" {
+		return instance.DBSubnetGroup, nil
+	}
+
+	subnetGroups, err := c.getDBSubnetGroups(&c.configuration.Items.Upgrade.SubnetGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subnetGroups) == 0 {
+		return nil, errors.New(fmt.Sprintf("Failed to find a subnet group with a name: %s", c.configuration.Items.Upgrade.SubnetGroupName))
+	}
+
+	return &subnetGroups[0], nil
+}
+
+// Evaluates the security groups and the network ACLs between the subnets of the new instance and the source one,
+// for the connection the subscription makes to the source port. Routing, peering and public access are not analyzed.
+// Analyzed is false if the subnets of either side are unknown.
+func (c *Controller) FindReplicationNetworkProblems(instance *rdsTypes.DBInstance) ([]string, bool, error) {
+	port, err := strconv.ParseInt(c.configuration.Items.Src.Port, 10, 32)
+	if err != nil {
+		return nil, false, errors.New(fmt.Sprintf("Invalid source port: '%s'!", c.configuration.Items.Src.Port))
+	}
+
+	if instance.Endpoint != nil && c.configuration.Items.Src.Host != a.ToString(instance.Endpoint.Address) {
+		log.Infof("Source host: '%s' is assumed to lead to instance: '%s'.", c.configuration.Items.Src.Host, *instance.DBInstanceIdentifier)
+	}
+
+	srcGroupIDs := []string{}
+	for idx := range instance.VpcSecurityGroups {
+		srcGroupIDs = append(srcGroupIDs, a.ToString(instance.VpcSecurityGroups[idx].VpcSecurityGroupId))
+	}
+
+	dstGroupIDs := c.configuration.Items.Upgrade.SecurityGroupIDs
+	if len(dstGroupIDs) == 0 {
+		dstGroupIDs = srcGroupIDs
+	}
+
+	dstSubnetGroup, err := c.getDstSubnetGroup(instance)
+	if err != nil {
+		return nil, false, err
+	}
+
+	src, err := c.describeNetworkSide(c.ec2Client, srcGroupIDs, instance.DBSubnetGroup)
+	if err != nil {
+		return nil, false, err
+	}
+
+	dst, err := c.describeNetworkSide(c.dstEC2Client, dstGroupIDs, dstSubnetGroup)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(src.subnets) == 0 || len(dst.subnets) == 0 {
+		return nil, false, nil
+	}
+
+	return findReplicationNetworkProblems(src, dst, int32(port)), true, nil
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"net"
+	"testing"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildNetworkACLEntry(ruleNumber int32, action ec2Types.RuleAction, cidr string, fromPort int32, toPort int32) ec2Types.NetworkAclEntry {
+	return ec2Types.NetworkAclEntry{
+		RuleNumber: a.Int32(ruleNumber),
+		Protocol:   a.String(TCP_PROTOCOL_NUMBER),
+		PortRange:  &ec2Types.PortRange{From: a.Int32(fromPort), To: a.Int32(toPort)},
+		RuleAction: action,
+		Egress:     a.Bool(false),
+		CidrBlock:  a.String(cidr),
+	}
+}
+
+func TestNetworkACLAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []ec2Types.NetworkAclEntry
+		toPort   int32
+		expected bool
+	}{
+		{
+			name: "allowed by a single entry",
+			entries: []ec2Types.NetworkAclEntry{
+				buildNetworkACLEntry(100, ec2Types.RuleActionAllow, "10.0.0.0/16", 5432, 5432),
+			},
+			toPort:   5432,
+			expected: true,
+		},
+		{
+			name:     "denied without a matching entry",
+			entries:  []ec2Types.NetworkAclEntry{buildNetworkACLEntry(100, ec2Types.RuleActionAllow, "10.1.0.0/16", 5432, 5432)},
+			toPort:   5432,
+			expected: false,
+		},
+		{
+			name: "denied by a lower rule number listed last",
+			entries: []ec2Types.NetworkAclEntry{
+				buildNetworkACLEntry(100, ec2Types.RuleActionAllow, "0.0.0.0/0", 0, 65535),
+				buildNetworkACLEntry(50, ec2Types.RuleActionDeny, "10.0.1.128/25", 5432, 5432),
+			},
+			toPort:   5432,
+			expected: false,
+		},
+		{
+			name: "deny of another port does not apply",
+			entries: []ec2Types.NetworkAclEntry{
+				buildNetworkACLEntry(50, ec2Types.RuleActionDeny, "10.0.1.0/24", 22, 22),
+				buildNetworkACLEntry(100, ec2Types.RuleActionAllow, "0.0.0.0/0", 0, 65535),
+			},
+			toPort:   5432,
+			expected: true,
+		},
+		{
+			name: "part of the subnet is allowed first, all of it later",
+			entries: []ec2Types.NetworkAclEntry{
+				buildNetworkACLEntry(50, ec2Types.RuleActionAllow, "10.0.1.0/25", 5432, 5432),
+				buildNetworkACLEntry(100, ec2Types.RuleActionAllow, "10.0.0.0/16", 5000, 6000),
+			},
+			toPort:   5432,
+			expected: true,
+		},
+		{
+			name: "only a part of the port range is allowed",
+			entries: []ec2Types.NetworkAclEntry{
+				buildNetworkACLEntry(100, ec2Types.RuleActionAllow, "10.0.0.0/16", 5432, 5432),
+			},
+			toPort:   5433,
+			expected: false,
+		},
+	}
+
+	_, peer, _ := net.ParseCIDR("10.0.1.0/24")
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			acl := &ec2Types.NetworkAcl{Entries: test.entries}
+			assert.Equal(t, test.expected, networkACLAllows(acl, false, peer, 5432, test.toPort))
+		}
+		t.Run(test.name, testFunction)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	READ_REPLICA_CREATE_TIMEOUT string = "1440m"
+)
+
+type ReadReplica struct {
+	// Empty for the replicas in the configured region.
+	Region   string
+	Instance *rdsTypes.DBInstance
+}
+
+// Replicas in the configured region move to the target region and account together with the instance.
+// Replicas in other regions stay where they are.
+func (c *Controller) getReadReplicaTargetRegion(readReplica *ReadReplica) string {
+	if readReplica.Region == "" {
+		return c.GetTargetRegion()
+	}
+
+	return readReplica.Region
+}
+
+func (c *Controller) isMovedReadReplica(readReplica *ReadReplica) bool {
+	return readReplica.Region == "" && (c.IsCrossRegion() || c.IsCrossAccount())
+}
+
+func (r *ReadReplica) Location() string {
+	if r.Region == "" {
+		return *r.Instance.DBInstanceIdentifier
+	}
+
+	return fmt.Sprintf("%s (%s)", *r.Instance.DBInstanceIdentifier, r.Region)
+}
+
+// Cross-region replicas are referenced by their ARN, e.g. 'arn:aws:rds:eu-west-1:123456789012:db:test-db-replica'.
+func (c *Controller) parseReadReplicaIdentifier(replicaIdentifier string) (string, string, error) {
+	if !arn.IsARN(replicaIdentifier) {
+		return replicaIdentifier, "", nil
+	}
+
+	replicaArn, err := arn.Parse(replicaIdentifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !strings.HasPrefix(replicaArn.Resource, "db:") {
+		return "", "", errors.New(fmt.Sprintf("Read replica: '%s' is not a DB instance!", replicaIdentifier))
+	}
+
+	region := replicaArn.Region
+	if region == c.configuration.AWSRegion {
+		region = ""
+	}
+
+	return strings.TrimPrefix(replicaArn.Resource, "db:"), region, nil
+}
+
+func (c *Controller) buildReadReplicaIdentifier(replica *rdsTypes.DBInstance) string {
+	targetEnginePrefix := strings.Split(c.configuration.Items.Upgrade.EngineVersion, ".")[0]
+
+	return fmt.Sprintf("%s-v%s", *replica.DBInstanceIdentifier, targetEnginePrefix)
+}
+
+func (c *Controller) DescribeReadReplicas(instance *rdsTypes.DBInstance) ([]*ReadReplica, error) {
+	readReplicas := []*ReadReplica{}
+
+	for idx := range instance.ReadReplicaDBInstanceIdentifiers {
+		identifier, region, err := c.parseReadReplicaIdentifier(instance.ReadReplicaDBInstanceIdentifiers[idx])
+		if err != nil {
+			return nil, err
+		}
+
+		// Replicas in the same region as the instance are referenced by their identifier
+		// and live in the same account as the instance.
+		client := c.getRDSClientForInstance(instance)
+		instanceRegion := c.getDBInstanceRegion(instance)
+		if region == "" && instanceRegion != c.configuration.AWSRegion {
+			region = instanceRegion
+		} else if region != "" && region != instanceRegion {
+			client, err = c.getRDSClientForRegion(region)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		instances, err := c.describeDBInstance(client, &identifier)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(instances) == 0 {
+			return nil, errors.New(fmt.Sprintf("Failed to find read replica: '%s'!", identifier))
+		}
+
+		readReplicas = append(readReplicas, &ReadReplica{Region: region, Instance: &instances[0]})
+	}
+
+	return readReplicas, nil
+}
+
+// The new replica mirrors the old one, but replicates from the destination instance.
+// Cross-region replicas always use the default parameter group, since RDS does not allow to set it for PostgreSQL.
+func (c *Controller) buildReadReplicaInput(readReplica *ReadReplica, dstInstance *rdsTypes.DBInstance) *rds.CreateDBInstanceReadReplicaInput {
+	replica := readReplica.Instance
+	moved := c.isMovedReadReplica(readReplica)
+
+	input := &rds.CreateDBInstanceReadReplicaInput{
+		DBInstanceIdentifier:            a.String(c.buildReadReplicaIdentifier(replica)),
+		SourceDBInstanceIdentifier:      dstInstance.DBInstanceIdentifier,
+		AutoMinorVersionUpgrade:         &replica.AutoMinorVersionUpgrade,
+		CopyTagsToSnapshot:              &replica.CopyTagsToSnapshot,
+		DBInstanceClass:                 replica.DBInstanceClass,
+		DeletionProtection:              &replica.DeletionProtection,
+		EnableCloudwatchLogsExports:     replica.EnabledCloudwatchLogsExports,
+		EnableIAMDatabaseAuthentication: &replica.IAMDatabaseAuthenticationEnabled,
+		Iops:                            replica.Iops,
+		MaxAllocatedStorage:             replica.MaxAllocatedStorage,
+		MonitoringInterval:              replica.MonitoringInterval,
+		MonitoringRoleArn:               replica.MonitoringRoleArn,
+		MultiAZ:                         &replica.MultiAZ,
+		PubliclyAccessible:              &replica.PubliclyAccessible,
+		StorageThroughput:               replica.StorageThroughput,
+		StorageType:                     replica.StorageType,
+		Tags:                            replica.TagList,
+	}
+
+	// Availability zone can not be set for Multi-AZ deployments.
+	// Zones of the source region do not exist in the target one and zone names differ between accounts.
+	if !replica.MultiAZ && !moved {
+		input.AvailabilityZone = replica.AvailabilityZone
+	}
+
+	if a.ToBool(replica.PerformanceInsightsEnabled) {
+		input.EnablePerformanceInsights = replica.PerformanceInsightsEnabled
+		input.PerformanceInsightsRetentionPeriod = replica.PerformanceInsightsRetentionPeriod
+	}
+
+	// KMS keys and security groups belong to a region and an account, so the moved replicas use the ones of the destination instance.
+	securityGroups := replica.VpcSecurityGroups
+	if moved {
+		securityGroups = dstInstance.VpcSecurityGroups
+	} else {
+		input.PerformanceInsightsKMSKeyId = replica.PerformanceInsightsKMSKeyId
+	}
+	for idx := range securityGroups {
+		input.VpcSecurityGroupIds = append(input.VpcSecurityGroupIds, *securityGroups[idx].VpcSecurityGroupId)
+	}
+
+	dstRegion := c.getDBInstanceRegion(dstInstance)
+	if c.getReadReplicaTargetRegion(readReplica) == dstRegion {
+		input.DBParameterGroupName = dstInstance.DBParameterGroups[0].DBParameterGroupName
+		return input
+	}
+
+	log.Warnf(
+		"Read replica: '%s' is in another region. The default parameter group will be used.",
+		*input.DBInstanceIdentifier,
+	)
+
+	input.SourceDBInstanceIdentifier = dstInstance.DBInstanceArn
+	input.SourceRegion = &dstRegion
+	input.KmsKeyId = replica.KmsKeyId
+	if replica.DBSubnetGroup != nil {
+		input.DBSubnetGroupName = replica.DBSubnetGroup.DBSubnetGroupName
+	}
+
+	return input
+}
+
+func (c *Controller) waitForReadReplica(client RDSAPI, instanceIdentifier *string) (*rdsTypes.DBInstance, error) {
+	waitParams := &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: instanceIdentifier,
+	}
+	waiter := c.newDBInstanceAvailableWaiterForClient(client)
+
+	duration, err := c.getTimeout(OPERATION_READ_REPLICA_CREATE)
+	if err != nil {
+		return nil, err
+	}
+	stopProgressReport := c.startProgressReport(client, rdsTypes.SourceTypeDbInstance, instanceIdentifier)
+	output, err := waiter.WaitForOutput(*c.configuration.Context, waitParams, duration)
+	stopProgressReport()
+	if err != nil {
+		return nil, err
+	}
+
+	return &output.DBInstances[0], nil
+}
+
+// All the replicas are requested at once and then waited for, since each of them takes as long as a restore.
+func (c *Controller) CreateReadReplicas(srcInstance *rdsTypes.DBInstance, dstInstance *rdsTypes.DBInstance) ([]*ReadReplica, error) {
+	if !c.configuration.Items.Upgrade.ReadReplicas || len(srcInstance.ReadReplicaDBInstanceIdentifiers) == 0 {
+		return nil, nil
+	}
+
+	srcReadReplicas, err := c.DescribeReadReplicas(srcInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := []RDSAPI{}
+	regions := []string{}
+	instanceIdentifiers := []*string{}
+
+	for idx := range srcReadReplicas {
+		region := c.getReadReplicaTargetRegion(srcReadReplicas[idx])
+
+		// Aurora readers can only be added to the cluster itself, other regions need a global database.
+		if c.IsAuroraTarget() {
+			if region != c.GetTargetRegion() {
+				log.Warnf(
+					"Read replica: '%s' can not be recreated as a reader of the cluster from another region. Skipping.",
+					srcReadReplicas[idx].Location(),
+				)
+				continue
+			}
+
+			input := c.buildDBClusterReaderInput(srcReadReplicas[idx], dstInstance)
+			log.Infof("Creating cluster reader: '%s'", *input.DBInstanceIdentifier)
+
+			_, err = c.dstRDSClient.CreateDBInstance(*c.configuration.Context, input)
+			if err != nil {
+				return nil, err
+			}
+
+			clients = append(clients, c.dstRDSClient)
+			regions = append(regions, region)
+			instanceIdentifiers = append(instanceIdentifiers, input.DBInstanceIdentifier)
+			continue
+		}
+
+		client := c.dstRDSClient
+		if region != c.GetTargetRegion() {
+			// RDS does not support read replicas in another account.
+			if c.IsCrossAccount() {
+				log.Warnf(
+					"Read replica: '%s' can not be recreated in the target account from another region. Skipping.",
+					srcReadReplicas[idx].Location(),
+				)
+				continue
+			}
+
+			client, err = c.getRDSClientForRegion(region)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		input := c.buildReadReplicaInput(srcReadReplicas[idx], dstInstance)
+		log.Infof("Creating read replica: '%s'", *input.DBInstanceIdentifier)
+
+		_, err = client.CreateDBInstanceReadReplica(*c.configuration.Context, input)
+		if err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, client)
+		regions = append(regions, region)
+		instanceIdentifiers = append(instanceIdentifiers, input.DBInstanceIdentifier)
+	}
+
+	dstReadReplicas := []*ReadReplica{}
+
+	log.Infoln("Waiting for read replicas to become available.")
+	for idx := range instanceIdentifiers {
+		replica, err := c.waitForReadReplica(clients[idx], instanceIdentifiers[idx])
+		if err != nil {
+			return nil, err
+		}
+
+		region := regions[idx]
+		if region == c.configuration.AWSRegion {
+			region = ""
+		}
+
+		dstReadReplicas = append(dstReadReplicas, &ReadReplica{Region: region, Instance: replica})
+	}
+
+	return dstReadReplicas, nil
+}
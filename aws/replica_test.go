@@ -0,0 +1,69 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReadReplicaIdentifier(t *testing.T) {
+	c := &Controller{configuration: &types.Configuration{AWSRegion: "us-east-1"}}
+
+	tests := []struct {
+		name               string
+		replicaIdentifier  string
+		expectedIdentifier string
+		expectedRegion     string
+		expectedError      bool
+	}{
+		{
+			name:               "Same region replica is referenced by its identifier.",
+			replicaIdentifier:  "test-db-replica",
+			expectedIdentifier: "test-db-replica",
+			expectedRegion:     "",
+		},
+		{
+			name:               "Same region replica is referenced by its ARN.",
+			replicaIdentifier:  "arn:aws:rds:us-east-1:123456789012:db:test-db-replica",
+			expectedIdentifier: "test-db-replica",
+			expectedRegion:     "",
+		},
+		{
+			name:               "Cross-region replica is referenced by its ARN.",
+			replicaIdentifier:  "arn:aws:rds:eu-west-1:123456789012:db:test-db-replica",
+			expectedIdentifier: "test-db-replica",
+			expectedRegion:     "eu-west-1",
+		},
+		{
+			name:              "ARN does not belong to a DB instance.",
+			replicaIdentifier: "arn:aws:rds:eu-west-1:123456789012:cluster:test-cluster",
+			expectedError:     true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			identifier, region, err := c.parseReadReplicaIdentifier(test.replicaIdentifier)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedIdentifier, identifier)
+			assert.Equal(t, test.expectedRegion, region)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
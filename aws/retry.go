@@ -0,0 +1,105 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+
+	"db_relocate/log"
+	"db_relocate/types"
+
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Operations the timeout of which can be overridden with 'aws.timeouts.<operation>'.
+const (
+	OPERATION_SNAPSHOT_CREATE           string = "snapshot_create"
+	OPERATION_SNAPSHOT_COPY             string = "snapshot_copy"
+	OPERATION_SNAPSHOT_UPGRADE          string = "snapshot_upgrade"
+	OPERATION_SNAPSHOT_RESTORE          string = "snapshot_restore"
+	OPERATION_DB_INSTANCE_MODIFY        string = "instance_modify"
+	OPERATION_DB_INSTANCE_REBOOT        string = "instance_reboot"
+	OPERATION_DB_CLUSTER_INSTANCE       string = "cluster_instance_create"
+	OPERATION_READ_REPLICA_CREATE       string = "read_replica_create"
+	OPERATION_PENDING_MAINTENANCE_APPLY string = "maintenance_apply"
+	OPERATION_DNS_RECORD_CHANGE         string = "dns_record_change"
+	OPERATION_BLUE_GREEN_CREATE         string = "blue_green_create"
+	OPERATION_BLUE_GREEN_REPLICATION    string = "blue_green_replication_lag"
+)
+
+var defaultTimeouts = map[string]string{
+	OPERATION_SNAPSHOT_CREATE:           SNAPSHOT_CREATE_TIMEOUT,
+	OPERATION_SNAPSHOT_COPY:             SNAPSHOT_COPY_TIMEOUT,
+	OPERATION_SNAPSHOT_UPGRADE:          SNAPSHOT_UPGRADE_TIMEOUT,
+	OPERATION_SNAPSHOT_RESTORE:          SNAPSHOT_RESTORE_TIMEOUT,
+	OPERATION_DB_INSTANCE_MODIFY:        DB_INSTANCE_MODIFY_TIMEOUT,
+	OPERATION_DB_INSTANCE_REBOOT:        DB_INSTANCE_REBOOT_TIMEOUT,
+	OPERATION_DB_CLUSTER_INSTANCE:       DB_CLUSTER_INSTANCE_CREATE_TIMEOUT,
+	OPERATION_READ_REPLICA_CREATE:       READ_REPLICA_CREATE_TIMEOUT,
+	OPERATION_PENDING_MAINTENANCE_APPLY: PENDING_MAINTENANCE_APPLY_TIMEOUT,
+	OPERATION_DNS_RECORD_CHANGE:         DNS_RECORD_CHANGE_TIMEOUT,
+	OPERATION_BLUE_GREEN_CREATE:         BLUE_GREEN_DEPLOYMENT_CREATE_TIMEOUT,
+	OPERATION_BLUE_GREEN_REPLICATION:    BLUE_GREEN_REPLICATION_LAG_TIMEOUT,
+}
+
+// Throttling and transient errors are retried by the SDK with an exponential backoff.
+// Every page of a paginator is a separate request, so a throttled page does not abort the listing.
+func newRetryer(retryDetails *types.RetryDetails) func() a.Retryer {
+	return func() a.Retryer {
+		return retry.NewStandard(func(options *retry.StandardOptions) {
+			if retryDetails == nil {
+				return
+			}
+			if retryDetails.MaxAttempts > 0 {
+				options.MaxAttempts = retryDetails.MaxAttempts
+			}
+			if retryDetails.MaxBackoff > 0 {
+				options.MaxBackoff = retryDetails.MaxBackoff
+			}
+		})
+	}
+}
+
+func (c *Controller) getTimeout(operation string) (time.Duration, error) {
+	timeout, ok := c.configuration.AWSTimeouts[operation]
+	if !ok {
+		timeout = defaultTimeouts[operation]
+	}
+
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid timeout: '%s' of operation: '%s'!", timeout, operation))
+	}
+
+	return duration, nil
+}
+
+func (c *Controller) IsValidTimeouts() bool {
+	valid := true
+	for operation, timeout := range c.configuration.AWSTimeouts {
+		if _, ok := defaultTimeouts[operation]; !ok {
+			log.Errorf("Timeout of an unknown operation: '%s' is provided.", operation)
+			valid = false
+			continue
+		}
+
+		duration, err := time.ParseDuration(timeout)
+		if err != nil || duration <= 0 {
+			log.Errorf("Provided timeout: '%s' of operation: '%s' is invalid.", timeout, operation)
+			valid = false
+		}
+	}
+
+	return valid
+}
@@ -0,0 +1,168 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/types"
+
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	TEST_KMS_KEY_ARN string = "arn:aws:kms:us-east-1:123456789012:key/second-page-key"
+)
+
+// Throttles the first requests, then lists the keys in two pages.
+type kmsStandIn struct {
+	mutex     sync.Mutex
+	throttled int
+	pages     int
+}
+
+func (s *kmsStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+
+	if s.throttled > 0 {
+		s.throttled--
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"__type":"ThrottlingException","message":"Rate exceeded"}`)
+		return
+	}
+
+	s.pages++
+	if s.pages == 1 {
+		fmt.Fprint(w, `{"Keys":[{"KeyArn":"arn:aws:kms:us-east-1:123456789012:key/first-page-key"}],"NextMarker":"page-2","Truncated":true}`)
+		return
+	}
+	fmt.Fprintf(w, `{"Keys":[{"KeyArn":"%s"}],"Truncated":false}`, TEST_KMS_KEY_ARN)
+}
+
+func setupKMSStandIn(t *testing.T, standIn *kmsStandIn, retryDetails *types.RetryDetails) *Controller {
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	cont := context.TODO()
+
+	return &Controller{
+		dstKMSClient: kms.New(kms.Options{
+			Region:           "us-east-1",
+			Credentials:      a.AnonymousCredentials{},
+			EndpointResolver: kms.EndpointResolverFromURL(server.URL),
+			Retryer:          newRetryer(retryDetails)(),
+		}),
+		configuration: &types.Configuration{
+			Context:  &cont,
+			AWSRetry: retryDetails,
+		},
+	}
+}
+
+func TestRetryThrottledPages(t *testing.T) {
+	tests := []struct {
+		name          string
+		throttled     int
+		maxAttempts   int
+		expectedError bool
+	}{
+		{
+			name:          "throttled page is retried",
+			throttled:     3,
+			maxAttempts:   5,
+			expectedError: false,
+		},
+		{
+			name:          "retries are exhausted",
+			throttled:     3,
+			maxAttempts:   2,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			standIn := &kmsStandIn{throttled: test.throttled}
+			c := setupKMSStandIn(t, standIn, &types.RetryDetails{MaxAttempts: test.maxAttempts, MaxBackoff: time.Millisecond})
+
+			ok, err := c.isKMSKeyExists(a.String(TEST_KMS_KEY_ARN))
+			if test.expectedError {
+				assert.Error(t, err, "error must be raised once the retries are exhausted")
+				return
+			}
+			assert.NoError(t, err, "no error must be raised")
+			assert.True(t, ok, "key of the second page must be found")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestGetTimeout(t *testing.T) {
+	tests := []struct {
+		name             string
+		timeouts         map[string]string
+		expectedTimeout  time.Duration
+		expectedError    bool
+		expectedValidity bool
+	}{
+		{
+			name:             "default timeout is used",
+			timeouts:         map[string]string{},
+			expectedTimeout:  1440 * time.Minute,
+			expectedValidity: true,
+		},
+		{
+			name:             "timeout is overridden",
+			timeouts:         map[string]string{OPERATION_SNAPSHOT_CREATE: "2h"},
+			expectedTimeout:  2 * time.Hour,
+			expectedValidity: true,
+		},
+		{
+			name:             "timeout is invalid",
+			timeouts:         map[string]string{OPERATION_SNAPSHOT_CREATE: "two hours"},
+			expectedError:    true,
+			expectedValidity: false,
+		},
+		{
+			name:             "operation is unknown",
+			timeouts:         map[string]string{"snapshot_delete": "2h"},
+			expectedTimeout:  1440 * time.Minute,
+			expectedValidity: false,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			c := &Controller{configuration: &types.Configuration{AWSTimeouts: test.timeouts}}
+
+			timeout, err := c.getTimeout(OPERATION_SNAPSHOT_CREATE)
+			if test.expectedError {
+				assert.Error(t, err, "error must be raised")
+			} else {
+				assert.NoError(t, err, "no error must be raised")
+				assert.Equal(t, test.expectedTimeout, timeout, "received timeout must match expected timeout")
+			}
+			assert.Equal(t, test.expectedValidity, c.IsValidTimeouts())
+		}
+		t.Run(test.name, testFunction)
+	}
+}
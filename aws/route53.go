@@ -0,0 +1,200 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53Types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"db_relocate/log"
+
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DNS_RECORD_CHANGE_TIMEOUT string = "10m"
+	// Kept on the source instance, so any later process can restore the original TTL.
+	DNS_RECORD_ORIGINAL_TTL_TAG string = "db_relocate:original-dns-ttl"
+)
+
+func (c *Controller) Route53Enabled() bool {
+	return c.configuration.AWSRoute53.HostedZoneID != "" && c.configuration.AWSRoute53.RecordName != ""
+}
+
+// Route53 always returns fully qualified names with a trailing dot.
+func (c *Controller) isSameDNSRecordName(first *string, second *string) bool {
+	return strings.TrimSuffix(strings.ToLower(*first), ".") == strings.TrimSuffix(strings.ToLower(*second), ".")
+}
+
+func (c *Controller) getDNSRecord() (*route53Types.ResourceRecordSet, error) {
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    &c.configuration.AWSRoute53.HostedZoneID,
+		StartRecordName: &c.configuration.AWSRoute53.RecordName,
+		StartRecordType: route53Types.RRTypeCname,
+		MaxItems:        a.Int32(1),
+	}
+
+	result, err := c.route53Client.ListResourceRecordSets(*c.configuration.Context, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.ResourceRecordSets) == 0 ||
+		!c.isSameDNSRecordName(result.ResourceRecordSets[0].Name, &c.configuration.AWSRoute53.RecordName) ||
+		result.ResourceRecordSets[0].Type != route53Types.RRTypeCname ||
+		len(result.ResourceRecordSets[0].ResourceRecords) == 0 {
+		return nil, errors.New(fmt.Sprintf(
+			"Failed to find CNAME record: '%s' in hosted zone: '%s'!",
+			c.configuration.AWSRoute53.RecordName,
+			c.configuration.AWSRoute53.HostedZoneID,
+		))
+	}
+
+	return &result.ResourceRecordSets[0], nil
+}
+
+func (c *Controller) upsertDNSRecord(value *string, ttl int64) error {
+	log.Infof(
+		"Pointing CNAME record: '%s' to: '%s' with TTL: %d",
+		c.configuration.AWSRoute53.RecordName,
+		*value,
+		ttl,
+	)
+
+	input := &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: &c.configuration.AWSRoute53.HostedZoneID,
+		ChangeBatch: &route53Types.ChangeBatch{
+			Changes: []route53Types.Change{
+				{
+					Action: route53Types.ChangeActionUpsert,
+					ResourceRecordSet: &route53Types.ResourceRecordSet{
+						Name: &c.configuration.AWSRoute53.RecordName,
+						Type: route53Types.RRTypeCname,
+						TTL:  a.Int64(ttl),
+						ResourceRecords: []route53Types.ResourceRecord{
+							{Value: value},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := c.route53Client.ChangeResourceRecordSets(*c.configuration.Context, input)
+	if err != nil {
+		return err
+	}
+
+	waitParams := &route53.GetChangeInput{
+		Id: result.ChangeInfo.Id,
+	}
+	waiter := c.newResourceRecordSetsChangedWaiter()
+
+	duration, err := c.getTimeout(OPERATION_DNS_RECORD_CHANGE)
+	if err != nil {
+		return err
+	}
+	err = waiter.Wait(*c.configuration.Context, waitParams, duration)
+
+	return err
+}
+
+func (c *Controller) EnsureDNSRecordExists() error {
+	_, err := c.getDNSRecord()
+	return err
+}
+
+// Must be done well ahead of the switchover, so the old TTL has a chance to expire in resolvers.
+// The original TTL is tagged on the source instance before it is lowered, so it outlives this process.
+func (c *Controller) LowerDNSRecordTTL(instance *rdsTypes.DBInstance) error {
+	record, err := c.getDNSRecord()
+	if err != nil {
+		return err
+	}
+
+	if record.TTL != nil && *record.TTL <= c.configuration.AWSRoute53.LoweredTTL {
+		log.Infof("CNAME record: '%s' TTL is already low enough.", c.configuration.AWSRoute53.RecordName)
+		return nil
+	}
+
+	if record.TTL != nil {
+		err = c.tagDBInstance(instance, DNS_RECORD_ORIGINAL_TTL_TAG, strconv.FormatInt(*record.TTL, 10))
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.upsertDNSRecord(record.ResourceRecords[0].Value, c.configuration.AWSRoute53.LoweredTTL)
+}
+
+func (c *Controller) SwitchDNSRecordToDestination() error {
+	record, err := c.getDNSRecord()
+	if err != nil {
+		return err
+	}
+	c.previousDNSRecordValue = record.ResourceRecords[0].Value
+
+	// The TTL is kept low, so a rollback or a fallback is picked up by resolvers just as quickly.
+	return c.upsertDNSRecord(&c.configuration.Items.Dst.Host, c.configuration.AWSRoute53.LoweredTTL)
+}
+
+// A rollback restores the value the record had before the switchover. A fallback runs in another process,
+// so the record is pointed to the source host instead.
+func (c *Controller) SwitchDNSRecordToSource() error {
+	value := c.previousDNSRecordValue
+	if value == nil {
+		value = &c.configuration.Items.Src.Host
+	}
+
+	return c.upsertDNSRecord(value, c.configuration.AWSRoute53.LoweredTTL)
+}
+
+// The original TTL is read from the tag of the source instance, so it can be restored by a later process as well.
+func (c *Controller) RestoreDNSRecordTTL() error {
+	instances, err := c.describeDBInstance(c.rdsClient, &c.configuration.Items.Src.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	originalTTL := getTagValue(instances[0].TagList, DNS_RECORD_ORIGINAL_TTL_TAG)
+	if originalTTL == "" {
+		log.Infof("CNAME record: '%s' TTL has not been lowered. Nothing to restore.", c.configuration.AWSRoute53.RecordName)
+		return nil
+	}
+
+	ttl, err := strconv.ParseInt(originalTTL, 10, 64)
+	if err != nil {
+		return errors.New(fmt.Sprintf(
+			"Tag: '%s' of instance: '%s' holds an invalid TTL: '%s'!",
+			DNS_RECORD_ORIGINAL_TTL_TAG,
+			c.configuration.Items.Src.InstanceID,
+			originalTTL,
+		))
+	}
+
+	record, err := c.getDNSRecord()
+	if err != nil {
+		return err
+	}
+
+	err = c.upsertDNSRecord(record.ResourceRecords[0].Value, ttl)
+	if err != nil {
+		return err
+	}
+
+	return c.untagDBInstance(&instances[0], DNS_RECORD_ORIGINAL_TTL_TAG)
+}
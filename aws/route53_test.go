@@ -0,0 +1,206 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/testing/fakeaws"
+	"db_relocate/types"
+
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/stretchr/testify/assert"
+)
+
+type route53StandInChange struct {
+	Value string `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+	TTL   int64  `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>TTL"`
+}
+
+type route53StandIn struct {
+	mutex   sync.Mutex
+	value   string
+	ttl     int64
+	changes []route53StandInChange
+}
+
+func (s *route53StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/rrset"):
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+<ResourceRecordSets><ResourceRecordSet><Name>db.example.com.</Name><Type>CNAME</Type><TTL>%d</TTL>
+<ResourceRecords><ResourceRecord><Value>%s</Value></ResourceRecord></ResourceRecords>
+</ResourceRecordSet></ResourceRecordSets><IsTruncated>false</IsTruncated><MaxItems>1</MaxItems>
+</ListResourceRecordSetsResponse>`, s.ttl, s.value)
+	case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/rrset"):
+		change := route53StandInChange{}
+		if err := xml.NewDecoder(r.Body).Decode(&change); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.changes = append(s.changes, change)
+		s.value = change.Value
+		s.ttl = change.TTL
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ChangeResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+<ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status><SubmittedAt>2023-01-01T00:00:00Z</SubmittedAt></ChangeInfo>
+</ChangeResourceRecordSetsResponse>`)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/change/C1"):
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<GetChangeResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+<ChangeInfo><Id>/change/C1</Id><Status>INSYNC</Status><SubmittedAt>2023-01-01T00:00:00Z</SubmittedAt></ChangeInfo>
+</GetChangeResponse>`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// The original TTL is tagged on the source instance of the fake cloud.
+func setupRoute53StandIn(t *testing.T, standIn *route53StandIn) (*Controller, *fakeaws.Cloud) {
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	cloud := setupFakeCloud()
+	cloud.Instances[TEST_INSTANCE_ID].DBInstanceArn = a.String(fmt.Sprintf("arn:aws:rds:%s:123456789012:db:%s", fakeaws.DEFAULT_REGION, TEST_INSTANCE_ID))
+
+	c := setupFakeCloudController(cloud)
+	c.route53Client = route53.New(route53.Options{
+		Region:           "us-east-1",
+		Credentials:      a.AnonymousCredentials{},
+		EndpointResolver: route53.EndpointResolverFromURL(server.URL),
+	})
+	c.configuration.Items.Dst.Host = "new.example.com"
+	c.configuration.AWSRoute53 = &types.Route53Details{
+		HostedZoneID: "Z1",
+		RecordName:   "db.example.com",
+		LoweredTTL:   60,
+	}
+
+	return c, cloud
+}
+
+func TestLowerDNSRecordTTL(t *testing.T) {
+	tests := []struct {
+		name                string
+		ttl                 int64
+		expectedChanges     []route53StandInChange
+		expectedOriginalTTL string
+	}{
+		{
+			name:                "TTL is lowered",
+			ttl:                 300,
+			expectedChanges:     []route53StandInChange{{Value: "old.example.com", TTL: 60}},
+			expectedOriginalTTL: "300",
+		},
+		{
+			name:            "TTL is already low enough",
+			ttl:             30,
+			expectedChanges: nil,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			standIn := &route53StandIn{value: "old.example.com", ttl: test.ttl}
+			c, cloud := setupRoute53StandIn(t, standIn)
+
+			err := c.LowerDNSRecordTTL(cloud.Instances[TEST_INSTANCE_ID])
+			assert.NoError(t, err, "no error must be raised")
+			assert.Equal(t, test.expectedChanges, standIn.changes, "received changes must match expected changes")
+			assert.Equal(
+				t,
+				test.expectedOriginalTTL,
+				getTagValue(cloud.Instances[TEST_INSTANCE_ID].TagList, DNS_RECORD_ORIGINAL_TTL_TAG),
+				"original TTL must be tagged on the source instance",
+			)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestSwitchDNSRecord(t *testing.T) {
+	standIn := &route53StandIn{value: "old.example.com", ttl: 60}
+	c, _ := setupRoute53StandIn(t, standIn)
+
+	err := c.SwitchDNSRecordToDestination()
+	assert.NoError(t, err, "no error must be raised")
+	assert.Equal(
+		t,
+		[]route53StandInChange{{Value: "new.example.com", TTL: 60}},
+		standIn.changes,
+		"record must point to the new instance in a single change with the lowered TTL",
+	)
+
+	err = c.SwitchDNSRecordToSource()
+	assert.NoError(t, err, "no error must be raised")
+	assert.Equal(t, "old.example.com", standIn.value, "record must point back to the old instance")
+	assert.Equal(t, int64(60), standIn.ttl, "TTL must stay low")
+}
+
+func TestRestoreDNSRecordTTL(t *testing.T) {
+	tests := []struct {
+		name            string
+		ttl             int64
+		expectedChanges []route53StandInChange
+	}{
+		{
+			name: "original TTL is restored on the new instance",
+			ttl:  3600,
+			expectedChanges: []route53StandInChange{
+				{Value: "old.example.com", TTL: 60},
+				{Value: "new.example.com", TTL: 60},
+				{Value: "new.example.com", TTL: 3600},
+			},
+		},
+		{
+			name:            "TTL has not been lowered",
+			ttl:             30,
+			expectedChanges: []route53StandInChange{{Value: "new.example.com", TTL: 60}},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			standIn := &route53StandIn{value: "old.example.com", ttl: test.ttl}
+			c, cloud := setupRoute53StandIn(t, standIn)
+
+			err := c.LowerDNSRecordTTL(cloud.Instances[TEST_INSTANCE_ID])
+			assert.NoError(t, err, "no error must be raised")
+
+			err = c.SwitchDNSRecordToDestination()
+			assert.NoError(t, err, "no error must be raised")
+
+			// Restored by another process, which only knows the tag of the source instance.
+			restoringController := setupFakeCloudController(cloud)
+			restoringController.route53Client = c.route53Client
+			restoringController.configuration.AWSRoute53 = c.configuration.AWSRoute53
+
+			err = restoringController.RestoreDNSRecordTTL()
+			assert.NoError(t, err, "no error must be raised")
+			assert.Equal(t, test.expectedChanges, standIn.changes, "received changes must match expected changes")
+			assert.Empty(t, getTagValue(cloud.Instances[TEST_INSTANCE_ID].TagList, DNS_RECORD_ORIGINAL_TTL_TAG), "tag must be removed")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
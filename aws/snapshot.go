@@ -29,22 +29,165 @@ const (
 	SNAPSHOT_COPY_TIMEOUT      string = "1440m"
 	SNAPSHOT_RESTORE_TIMEOUT   string = "1440m"
 	SNAPSHOT_ENCRYPTED_SUFFIX  string = "-encrypted"
+	SNAPSHOT_RESTORE_ATTRIBUTE string = "restore"
+	SNAPSHOT_RUN_ID_FORMAT     string = "20060102150405"
+	SNAPSHOT_STATUS_AVAILABLE  string = "available"
+	// Tags of the snapshots created by a run. Copies of the snapshots keep them.
+	SNAPSHOT_RUN_ID_TAG          string = "db_relocate:run-id"
+	SNAPSHOT_SOURCE_INSTANCE_TAG string = "db_relocate:source-instance"
+	SNAPSHOT_ENGINE_VERSION_TAG  string = "db_relocate:engine-version"
+	// Confirmed flush LSN of the replication slot the snapshot was taken after. A snapshot is only reused with this slot.
+	SNAPSHOT_REPLICATION_SLOT_LSN_TAG string = "db_relocate:replication-slot-lsn"
+	// Retention of the snapshots created by a run, applied once the snapshot has been restored.
+	SNAPSHOT_RETENTION_ALL      string = "all"
+	SNAPSHOT_RETENTION_RESTORED string = "restored"
+	SNAPSHOT_RETENTION_NONE     string = "none"
+	SNAPSHOT_STATE_KEPT         string = "kept"
+	SNAPSHOT_STATE_DELETED      string = "deleted"
+	SNAPSHOT_STATE_REUSED       string = "reused"
+	SNAPSHOT_STATE_FAILED       string = "failed to delete"
 )
 
-func (c *Controller) takeDBInstanceSnapshot(instance *rdsTypes.DBInstance) (*rdsTypes.DBSnapshot, error) {
+// Snapshot created or reused by a run, together with the client of the region and account it belongs to.
+type runSnapshot struct {
+	snapshot *rdsTypes.DBSnapshot
+	client   RDSAPI
+	state    string
+}
+
+func newRunID() string {
+	return time.Now().UTC().Format(SNAPSHOT_RUN_ID_FORMAT)
+}
+
+func (c *Controller) GetRunID() string {
+	return c.runID
+}
+
+func (c *Controller) GetSnapshotRetention() string {
+	if c.configuration.Items.Upgrade.SnapshotRetention == "" {
+		return SNAPSHOT_RETENTION_RESTORED
+	}
+
+	return c.configuration.Items.Upgrade.SnapshotRetention
+}
+
+func (c *Controller) IsValidSnapshotRetention() bool {
+	switch c.GetSnapshotRetention() {
+	case SNAPSHOT_RETENTION_ALL, SNAPSHOT_RETENTION_RESTORED, SNAPSHOT_RETENTION_NONE:
+		return true
+	}
+
+	log.Errorf(
+		"Provided snapshot retention: '%s' is invalid. Available retentions: %v",
+		c.GetSnapshotRetention(),
+		[]string{SNAPSHOT_RETENTION_ALL, SNAPSHOT_RETENTION_RESTORED, SNAPSHOT_RETENTION_NONE},
+	)
+
+	return false
+}
+
+func buildSnapshotName(instance *rdsTypes.DBInstance, runID string) string {
+	return fmt.Sprintf("%s-%s-%s", *instance.DBInstanceIdentifier, SNAPSHOT_IDENTIFIER_SUFFIX, runID)
+}
+
+func (c *Controller) buildSnapshotTags(instance *rdsTypes.DBInstance, replicationSlotLSN *string) []rdsTypes.Tag {
+	return []rdsTypes.Tag{
+		{Key: a.String(SNAPSHOT_RUN_ID_TAG), Value: a.String(c.runID)},
+		{Key: a.String(SNAPSHOT_SOURCE_INSTANCE_TAG), Value: instance.DBInstanceIdentifier},
+		{Key: a.String(SNAPSHOT_ENGINE_VERSION_TAG), Value: a.String(c.configuration.Items.Upgrade.EngineVersion)},
+		{Key: a.String(SNAPSHOT_REPLICATION_SLOT_LSN_TAG), Value: replicationSlotLSN},
+	}
+}
+
+func getTagValue(tags []rdsTypes.Tag, key string) string {
+	for _, tag := range tags {
+		if a.ToString(tag.Key) == key {
+			return a.ToString(tag.Value)
+		}
+	}
+
+	return ""
+}
+
+// Run metadata only describes the snapshots, so it is not passed on to the restored instance.
+func withoutRunTags(tags []rdsTypes.Tag) []rdsTypes.Tag {
+	filtered := []rdsTypes.Tag{}
+	for _, tag := range tags {
+		switch a.ToString(tag.Key) {
+		case SNAPSHOT_RUN_ID_TAG, SNAPSHOT_SOURCE_INSTANCE_TAG, SNAPSHOT_ENGINE_VERSION_TAG, SNAPSHOT_REPLICATION_SLOT_LSN_TAG:
+			continue
+		}
+		filtered = append(filtered, tag)
+	}
+
+	if len(filtered) == 0 {
+		return nil
+	}
+
+	return filtered
+}
+
+// A snapshot is compatible when a previous run created it for the same source instance
+// right after the given replication slot, and it has already been upgraded to the target engine version.
+// Returns nil if there is no such snapshot.
+func (c *Controller) FindReusableDBSnapshot(instance *rdsTypes.DBInstance, replicationSlotLSN *string) (*rdsTypes.DBSnapshot, error) {
+	input := &rds.DescribeDBSnapshotsInput{
+		DBInstanceIdentifier: instance.DBInstanceIdentifier,
+		SnapshotType:         a.String("manual"),
+	}
+
+	var reusableSnapshot *rdsTypes.DBSnapshot
+	paginator := rds.NewDescribeDBSnapshotsPaginator(c.dstRDSClient, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(*c.configuration.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		for idx := range output.DBSnapshots {
+			snapshot := &output.DBSnapshots[idx]
+
+			if getTagValue(snapshot.TagList, SNAPSHOT_RUN_ID_TAG) == "" ||
+				getTagValue(snapshot.TagList, SNAPSHOT_SOURCE_INSTANCE_TAG) != *instance.DBInstanceIdentifier ||
+				getTagValue(snapshot.TagList, SNAPSHOT_REPLICATION_SLOT_LSN_TAG) != *replicationSlotLSN ||
+				a.ToString(snapshot.EngineVersion) != c.configuration.Items.Upgrade.EngineVersion ||
+				a.ToString(snapshot.Status) != SNAPSHOT_STATUS_AVAILABLE {
+				continue
+			}
+
+			if reusableSnapshot == nil || getTagValue(snapshot.TagList, SNAPSHOT_RUN_ID_TAG) > getTagValue(reusableSnapshot.TagList, SNAPSHOT_RUN_ID_TAG) {
+				reusableSnapshot = snapshot
+			}
+		}
+	}
+
+	if reusableSnapshot != nil {
+		log.Infof(
+			"Found a snapshot: '%s' of run: '%s' to reuse.",
+			*reusableSnapshot.DBSnapshotIdentifier,
+			getTagValue(reusableSnapshot.TagList, SNAPSHOT_RUN_ID_TAG),
+		)
+	}
+
+	return reusableSnapshot, nil
+}
+
+func (c *Controller) takeDBInstanceSnapshot(instance *rdsTypes.DBInstance, replicationSlotLSN *string) (*rdsTypes.DBSnapshot, error) {
 	log.Infoln("Taking a snapshot!")
 	encryptionStatusSuffix := ""
 
 	// Only in case storage is encrypted with correct KMS key we add encrypted suffix.
-	if instance.StorageEncrypted && *instance.KmsKeyId == c.configuration.Items.Upgrade.KMSID {
+	// KMS keys belong to a region and an account, so a snapshot for another region or account always has to be copied.
+	if !c.IsCrossRegion() && !c.IsCrossAccount() && instance.StorageEncrypted && *instance.KmsKeyId == c.configuration.Items.Upgrade.KMSID {
 		encryptionStatusSuffix = SNAPSHOT_ENCRYPTED_SUFFIX
 	}
 
-	snapshotName := fmt.Sprintf("%s-%s%s", *instance.DBInstanceIdentifier, SNAPSHOT_IDENTIFIER_SUFFIX, encryptionStatusSuffix)
+	snapshotName := buildSnapshotName(instance, c.runID) + encryptionStatusSuffix
 
 	snapshotInput := &rds.CreateDBSnapshotInput{
 		DBInstanceIdentifier: instance.DBInstanceIdentifier,
 		DBSnapshotIdentifier: a.String(snapshotName),
+		Tags:                 c.buildSnapshotTags(instance, replicationSlotLSN),
 	}
 	snapshot, err := c.rdsClient.CreateDBSnapshot(*c.configuration.Context, snapshotInput)
 	if err != nil {
@@ -52,17 +195,19 @@ func (c *Controller) takeDBInstanceSnapshot(instance *rdsTypes.DBInstance) (*rds
 	}
 
 	log.Infoln("Waiting for a snapshot to become available.")
-	waiter := rds.NewDBSnapshotAvailableWaiter(c.rdsClient)
+	waiter := c.newDBSnapshotAvailableWaiter()
 	waiterParams := &rds.DescribeDBSnapshotsInput{
 		DBSnapshotIdentifier: snapshot.DBSnapshot.DBSnapshotIdentifier,
 	}
 
-	duration, err := time.ParseDuration(SNAPSHOT_CREATE_TIMEOUT)
+	duration, err := c.getTimeout(OPERATION_SNAPSHOT_CREATE)
 	if err != nil {
 		return nil, err
 	}
 
+	stopProgressReport := c.startProgressReport(c.rdsClient, rdsTypes.SourceTypeDbSnapshot, snapshot.DBSnapshot.DBSnapshotIdentifier)
 	err = waiter.Wait(*c.configuration.Context, waiterParams, duration)
+	stopProgressReport()
 	if err != nil {
 		return nil, err
 	}
@@ -76,23 +221,25 @@ func (c *Controller) upgradeDBSnapshot(snapshot *rdsTypes.DBSnapshot, engineVers
 		DBSnapshotIdentifier: snapshot.DBSnapshotIdentifier,
 		EngineVersion:        engineVersion,
 	}
-	output, err := c.rdsClient.ModifyDBSnapshot(*c.configuration.Context, snapshotInput)
+	output, err := c.dstRDSClient.ModifyDBSnapshot(*c.configuration.Context, snapshotInput)
 	if err != nil {
 		return nil, err
 	}
 
 	log.Infoln("Waiting for a snapshot to become available.")
-	waiter := rds.NewDBSnapshotAvailableWaiter(c.rdsClient)
+	waiter := c.newDBSnapshotAvailableWaiterForClient(c.dstRDSClient)
 	waiterParams := &rds.DescribeDBSnapshotsInput{
 		DBSnapshotIdentifier: output.DBSnapshot.DBSnapshotIdentifier,
 	}
 
-	duration, err := time.ParseDuration(SNAPSHOT_UPGRADE_TIMEOUT)
+	duration, err := c.getTimeout(OPERATION_SNAPSHOT_UPGRADE)
 	if err != nil {
 		return nil, err
 	}
 
+	stopProgressReport := c.startProgressReport(c.dstRDSClient, rdsTypes.SourceTypeDbSnapshot, output.DBSnapshot.DBSnapshotIdentifier)
 	err = waiter.Wait(*c.configuration.Context, waiterParams, duration)
+	stopProgressReport()
 	if err != nil {
 		return nil, err
 	}
@@ -101,9 +248,37 @@ func (c *Controller) upgradeDBSnapshot(snapshot *rdsTypes.DBSnapshot, engineVers
 
 }
 
+// Allows the target account to copy the snapshot. Sharing is removed again once the copy is done.
+func (c *Controller) modifyDBSnapshotSharing(snapshot *rdsTypes.DBSnapshot, share bool) error {
+	input := &rds.ModifyDBSnapshotAttributeInput{
+		DBSnapshotIdentifier: snapshot.DBSnapshotIdentifier,
+		AttributeName:        a.String(SNAPSHOT_RESTORE_ATTRIBUTE),
+	}
+	if share {
+		log.Infof("Sharing a snapshot: '%s' with account: '%s'", *snapshot.DBSnapshotIdentifier, c.GetTargetAccountID())
+		input.ValuesToAdd = []string{c.GetTargetAccountID()}
+	} else {
+		log.Infof("Removing sharing of a snapshot: '%s' with account: '%s'", *snapshot.DBSnapshotIdentifier, c.GetTargetAccountID())
+		input.ValuesToRemove = []string{c.GetTargetAccountID()}
+	}
+
+	_, err := c.rdsClient.ModifyDBSnapshotAttribute(*c.configuration.Context, input)
+
+	return err
+}
+
+// The copy is always made in the destination region and account.
+// Snapshots from another region or account are referenced by their ARN and are re-encrypted with a key of the destination.
 func (c *Controller) copyDBSnapshot(snapshot *rdsTypes.DBSnapshot, engineVersion *string, kmsKeyID *string) (*rdsTypes.DBSnapshot, error) {
 	log.Infof("Encrypting a snapshot: '%s' with a KMS key: '%s'", *snapshot.DBSnapshotIdentifier, *kmsKeyID)
 
+	if c.IsCrossAccount() {
+		err := c.modifyDBSnapshotSharing(snapshot, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	snapshotName := fmt.Sprintf("%s%s", *snapshot.DBSnapshotIdentifier, SNAPSHOT_ENCRYPTED_SUFFIX)
 
 	snapshotInput := &rds.CopyDBSnapshotInput{
@@ -112,32 +287,66 @@ func (c *Controller) copyDBSnapshot(snapshot *rdsTypes.DBSnapshot, engineVersion
 		CopyTags:                   a.Bool(true),
 		KmsKeyId:                   kmsKeyID,
 	}
-	output, err := c.rdsClient.CopyDBSnapshot(*c.configuration.Context, snapshotInput)
+	if c.IsCrossRegion() || c.IsCrossAccount() {
+		snapshotInput.SourceDBSnapshotIdentifier = snapshot.DBSnapshotArn
+	}
+	if c.IsCrossRegion() {
+		log.Infof("Copying a snapshot: '%s' to region: '%s'", *snapshot.DBSnapshotIdentifier, c.GetTargetRegion())
+		snapshotInput.SourceRegion = &c.configuration.AWSRegion
+	}
+	output, err := c.dstRDSClient.CopyDBSnapshot(*c.configuration.Context, snapshotInput)
 	if err != nil {
 		return nil, err
 	}
 
 	log.Infoln("Waiting for a snapshot to become available.")
-	waiter := rds.NewDBSnapshotAvailableWaiter(c.rdsClient)
+	waiter := c.newDBSnapshotAvailableWaiterForClient(c.dstRDSClient)
 	waiterParams := &rds.DescribeDBSnapshotsInput{
 		DBSnapshotIdentifier: output.DBSnapshot.DBSnapshotIdentifier,
 	}
 
-	duration, err := time.ParseDuration(SNAPSHOT_COPY_TIMEOUT)
+	duration, err := c.getTimeout(OPERATION_SNAPSHOT_COPY)
 	if err != nil {
 		return nil, err
 	}
 
+	stopProgressReport := c.startProgressReport(c.dstRDSClient, rdsTypes.SourceTypeDbSnapshot, output.DBSnapshot.DBSnapshotIdentifier)
 	err = waiter.Wait(*c.configuration.Context, waiterParams, duration)
+	stopProgressReport()
 	if err != nil {
 		return nil, err
 	}
 
+	if c.IsCrossAccount() {
+		err = c.modifyDBSnapshotSharing(snapshot, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return output.DBSnapshot, nil
 
 }
 
-func (c *Controller) sanitizeTargetDBInstanceConfiguration(instance *rdsTypes.DBInstance, snapshot *rdsTypes.DBSnapshot) *targetDBConfiguration {
+// IAM roles of the source account can not be used in the target one, so only the overridden ones are kept.
+func (c *Controller) dropSrcAccountRoles(configuration *targetDBConfiguration) {
+	if !c.IsCrossAccount() {
+		return
+	}
+
+	if c.configuration.Items.Upgrade.MonitoringRoleArn == "" && configuration.monitoringRoleArn != nil {
+		log.Warnf("Enhanced Monitoring is disabled, since 'monitoring_role_arn' of the target account is not set.")
+		configuration.monitoringInterval = a.Int32(0)
+		configuration.monitoringRoleArn = nil
+	}
+
+	if c.configuration.Items.Upgrade.IAMRoles == nil && len(configuration.iamRoles) > 0 {
+		log.Warnf("IAM roles are not associated, since 'iam_roles' of the target account are not set.")
+		configuration.iamRoles = nil
+	}
+}
+
+func (c *Controller) sanitizeTargetDBInstanceConfiguration(instance *rdsTypes.DBInstance, snapshot *rdsTypes.DBSnapshot) (*targetDBConfiguration, error) {
 	configuration := targetDBConfiguration{}
 
 	configuration.setDBInstanceIdentifier(c.configuration.Items, instance)
@@ -148,22 +357,65 @@ func (c *Controller) sanitizeTargetDBInstanceConfiguration(instance *rdsTypes.DB
 
 	configuration.setDBInstanceClass(c.configuration.Items.Upgrade, instance)
 
-	configuration.setDBParameterGroupName(c.configuration.Items.Upgrade, instance)
+	// Aurora manages the storage of the cluster and does not support option groups.
+	if c.IsAuroraTarget() {
+		configuration.setDBClusterAttributes(c.configuration.Items.Upgrade)
+	} else {
+		configuration.setDBParameterGroupName(c.configuration.Items.Upgrade, instance)
+
+		configuration.setStorageSize(c.configuration.Items.Upgrade, snapshot)
+
+		configuration.setStorageType(c.configuration.Items.Upgrade, snapshot)
+
+		configuration.setStorageIOPS(c.configuration.Items.Upgrade)
+
+		configuration.setStorageThroughput(c.configuration.Items.Upgrade)
+
+		configuration.setOptionGroupName(c.configuration.Items.Upgrade, instance)
+
+		configuration.setMaxAllocatedStorage(c.configuration.Items.Upgrade, instance)
+	}
+
+	configuration.setPort(c.configuration.Items.Upgrade, instance)
+
+	configuration.setPubliclyAccessible(c.configuration.Items.Upgrade, instance)
 
-	configuration.setStorageSize(c.configuration.Items.Upgrade, snapshot)
+	configuration.setCloudwatchLogsExports(c.configuration.Items.Upgrade, instance)
 
-	configuration.setStorageType(c.configuration.Items.Upgrade, snapshot)
+	configuration.setBackupSettings(c.configuration.Items.Upgrade, instance)
 
-	configuration.setStorageIOPS(c.configuration.Items.Upgrade)
+	configuration.setMonitoring(c.configuration.Items.Upgrade, instance)
 
-	configuration.setStorageThroughput(c.configuration.Items.Upgrade)
+	configuration.setPerformanceInsights(c.configuration.Items.Upgrade, instance)
 
-	return &configuration
+	// KMS key of the source can not be used, so the default one of the destination is picked by AWS.
+	if (c.IsCrossRegion() || c.IsCrossAccount()) && c.configuration.Items.Upgrade.PerformanceInsightsKMSKeyID == "" {
+		configuration.performanceInsightsKMSKeyID = nil
+	}
+
+	configuration.setMasterUserSecret(instance)
+
+	// Same for the key of the master user secret, the default one of Secrets Manager is used instead.
+	if c.IsCrossRegion() || c.IsCrossAccount() {
+		configuration.masterUserSecretKMSKeyID = nil
+	}
+
+	err := configuration.setIAMRoles(c.configuration.Items.Upgrade, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	c.dropSrcAccountRoles(&configuration)
+
+	return &configuration, nil
 }
 
-func (c *Controller) restoreDBSnapshot(snapshot *rdsTypes.DBSnapshot, instance *rdsTypes.DBInstance) (*rdsTypes.DBInstance, error) {
+func (c *Controller) restoreDBSnapshot(snapshot *rdsTypes.DBSnapshot, instance *rdsTypes.DBInstance) (*rdsTypes.DBInstance, *targetDBConfiguration, error) {
 	log.Infoln("Restoring a snapshot!")
-	configuration := c.sanitizeTargetDBInstanceConfiguration(instance, snapshot)
+	configuration, err := c.sanitizeTargetDBInstanceConfiguration(instance, snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	input := &rds.RestoreDBInstanceFromDBSnapshotInput{
 		DBInstanceIdentifier:            configuration.instanceIdentifier,
@@ -175,60 +427,138 @@ func (c *Controller) restoreDBSnapshot(snapshot *rdsTypes.DBSnapshot, instance *
 		DBSnapshotIdentifier:            snapshot.DBSnapshotIdentifier,
 		DBSubnetGroupName:               configuration.subnetGroupName,
 		DeletionProtection:              &instance.DeletionProtection,
+		EnableCloudwatchLogsExports:     configuration.cloudwatchLogsExports,
 		EnableIAMDatabaseAuthentication: &instance.IAMDatabaseAuthenticationEnabled,
 		Iops:                            configuration.iops,
 		MultiAZ:                         &instance.MultiAZ,
+		OptionGroupName:                 configuration.optionGroupName,
+		Port:                            configuration.port,
+		PubliclyAccessible:              configuration.publiclyAccessible,
 		StorageThroughput:               configuration.storageThroughput,
 		StorageType:                     configuration.storageType,
-		Tags:                            snapshot.TagList,
+		Tags:                            withoutRunTags(snapshot.TagList),
 		VpcSecurityGroupIds:             configuration.vpcSecurityGroupIDs,
 	}
-	_, err := c.rdsClient.RestoreDBInstanceFromDBSnapshot(*c.configuration.Context, input)
+	_, err = c.dstRDSClient.RestoreDBInstanceFromDBSnapshot(*c.configuration.Context, input)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	log.Infoln("Waiting for an instance to become available.")
 	waitParams := &rds.DescribeDBInstancesInput{
 		DBInstanceIdentifier: configuration.instanceIdentifier,
 	}
-	waiter := rds.NewDBInstanceAvailableWaiter(c.rdsClient)
+	waiter := c.newDBInstanceAvailableWaiterForClient(c.dstRDSClient)
 
-	duration, err := time.ParseDuration(SNAPSHOT_RESTORE_TIMEOUT)
+	duration, err := c.getTimeout(OPERATION_SNAPSHOT_RESTORE)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	stopProgressReport := c.startProgressReport(c.dstRDSClient, rdsTypes.SourceTypeDbInstance, configuration.instanceIdentifier)
 	output, err := waiter.WaitForOutput(*c.configuration.Context, waitParams, duration)
+	stopProgressReport()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return &output.DBInstances[0], nil
+	return &output.DBInstances[0], configuration, nil
 }
 
-func (c *Controller) RunDBSnapshotMaintenance(instance *rdsTypes.DBInstance) (*rdsTypes.DBInstance, error) {
-	snapshot, err := c.takeDBInstanceSnapshot(instance)
-	if err != nil {
-		return nil, err
+func (c *Controller) deleteDBSnapshot(client RDSAPI, snapshot *rdsTypes.DBSnapshot) error {
+	log.Infof("Deleting a snapshot: '%s'", *snapshot.DBSnapshotIdentifier)
+	input := &rds.DeleteDBSnapshotInput{
+		DBSnapshotIdentifier: snapshot.DBSnapshotIdentifier,
 	}
+	_, err := client.DeleteDBSnapshot(*c.configuration.Context, input)
 
-	if !strings.HasSuffix(*snapshot.DBSnapshotIdentifier, SNAPSHOT_ENCRYPTED_SUFFIX) {
-		snapshot, err = c.copyDBSnapshot(
-			snapshot,
-			&c.configuration.Items.Upgrade.EngineVersion,
-			&c.configuration.Items.Upgrade.KMSID,
-		)
+	return err
+}
+
+// Reused snapshots belong to a previous run, so they are never deleted.
+// Failing to delete a snapshot does not fail the run, since the instance has already been restored.
+func (c *Controller) applySnapshotRetention(snapshots []*runSnapshot, restoredSnapshot *rdsTypes.DBSnapshot) {
+	for _, snapshot := range snapshots {
+		if snapshot.state == SNAPSHOT_STATE_REUSED {
+			continue
+		}
+
+		isRestored := *snapshot.snapshot.DBSnapshotIdentifier == *restoredSnapshot.DBSnapshotIdentifier
+		switch c.GetSnapshotRetention() {
+		case SNAPSHOT_RETENTION_ALL:
+			snapshot.state = SNAPSHOT_STATE_KEPT
+			continue
+		case SNAPSHOT_RETENTION_RESTORED:
+			if isRestored {
+				snapshot.state = SNAPSHOT_STATE_KEPT
+				continue
+			}
+		}
+
+		err := c.deleteDBSnapshot(snapshot.client, snapshot.snapshot)
+		if err != nil {
+			log.Warnf("Failed to delete a snapshot: '%s'. Received an error: '%s'", *snapshot.snapshot.DBSnapshotIdentifier, err)
+			snapshot.state = SNAPSHOT_STATE_FAILED
+			continue
+		}
+		snapshot.state = SNAPSHOT_STATE_DELETED
+	}
+}
+
+func (c *Controller) reportRunSnapshots(snapshots []*runSnapshot) {
+	log.Infof("Snapshots of run: '%s'", c.runID)
+	for _, snapshot := range snapshots {
+		log.Infof("  - %s (%s)", *snapshot.snapshot.DBSnapshotIdentifier, snapshot.state)
+	}
+}
+
+// Takes a new snapshot unless a reusable one is given. A new snapshot is tagged with the LSN of the replication slot created before it.
+func (c *Controller) RunDBSnapshotMaintenance(instance *rdsTypes.DBInstance, reusableSnapshot *rdsTypes.DBSnapshot, replicationSlotLSN *string) (*rdsTypes.DBInstance, error) {
+	snapshots := []*runSnapshot{}
+	snapshot := reusableSnapshot
+	var err error
+
+	if snapshot != nil {
+		snapshots = append(snapshots, &runSnapshot{snapshot: snapshot, client: c.dstRDSClient, state: SNAPSHOT_STATE_REUSED})
+	} else {
+		snapshot, err = c.takeDBInstanceSnapshot(instance, replicationSlotLSN)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, &runSnapshot{snapshot: snapshot, client: c.rdsClient})
+
+		if !strings.HasSuffix(*snapshot.DBSnapshotIdentifier, SNAPSHOT_ENCRYPTED_SUFFIX) {
+			snapshot, err = c.copyDBSnapshot(
+				snapshot,
+				&c.configuration.Items.Upgrade.EngineVersion,
+				&c.configuration.Items.Upgrade.KMSID,
+			)
+			if err != nil {
+				return nil, err
+			}
+			snapshots = append(snapshots, &runSnapshot{snapshot: snapshot, client: c.dstRDSClient})
+		}
+
+		snapshot, err = c.upgradeDBSnapshot(snapshot, &c.configuration.Items.Upgrade.EngineVersion)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	snapshot, err = c.upgradeDBSnapshot(snapshot, &c.configuration.Items.Upgrade.EngineVersion)
+	var newInstance *rdsTypes.DBInstance
+	var configuration *targetDBConfiguration
+	if c.IsAuroraTarget() {
+		newInstance, configuration, err = c.restoreDBCluster(snapshot, instance)
+	} else {
+		newInstance, configuration, err = c.restoreDBSnapshot(snapshot, instance)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	newInstance, err := c.restoreDBSnapshot(snapshot, instance)
+	c.applySnapshotRetention(snapshots, snapshot)
+	c.reportRunSnapshots(snapshots)
+
+	err = c.applyTargetDBInstanceAttributes(newInstance, configuration)
 	if err != nil {
 		return nil, err
 	}
@@ -240,5 +570,15 @@ func (c *Controller) RunDBSnapshotMaintenance(instance *rdsTypes.DBInstance) (*r
 		}
 	}
 
+	err = c.reportTargetDBInstanceAttributeDifferences(newInstance, configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.setDBClusterEndpoint(newInstance)
+	if err != nil {
+		return nil, err
+	}
+
 	return newInstance, nil
 }
@@ -0,0 +1,535 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"db_relocate/log"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+const (
+	GP2_STORAGE_TYPE                   string  = "gp2"
+	IO1_STORAGE_TYPE                   string  = "io1"
+	IO2_STORAGE_TYPE                   string  = "io2"
+	GP3_STORAGE_MIN_SIZE               int32   = 20 // GB
+	GP3_STORAGE_BASELINE_IOPS          int32   = 3000
+	GP3_STORAGE_BASELINE_THROUGHPUT    int32   = 125 // MiB/s
+	GP3_STORAGE_MAX_IOPS               int32   = 64000
+	GP3_STORAGE_MAX_THROUGHPUT         int32   = 4000 // MiB/s
+	GP3_STORAGE_THROUGHPUT_PER_IOPS    float64 = 0.25 // MiB/s
+	IO_STORAGE_MIN_SIZE                int32   = 100  // GB
+	IO_STORAGE_MIN_IOPS                int32   = 1000
+	IO_STORAGE_MAX_IOPS                int32   = 256000
+	IO1_STORAGE_MAX_IOPS_PER_GB        int32   = 50
+	IO2_STORAGE_MAX_IOPS_PER_GB        int32   = 1000
+	MAX_ALLOCATED_STORAGE_MIN_RATIO    float64 = 1.1
+	MAX_ALLOCATED_STORAGE_RATIO        float64 = 1.25
+	STORAGE_HEADROOM_RATIO             float64 = 1.2
+	SIZING_METRIC_PERIOD               int32   = 3600 // seconds
+	READ_IOPS_METRIC                   string  = "ReadIOPS"
+	WRITE_IOPS_METRIC                  string  = "WriteIOPS"
+	READ_THROUGHPUT_METRIC             string  = "ReadThroughput"
+	WRITE_THROUGHPUT_METRIC            string  = "WriteThroughput"
+	TRANSACTION_LOGS_GENERATION_METRIC string  = "TransactionLogsGeneration"
+	BYTES_PER_GB                       float64 = 1024 * 1024 * 1024
+	BYTES_PER_MB                       float64 = 1024 * 1024
+)
+
+// Peaks and trends of the storage of an instance over the look-back period.
+type storageUsage struct {
+	allocatedStorage float64 // GB
+	usedStorage      float64 // GB
+	freeStorage      float64 // GB
+	storageGrowth    float64 // GB per day
+	peakIOPS         float64
+	peakThroughput   float64 // MiB/s
+	walGeneration    float64 // bytes per second
+}
+
+// Values of 0 leave the IOPS and the throughput at the baseline of the storage type.
+type StorageRecommendation struct {
+	StorageType         string
+	StorageSize         int32
+	StorageIOPS         int32
+	StorageThroughput   int32
+	MaxAllocatedStorage int32
+	Justifications      []string
+}
+
+func (sr *StorageRecommendation) justify(format string, args ...interface{}) {
+	sr.Justifications = append(sr.Justifications, fmt.Sprintf(format, args...))
+}
+
+// Sums up the series at the same timestamps and returns the highest sum, e.g. reads and writes.
+func peakOfSummedSeries(series ...*metricSeries) float64 {
+	sums := make(map[time.Time]float64)
+	for _, s := range series {
+		if s == nil {
+			continue
+		}
+		for idx := range s.values {
+			sums[s.timestamps[idx]] += s.values[idx]
+		}
+	}
+
+	peak := 0.0
+	for _, sum := range sums {
+		peak = math.Max(peak, sum)
+	}
+
+	return peak
+}
+
+// Least squares slope of the values per day.
+func dailySlope(series *metricSeries) float64 {
+	if series == nil || len(series.values) < 2 {
+		return 0
+	}
+
+	origin := series.timestamps[0]
+	var sumX, sumY, sumXY, sumXX float64
+	for idx := range series.values {
+		x := series.timestamps[idx].Sub(origin).Hours() / 24
+		y := series.values[idx]
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(series.values))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+func latestValue(series *metricSeries) (float64, bool) {
+	if series == nil || len(series.values) == 0 {
+		return 0, false
+	}
+
+	latest := 0
+	for idx := range series.timestamps {
+		if series.timestamps[idx].After(series.timestamps[latest]) {
+			latest = idx
+		}
+	}
+
+	return series.values[latest], true
+}
+
+func averageValue(series *metricSeries) float64 {
+	if series == nil || len(series.values) == 0 {
+		return 0
+	}
+
+	average, _ := calculateAverage(series.values)
+
+	return average
+}
+
+func (c *Controller) getStorageUsage(instance *rdsTypes.DBInstance, now *time.Time) (*storageUsage, error) {
+	start := now.Add(-c.configuration.Items.Sizing.Lookback)
+
+	series, err := c.getMetricSeriesForDBInstance(
+		instance,
+		[]metricStatistic{
+			{metricName: READ_IOPS_METRIC, stat: "Maximum"},
+			{metricName: WRITE_IOPS_METRIC, stat: "Maximum"},
+			{metricName: READ_THROUGHPUT_METRIC, stat: "Maximum"},
+			{metricName: WRITE_THROUGHPUT_METRIC, stat: "Maximum"},
+			{metricName: FREE_STORAGE_SPACE_METRIC, stat: "Minimum"},
+			{metricName: TRANSACTION_LOGS_GENERATION_METRIC, stat: "Average"},
+		},
+		&start,
+		now,
+		SIZING_METRIC_PERIOD,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	freeStorageSpace := series[FREE_STORAGE_SPACE_METRIC]
+
+	latestFreeStorageSpace, ok := latestValue(freeStorageSpace)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf(
+			"Failed to find '%s' metric of DB instance: '%s' within the last %s!",
+			FREE_STORAGE_SPACE_METRIC,
+			*instance.DBInstanceIdentifier,
+			c.configuration.Items.Sizing.Lookback,
+		))
+	}
+
+	usage := &storageUsage{
+		allocatedStorage: float64(instance.AllocatedStorage),
+		freeStorage:      latestFreeStorageSpace / BYTES_PER_GB,
+		// Free storage space shrinks as the data grows. Storage autoscaling shows up as a jump and is ignored by the trend.
+		storageGrowth:  math.Max(0, -dailySlope(freeStorageSpace)/BYTES_PER_GB),
+		peakIOPS:       peakOfSummedSeries(series[READ_IOPS_METRIC], series[WRITE_IOPS_METRIC]),
+		peakThroughput: peakOfSummedSeries(series[READ_THROUGHPUT_METRIC], series[WRITE_THROUGHPUT_METRIC]) / BYTES_PER_MB,
+		walGeneration:  averageValue(series[TRANSACTION_LOGS_GENERATION_METRIC]),
+	}
+	usage.usedStorage = math.Max(0, usage.allocatedStorage-usage.freeStorage)
+
+	return usage, nil
+}
+
+func (c *Controller) recommendStorageSize(recommendation *StorageRecommendation, usage *storageUsage) {
+	horizonDays := c.configuration.Items.Sizing.Horizon.Hours() / 24
+	projectedStorage := usage.usedStorage + usage.storageGrowth*horizonDays
+
+	recommendation.justify(
+		"%.1f GB are used and grow by %.2f GB per day, %.1f GB are projected in %s.",
+		usage.usedStorage,
+		usage.storageGrowth,
+		projectedStorage,
+		c.configuration.Items.Sizing.Horizon,
+	)
+
+	// The WAL generated while the old instance is kept in sync is retained on the new one.
+	if c.configuration.Items.Upgrade.ReverseReplication {
+		walRetention := usage.walGeneration * c.configuration.Items.Upgrade.ExpectedDuration.Seconds() / BYTES_PER_GB
+		projectedStorage += walRetention
+
+		recommendation.justify(
+			"%.1f GB of WAL are retained by reverse replication within %s.",
+			walRetention,
+			c.configuration.Items.Upgrade.ExpectedDuration,
+		)
+	}
+
+	storageSize := int32(math.Ceil(projectedStorage * STORAGE_HEADROOM_RATIO))
+
+	// A snapshot can not be restored to less storage than the instance had.
+	if storageSize < int32(usage.allocatedStorage) {
+		storageSize = int32(usage.allocatedStorage)
+	}
+
+	if storageSize > DB_INSTANCE_MAX_STORAGE_SIZE {
+		storageSize = DB_INSTANCE_MAX_STORAGE_SIZE
+		recommendation.justify("Storage size is capped at the maximum of %d GB.", DB_INSTANCE_MAX_STORAGE_SIZE)
+	}
+
+	// The rest of the recommendation is built around a storage size set explicitly.
+	if c.configuration.Items.Upgrade.StorageSize != 0 {
+		recommendation.justify(
+			"Storage size of %d GB is set explicitly, %d GB would be enough.",
+			c.configuration.Items.Upgrade.StorageSize,
+			storageSize,
+		)
+		storageSize = c.configuration.Items.Upgrade.StorageSize
+	}
+
+	recommendation.StorageSize = storageSize
+}
+
+func recommendGP3StorageProvisioning(recommendation *StorageRecommendation, neededIOPS int32, neededThroughput int32) {
+	if recommendation.StorageSize < GP3_STORAGE_MIN_SIZE {
+		recommendation.StorageSize = GP3_STORAGE_MIN_SIZE
+	}
+
+	if neededIOPS <= GP3_STORAGE_BASELINE_IOPS && neededThroughput <= GP3_STORAGE_BASELINE_THROUGHPUT && recommendation.StorageSize < GP3_STORAGE_SIZE_THRESHOLD {
+		recommendation.justify(
+			"The baseline of %d IOPS and %d MiB/s of gp3 storage below %d GB is enough.",
+			GP3_STORAGE_BASELINE_IOPS,
+			GP3_STORAGE_BASELINE_THROUGHPUT,
+			GP3_STORAGE_SIZE_THRESHOLD,
+		)
+		return
+	}
+
+	// IOPS and throughput can only be provisioned from the size threshold on, where the baseline is higher too.
+	if recommendation.StorageSize < GP3_STORAGE_SIZE_THRESHOLD {
+		recommendation.StorageSize = GP3_STORAGE_SIZE_THRESHOLD
+		recommendation.justify(
+			"Storage size is raised to %d GB, since gp3 storage can not be provisioned beyond its baseline below it.",
+			GP3_STORAGE_SIZE_THRESHOLD,
+		)
+	}
+
+	iops := maxInt32(neededIOPS, GP3_STORAGE_IOPS_LOW_WATERMARK)
+	throughput := maxInt32(neededThroughput, GP3_STORAGE_THROUGHPUT_LOW_WATERMARK)
+	if float64(throughput) > float64(iops)*GP3_STORAGE_THROUGHPUT_PER_IOPS {
+		iops = int32(math.Ceil(float64(throughput) / GP3_STORAGE_THROUGHPUT_PER_IOPS))
+	}
+
+	// Only reached when gp3 is set explicitly, otherwise io2 is recommended.
+	if iops > GP3_STORAGE_MAX_IOPS || throughput > GP3_STORAGE_MAX_THROUGHPUT {
+		iops = minInt32(iops, GP3_STORAGE_MAX_IOPS)
+		throughput = minInt32(throughput, GP3_STORAGE_MAX_THROUGHPUT)
+		recommendation.justify(
+			"Warning: gp3 storage is limited to %d IOPS and %d MiB/s, which is less than needed.",
+			GP3_STORAGE_MAX_IOPS,
+			GP3_STORAGE_MAX_THROUGHPUT,
+		)
+	}
+
+	if iops > GP3_STORAGE_IOPS_LOW_WATERMARK {
+		recommendation.StorageIOPS = iops
+	}
+
+	if throughput > GP3_STORAGE_THROUGHPUT_LOW_WATERMARK {
+		recommendation.StorageThroughput = throughput
+	}
+}
+
+func recommendIOStorageProvisioning(recommendation *StorageRecommendation, neededIOPS int32) {
+	maxIOPSPerGB := IO1_STORAGE_MAX_IOPS_PER_GB
+	if recommendation.StorageType == IO2_STORAGE_TYPE {
+		maxIOPSPerGB = IO2_STORAGE_MAX_IOPS_PER_GB
+	}
+
+	iops := minInt32(maxInt32(neededIOPS, IO_STORAGE_MIN_IOPS), IO_STORAGE_MAX_IOPS)
+	recommendation.StorageIOPS = iops
+
+	storageSize := maxInt32(recommendation.StorageSize, IO_STORAGE_MIN_SIZE)
+	minStorageSize := int32(math.Ceil(float64(iops) / float64(maxIOPSPerGB)))
+	if storageSize < minStorageSize {
+		storageSize = minStorageSize
+		recommendation.justify(
+			"Storage size is raised to %d GB, since %s storage allows at most %d IOPS per GB.",
+			minStorageSize,
+			recommendation.StorageType,
+			maxIOPSPerGB,
+		)
+	}
+	recommendation.StorageSize = storageSize
+}
+
+// gp2 and magnetic storage are moved to gp3, which has a higher baseline for the same price.
+// Provisioned IOPS storage is kept, unless the type is set explicitly.
+func (c *Controller) recommendStorageType(instance *rdsTypes.DBInstance, neededIOPS int32, neededThroughput int32) string {
+	if c.configuration.Items.Upgrade.StorageType != "" {
+		return c.configuration.Items.Upgrade.StorageType
+	}
+
+	storageType := a.ToString(instance.StorageType)
+	if storageType == IO1_STORAGE_TYPE || storageType == IO2_STORAGE_TYPE {
+		return storageType
+	}
+
+	if neededIOPS > GP3_STORAGE_MAX_IOPS || neededThroughput > GP3_STORAGE_MAX_THROUGHPUT {
+		return IO2_STORAGE_TYPE
+	}
+
+	return GP3_STORAGE_TYPE
+}
+
+// Storage autoscaling must allow at least 10% more than the allocated storage.
+func recommendMaxAllocatedStorage(recommendation *StorageRecommendation, instance *rdsTypes.DBInstance) {
+	maxAllocatedStorage := int32(math.Ceil(float64(recommendation.StorageSize) * MAX_ALLOCATED_STORAGE_RATIO))
+	if instance.MaxAllocatedStorage != nil && *instance.MaxAllocatedStorage > maxAllocatedStorage {
+		maxAllocatedStorage = *instance.MaxAllocatedStorage
+	}
+
+	if maxAllocatedStorage > DB_INSTANCE_MAX_STORAGE_SIZE {
+		maxAllocatedStorage = DB_INSTANCE_MAX_STORAGE_SIZE
+	}
+
+	if float64(maxAllocatedStorage) < float64(recommendation.StorageSize)*MAX_ALLOCATED_STORAGE_MIN_RATIO {
+		return
+	}
+
+	recommendation.MaxAllocatedStorage = maxAllocatedStorage
+}
+
+func maxInt32(first int32, second int32) int32 {
+	if first > second {
+		return first
+	}
+	return second
+}
+
+func minInt32(first int32, second int32) int32 {
+	if first < second {
+		return first
+	}
+	return second
+}
+
+// Validates a combination of storage settings against the rules of the storage type. IOPS and throughput of 0 mean the baseline.
+func ValidateStorageConfiguration(storageType string, storageSize int32, iops int32, throughput int32) error {
+	switch storageType {
+	case GP3_STORAGE_TYPE:
+		if storageSize < GP3_STORAGE_MIN_SIZE {
+			return errors.New(fmt.Sprintf("Storage size of gp3 storage must be at least %d GB!", GP3_STORAGE_MIN_SIZE))
+		}
+
+		if storageSize < GP3_STORAGE_SIZE_THRESHOLD {
+			if iops != 0 || throughput != 0 {
+				return errors.New(fmt.Sprintf(
+					"IOPS and throughput of gp3 storage can only be provisioned from %d GB on!",
+					GP3_STORAGE_SIZE_THRESHOLD,
+				))
+			}
+			return nil
+		}
+
+		if iops != 0 && (iops < GP3_STORAGE_IOPS_LOW_WATERMARK || iops > GP3_STORAGE_MAX_IOPS) {
+			return errors.New(fmt.Sprintf(
+				"IOPS of gp3 storage must be between %d and %d!",
+				GP3_STORAGE_IOPS_LOW_WATERMARK,
+				GP3_STORAGE_MAX_IOPS,
+			))
+		}
+
+		if throughput != 0 && (throughput < GP3_STORAGE_THROUGHPUT_LOW_WATERMARK || throughput > GP3_STORAGE_MAX_THROUGHPUT) {
+			return errors.New(fmt.Sprintf(
+				"Throughput of gp3 storage must be between %d and %d MiB/s!",
+				GP3_STORAGE_THROUGHPUT_LOW_WATERMARK,
+				GP3_STORAGE_MAX_THROUGHPUT,
+			))
+		}
+
+		effectiveIOPS := maxInt32(iops, GP3_STORAGE_IOPS_LOW_WATERMARK)
+		if float64(throughput) > float64(effectiveIOPS)*GP3_STORAGE_THROUGHPUT_PER_IOPS {
+			return errors.New(fmt.Sprintf(
+				"Throughput of gp3 storage can be at most %.2f MiB/s per provisioned IOPS!",
+				GP3_STORAGE_THROUGHPUT_PER_IOPS,
+			))
+		}
+	case IO1_STORAGE_TYPE, IO2_STORAGE_TYPE:
+		maxIOPSPerGB := IO1_STORAGE_MAX_IOPS_PER_GB
+		if storageType == IO2_STORAGE_TYPE {
+			maxIOPSPerGB = IO2_STORAGE_MAX_IOPS_PER_GB
+		}
+
+		if storageSize < IO_STORAGE_MIN_SIZE {
+			return errors.New(fmt.Sprintf("Storage size of %s storage must be at least %d GB!", storageType, IO_STORAGE_MIN_SIZE))
+		}
+
+		if iops < IO_STORAGE_MIN_IOPS || iops > IO_STORAGE_MAX_IOPS {
+			return errors.New(fmt.Sprintf(
+				"IOPS of %s storage must be between %d and %d!",
+				storageType,
+				IO_STORAGE_MIN_IOPS,
+				IO_STORAGE_MAX_IOPS,
+			))
+		}
+
+		if iops > storageSize*maxIOPSPerGB {
+			return errors.New(fmt.Sprintf(
+				"IOPS of %s storage can be at most %d per GB of storage!",
+				storageType,
+				maxIOPSPerGB,
+			))
+		}
+
+		if throughput != 0 {
+			return errors.New(fmt.Sprintf("Throughput of %s storage can not be provisioned!", storageType))
+		}
+	default:
+		if iops != 0 || throughput != 0 {
+			return errors.New(fmt.Sprintf("IOPS and throughput of %s storage can not be provisioned!", storageType))
+		}
+	}
+
+	return nil
+}
+
+// Storage settings copied from the source instance are valid already, so only overridden ones are checked.
+func (c *Controller) IsValidStorageConfiguration(instance *rdsTypes.DBInstance) bool {
+	upgradeConfiguration := c.configuration.Items.Upgrade
+	if c.IsAuroraTarget() || (upgradeConfiguration.StorageType == "" && upgradeConfiguration.StorageIOPS == 0 && upgradeConfiguration.StorageThroughput == 0) {
+		return true
+	}
+
+	storageType := upgradeConfiguration.StorageType
+	if storageType == "" {
+		storageType = a.ToString(instance.StorageType)
+	}
+
+	storageSize := upgradeConfiguration.StorageSize
+	if storageSize == 0 {
+		storageSize = instance.AllocatedStorage
+	}
+
+	iops := upgradeConfiguration.StorageIOPS
+	if iops == 0 && (storageType == IO1_STORAGE_TYPE || storageType == IO2_STORAGE_TYPE) {
+		iops = a.ToInt32(instance.Iops)
+	}
+
+	err := ValidateStorageConfiguration(storageType, storageSize, iops, upgradeConfiguration.StorageThroughput)
+	if err != nil {
+		log.Errorln(err)
+		return false
+	}
+
+	return true
+}
+
+// Recommends the storage of the new instance from the peaks and the trend of the old one, with some headroom.
+func (c *Controller) RecommendDBInstanceStorage(instance *rdsTypes.DBInstance, now *time.Time) (*StorageRecommendation, error) {
+	usage, err := c.getStorageUsage(instance, now)
+	if err != nil {
+		return nil, err
+	}
+
+	neededIOPS := int32(math.Ceil(usage.peakIOPS * STORAGE_HEADROOM_RATIO))
+	neededThroughput := int32(math.Ceil(usage.peakThroughput * STORAGE_HEADROOM_RATIO))
+
+	recommendation := &StorageRecommendation{
+		StorageType: c.recommendStorageType(instance, neededIOPS, neededThroughput),
+	}
+
+	recommendation.justify(
+		"Peak usage within the last %s: %.0f IOPS and %.1f MiB/s, %d IOPS and %d MiB/s are needed with headroom.",
+		c.configuration.Items.Sizing.Lookback,
+		usage.peakIOPS,
+		usage.peakThroughput,
+		neededIOPS,
+		neededThroughput,
+	)
+
+	c.recommendStorageSize(recommendation, usage)
+
+	switch recommendation.StorageType {
+	case GP3_STORAGE_TYPE:
+		recommendGP3StorageProvisioning(recommendation, neededIOPS, neededThroughput)
+	case IO1_STORAGE_TYPE, IO2_STORAGE_TYPE:
+		recommendIOStorageProvisioning(recommendation, neededIOPS)
+	}
+
+	recommendMaxAllocatedStorage(recommendation, instance)
+
+	// The replication slot retains the WAL on the old instance until the new one has caught up.
+	walRetention := usage.walGeneration * c.configuration.Items.Upgrade.ExpectedDuration.Seconds() / BYTES_PER_GB
+	if walRetention > usage.freeStorage {
+		recommendation.justify(
+			"Warning: %.1f GB of WAL are retained on the old instance within %s, but only %.1f GB are free.",
+			walRetention,
+			c.configuration.Items.Upgrade.ExpectedDuration,
+			usage.freeStorage,
+		)
+	}
+
+	err = ValidateStorageConfiguration(
+		recommendation.StorageType,
+		recommendation.StorageSize,
+		recommendation.StorageIOPS,
+		recommendation.StorageThroughput,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return recommendation, nil
+}
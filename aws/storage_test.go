@@ -0,0 +1,184 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStorageConfiguration(t *testing.T) {
+	tests := []struct {
+		name          string
+		storageType   string
+		storageSize   int32
+		iops          int32
+		throughput    int32
+		expectedError bool
+	}{
+		{
+			name:        "gp3 storage below the threshold with the baseline",
+			storageType: GP3_STORAGE_TYPE,
+			storageSize: 100,
+		},
+		{
+			name:          "gp3 storage below the threshold can not be provisioned",
+			storageType:   GP3_STORAGE_TYPE,
+			storageSize:   100,
+			iops:          6000,
+			expectedError: true,
+		},
+		{
+			name:        "gp3 storage above the threshold is provisioned",
+			storageType: GP3_STORAGE_TYPE,
+			storageSize: 500,
+			iops:        16000,
+			throughput:  1000,
+		},
+		{
+			name:          "gp3 storage throughput exceeds the ratio to the IOPS",
+			storageType:   GP3_STORAGE_TYPE,
+			storageSize:   500,
+			iops:          12000,
+			throughput:    4000,
+			expectedError: true,
+		},
+		{
+			name:          "gp3 storage IOPS above the maximum",
+			storageType:   GP3_STORAGE_TYPE,
+			storageSize:   500,
+			iops:          80000,
+			expectedError: true,
+		},
+		{
+			name:        "io1 storage within the IOPS per GB ratio",
+			storageType: IO1_STORAGE_TYPE,
+			storageSize: 200,
+			iops:        10000,
+		},
+		{
+			name:          "io1 storage exceeds the IOPS per GB ratio",
+			storageType:   IO1_STORAGE_TYPE,
+			storageSize:   200,
+			iops:          20000,
+			expectedError: true,
+		},
+		{
+			name:        "io2 storage allows a higher IOPS per GB ratio",
+			storageType: IO2_STORAGE_TYPE,
+			storageSize: 200,
+			iops:        20000,
+		},
+		{
+			name:          "io2 storage requires IOPS",
+			storageType:   IO2_STORAGE_TYPE,
+			storageSize:   200,
+			expectedError: true,
+		},
+		{
+			name:          "io1 storage throughput can not be provisioned",
+			storageType:   IO1_STORAGE_TYPE,
+			storageSize:   200,
+			iops:          10000,
+			throughput:    500,
+			expectedError: true,
+		},
+		{
+			name:          "gp2 storage can not be provisioned",
+			storageType:   GP2_STORAGE_TYPE,
+			storageSize:   200,
+			iops:          3000,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			err := ValidateStorageConfiguration(test.storageType, test.storageSize, test.iops, test.throughput)
+			if test.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestRecommendGP3StorageProvisioning(t *testing.T) {
+	tests := []struct {
+		name               string
+		storageSize        int32
+		neededIOPS         int32
+		neededThroughput   int32
+		expectedSize       int32
+		expectedIOPS       int32
+		expectedThroughput int32
+	}{
+		{
+			name:             "baseline is enough",
+			storageSize:      100,
+			neededIOPS:       2000,
+			neededThroughput: 100,
+			expectedSize:     100,
+		},
+		{
+			name:             "storage is raised to the threshold to provision IOPS",
+			storageSize:      100,
+			neededIOPS:       5000,
+			neededThroughput: 100,
+			expectedSize:     GP3_STORAGE_SIZE_THRESHOLD,
+		},
+		{
+			name:               "IOPS are raised to allow the throughput",
+			storageSize:        1000,
+			neededIOPS:         5000,
+			neededThroughput:   4000,
+			expectedSize:       1000,
+			expectedIOPS:       16000,
+			expectedThroughput: 4000,
+		},
+		{
+			name:             "IOPS above the baseline are provisioned",
+			storageSize:      1000,
+			neededIOPS:       20000,
+			neededThroughput: 200,
+			expectedSize:     1000,
+			expectedIOPS:     20000,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			recommendation := &StorageRecommendation{StorageType: GP3_STORAGE_TYPE, StorageSize: test.storageSize}
+			recommendGP3StorageProvisioning(recommendation, test.neededIOPS, test.neededThroughput)
+
+			assert.Equal(t, test.expectedSize, recommendation.StorageSize)
+			assert.Equal(t, test.expectedIOPS, recommendation.StorageIOPS)
+			assert.Equal(t, test.expectedThroughput, recommendation.StorageThroughput)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestDailySlope(t *testing.T) {
+	now := time.Now().UTC()
+	series := &metricSeries{
+		timestamps: []time.Time{now, now.Add(24 * time.Hour), now.Add(48 * time.Hour)},
+		values:     []float64{100, 90, 80},
+	}
+
+	assert.InDelta(t, -10.0, dailySlope(series), 0.0001)
+	assert.Equal(t, 0.0, dailySlope(&metricSeries{timestamps: []time.Time{now}, values: []float64{1}}))
+	assert.Equal(t, 0.0, dailySlope(nil))
+}
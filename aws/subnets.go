@@ -22,7 +22,7 @@ func (c *Controller) getDBSubnetGroups(subnetGroupName *string) ([]rdsTypes.DBSu
 		DBSubnetGroupName: subnetGroupName,
 	}
 
-	paginator := rds.NewDescribeDBSubnetGroupsPaginator(c.rdsClient, input)
+	paginator := rds.NewDescribeDBSubnetGroupsPaginator(c.dstRDSClient, input)
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -38,6 +38,10 @@ func (c *Controller) getDBSubnetGroups(subnetGroupName *string) ([]rdsTypes.DBSu
 func (c *Controller) IsValidDBSubnetGroup(instance *rdsTypes.DBInstance, vpcID *string) (bool, error) {
 	// If empty, the subnet group will be copied from the source instance.
 	if c.configuration.Items.Upgrade.SubnetGroupName == "" {
+		if c.IsCrossRegion() || c.IsCrossAccount() {
+			log.Errorf("Subnet group must be provided when relocating to another region or account!")
+			return false, nil
+		}
 		// We need to make sure the selected subnet group belongs to the correct VPC.
 		if *instance.DBSubnetGroup.VpcId == *vpcID {
 			return true, nil
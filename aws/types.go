@@ -13,6 +13,7 @@ package aws
 import (
 	"db_relocate/log"
 	"db_relocate/types"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -30,25 +31,56 @@ type targetDBConfiguration struct {
 	storageSize         *int32
 	iops                *int32
 	storageThroughput   *int32
+
+	// Attributes which can not be set on restore are applied by a modification right after it.
+	optionGroupName                    *string
+	port                               *int32
+	publiclyAccessible                 *bool
+	cloudwatchLogsExports              []string
+	backupRetentionPeriod              *int32
+	backupWindow                       *string
+	maintenanceWindow                  *string
+	maxAllocatedStorage                *int32
+	monitoringInterval                 *int32
+	monitoringRoleArn                  *string
+	performanceInsightsEnabled         *bool
+	performanceInsightsKMSKeyID        *string
+	performanceInsightsRetentionPeriod *int32
+	iamRoles                           []rdsTypes.DBInstanceRole
+	// Only set if RDS manages the master user password of the source instance in Secrets Manager.
+	manageMasterUserPassword *bool
+	masterUserSecretKMSKeyID *string
+
+	// Only set for Aurora targets.
+	clusterIdentifier         *string
+	clusterParameterGroupName *string
 }
 
 const (
+	DEFAULT_OPTION_GROUP_PREFIX          string = "default:"
+	IAM_ROLE_OVERRIDE_SEPARATOR          string = "="
 	GP3_STORAGE_TYPE                     string = "gp3"
 	GP3_STORAGE_SIZE_THRESHOLD           int32  = 400 // GB
 	GP3_STORAGE_THROUGHPUT_LOW_WATERMARK int32  = 500
 	GP3_STORAGE_IOPS_LOW_WATERMARK       int32  = 12000
 )
 
+func buildDstDBInstanceIdentifier(itemsConfiguration *types.Items, srcInstanceIdentifier string) string {
+	if itemsConfiguration.Dst.InstanceID != "" {
+		return itemsConfiguration.Dst.InstanceID
+	}
+
+	targetEnginePrefix := strings.Split(itemsConfiguration.Upgrade.EngineVersion, ".")[0]
+	return fmt.Sprintf("%s-v%s", srcInstanceIdentifier, targetEnginePrefix)
+}
+
 func (tdbc *targetDBConfiguration) setDBInstanceIdentifier(itemsConfiguration *types.Items, instance *rdsTypes.DBInstance) {
+	newIdentifier := buildDstDBInstanceIdentifier(itemsConfiguration, *instance.DBInstanceIdentifier)
 	if itemsConfiguration.Dst.InstanceID == "" {
-		targetEnginePrefix := strings.Split(itemsConfiguration.Upgrade.EngineVersion, ".")[0]
-		newIdentifier := fmt.Sprintf("%s-v%s", *instance.DBInstanceIdentifier, targetEnginePrefix)
 		log.Infof("Desired name was not specified for the destination DB instance. Generating a new one: %s", newIdentifier)
-
-		tdbc.instanceIdentifier = &newIdentifier
-	} else {
-		tdbc.instanceIdentifier = &itemsConfiguration.Dst.InstanceID
 	}
+
+	tdbc.instanceIdentifier = &newIdentifier
 }
 
 func (tdbc *targetDBConfiguration) setDBSubnetGroup(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
@@ -91,6 +123,20 @@ func (tdbc *targetDBConfiguration) setDBParameterGroupName(upgradeConfiguration
 	}
 }
 
+// Custom parameters of Aurora targets are kept in the cluster parameter group,
+// so the instances use the default parameter group unless it is set.
+func (tdbc *targetDBConfiguration) setDBClusterAttributes(upgradeConfiguration *types.UpgradeDetails) {
+	tdbc.clusterIdentifier = a.String(buildDBClusterIdentifier(*tdbc.instanceIdentifier))
+
+	if upgradeConfiguration.ClusterParameterGroup != "" {
+		tdbc.clusterParameterGroupName = &upgradeConfiguration.ClusterParameterGroup
+	}
+
+	if upgradeConfiguration.ParameterGroup != "" {
+		tdbc.parameterGroupName = &upgradeConfiguration.ParameterGroup
+	}
+}
+
 func (tdbc *targetDBConfiguration) setStorageSize(upgradeConfiguration *types.UpgradeDetails, snapshot *rdsTypes.DBSnapshot) {
 	if upgradeConfiguration.StorageSize == 0 {
 		log.Infoln("Storage size was not specified by the user. Copying existing one from source database snapshot!")
@@ -101,6 +147,7 @@ func (tdbc *targetDBConfiguration) setStorageSize(upgradeConfiguration *types.Up
 	}
 }
 
+// Provisioned IOPS storage keeps the IOPS of the snapshot unless set.
 func (tdbc *targetDBConfiguration) setStorageIOPS(upgradeConfiguration *types.UpgradeDetails) {
 	if *tdbc.storageType == GP3_STORAGE_TYPE {
 		if *tdbc.storageSize < GP3_STORAGE_SIZE_THRESHOLD {
@@ -112,6 +159,11 @@ func (tdbc *targetDBConfiguration) setStorageIOPS(upgradeConfiguration *types.Up
 			}
 			tdbc.iops = a.Int32(upgradeConfiguration.StorageIOPS)
 		}
+		return
+	}
+
+	if (*tdbc.storageType == IO1_STORAGE_TYPE || *tdbc.storageType == IO2_STORAGE_TYPE) && upgradeConfiguration.StorageIOPS != 0 {
+		tdbc.iops = a.Int32(upgradeConfiguration.StorageIOPS)
 	}
 }
 
@@ -120,7 +172,7 @@ func (tdbc *targetDBConfiguration) setStorageThroughput(upgradeConfiguration *ty
 		if *tdbc.storageSize < GP3_STORAGE_SIZE_THRESHOLD {
 			tdbc.storageThroughput = nil
 		} else {
-			if upgradeConfiguration.StorageThroughput == 0 || upgradeConfiguration.StorageIOPS < GP3_STORAGE_THROUGHPUT_LOW_WATERMARK {
+			if upgradeConfiguration.StorageThroughput == 0 || upgradeConfiguration.StorageThroughput < GP3_STORAGE_THROUGHPUT_LOW_WATERMARK {
 				tdbc.storageThroughput = a.Int32(GP3_STORAGE_THROUGHPUT_LOW_WATERMARK)
 				return
 			}
@@ -137,3 +189,157 @@ func (tdbc *targetDBConfiguration) setStorageType(upgradeConfiguration *types.Up
 		tdbc.storageType = &upgradeConfiguration.StorageType
 	}
 }
+
+// Option groups are bound to a major engine version, so a custom one can not be reused as is.
+func (tdbc *targetDBConfiguration) setOptionGroupName(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
+	if upgradeConfiguration.OptionGroup != "" {
+		tdbc.optionGroupName = &upgradeConfiguration.OptionGroup
+		return
+	}
+
+	for idx := range instance.OptionGroupMemberships {
+		if !strings.HasPrefix(*instance.OptionGroupMemberships[idx].OptionGroupName, DEFAULT_OPTION_GROUP_PREFIX) {
+			log.Warnf(
+				"Option group: '%s' belongs to the source engine version. Set 'upgrade.option_group' to keep its options. Using the default one.",
+				*instance.OptionGroupMemberships[idx].OptionGroupName,
+			)
+		}
+	}
+}
+
+func (tdbc *targetDBConfiguration) setPort(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
+	if upgradeConfiguration.Port != nil {
+		tdbc.port = upgradeConfiguration.Port
+	} else if instance.Endpoint != nil {
+		tdbc.port = a.Int32(instance.Endpoint.Port)
+	}
+}
+
+func (tdbc *targetDBConfiguration) setPubliclyAccessible(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
+	if upgradeConfiguration.PubliclyAccessible != nil {
+		tdbc.publiclyAccessible = upgradeConfiguration.PubliclyAccessible
+	} else {
+		tdbc.publiclyAccessible = a.Bool(instance.PubliclyAccessible)
+	}
+}
+
+func (tdbc *targetDBConfiguration) setCloudwatchLogsExports(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
+	if upgradeConfiguration.CloudwatchLogsExports != nil {
+		tdbc.cloudwatchLogsExports = upgradeConfiguration.CloudwatchLogsExports
+	} else {
+		tdbc.cloudwatchLogsExports = instance.EnabledCloudwatchLogsExports
+	}
+}
+
+func (tdbc *targetDBConfiguration) setBackupSettings(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
+	if upgradeConfiguration.BackupRetentionPeriod != nil {
+		tdbc.backupRetentionPeriod = upgradeConfiguration.BackupRetentionPeriod
+	} else {
+		tdbc.backupRetentionPeriod = a.Int32(instance.BackupRetentionPeriod)
+	}
+
+	if upgradeConfiguration.BackupWindow != "" {
+		tdbc.backupWindow = &upgradeConfiguration.BackupWindow
+	} else {
+		tdbc.backupWindow = instance.PreferredBackupWindow
+	}
+
+	if upgradeConfiguration.MaintenanceWindow != "" {
+		tdbc.maintenanceWindow = &upgradeConfiguration.MaintenanceWindow
+	} else {
+		tdbc.maintenanceWindow = instance.PreferredMaintenanceWindow
+	}
+}
+
+func (tdbc *targetDBConfiguration) setMaxAllocatedStorage(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
+	if upgradeConfiguration.MaxAllocatedStorage != nil {
+		tdbc.maxAllocatedStorage = upgradeConfiguration.MaxAllocatedStorage
+	} else {
+		tdbc.maxAllocatedStorage = instance.MaxAllocatedStorage
+	}
+}
+
+// The monitoring role can only be set together with a non-zero interval.
+func (tdbc *targetDBConfiguration) setMonitoring(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
+	if upgradeConfiguration.MonitoringInterval != nil {
+		tdbc.monitoringInterval = upgradeConfiguration.MonitoringInterval
+	} else {
+		tdbc.monitoringInterval = instance.MonitoringInterval
+	}
+
+	if a.ToInt32(tdbc.monitoringInterval) == 0 {
+		tdbc.monitoringRoleArn = nil
+		return
+	}
+
+	if upgradeConfiguration.MonitoringRoleArn != "" {
+		tdbc.monitoringRoleArn = &upgradeConfiguration.MonitoringRoleArn
+	} else {
+		tdbc.monitoringRoleArn = instance.MonitoringRoleArn
+	}
+}
+
+// A restore keeps the master user password of the snapshot, so the management by RDS is turned on afterwards.
+func (tdbc *targetDBConfiguration) setMasterUserSecret(instance *rdsTypes.DBInstance) {
+	if instance.MasterUserSecret == nil {
+		return
+	}
+
+	tdbc.manageMasterUserPassword = a.Bool(true)
+	tdbc.masterUserSecretKMSKeyID = instance.MasterUserSecret.KmsKeyId
+}
+
+func (tdbc *targetDBConfiguration) setPerformanceInsights(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) {
+	if upgradeConfiguration.PerformanceInsights != nil {
+		tdbc.performanceInsightsEnabled = upgradeConfiguration.PerformanceInsights
+	} else {
+		tdbc.performanceInsightsEnabled = a.Bool(a.ToBool(instance.PerformanceInsightsEnabled))
+	}
+
+	if !*tdbc.performanceInsightsEnabled {
+		tdbc.performanceInsightsKMSKeyID = nil
+		tdbc.performanceInsightsRetentionPeriod = nil
+		return
+	}
+
+	if upgradeConfiguration.PerformanceInsightsKMSKeyID != "" {
+		tdbc.performanceInsightsKMSKeyID = &upgradeConfiguration.PerformanceInsightsKMSKeyID
+	} else {
+		tdbc.performanceInsightsKMSKeyID = instance.PerformanceInsightsKMSKeyId
+	}
+
+	if upgradeConfiguration.PerformanceInsightsRetention != nil {
+		tdbc.performanceInsightsRetentionPeriod = upgradeConfiguration.PerformanceInsightsRetention
+	} else {
+		tdbc.performanceInsightsRetentionPeriod = instance.PerformanceInsightsRetentionPeriod
+	}
+}
+
+// Overrides are given as '<feature_name>=<role_arn>', e.g: 's3Import=arn:aws:iam::123456789012:role/rds-s3-import'.
+func (tdbc *targetDBConfiguration) setIAMRoles(upgradeConfiguration *types.UpgradeDetails, instance *rdsTypes.DBInstance) error {
+	if upgradeConfiguration.IAMRoles == nil {
+		for idx := range instance.AssociatedRoles {
+			tdbc.iamRoles = append(tdbc.iamRoles, rdsTypes.DBInstanceRole{
+				FeatureName: instance.AssociatedRoles[idx].FeatureName,
+				RoleArn:     instance.AssociatedRoles[idx].RoleArn,
+			})
+		}
+		return nil
+	}
+
+	for idx := range upgradeConfiguration.IAMRoles {
+		role := strings.SplitN(upgradeConfiguration.IAMRoles[idx], IAM_ROLE_OVERRIDE_SEPARATOR, 2)
+		if len(role) != 2 || role[0] == "" || role[1] == "" {
+			return errors.New(fmt.Sprintf(
+				"IAM role: '%s' must be specified as '<feature_name>=<role_arn>'!",
+				upgradeConfiguration.IAMRoles[idx],
+			))
+		}
+		tdbc.iamRoles = append(tdbc.iamRoles, rdsTypes.DBInstanceRole{
+			FeatureName: a.String(role[0]),
+			RoleArn:     a.String(role[1]),
+		})
+	}
+
+	return nil
+}
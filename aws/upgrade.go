@@ -11,6 +11,7 @@
 package aws
 
 import (
+	a "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 
@@ -33,7 +34,7 @@ func (c *Controller) getValidUpgradeTargets(instance *rdsTypes.DBInstance) (map[
 		DefaultOnly:   false,
 	}
 
-	paginator := rds.NewDescribeDBEngineVersionsPaginator(c.rdsClient, input)
+	paginator := rds.NewDescribeDBEngineVersionsPaginator(c.dstRDSClient, input)
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(*c.configuration.Context)
 		if err != nil {
@@ -75,6 +76,9 @@ func (c *Controller) IsValidUpgradeTarget(instance *rdsTypes.DBInstance) (bool,
 	}
 
 	if _, engineVersion := validUpgradeTargets[c.configuration.Items.Upgrade.EngineVersion]; engineVersion {
+		if c.IsAuroraTarget() {
+			return c.isValidAuroraEngineVersion()
+		}
 		return true, nil
 	}
 
@@ -86,3 +90,29 @@ func (c *Controller) IsValidUpgradeTarget(instance *rdsTypes.DBInstance) (bool,
 
 	return false, nil
 }
+
+// The snapshot is upgraded by the source engine before it is restored to a cluster,
+// so the desired version must be available for both of the engines.
+func (c *Controller) isValidAuroraEngineVersion() (bool, error) {
+	input := &rds.DescribeDBEngineVersionsInput{
+		Engine:        a.String(TARGET_ENGINE_AURORA_POSTGRESQL),
+		EngineVersion: &c.configuration.Items.Upgrade.EngineVersion,
+	}
+
+	output, err := c.dstRDSClient.DescribeDBEngineVersions(*c.configuration.Context, input)
+	if err != nil {
+		return false, err
+	}
+
+	if len(output.DBEngineVersions) > 0 {
+		return true, nil
+	}
+
+	log.Errorf(
+		"Desired version: %s is not available for engine: '%s'!",
+		c.configuration.Items.Upgrade.EngineVersion,
+		TARGET_ENGINE_AURORA_POSTGRESQL,
+	)
+
+	return false, nil
+}
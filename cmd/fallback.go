@@ -0,0 +1,66 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package cmd
+
+import (
+	"db_relocate/aws"
+	"db_relocate/database"
+	"db_relocate/haproxy"
+	"db_relocate/pgbouncer"
+	"db_relocate/types"
+	"db_relocate/upgrade"
+
+	"github.com/spf13/viper"
+)
+
+type FallbackCmd struct{}
+
+func (fc *FallbackCmd) Run(v *viper.Viper, errorChannel chan error) error {
+	configuration, err := types.ReadConfiguration(v)
+	if err != nil {
+		return err
+	}
+
+	awsController, err := aws.NewController(configuration, errorChannel)
+	if err != nil {
+		return err
+	}
+
+	dbController, err := database.NewController(configuration, awsController, errorChannel)
+	if err != nil {
+		return err
+	}
+
+	haproxyController, err := haproxy.NewController(configuration, errorChannel)
+	if err != nil {
+		return err
+	}
+
+	pgBouncerController, err := pgbouncer.NewController(configuration, errorChannel)
+	if err != nil {
+		return err
+	}
+
+	upgradeController := upgrade.NewController(
+		configuration,
+		dbController,
+		awsController,
+		haproxyController,
+		pgBouncerController,
+		errorChannel,
+	)
+
+	if err := upgradeController.Fallback(); err != nil {
+		return err
+	}
+
+	return nil
+}
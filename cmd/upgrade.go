@@ -13,6 +13,8 @@ package cmd
 import (
 	"db_relocate/aws"
 	"db_relocate/database"
+	"db_relocate/haproxy"
+	"db_relocate/pgbouncer"
 	"db_relocate/types"
 	"db_relocate/upgrade"
 
@@ -22,9 +24,7 @@ import (
 type RunCmd struct{}
 
 func (pc *RunCmd) Run(v *viper.Viper, errorChannel chan error) error {
-	configuration := types.ReadConfiguration(v)
-
-	dbController, err := database.NewController(configuration, errorChannel)
+	configuration, err := types.ReadConfiguration(v)
 	if err != nil {
 		return err
 	}
@@ -34,10 +34,27 @@ func (pc *RunCmd) Run(v *viper.Viper, errorChannel chan error) error {
 		return err
 	}
 
+	dbController, err := database.NewController(configuration, awsController, errorChannel)
+	if err != nil {
+		return err
+	}
+
+	haproxyController, err := haproxy.NewController(configuration, errorChannel)
+	if err != nil {
+		return err
+	}
+
+	pgBouncerController, err := pgbouncer.NewController(configuration, errorChannel)
+	if err != nil {
+		return err
+	}
+
 	upgradeController := upgrade.NewController(
 		configuration,
 		dbController,
 		awsController,
+		haproxyController,
+		pgBouncerController,
 		errorChannel,
 	)
 
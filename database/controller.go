@@ -11,71 +11,340 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"db_relocate/log"
 	thelper "db_relocate/testing"
 	"db_relocate/types"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// Builds short-lived passwords for the user of the source and the destination instance, e.g. RDS IAM auth tokens.
+type AuthTokenBuilder interface {
+	BuildSourceAuthToken(host string, port string, user string) (string, error)
+	BuildDestinationAuthToken(host string, port string, user string) (string, error)
+}
+
+// Reads the master user password RDS manages in Secrets Manager. Managed is false if RDS does not manage the
+// password of the user, in which case the configured one is used.
+type MasterUserSecretReader interface {
+	ReadSourceMasterUserPassword(user string) (string, bool, error)
+	ReadDestinationMasterUserPassword(instanceID string, user string) (string, bool, error)
+}
+
+type CredentialsProvider interface {
+	AuthTokenBuilder
+	MasterUserSecretReader
+}
+
+type authTokenFunc func(host string, port string, user string) (string, error)
+
+type masterUserPasswordFunc func() (string, bool, error)
+
+const (
+	// SQLSTATE of a failed password authentication.
+	INVALID_PASSWORD_ERROR_CODE pq.ErrorCode = "28P01"
+)
+
+// The mutex guards the connection, which is replaced once it is found closed, possibly by a background process.
 type databaseConnection struct {
 	connection *sqlx.DB
+	mutex      sync.Mutex
 	dsn        *string
 	id         *string
+	// Opens connections with a fresh auth token or the managed master user password instead of the DSN.
+	// Nil for password authentication.
+	connector driver.Connector
 }
 
+// The metrics and health check processes read the connections while the main flow initializes them,
+// so they are assigned under the mutex and read through getSrcDatabaseConnection and getDstDatabaseConnection there.
 type Controller struct {
 	srcDatabaseConnection *databaseConnection
 	dstDatabaseConnection *databaseConnection
+	mutex                 sync.Mutex
+	credentialsProvider   CredentialsProvider
 	configuration         *types.Configuration
 	errorChannel          chan error
 }
 
-func initDatabaseConnection(user *string, password *string, host *string, port *string, name *string, id *string) (*databaseConnection, error) {
-	dsn := fmt.Sprintf(
-		"user=%s password=%s host=%s port=%s dbname=%s sslmode=require",
-		*user,
-		*password,
-		*host,
-		*port,
-		*name,
+// Passwords generated by RDS may contain characters with a meaning in the DSN, so the password is quoted.
+func buildDSN(user string, password string, host string, port string, name string) string {
+	return fmt.Sprintf(
+		"user=%s password='%s' host=%s port=%s dbname=%s sslmode=require",
+		user,
+		strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password),
+		host,
+		port,
+		name,
 	)
-	connection, err := sqlx.Connect("postgres", dsn)
+}
+
+// An auth token is only checked when a connection is opened. Every new connection of the pool gets a fresh one,
+// so the pool keeps working after the 15 minutes a token is valid for.
+type authTokenConnector struct {
+	user      string
+	host      string
+	port      string
+	name      string
+	authToken authTokenFunc
+}
+
+func (atc *authTokenConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := atc.authToken(atc.host, atc.port, atc.user)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := pq.NewConnector(buildDSN(atc.user, token, atc.host, atc.port, atc.name))
+	if err != nil {
+		return nil, err
+	}
+
+	return connector.Connect(ctx)
+}
+
+func (atc *authTokenConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// RDS rotates the master user password it manages, which may happen during a long run. Once the password in use
+// is rejected, the secret is read again and the connection is retried with the current one.
+type masterUserPasswordConnector struct {
+	user               string
+	host               string
+	port               string
+	name               string
+	mutex              sync.Mutex
+	password           string
+	masterUserPassword masterUserPasswordFunc
+}
+
+func isAuthenticationFailure(err error) bool {
+	var pqError *pq.Error
+	return errors.As(err, &pqError) && pqError.Code == INVALID_PASSWORD_ERROR_CODE
+}
+
+func (mupc *masterUserPasswordConnector) connect(ctx context.Context, password string) (driver.Conn, error) {
+	connector, err := pq.NewConnector(buildDSN(mupc.user, password, mupc.host, mupc.port, mupc.name))
 	if err != nil {
 		return nil, err
 	}
 
+	return connector.Connect(ctx)
+}
+
+func (mupc *masterUserPasswordConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	mupc.mutex.Lock()
+	defer mupc.mutex.Unlock()
+
+	connection, err := mupc.connect(ctx, mupc.password)
+	if !isAuthenticationFailure(err) {
+		return connection, err
+	}
+
+	log.Warnf("Password of user: '%s' was rejected, reading the master user secret again as it may have been rotated.", mupc.user)
+	password, managed, readErr := mupc.masterUserPassword()
+	if readErr != nil {
+		return nil, readErr
+	}
+	if !managed {
+		return nil, err
+	}
+	mupc.password = password
+
+	return mupc.connect(ctx, mupc.password)
+}
+
+func (mupc *masterUserPasswordConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// Used to establish the connection as well as to re-establish it.
+func (dc *databaseConnection) open() (*sqlx.DB, error) {
+	if dc.connector == nil {
+		return sqlx.Connect("postgres", *dc.dsn)
+	}
+
+	connection := sqlx.NewDb(sql.OpenDB(dc.connector), "postgres")
+	if err := connection.Ping(); err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	return connection, nil
+}
+
+func initDatabaseConnection(user *string, password *string, host *string, port *string, name *string, id *string) (*databaseConnection, error) {
+	dsn := buildDSN(*user, *password, *host, *port, *name)
+
 	databaseConnection := &databaseConnection{
-		connection: connection,
-		dsn:        &dsn,
-		id:         id,
+		dsn: &dsn,
+		id:  id,
+	}
+
+	connection, err := databaseConnection.open()
+	if err != nil {
+		return nil, err
 	}
+	databaseConnection.connection = connection
 
 	return databaseConnection, nil
 }
 
-func (c *Controller) InitDestinationDatabaseConnection(host *string) error {
-	log.Infof("Initializing destination database connection to host: %s", *host)
+// The DSN is kept without a password, the tokens are only held by the open connections.
+func initIAMDatabaseConnection(user *string, host *string, port *string, name *string, id *string, authToken authTokenFunc) (*databaseConnection, error) {
+	dsn := buildDSN(*user, "", *host, *port, *name)
 
-	connectionId := "destination"
+	databaseConnection := &databaseConnection{
+		dsn: &dsn,
+		id:  id,
+		connector: &authTokenConnector{
+			user:      *user,
+			host:      *host,
+			port:      *port,
+			name:      *name,
+			authToken: authToken,
+		},
+	}
 
-	connection, err := initDatabaseConnection(
+	connection, err := databaseConnection.open()
+	if err != nil {
+		return nil, err
+	}
+	databaseConnection.connection = connection
+
+	return databaseConnection, nil
+}
+
+// The DSN is kept without a password, the current one is only held by the connector.
+func initMasterUserPasswordDatabaseConnection(
+	user *string,
+	password *string,
+	host *string,
+	port *string,
+	name *string,
+	id *string,
+	masterUserPassword masterUserPasswordFunc,
+) (*databaseConnection, error) {
+	dsn := buildDSN(*user, "", *host, *port, *name)
+
+	databaseConnection := &databaseConnection{
+		dsn: &dsn,
+		id:  id,
+		connector: &masterUserPasswordConnector{
+			user:               *user,
+			host:               *host,
+			port:               *port,
+			name:               *name,
+			password:           *password,
+			masterUserPassword: masterUserPassword,
+		},
+	}
+
+	connection, err := databaseConnection.open()
+	if err != nil {
+		return nil, err
+	}
+	databaseConnection.connection = connection
+
+	return databaseConnection, nil
+}
+
+func (c *Controller) isIAMAuth() bool {
+	return c.configuration.Items.Src.IAMAuth && c.credentialsProvider != nil
+}
+
+func (c *Controller) readSourceMasterUserPassword() (string, bool, error) {
+	if c.credentialsProvider == nil {
+		return "", false, nil
+	}
+
+	return c.credentialsProvider.ReadSourceMasterUserPassword(c.configuration.Items.Src.User)
+}
+
+func (c *Controller) readDestinationMasterUserPassword(instanceID string) masterUserPasswordFunc {
+	return func() (string, bool, error) {
+		if c.credentialsProvider == nil {
+			return "", false, nil
+		}
+
+		return c.credentialsProvider.ReadDestinationMasterUserPassword(instanceID, c.configuration.Items.Src.User)
+	}
+}
+
+// The password managed by RDS takes precedence over the configured one, which would not survive a rotation.
+func (c *Controller) initPasswordDatabaseConnection(host *string, port *string, id *string, masterUserPassword masterUserPasswordFunc) (*databaseConnection, error) {
+	password, managed, err := masterUserPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	if !managed {
+		return initDatabaseConnection(
+			&c.configuration.Items.Src.User,
+			&c.configuration.Items.Src.Password,
+			host,
+			port,
+			&c.configuration.Items.Src.Name,
+			id,
+		)
+	}
+
+	log.Infoln("Using the master user password managed by RDS.")
+	return initMasterUserPasswordDatabaseConnection(
 		&c.configuration.Items.Src.User,
-		&c.configuration.Items.Src.Password,
+		&password,
 		host,
-		&c.configuration.Items.Src.Port,
+		port,
 		&c.configuration.Items.Src.Name,
-		&connectionId,
+		id,
+		masterUserPassword,
 	)
+}
+
+// The port of the destination endpoint may differ from the source one, e.g. if it has been overridden on restore.
+// The instance identifier is used to look up the master user password, if it is managed by RDS.
+func (c *Controller) InitDestinationDatabaseConnection(instanceID *string, host *string, port int32) error {
+	log.Infof("Initializing destination database connection to host: %s", *host)
+
+	connectionId := "destination"
+	dstPort := strconv.Itoa(int(port))
+
+	var connection *databaseConnection
+	var err error
+	if c.isIAMAuth() {
+		log.Infoln("Using IAM database authentication.")
+		connection, err = initIAMDatabaseConnection(
+			&c.configuration.Items.Src.User,
+			host,
+			&dstPort,
+			&c.configuration.Items.Src.Name,
+			&connectionId,
+			c.credentialsProvider.BuildDestinationAuthToken,
+		)
+	} else {
+		connection, err = c.initPasswordDatabaseConnection(host, &dstPort, &connectionId, c.readDestinationMasterUserPassword(*instanceID))
+	}
 
 	if err != nil {
 		return err
 	}
 
+	c.mutex.Lock()
 	c.dstDatabaseConnection = connection
+	c.mutex.Unlock()
+	c.configuration.Items.Dst.Host = *host
+	c.configuration.Items.Dst.Port = dstPort
 
 	return nil
 }
@@ -85,29 +354,59 @@ func (c *Controller) InitSourceDatabaseConnection() error {
 
 	connectionId := "source"
 
-	connection, err := initDatabaseConnection(
-		&c.configuration.Items.Src.User,
-		&c.configuration.Items.Src.Password,
-		&c.configuration.Items.Src.Host,
-		&c.configuration.Items.Src.Port,
-		&c.configuration.Items.Src.Name,
-		&connectionId,
-	)
+	var connection *databaseConnection
+	var err error
+	if c.isIAMAuth() {
+		log.Infoln("Using IAM database authentication.")
+		connection, err = initIAMDatabaseConnection(
+			&c.configuration.Items.Src.User,
+			&c.configuration.Items.Src.Host,
+			&c.configuration.Items.Src.Port,
+			&c.configuration.Items.Src.Name,
+			&connectionId,
+			c.credentialsProvider.BuildSourceAuthToken,
+		)
+	} else {
+		connection, err = c.initPasswordDatabaseConnection(
+			&c.configuration.Items.Src.Host,
+			&c.configuration.Items.Src.Port,
+			&connectionId,
+			c.readSourceMasterUserPassword,
+		)
+	}
 
 	if err != nil {
 		return err
 	}
 
+	c.mutex.Lock()
 	c.srcDatabaseConnection = connection
+	c.mutex.Unlock()
 
 	return nil
 }
 
-func NewController(configuration *types.Configuration, errorChannel chan error) (*Controller, error) {
+func (c *Controller) getSrcDatabaseConnection() *databaseConnection {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.srcDatabaseConnection
+}
+
+func (c *Controller) getDstDatabaseConnection() *databaseConnection {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.dstDatabaseConnection
+}
+
+// Auth tokens are only used with IAM database authentication, the master user secret only if RDS manages it.
+func NewController(configuration *types.Configuration, credentialsProvider CredentialsProvider, errorChannel chan error) (*Controller, error) {
 	log.Infoln("Initializing database controller.")
 	controller := &Controller{
-		configuration: configuration,
-		errorChannel:  errorChannel,
+		credentialsProvider: credentialsProvider,
+		configuration:       configuration,
+		errorChannel:        errorChannel,
 	}
 
 	err := controller.InitSourceDatabaseConnection()
@@ -0,0 +1,82 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		expected string
+	}{
+		{
+			name:     "plain password",
+			password: "secret",
+			expected: "user=ops password='secret' host=test-db port=5432 dbname=postgres sslmode=require",
+		},
+		{
+			name:     "generated password with quotes, backslashes and spaces",
+			password: `a'b\c d`,
+			expected: `user=ops password='a\'b\\c d' host=test-db port=5432 dbname=postgres sslmode=require`,
+		},
+		{
+			name:     "no password",
+			password: "",
+			expected: "user=ops password='' host=test-db port=5432 dbname=postgres sslmode=require",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			assert.Equal(t, test.expected, buildDSN("ops", test.password, "test-db", "5432", "postgres"))
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestIsAuthenticationFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "password authentication failed",
+			err:      &pq.Error{Code: INVALID_PASSWORD_ERROR_CODE},
+			expected: true,
+		},
+		{
+			name: "database does not exist",
+			err:  &pq.Error{Code: "3D000"},
+		},
+		{
+			name: "network error",
+			err:  errors.New("connection refused"),
+		},
+		{
+			name: "no error",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			assert.Equal(t, test.expected, isAuthenticationFailure(test.err))
+		}
+		t.Run(test.name, testFunction)
+	}
+}
@@ -71,7 +71,7 @@ func (c *Controller) insertHeartBeatRecord(timestamp *int64) error {
 	log.Debugf("Inserting a new heart beat record with value: %d", *timestamp)
 
 	statement := `INSERT INTO %s (timestamp) VALUES(%d);`
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, HEALTHCHECK_TABLE_NAME, *timestamp)
+	err := c.writeTransaction(c.getSrcDatabaseConnection(), &statement, HEALTHCHECK_TABLE_NAME, *timestamp)
 
 	return err
 }
@@ -132,6 +132,44 @@ func (c *Controller) BeginHealthCheckProcess(heartBeatRecords *[]int64) (*time.T
 	return healthCheckProcessTicker, healthCheckCompletionChannel
 }
 
+// Returns nil if there is no connection or health check table yet.
+func (c *Controller) countHeartBeatRecords(databaseConnection *databaseConnection) (*int, error) {
+	if databaseConnection == nil {
+		return nil, nil
+	}
+
+	healthCheckTableName := HEALTHCHECK_TABLE_NAME
+	exists, err := c.tableExists(databaseConnection, &healthCheckTableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	counts := []int64{}
+
+	statement := `SELECT count(*) FROM %s;`
+
+	_, err = c.readTransaction(&counts, databaseConnection, &statement, HEALTHCHECK_TABLE_NAME)
+	if err != nil {
+		return nil, err
+	}
+
+	count := int(counts[0])
+
+	return &count, nil
+}
+
+func (c *Controller) CountSentHeartBeatRecords() (*int, error) {
+	return c.countHeartBeatRecords(c.getSrcDatabaseConnection())
+}
+
+func (c *Controller) CountReceivedHeartBeatRecords() (*int, error) {
+	return c.countHeartBeatRecords(c.getDstDatabaseConnection())
+}
+
 func (c *Controller) DropHealthCheckTable() error {
 	log.Infoln("Deleting the healthcheck table that was used during the upgrade/migration process.")
 	healthCheckTableName := HEALTHCHECK_TABLE_NAME
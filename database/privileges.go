@@ -13,6 +13,7 @@ package database
 const (
 	RDS_SUPERUSER_ROLE_NAME   string = "rds_superuser"
 	RDS_REPLICATION_ROLE_NAME string = "rds_replication"
+	RDS_IAM_ROLE_NAME         string = "rds_iam"
 )
 
 func (c *Controller) getDatabaseOwner(database *string) (*string, error) {
@@ -34,7 +35,7 @@ func (c *Controller) getDatabaseOwner(database *string) (*string, error) {
 	return &owners[0], nil
 }
 
-func (c *Controller) listMissingReadOnlyPrivilegesForTablesInSchemaAndDatabaseForUser(u *user, database *string, schema *string) (bool, error) {
+func (c *Controller) listMissingReadOnlyPrivilegesForTablesInSchemaAndDatabaseForUser(databaseConnection *databaseConnection, u *user, database *string, schema *string) (bool, error) {
 	tablePrivileges := []tablePrivilege{}
 
 	statement := `
@@ -68,13 +69,13 @@ func (c *Controller) listMissingReadOnlyPrivilegesForTablesInSchemaAndDatabaseFo
 			tp.privilege_type IS NULL
 		);`
 
-	result, err := c.readTransaction(&tablePrivileges, c.srcDatabaseConnection, &statement, u.Name, *database, *schema)
+	result, err := c.readTransaction(&tablePrivileges, databaseConnection, &statement, u.Name, *database, *schema)
 
 	return result, err
 }
 
-func (c *Controller) ensureReadOnlyPrivilegesForUserInSchemaAndDatabase(u *user, database *string, schema *string) error {
-	foundMissingPrivileges, err := c.listMissingReadOnlyPrivilegesForTablesInSchemaAndDatabaseForUser(u, database, schema)
+func (c *Controller) ensureReadOnlyPrivilegesForUserInSchemaAndDatabase(databaseConnection *databaseConnection, u *user, database *string, schema *string) error {
+	foundMissingPrivileges, err := c.listMissingReadOnlyPrivilegesForTablesInSchemaAndDatabaseForUser(databaseConnection, u, database, schema)
 	if err != nil {
 		return err
 	}
@@ -86,7 +87,7 @@ func (c *Controller) ensureReadOnlyPrivilegesForUserInSchemaAndDatabase(u *user,
 	statement := `GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s;`
 
 	err = c.writeTransaction(
-		c.srcDatabaseConnection,
+		databaseConnection,
 		&statement,
 		c.configuration.Items.Src.Schema,
 		c.configuration.Items.Upgrade.User,
@@ -95,14 +96,14 @@ func (c *Controller) ensureReadOnlyPrivilegesForUserInSchemaAndDatabase(u *user,
 	return err
 }
 
-func (c *Controller) ensureReplicationPrivilege(u *user) error {
+func (c *Controller) ensureReplicationPrivilege(databaseConnection *databaseConnection, u *user) error {
 	if u.memberOf(RDS_REPLICATION_ROLE_NAME) {
 		return nil
 	}
 
 	statement := `GRANT %s TO %s;`
 
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, RDS_REPLICATION_ROLE_NAME, u.Name)
+	err := c.writeTransaction(databaseConnection, &statement, RDS_REPLICATION_ROLE_NAME, u.Name)
 
 	return err
 }
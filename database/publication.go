@@ -16,24 +16,24 @@ const (
 	PUBLICATION_NAME string = "upgrade"
 )
 
-func (c *Controller) createPublication(publicationName *string) error {
+func (c *Controller) createPublication(databaseConnection *databaseConnection, publicationName *string) error {
 	statement := `
 	CREATE publication %s
 	FOR ALL TABLES;`
 
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, *publicationName)
+	err := c.writeTransaction(databaseConnection, &statement, *publicationName)
 
 	return err
 }
 
-func (c *Controller) dropPublication(publicationName *string) error {
+func (c *Controller) dropPublication(databaseConnection *databaseConnection, publicationName *string) error {
 	statement := `DROP publication %s;`
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, *publicationName)
+	err := c.writeTransaction(databaseConnection, &statement, *publicationName)
 
 	return err
 }
 
-func (c *Controller) publicationExists(publicationName *string) (bool, error) {
+func (c *Controller) publicationExists(databaseConnection *databaseConnection, publicationName *string) (bool, error) {
 	publications := []publication{}
 
 	statement := `
@@ -47,26 +47,26 @@ func (c *Controller) publicationExists(publicationName *string) (bool, error) {
 	FROM pg_catalog.pg_publication AS p
 	WHERE p.pubname = '%s';`
 
-	exists, err := c.readTransaction(&publications, c.srcDatabaseConnection, &statement, *publicationName)
+	exists, err := c.readTransaction(&publications, databaseConnection, &statement, *publicationName)
 
 	return exists, err
 }
 
-func (c *Controller) ensurePublication(publicationName *string) error {
-	exists, err := c.publicationExists(publicationName)
+func (c *Controller) ensurePublication(databaseConnection *databaseConnection, publicationName *string) error {
+	exists, err := c.publicationExists(databaseConnection, publicationName)
 	if err != nil {
 		return err
 	}
 
 	// TODO: add force flag logic
 	if exists {
-		err = c.dropPublication(publicationName)
+		err = c.dropPublication(databaseConnection, publicationName)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = c.createPublication(publicationName)
+	err = c.createPublication(databaseConnection, publicationName)
 
 	return err
 }
@@ -75,13 +75,13 @@ func (c *Controller) DropUpgradePublication() error {
 	log.Infoln("Deleting the upgrade publication that was used during the upgrade/migration process.")
 
 	publicationName := PUBLICATION_NAME
-	exists, err := c.publicationExists(&publicationName)
+	exists, err := c.publicationExists(c.srcDatabaseConnection, &publicationName)
 	if err != nil {
 		return err
 	}
 
 	if exists {
-		err = c.dropPublication(&publicationName)
+		err = c.dropPublication(c.srcDatabaseConnection, &publicationName)
 		if err != nil {
 			return err
 		}
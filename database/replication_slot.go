@@ -12,32 +12,37 @@ package database
 
 import (
 	"db_relocate/log"
+	"db_relocate/types"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 )
 
 const (
-	REPLICATION_SLOT_NAME   string        = "upgrade"
-	WAIT_UNTIL_SYNC_TIMEOUT time.Duration = 1440 // minutes
+	REPLICATION_SLOT_NAME          string        = "upgrade"
+	LOGICAL_WAL_LEVEL              string        = "logical"
+	WAIT_UNTIL_SYNC_TIMEOUT        time.Duration = 1440 // minutes
+	WAIT_UNTIL_SYNC_CHECK_INTERVAL time.Duration = 10   // seconds
 )
 
-func (c *Controller) createLogicalReplicationSlot() error {
+func (c *Controller) createLogicalReplicationSlot(databaseConnection *databaseConnection, replicationSlotName *string) error {
 	statement := `SELECT pg_create_logical_replication_slot('%s', 'pgoutput');`
 
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, REPLICATION_SLOT_NAME)
+	err := c.writeTransaction(databaseConnection, &statement, *replicationSlotName)
 
 	return err
 }
 
-func (c *Controller) dropLogicalReplicationSlot(replicationSlotName *string) error {
+func (c *Controller) dropLogicalReplicationSlot(databaseConnection *databaseConnection, replicationSlotName *string) error {
 	statement := `SELECT pg_drop_replication_slot('%s');`
 
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, *replicationSlotName)
+	err := c.writeTransaction(databaseConnection, &statement, *replicationSlotName)
 
 	return err
 }
 
-func (c *Controller) getLSNDistanceForLogicalReplicationSlot(replicationSlotName *string) (*int64, error) {
+func (c *Controller) getLSNDistanceForLogicalReplicationSlot(databaseConnection *databaseConnection, replicationSlotName *string) (*int64, error) {
 	lsnDistances := []string{}
 
 	statement := `
@@ -46,7 +51,7 @@ func (c *Controller) getLSNDistanceForLogicalReplicationSlot(replicationSlotName
 	FROM pg_catalog.pg_replication_slots
 	WHERE slot_name = '%s';`
 
-	_, err := c.readTransaction(&lsnDistances, c.srcDatabaseConnection, &statement, *replicationSlotName)
+	_, err := c.readTransaction(&lsnDistances, databaseConnection, &statement, *replicationSlotName)
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +64,43 @@ func (c *Controller) getLSNDistanceForLogicalReplicationSlot(replicationSlotName
 	return &lsnDistance, nil
 }
 
-func (c *Controller) logicalReplicationSlotExists(replicationSlotName *string) (bool, error) {
+// The time lag is only reported by PostgreSQL while the subscriber is connected, it is 0 otherwise.
+func (c *Controller) getReplicationLagForLogicalReplicationSlot(databaseConnection *databaseConnection, replicationSlotName *string) (*types.ReplicationLag, error) {
+	if databaseConnection == nil {
+		return nil, nil
+	}
+
+	replicationLags := []types.ReplicationLag{}
+
+	statement := `
+	SELECT
+		COALESCE(pg_current_wal_lsn() - s.confirmed_flush_lsn, 0)::bigint AS byte_lag,
+		COALESCE(EXTRACT(EPOCH FROM r.replay_lag), 0)::float8 AS time_lag,
+		COALESCE(pg_current_wal_lsn() - s.restart_lsn, 0)::bigint AS retained_wal
+	FROM pg_catalog.pg_replication_slots s
+	LEFT JOIN pg_catalog.pg_stat_replication r ON r.pid = s.active_pid
+	WHERE s.slot_name = '%s';`
+
+	exists, err := c.readTransaction(&replicationLags, databaseConnection, &statement, *replicationSlotName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	return &replicationLags[0], nil
+}
+
+// Returns nil if there is no connection or the upgrade replication slot does not exist.
+func (c *Controller) GetUpgradeReplicationLag() (*types.ReplicationLag, error) {
+	replicationSlotName := REPLICATION_SLOT_NAME
+
+	return c.getReplicationLagForLogicalReplicationSlot(c.getSrcDatabaseConnection(), &replicationSlotName)
+}
+
+func (c *Controller) logicalReplicationSlotExists(databaseConnection *databaseConnection, replicationSlotName *string) (bool, error) {
 	replicationSlots := []replicationSlot{}
 	statement := `
         SELECT
@@ -71,7 +112,7 @@ func (c *Controller) logicalReplicationSlotExists(replicationSlotName *string) (
         FROM pg_catalog.pg_replication_slots
 	WHERE slot_name = '%s';`
 
-	exists, err := c.readTransaction(&replicationSlots, c.srcDatabaseConnection, &statement, *replicationSlotName)
+	exists, err := c.readTransaction(&replicationSlots, databaseConnection, &statement, *replicationSlotName)
 	if err != nil {
 		return false, err
 	}
@@ -82,41 +123,98 @@ func (c *Controller) logicalReplicationSlotExists(replicationSlotName *string) (
 func (c *Controller) UpgradeLogicalReplicationSlotExists() (bool, error) {
 	replicationSlotName := REPLICATION_SLOT_NAME
 
-	return c.logicalReplicationSlotExists(&replicationSlotName)
+	return c.logicalReplicationSlotExists(c.srcDatabaseConnection, &replicationSlotName)
+}
+
+// The confirmed flush LSN stays at the position the slot was created at until a subscription consumes it.
+// Returns nil if the replication slot does not exist.
+func (c *Controller) getLogicalReplicationSlotLSN(databaseConnection *databaseConnection, replicationSlotName *string) (*string, error) {
+	lsns := []string{}
+	statement := `
+	SELECT
+		confirmed_flush_lsn::text AS lsn
+	FROM pg_catalog.pg_replication_slots
+	WHERE slot_name = '%s';`
+
+	exists, err := c.readTransaction(&lsns, databaseConnection, &statement, *replicationSlotName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	return &lsns[0], nil
 }
 
-func (c *Controller) ensureLogicalReplicationSlot() error {
+func (c *Controller) GetUpgradeLogicalReplicationSlotLSN() (*string, error) {
 	replicationSlotName := REPLICATION_SLOT_NAME
-	exists, err := c.logicalReplicationSlotExists(&replicationSlotName)
+
+	return c.getLogicalReplicationSlotLSN(c.srcDatabaseConnection, &replicationSlotName)
+}
+
+func (c *Controller) ensureLogicalReplicationSlot(databaseConnection *databaseConnection, replicationSlotName *string) error {
+	exists, err := c.logicalReplicationSlotExists(databaseConnection, replicationSlotName)
 	if err != nil {
 		return err
 	}
 
 	// TODO: add force logic
 	if exists {
-		err = c.dropLogicalReplicationSlot(&replicationSlotName)
+		err = c.dropLogicalReplicationSlot(databaseConnection, replicationSlotName)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = c.createLogicalReplicationSlot()
+	err = c.createLogicalReplicationSlot(databaseConnection, replicationSlotName)
 
 	return err
 }
 
+func (c *Controller) ensureLogicalWALLevel(databaseConnection *databaseConnection) error {
+	walLevels := []string{}
+
+	statement := `SELECT current_setting('wal_level');`
+
+	exists, err := c.readTransaction(&walLevels, databaseConnection, &statement)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return errors.New("Failed to read the WAL level!")
+	}
+
+	if walLevels[0] != LOGICAL_WAL_LEVEL {
+		return errors.New(fmt.Sprintf(
+			"WAL level of the %s database is: '%s', logical decoding requires: '%s'. Set 'rds.logical_replication' to 1 and reboot the instance!",
+			*databaseConnection.id,
+			walLevels[0],
+			LOGICAL_WAL_LEVEL,
+		))
+	}
+
+	return nil
+}
+
+// Reverse replication decodes the WAL of the new instance, which is only possible with the logical WAL level.
+func (c *Controller) EnsureLogicalReplicationOnDstDatabase() error {
+	return c.ensureLogicalWALLevel(c.dstDatabaseConnection)
+}
+
 func (c *Controller) DropUpgradeLogicalReplicationSlot() error {
 	log.Infoln("Deleting the upgrade replication slot that was used during the upgrade/migration process.")
 
 	replicationSlotName := REPLICATION_SLOT_NAME
-	exists, err := c.logicalReplicationSlotExists(&replicationSlotName)
+	exists, err := c.logicalReplicationSlotExists(c.srcDatabaseConnection, &replicationSlotName)
 	if err != nil {
 		return err
 	}
 
 	if exists {
-		replicationSlotName := REPLICATION_SLOT_NAME
-		err = c.dropLogicalReplicationSlot(&replicationSlotName)
+		err = c.dropLogicalReplicationSlot(c.srcDatabaseConnection, &replicationSlotName)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,125 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package database
+
+import (
+	"database/sql/driver"
+	"db_relocate/types"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUpgradeReplicationLag(t *testing.T) {
+	c, mock := setupDatabaseMockData()
+
+	statement := `
+	SELECT
+		COALESCE(pg_current_wal_lsn() - s.confirmed_flush_lsn, 0)::bigint AS byte_lag,
+		COALESCE(EXTRACT(EPOCH FROM r.replay_lag), 0)::float8 AS time_lag,
+		COALESCE(pg_current_wal_lsn() - s.restart_lsn, 0)::bigint AS retained_wal
+	FROM pg_catalog.pg_replication_slots s
+	LEFT JOIN pg_catalog.pg_stat_replication r ON r.pid = s.active_pid
+	WHERE s.slot_name = 'upgrade';`
+
+	tests := []struct {
+		name                   string
+		rows                   [][]driver.Value
+		expectedReplicationLag *types.ReplicationLag
+	}{
+		{
+			name: "replication slot exists",
+			rows: [][]driver.Value{{1024, 2.5, 4096}},
+			expectedReplicationLag: &types.ReplicationLag{
+				ByteLag:     1024,
+				TimeLag:     2.5,
+				RetainedWAL: 4096,
+			},
+		},
+		{
+			name:                   "replication slot does not exist",
+			rows:                   [][]driver.Value{},
+			expectedReplicationLag: nil,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			query := c.buildQuery(&statement)
+			rows := sqlmock.NewRows([]string{"byte_lag", "time_lag", "retained_wal"}).AddRows(test.rows...)
+			(*mock).ExpectQuery(regexp.QuoteMeta(*query)).WillReturnRows(rows).WillReturnError(nil)
+
+			replicationLag, err := c.GetUpgradeReplicationLag()
+			assert.NoError(t, err, "no error must be raised")
+			assert.Equal(t, test.expectedReplicationLag, replicationLag)
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestGetUpgradeLogicalReplicationSlotLSN(t *testing.T) {
+	c, mock := setupDatabaseMockData()
+
+	statement := `
+	SELECT
+		confirmed_flush_lsn::text AS lsn
+	FROM pg_catalog.pg_replication_slots
+	WHERE slot_name = 'upgrade';`
+
+	replicationSlotLSN := "0/16B3748"
+	tests := []struct {
+		name                       string
+		rows                       [][]driver.Value
+		expectedReplicationSlotLSN *string
+	}{
+		{
+			name:                       "replication slot exists",
+			rows:                       [][]driver.Value{{replicationSlotLSN}},
+			expectedReplicationSlotLSN: &replicationSlotLSN,
+		},
+		{
+			name:                       "replication slot does not exist",
+			rows:                       [][]driver.Value{},
+			expectedReplicationSlotLSN: nil,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			query := c.buildQuery(&statement)
+			rows := sqlmock.NewRows([]string{"lsn"}).AddRows(test.rows...)
+			(*mock).ExpectQuery(regexp.QuoteMeta(*query)).WillReturnRows(rows).WillReturnError(nil)
+
+			lsn, err := c.GetUpgradeLogicalReplicationSlotLSN()
+			assert.NoError(t, err, "no error must be raised")
+			assert.Equal(t, test.expectedReplicationSlotLSN, lsn)
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestGetUpgradeReplicationLagWithoutConnection(t *testing.T) {
+	c := &Controller{}
+
+	replicationLag, err := c.GetUpgradeReplicationLag()
+	assert.NoError(t, err, "no error must be raised before the connection is initialized")
+	assert.Nil(t, replicationLag)
+}
@@ -0,0 +1,260 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package database
+
+import (
+	"db_relocate/log"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	REVERSE_PUBLICATION_NAME       string = "upgrade_reverse"
+	REVERSE_SUBSCRIPTION_NAME      string = "upgrade_reverse"
+	REVERSE_REPLICATION_SLOT_NAME  string = "upgrade_reverse"
+	ORIGIN_NONE_MIN_SERVER_VERSION int    = 160000
+)
+
+func (c *Controller) getServerVersionNumber(databaseConnection *databaseConnection) (int, error) {
+	versions := []string{}
+
+	statement := `SELECT current_setting('server_version_num');`
+
+	exists, err := c.readTransaction(&versions, databaseConnection, &statement)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, errors.New("Failed to read the server version number!")
+	}
+
+	return strconv.Atoi(versions[0])
+}
+
+// The 'origin' subscription option is only available starting from PostgreSQL 16.
+// It prevents changes that have been replicated into the subscriber from being sent back.
+func (c *Controller) buildSubscriptionOriginOption(databaseConnection *databaseConnection) (string, error) {
+	serverVersionNumber, err := c.getServerVersionNumber(databaseConnection)
+	if err != nil {
+		return "", err
+	}
+
+	if serverVersionNumber < ORIGIN_NONE_MIN_SERVER_VERSION {
+		log.Warnf(
+			"Server version '%d' does not support 'origin = none' subscription option. Skipping it.",
+			serverVersionNumber,
+		)
+		return "", nil
+	}
+
+	return `,
+		origin = none`, nil
+}
+
+func (c *Controller) createReverseSubscription() error {
+	originOption, err := c.buildSubscriptionOriginOption(c.srcDatabaseConnection)
+	if err != nil {
+		return err
+	}
+
+	statement := `
+	CREATE SUBSCRIPTION %s
+	CONNECTION 'host=%s port=%s dbname=%s user=%s password=%s'
+	PUBLICATION %s
+	WITH (
+		copy_data = false,
+		synchronous_commit = false,
+		connect = true,
+		enabled = true,
+		create_slot = false,
+		slot_name = '%s'%s
+	);`
+
+	err = c.writeTransaction(
+		c.srcDatabaseConnection,
+		&statement,
+		REVERSE_SUBSCRIPTION_NAME,
+		c.configuration.Items.Dst.Host,
+		c.configuration.Items.Dst.Port,
+		c.configuration.Items.Src.Name,
+		c.configuration.Items.Upgrade.User,
+		c.configuration.Items.Upgrade.Password,
+		REVERSE_PUBLICATION_NAME,
+		REVERSE_REPLICATION_SLOT_NAME,
+		originOption,
+	)
+
+	return err
+}
+
+func (c *Controller) dropReverseReplication() error {
+	subscriptionName := REVERSE_SUBSCRIPTION_NAME
+	exists, err := c.subscriptionExists(c.srcDatabaseConnection, &subscriptionName)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		err = c.dropSubscription(c.srcDatabaseConnection, &subscriptionName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The slot is normally dropped together with the subscription, unless the destination was unreachable.
+	replicationSlotName := REVERSE_REPLICATION_SLOT_NAME
+	exists, err = c.logicalReplicationSlotExists(c.dstDatabaseConnection, &replicationSlotName)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		err = c.dropLogicalReplicationSlot(c.dstDatabaseConnection, &replicationSlotName)
+		if err != nil {
+			return err
+		}
+	}
+
+	publicationName := REVERSE_PUBLICATION_NAME
+	exists, err = c.publicationExists(c.dstDatabaseConnection, &publicationName)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		err = c.dropPublication(c.dstDatabaseConnection, &publicationName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Must be called only after the application traffic has been switched to the destination database.
+func (c *Controller) EnableReverseReplication() error {
+	log.Infoln("Enabling reverse replication from the new instance back to the old one.")
+
+	subscriptionName := REVERSE_SUBSCRIPTION_NAME
+	exists, err := c.subscriptionExists(c.srcDatabaseConnection, &subscriptionName)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		log.Infoln("Reverse replication is already enabled.")
+		return nil
+	}
+
+	err = c.ensureLogicalWALLevel(c.dstDatabaseConnection)
+	if err != nil {
+		return err
+	}
+
+	err = c.ensureUpgradeUser(c.dstDatabaseConnection)
+	if err != nil {
+		return err
+	}
+
+	// The reverse publication and slot are created before anything is dropped, so a failure leaves the forward replication intact.
+	// The application no longer writes to the old instance, so the forward replication has nothing left to feed into the reverse slot.
+	publicationName := REVERSE_PUBLICATION_NAME
+	err = c.ensurePublication(c.dstDatabaseConnection, &publicationName)
+	if err != nil {
+		return err
+	}
+
+	// A freshly created slot starts from the current LSN of the destination database.
+	replicationSlotName := REVERSE_REPLICATION_SLOT_NAME
+	err = c.ensureLogicalReplicationSlot(c.dstDatabaseConnection, &replicationSlotName)
+	if err != nil {
+		return err
+	}
+
+	// The forward replication has to be removed before subscribing, otherwise the changes would travel in circles.
+	err = c.DeleteUpgradeSubscription()
+	if err != nil {
+		return err
+	}
+
+	err = c.DropUpgradeLogicalReplicationSlot()
+	if err != nil {
+		return err
+	}
+
+	err = c.createReverseSubscription()
+	if err != nil {
+		return err
+	}
+
+	log.Infoln("Reverse replication is up and running. The old instance will be kept up to date.")
+
+	return nil
+}
+
+// Must be called only after the application has stopped writing to the destination database.
+func (c *Controller) FallbackToSourceDatabase() error {
+	log.Infoln("Falling back to the old instance.")
+
+	replicationSlotName := REVERSE_REPLICATION_SLOT_NAME
+	err := c.waitUntilSync(
+		c.dstDatabaseConnection,
+		&replicationSlotName,
+		time.Minute*WAIT_UNTIL_SYNC_TIMEOUT,
+		time.Second*WAIT_UNTIL_SYNC_CHECK_INTERVAL,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = c.dropReverseReplication()
+	if err != nil {
+		return err
+	}
+
+	err = c.copySequenceValues(c.dstDatabaseConnection, c.srcDatabaseConnection)
+	if err != nil {
+		return err
+	}
+
+	// The old instance might still be read-only after an automated switchover.
+	err = c.LiftSrcDatabaseWriteFreeze()
+	if err != nil {
+		return err
+	}
+
+	// Flip the direction again so the new instance stays up to date for another attempt.
+	err = c.DeleteUpgradeSubscription()
+	if err != nil {
+		return err
+	}
+
+	err = c.PrepareSrcDatabaseForUpgrade(false)
+	if err != nil {
+		return err
+	}
+
+	err = c.createDisabledSubscription()
+	if err != nil {
+		return err
+	}
+
+	err = c.enableSubscription()
+	if err != nil {
+		return err
+	}
+
+	log.Infoln("Replication from the old instance to the new one has been restored.")
+
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package database
+
+import (
+	"database/sql/driver"
+	thelper "db_relocate/testing"
+	"db_relocate/types"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSubscriptionOriginOption(t *testing.T) {
+	c, mock := setupDatabaseMockData()
+
+	statement := `SELECT current_setting('server_version_num');`
+
+	tests := []struct {
+		name                 string
+		serverVersionNumber  string
+		expectedOriginOption string
+	}{
+		{
+			name:                 "server version does not support origin option",
+			serverVersionNumber:  "150004",
+			expectedOriginOption: "",
+		},
+		{
+			name:                 "server version supports origin option",
+			serverVersionNumber:  "160001",
+			expectedOriginOption: ",\n\t\torigin = none",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			query := c.buildQuery(&statement)
+			thelper.EscapeParanthesis(query)
+			rows := sqlmock.NewRows([]string{"current_setting"}).AddRow(test.serverVersionNumber)
+			(*mock).ExpectQuery(*query).WillReturnRows(rows).WillReturnError(nil)
+
+			originOption, err := c.buildSubscriptionOriginOption(c.srcDatabaseConnection)
+			assert.NoError(t, err, "no error must be raised")
+			assert.Equal(t, test.expectedOriginOption, originOption, "received origin option must match expected origin option")
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func setupReverseReplicationMockData() (*Controller, *sqlmock.Sqlmock) {
+	c, mock := setupDatabaseMockData()
+
+	c.configuration.Items = &types.Items{
+		Src:        &types.DBInstanceDetails{User: "ops", Name: "postgres", Schema: "public", Host: "src.example.com", Port: "5432"},
+		Dst:        &types.DBInstanceDetails{Host: "dst.example.com", Port: "5433"},
+		Upgrade:    &types.UpgradeDetails{User: "upgrade", Password: "test-password"},
+		Switchover: &types.SwitchoverDetails{ApplicationRoles: []string{"app"}},
+	}
+
+	return c, mock
+}
+
+// Both connections share the same mock, so the statements are expected in the order they run on either instance.
+func expectRead(mock sqlmock.Sqlmock, statement string, columns []string, values ...[]driver.Value) {
+	mock.ExpectQuery(regexp.QuoteMeta(statement)).WillReturnRows(sqlmock.NewRows(columns).AddRows(values...))
+}
+
+func expectWrite(mock sqlmock.Sqlmock, statement string) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
+
+func expectSimpleWrite(mock sqlmock.Sqlmock, statement string) {
+	mock.ExpectExec(regexp.QuoteMeta(statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectEnsureUpgradeUser(mock sqlmock.Sqlmock) {
+	expectRead(mock, "WHERE roles.rolname='upgrade'", []string{"name", "login", "member_of"}, []driver.Value{"upgrade", "true", "rds_replication"})
+	expectWrite(mock, "ALTER ROLE upgrade WITH PASSWORD 'test-password';")
+	expectRead(mock, "information_schema.table_privileges AS tp", []string{"name"})
+}
+
+func TestEnableReverseReplication(t *testing.T) {
+	tests := []struct {
+		name          string
+		expect        func(mock sqlmock.Sqlmock)
+		expectedError bool
+	}{
+		{
+			name: "reverse replication is already enabled",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectRead(mock, "WHERE subname='upgrade_reverse';", []string{"name"}, []driver.Value{"upgrade_reverse"})
+			},
+		},
+		{
+			name: "reverse slot is created before the forward replication is dropped",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectRead(mock, "WHERE subname='upgrade_reverse';", []string{"name"})
+				expectRead(mock, "SELECT current_setting('wal_level');", []string{"current_setting"}, []driver.Value{"logical"})
+				expectEnsureUpgradeUser(mock)
+				expectRead(mock, "WHERE p.pubname = 'upgrade_reverse';", []string{"name"})
+				expectWrite(mock, "CREATE publication upgrade_reverse")
+				expectRead(mock, "WHERE slot_name = 'upgrade_reverse';", []string{"name"})
+				expectWrite(mock, "SELECT pg_create_logical_replication_slot('upgrade_reverse', 'pgoutput');")
+				expectRead(mock, "WHERE subname='upgrade';", []string{"name"}, []driver.Value{"upgrade"})
+				expectSimpleWrite(mock, "DROP subscription upgrade;")
+				expectRead(mock, "WHERE slot_name = 'upgrade';", []string{"name"}, []driver.Value{"upgrade"})
+				expectWrite(mock, "SELECT pg_drop_replication_slot('upgrade');")
+				expectRead(mock, "SELECT current_setting('server_version_num');", []string{"current_setting"}, []driver.Value{"160001"})
+				expectWrite(mock, "CONNECTION 'host=dst.example.com port=5433 dbname=postgres user=upgrade password=test-password'")
+			},
+		},
+		{
+			name: "forward replication is kept if the new instance can not decode its WAL",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectRead(mock, "WHERE subname='upgrade_reverse';", []string{"name"})
+				expectRead(mock, "SELECT current_setting('wal_level');", []string{"current_setting"}, []driver.Value{"replica"})
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			c, mock := setupReverseReplicationMockData()
+			test.expect(*mock)
+
+			err := c.EnableReverseReplication()
+			if test.expectedError {
+				assert.Error(t, err, "error must be raised")
+			} else {
+				assert.NoError(t, err, "no error must be raised")
+			}
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestFallbackToSourceDatabase(t *testing.T) {
+	c, mock := setupReverseReplicationMockData()
+
+	// The old instance catches up first, then the reverse replication is removed.
+	expectRead(*mock, "WHERE slot_name = 'upgrade_reverse';", []string{"lsn_distance"}, []driver.Value{"0"})
+	expectRead(*mock, "WHERE subname='upgrade_reverse';", []string{"name"}, []driver.Value{"upgrade_reverse"})
+	expectSimpleWrite(*mock, "DROP subscription upgrade_reverse;")
+	expectRead(*mock, "WHERE slot_name = 'upgrade_reverse';", []string{"name"})
+	expectRead(*mock, "WHERE p.pubname = 'upgrade_reverse';", []string{"name"}, []driver.Value{"upgrade_reverse"})
+	expectWrite(*mock, "DROP publication upgrade_reverse;")
+
+	// Sequence values of the new instance are copied with a gap.
+	expectRead(*mock, "FROM pg_catalog.pg_class", []string{"string_agg"}, []driver.Value{"select 'select setval(''seq'', ' || last_value + 128 || ');' from seq"})
+	expectRead(*mock, "select 'select setval(''seq'', ' || last_value + 128 || ');' from seq;", []string{"statement"}, []driver.Value{"select setval('seq', 256);"})
+	expectWrite(*mock, "select setval('seq', 256);")
+
+	expectSimpleWrite(*mock, "ALTER ROLE app IN DATABASE postgres RESET default_transaction_read_only;")
+
+	// The forward replication is set up again from a fresh slot.
+	expectRead(*mock, "WHERE subname='upgrade';", []string{"name"})
+	expectEnsureUpgradeUser(*mock)
+	expectRead(*mock, "WHERE p.pubname = 'upgrade';", []string{"name"})
+	expectWrite(*mock, "CREATE publication upgrade")
+	expectRead(*mock, "WHERE slot_name = 'upgrade';", []string{"name"})
+	expectWrite(*mock, "SELECT pg_create_logical_replication_slot('upgrade', 'pgoutput');")
+	expectWrite(*mock, "CONNECTION 'host=src.example.com port=5432 dbname=postgres user=upgrade password=test-password'")
+	expectWrite(*mock, "ALTER SUBSCRIPTION upgrade ENABLE;")
+
+	err := c.FallbackToSourceDatabase()
+	assert.NoError(t, err, "no error must be raised")
+
+	if err := (*mock).ExpectationsWereMet(); err != nil {
+		assert.NoError(t, err, "expectation must be fulfilled")
+	}
+}
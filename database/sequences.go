@@ -23,7 +23,7 @@ const (
 	SEQUENCE_INCREMENT string = "128"
 )
 
-func (c *Controller) prepareSelectSequenceStatement() (*string, error) {
+func (c *Controller) prepareSelectSequenceStatement(databaseConnection *databaseConnection) (*string, error) {
 	statements := []string{}
 
 	statement := `
@@ -32,7 +32,7 @@ func (c *Controller) prepareSelectSequenceStatement() (*string, error) {
 	FROM pg_catalog.pg_class
 	WHERE relkind ='S';`
 
-	exists, err := c.readTransaction(&statements, c.srcDatabaseConnection, &statement, SEQUENCE_INCREMENT)
+	exists, err := c.readTransaction(&statements, databaseConnection, &statement, SEQUENCE_INCREMENT)
 
 	if err != nil {
 		return nil, err
@@ -45,30 +45,35 @@ func (c *Controller) prepareSelectSequenceStatement() (*string, error) {
 	return &statements[0], nil
 }
 
-func (c *Controller) buildUpdatableSequenceList(statement *string) ([]string, error) {
+func (c *Controller) buildUpdatableSequenceList(databaseConnection *databaseConnection, statement *string) ([]string, error) {
 	*statement = fmt.Sprintf("%s;", *statement)
 
 	statements := []string{}
-	_, err := c.readTransaction(&statements, c.srcDatabaseConnection, statement)
+	_, err := c.readTransaction(&statements, databaseConnection, statement)
 
 	return statements, err
 }
 
-func (c *Controller) updateSequence(statement *string) error {
-	err := c.writeTransaction(c.dstDatabaseConnection, statement)
+func (c *Controller) updateSequence(databaseConnection *databaseConnection, statement *string) error {
+	err := c.writeTransaction(databaseConnection, statement)
 
 	return err
 }
 
 func (c *Controller) incrementSequenceValues() error {
+	return c.copySequenceValues(c.srcDatabaseConnection, c.dstDatabaseConnection)
+}
+
+// Reads sequence values on the donor and applies them with a small gap on the receiver.
+func (c *Controller) copySequenceValues(donorConnection *databaseConnection, receiverConnection *databaseConnection) error {
 	log.Infoln("Incrementing sequence values by leaving a small gap in order to avoid conflicts.")
 
-	statement, err := c.prepareSelectSequenceStatement()
+	statement, err := c.prepareSelectSequenceStatement(donorConnection)
 	if err != nil {
 		return err
 	}
 
-	statements, err := c.buildUpdatableSequenceList(statement)
+	statements, err := c.buildUpdatableSequenceList(donorConnection, statement)
 	if err != nil {
 		return err
 	}
@@ -78,7 +83,7 @@ func (c *Controller) incrementSequenceValues() error {
 	for idx := range statements {
 		item := statements[idx]
 		g.Go(func() error {
-			err := c.updateSequence(&item)
+			err := c.updateSequence(receiverConnection, &item)
 			if err != nil {
 				return err
 			}
@@ -72,7 +72,7 @@ func (c *Controller) getSubscriptionID() (*string, error) {
 	return &subscriptionIDs[0], nil
 }
 
-func (c *Controller) subscriptionExists(subscriptionName *string) (bool, error) {
+func (c *Controller) subscriptionExists(databaseConnection *databaseConnection, subscriptionName *string) (bool, error) {
 	subscriptions := []subscription{}
 
 	statement := `
@@ -85,7 +85,7 @@ func (c *Controller) subscriptionExists(subscriptionName *string) (bool, error)
 	FROM pg_catalog.pg_subscription
 	WHERE subname='%s';`
 
-	exists, err := c.readTransaction(&subscriptions, c.dstDatabaseConnection, &statement, *subscriptionName)
+	exists, err := c.readTransaction(&subscriptions, databaseConnection, &statement, *subscriptionName)
 	if err != nil {
 		return false, err
 	}
@@ -93,10 +93,10 @@ func (c *Controller) subscriptionExists(subscriptionName *string) (bool, error)
 	return exists, nil
 }
 
-func (c *Controller) dropSubscription(subscriptionName *string) error {
+func (c *Controller) dropSubscription(databaseConnection *databaseConnection, subscriptionName *string) error {
 	statement := `DROP subscription %s;`
 
-	err := c.simpleWriteTransaction(c.dstDatabaseConnection, &statement, *subscriptionName)
+	err := c.simpleWriteTransaction(databaseConnection, &statement, *subscriptionName)
 
 	return err
 }
@@ -104,13 +104,13 @@ func (c *Controller) dropSubscription(subscriptionName *string) error {
 func (c *Controller) DeleteUpgradeSubscription() error {
 	log.Infoln("Deleting the subscription that was used during the upgrade/migration process.")
 	subscriptionName := SUBSCRIPTION_NAME
-	exists, err := c.subscriptionExists(&subscriptionName)
+	exists, err := c.subscriptionExists(c.dstDatabaseConnection, &subscriptionName)
 	if err != nil {
 		return err
 	}
 
 	if exists {
-		err = c.dropSubscription(&subscriptionName)
+		err = c.dropSubscription(c.dstDatabaseConnection, &subscriptionName)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,239 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package database
+
+import (
+	"db_relocate/log"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SWITCHOVER_SYNC_CHECK_INTERVAL time.Duration = 1 // seconds
+)
+
+// Only the application roles become read-only, so the tool itself can still write after a reconnect.
+func (c *Controller) freezeWrites(databaseConnection *databaseConnection) error {
+	for idx := range c.configuration.Items.Switchover.ApplicationRoles {
+		statement := `ALTER ROLE %s IN DATABASE %s SET default_transaction_read_only = on;`
+		err := c.simpleWriteTransaction(
+			databaseConnection,
+			&statement,
+			c.configuration.Items.Switchover.ApplicationRoles[idx],
+			c.configuration.Items.Src.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) liftWriteFreeze(databaseConnection *databaseConnection) error {
+	for idx := range c.configuration.Items.Switchover.ApplicationRoles {
+		statement := `ALTER ROLE %s IN DATABASE %s RESET default_transaction_read_only;`
+		err := c.simpleWriteTransaction(
+			databaseConnection,
+			&statement,
+			c.configuration.Items.Switchover.ApplicationRoles[idx],
+			c.configuration.Items.Src.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) buildSessionFilter() string {
+	return fmt.Sprintf(
+		"usename IN ('%s')",
+		strings.Join(c.configuration.Items.Switchover.ApplicationRoles, "', '"),
+	)
+}
+
+// Existing sessions keep their settings, so they have to be terminated for the freeze to take effect.
+func (c *Controller) terminateApplicationSessions(databaseConnection *databaseConnection) error {
+	terminatedSessions := []string{}
+
+	statement := `
+	SELECT
+		pg_terminate_backend(pid)::text
+	FROM pg_catalog.pg_stat_activity
+	WHERE
+		datname = '%s'
+	AND
+		pid <> pg_backend_pid()
+	AND
+		backend_type = 'client backend'
+	AND
+		%s;`
+
+	_, err := c.readTransaction(
+		&terminatedSessions,
+		databaseConnection,
+		&statement,
+		c.configuration.Items.Src.Name,
+		c.buildSessionFilter(),
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Terminated %d application sessions.", len(terminatedSessions))
+
+	return nil
+}
+
+func (c *Controller) heartBeatRecordExists(databaseConnection *databaseConnection, timestamp *int64) (bool, error) {
+	heartBeatRecords := []int64{}
+
+	statement := `SELECT timestamp FROM %s WHERE timestamp = %d;`
+
+	exists, err := c.readTransaction(&heartBeatRecords, databaseConnection, &statement, HEALTHCHECK_TABLE_NAME, *timestamp)
+
+	return exists, err
+}
+
+// The master user is often shared with the application, so its writes could not be blocked without naming the application roles.
+func (c *Controller) EnsureSwitchoverIsPossible() error {
+	if len(c.configuration.Items.Switchover.ApplicationRoles) == 0 {
+		return errors.New("No 'switchover.application_roles' are configured. They are required to block the application writes to the old instance!")
+	}
+
+	healthCheckTableName := HEALTHCHECK_TABLE_NAME
+
+	existsOnSrc, err := c.tableExists(c.srcDatabaseConnection, &healthCheckTableName)
+	if err != nil {
+		return err
+	}
+
+	existsOnDst, err := c.tableExists(c.dstDatabaseConnection, &healthCheckTableName)
+	if err != nil {
+		return err
+	}
+
+	if !existsOnSrc || !existsOnDst {
+		return errors.New(fmt.Sprintf(
+			"Health check table: '%s' is missing. Switchover must be done before the cleanup!",
+			HEALTHCHECK_TABLE_NAME,
+		))
+	}
+
+	subscriptionName := SUBSCRIPTION_NAME
+	exists, err := c.subscriptionExists(c.dstDatabaseConnection, &subscriptionName)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return errors.New(fmt.Sprintf(
+			"Subscription: '%s' is missing on the new instance. Nothing to switch over!",
+			SUBSCRIPTION_NAME,
+		))
+	}
+
+	return nil
+}
+
+func (c *Controller) FreezeSrcDatabaseWrites() error {
+	return c.freezeWrites(c.srcDatabaseConnection)
+}
+
+func (c *Controller) LiftSrcDatabaseWriteFreeze() error {
+	return c.liftWriteFreeze(c.srcDatabaseConnection)
+}
+
+func (c *Controller) TerminateSrcDatabaseSessions() error {
+	return c.terminateApplicationSessions(c.srcDatabaseConnection)
+}
+
+func (c *Controller) WaitUntilSyncWithin(waitTimeout time.Duration) error {
+	replicationSlotName := REPLICATION_SLOT_NAME
+
+	return c.waitUntilSync(
+		c.srcDatabaseConnection,
+		&replicationSlotName,
+		waitTimeout,
+		time.Second*SWITCHOVER_SYNC_CHECK_INTERVAL,
+	)
+}
+
+// Inserts a single heartbeat record on the source database, so it can be looked up on the destination later.
+func (c *Controller) SendHeartBeatRecord() (*int64, error) {
+	timestamp := time.Now().UnixMilli()
+
+	err := c.insertHeartBeatRecord(&timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &timestamp, nil
+}
+
+func (c *Controller) VerifyHeartBeatRecordReceived(timestamp *int64) error {
+	exists, err := c.heartBeatRecordExists(c.dstDatabaseConnection, timestamp)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return errors.New(fmt.Sprintf(
+			"Heartbeat record: '%d' has not been received by the new instance!",
+			*timestamp,
+		))
+	}
+
+	return nil
+}
+
+func (c *Controller) waitForHeartBeatRecord(databaseConnection *databaseConnection, timestamp *int64, waitTimeout time.Duration, checkInterval time.Duration) error {
+	startTime := time.Now()
+
+	for {
+		exists, err := c.heartBeatRecordExists(databaseConnection, timestamp)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return nil
+		}
+
+		if time.Since(startTime) > waitTimeout {
+			return errors.New(fmt.Sprintf(
+				"Reached a timeout '%s', while waiting for heartbeat record: '%d' on the new instance!",
+				waitTimeout.String(),
+				*timestamp,
+			))
+		}
+
+		time.Sleep(checkInterval)
+	}
+}
+
+// Used when the replication is not managed by the tool, so there is no replication slot to compare the LSN of.
+func (c *Controller) WaitForHeartBeatRecord(timestamp *int64, waitTimeout time.Duration) error {
+	return c.waitForHeartBeatRecord(
+		c.dstDatabaseConnection,
+		timestamp,
+		waitTimeout,
+		time.Second*SWITCHOVER_SYNC_CHECK_INTERVAL,
+	)
+}
+
+func (c *Controller) IncrementSequenceValues() error {
+	return c.incrementSequenceValues()
+}
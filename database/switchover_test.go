@@ -0,0 +1,126 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package database
+
+import (
+	"database/sql/driver"
+	"db_relocate/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSessionFilter(t *testing.T) {
+	c, _ := setupDatabaseMockData()
+
+	tests := []struct {
+		name             string
+		applicationRoles []string
+		expectedFilter   string
+	}{
+		{
+			name:             "single application role",
+			applicationRoles: []string{"app"},
+			expectedFilter:   "usename IN ('app')",
+		},
+		{
+			name:             "multiple application roles",
+			applicationRoles: []string{"app", "worker"},
+			expectedFilter:   "usename IN ('app', 'worker')",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			c.configuration.Items = &types.Items{
+				Src:        &types.DBInstanceDetails{User: "ops"},
+				Upgrade:    &types.UpgradeDetails{User: "upgrade"},
+				Switchover: &types.SwitchoverDetails{ApplicationRoles: test.applicationRoles},
+			}
+
+			filter := c.buildSessionFilter()
+			assert.Equal(t, test.expectedFilter, filter, "received filter must match expected filter")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestEnsureSwitchoverIsPossibleRequiresApplicationRoles(t *testing.T) {
+	c, mock := setupDatabaseMockData()
+	c.configuration.Items = &types.Items{
+		Src:        &types.DBInstanceDetails{User: "ops"},
+		Switchover: &types.SwitchoverDetails{ApplicationRoles: []string{}},
+	}
+
+	err := c.EnsureSwitchoverIsPossible()
+	assert.Error(t, err, "error must be raised")
+
+	if err := (*mock).ExpectationsWereMet(); err != nil {
+		assert.NoError(t, err, "nothing must be checked on the databases")
+	}
+}
+
+func TestWaitForHeartBeatRecord(t *testing.T) {
+	c, mock := setupDatabaseMockData()
+
+	timestamp := int64(123)
+	statement := "SELECT timestamp FROM healthcheck_heartbeats WHERE timestamp = 123;"
+
+	tests := []struct {
+		name          string
+		waitTimeout   time.Duration
+		checks        [][][]driver.Value
+		expectedError bool
+	}{
+		{
+			name:          "heartbeat record is received right away",
+			waitTimeout:   time.Second,
+			checks:        [][][]driver.Value{{{123}}},
+			expectedError: false,
+		},
+		{
+			name:          "heartbeat record is received on a later check",
+			waitTimeout:   time.Second,
+			checks:        [][][]driver.Value{{}, {}, {{123}}},
+			expectedError: false,
+		},
+		{
+			name:          "heartbeat record is not received within the timeout",
+			waitTimeout:   0,
+			checks:        [][][]driver.Value{{}},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			query := c.buildQuery(&statement)
+			for idx := range test.checks {
+				rows := sqlmock.NewRows([]string{"timestamp"}).AddRows(test.checks[idx]...)
+				(*mock).ExpectQuery(*query).WillReturnRows(rows).WillReturnError(nil)
+			}
+
+			err := c.waitForHeartBeatRecord(c.dstDatabaseConnection, &timestamp, test.waitTimeout, time.Millisecond)
+			if test.expectedError {
+				assert.Errorf(t, err, "error must be raised")
+			} else {
+				assert.NoError(t, err, "no error must be raised")
+			}
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
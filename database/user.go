@@ -17,26 +17,26 @@ import (
 	"strings"
 )
 
-func (c *Controller) addLoginOption(user *user) error {
+func (c *Controller) addLoginOption(databaseConnection *databaseConnection, user *user) error {
 	statement := `ALTER ROLE %s WITH LOGIN;`
 
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, user.Name)
+	err := c.writeTransaction(databaseConnection, &statement, user.Name)
 
 	return err
 }
 
-func (c *Controller) ensureCorrectPassword(u *user, password *string) error {
+func (c *Controller) ensureCorrectPassword(databaseConnection *databaseConnection, u *user, password *string) error {
 	statement := `ALTER ROLE %s WITH PASSWORD '%s';`
 
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, u.Name, *password)
+	err := c.writeTransaction(databaseConnection, &statement, u.Name, *password)
 
 	return err
 }
 
-func (c *Controller) ensureCanLogin(user *user) error {
+func (c *Controller) ensureCanLogin(databaseConnection *databaseConnection, user *user) error {
 	if user.Login != "t" && user.Login != "true" {
 		log.Infof("User '%s' is missing LOGIN option. Adding it now.", user.Name)
-		err := c.addLoginOption(user)
+		err := c.addLoginOption(databaseConnection, user)
 		if err != nil {
 			return err
 		}
@@ -45,7 +45,7 @@ func (c *Controller) ensureCanLogin(user *user) error {
 	return nil
 }
 
-func (c *Controller) getUserAndRoles(username *string, u *user) (bool, error) {
+func (c *Controller) getUserAndRoles(databaseConnection *databaseConnection, username *string, u *user) (bool, error) {
 	// TODO: handle row level security policy if any.
 	users := []user{}
 	statement := `
@@ -66,7 +66,7 @@ func (c *Controller) getUserAndRoles(username *string, u *user) (bool, error) {
 		FROM pg_catalog.pg_roles AS roles
 		WHERE roles.rolname='%s';`
 
-	exists, err := c.readTransaction(&users, c.srcDatabaseConnection, &statement, *username)
+	exists, err := c.readTransaction(&users, databaseConnection, &statement, *username)
 	if err != nil {
 		return false, err
 	}
@@ -125,7 +125,7 @@ func (c *Controller) dropUser(databaseConnection *databaseConnection, username *
 func (c *Controller) CurrentUserCanProceed() (bool, error) {
 	user := user{}
 
-	found, err := c.getUserAndRoles(&c.configuration.Items.Src.User, &user)
+	found, err := c.getUserAndRoles(c.srcDatabaseConnection, &c.configuration.Items.Src.User, &user)
 	if err != nil {
 		return false, err
 	}
@@ -161,18 +161,47 @@ func (c *Controller) CurrentUserCanProceed() (bool, error) {
 	return true, nil
 }
 
-func (c *Controller) ensureUpgradeUser() error {
-	user, err := c.ensureUser(&c.configuration.Items.Upgrade.User, &c.configuration.Items.Upgrade.Password)
+// Users granted 'rds_iam' authenticate with auth tokens only.
+func (c *Controller) CurrentUserHasIAMRole() (bool, error) {
+	user := user{}
+
+	found, err := c.getUserAndRoles(c.srcDatabaseConnection, &c.configuration.Items.Src.User, &user)
+	if err != nil {
+		return false, err
+	}
+
+	if !found {
+		return false, errors.New(fmt.Sprintf(
+			"User with name: '%s' does not exist!",
+			c.configuration.Items.Src.User,
+		))
+	}
+
+	user.memberOfStringToMemberOfList()
+
+	if !user.memberOf(RDS_IAM_ROLE_NAME) {
+		log.Infof("Current user '%s' is missing a '%s' role!", user.Name, RDS_IAM_ROLE_NAME)
+		query := fmt.Sprintf(`GRANT %s TO %s;`, RDS_IAM_ROLE_NAME, user.Name)
+		log.Infof("You can fix it by running the following query: '%s'", query)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (c *Controller) ensureUpgradeUser(databaseConnection *databaseConnection) error {
+	user, err := c.ensureUser(databaseConnection, &c.configuration.Items.Upgrade.User, &c.configuration.Items.Upgrade.Password)
 	if err != nil {
 		return err
 	}
 
-	err = c.ensureReplicationPrivilege(user)
+	err = c.ensureReplicationPrivilege(databaseConnection, user)
 	if err != nil {
 		return err
 	}
 
 	err = c.ensureReadOnlyPrivilegesForUserInSchemaAndDatabase(
+		databaseConnection,
 		user,
 		&c.configuration.Items.Src.Name,
 		&c.configuration.Items.Src.Schema,
@@ -184,16 +213,16 @@ func (c *Controller) ensureUpgradeUser() error {
 	return nil
 }
 
-func (c *Controller) createRoleWithLogin(username *string, password *string, u *user) error {
+func (c *Controller) createRoleWithLogin(databaseConnection *databaseConnection, username *string, password *string, u *user) error {
 	statement := `CREATE ROLE %s WITH LOGIN PASSWORD '%s';`
 
-	err := c.writeTransaction(c.srcDatabaseConnection, &statement, *username, *password)
+	err := c.writeTransaction(databaseConnection, &statement, *username, *password)
 
 	if err != nil {
 		return err
 	}
 
-	found, err := c.getUserAndRoles(username, u)
+	found, err := c.getUserAndRoles(databaseConnection, username, u)
 	if err != nil {
 		return err
 	}
@@ -208,26 +237,26 @@ func (c *Controller) createRoleWithLogin(username *string, password *string, u *
 	return nil
 }
 
-func (c *Controller) ensureUser(username *string, password *string) (*user, error) {
+func (c *Controller) ensureUser(databaseConnection *databaseConnection, username *string, password *string) (*user, error) {
 	user := user{}
-	found, err := c.getUserAndRoles(username, &user)
+	found, err := c.getUserAndRoles(databaseConnection, username, &user)
 	if err != nil {
 		return nil, err
 	}
 
 	if !found {
-		err = c.createRoleWithLogin(username, password, &user)
+		err = c.createRoleWithLogin(databaseConnection, username, password, &user)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	err = c.ensureCanLogin(&user)
+	err = c.ensureCanLogin(databaseConnection, &user)
 	if err != nil {
 		return nil, err
 	}
 
-	err = c.ensureCorrectPassword(&user, password)
+	err = c.ensureCorrectPassword(databaseConnection, &user, password)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,59 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package database
+
+import (
+	"db_relocate/types"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrentUserHasIAMRole(t *testing.T) {
+	c, mock := setupDatabaseMockData()
+	c.configuration.Items = &types.Items{Src: &types.DBInstanceDetails{User: "ops"}}
+
+	tests := []struct {
+		name     string
+		memberOf string
+		expected bool
+	}{
+		{
+			name:     "user is granted rds_iam",
+			memberOf: "rds_superuser,rds_iam",
+			expected: true,
+		},
+		{
+			name:     "user is not granted rds_iam",
+			memberOf: "rds_superuser",
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"name", "login", "password_valid_until", "bypass_row_level_security_policy", "member_of"}).
+				AddRow("ops", "true", nil, "false", test.memberOf)
+			(*mock).ExpectQuery(regexp.QuoteMeta("WHERE roles.rolname='ops';")).WillReturnRows(rows).WillReturnError(nil)
+
+			ok, err := c.CurrentUserHasIAMRole()
+			assert.NoError(t, err, "no error must be raised")
+			assert.Equal(t, test.expected, ok, "rds_iam membership must match expectations")
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
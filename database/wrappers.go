@@ -14,6 +14,7 @@ import (
 	"database/sql"
 	"db_relocate/input"
 	"db_relocate/log"
+	"db_relocate/types"
 	"errors"
 	"fmt"
 	"time"
@@ -24,7 +25,7 @@ import (
 func (c *Controller) buildQuery(statement *string, args ...interface{}) *string {
 	query := fmt.Sprintf(*statement, args...)
 
-	// TODO: filter out queries which migh contain sensitive information such as 'ALTER ROLE'.
+	// Passwords in queries such as 'ALTER ROLE' are redacted by the logger.
 	log.Debugf("Running a query: '%s'", query)
 
 	return &query
@@ -32,14 +33,18 @@ func (c *Controller) buildQuery(statement *string, args ...interface{}) *string
 
 // TODO: use interface instead in order to distinguish testing and real database connections
 // Or migrate to pgx.
-func (c *Controller) ensureDatabaseConnection(databaseConnection *databaseConnection) error {
+// Returns the connection to use, it is held under the mutex, so concurrent callers never close or replace it twice.
+func (c *Controller) ensureDatabaseConnection(databaseConnection *databaseConnection) (*sqlx.DB, error) {
+	databaseConnection.mutex.Lock()
+	defer databaseConnection.mutex.Unlock()
+
 	if *databaseConnection.id == "test" {
-		return nil
+		return databaseConnection.connection, nil
 	}
 
 	err := databaseConnection.connection.PingContext(*c.configuration.Context)
 	if err == nil {
-		return nil
+		return databaseConnection.connection, nil
 	}
 
 	log.Warnf(
@@ -48,13 +53,14 @@ func (c *Controller) ensureDatabaseConnection(databaseConnection *databaseConnec
 	)
 	databaseConnection.connection.Close()
 
-	connection, err := sqlx.Connect("postgres", *databaseConnection.dsn)
+	// A new auth token is built here as well, the one of the closed connection may have expired.
+	connection, err := databaseConnection.open()
 	if err != nil {
 		log.Errorf(
 			"Failed to re-establish database connection with an identifier: '%s'!",
 			*databaseConnection.id,
 		)
-		return err
+		return nil, err
 	}
 
 	log.Infof(
@@ -63,7 +69,7 @@ func (c *Controller) ensureDatabaseConnection(databaseConnection *databaseConnec
 	)
 	databaseConnection.connection = connection
 
-	return nil
+	return connection, nil
 }
 
 func (c *Controller) writeTransaction(databaseConnection *databaseConnection, statement *string, args ...interface{}) error {
@@ -73,12 +79,12 @@ func (c *Controller) writeTransaction(databaseConnection *databaseConnection, st
 		ReadOnly: false,
 	}
 
-	err := c.ensureDatabaseConnection(databaseConnection)
+	connection, err := c.ensureDatabaseConnection(databaseConnection)
 	if err != nil {
 		return err
 	}
 
-	tx, err := databaseConnection.connection.BeginTxx(*c.configuration.Context, opts)
+	tx, err := connection.BeginTxx(*c.configuration.Context, opts)
 	if err != nil {
 		return err
 	}
@@ -107,12 +113,12 @@ func (c *Controller) writeTransaction(databaseConnection *databaseConnection, st
 func (c *Controller) simpleWriteTransaction(databaseConnection *databaseConnection, statement *string, args ...interface{}) error {
 	query := c.buildQuery(statement, args...)
 
-	err := c.ensureDatabaseConnection(databaseConnection)
+	connection, err := c.ensureDatabaseConnection(databaseConnection)
 	if err != nil {
 		return err
 	}
 
-	_, err = databaseConnection.connection.Exec(*query)
+	_, err = connection.Exec(*query)
 
 	return err
 }
@@ -135,6 +141,8 @@ func (c *Controller) getContainerLength(container interface{}) int {
 		return len(*t)
 	case *[]subscription:
 		return len(*t)
+	case *[]types.ReplicationLag:
+		return len(*t)
 	default:
 		return 0
 	}
@@ -143,12 +151,12 @@ func (c *Controller) getContainerLength(container interface{}) int {
 func (c *Controller) readTransaction(container interface{}, databaseConnection *databaseConnection, statement *string, args ...interface{}) (bool, error) {
 	query := c.buildQuery(statement, args...)
 
-	err := c.ensureDatabaseConnection(databaseConnection)
+	connection, err := c.ensureDatabaseConnection(databaseConnection)
 	if err != nil {
 		return false, err
 	}
 
-	err = databaseConnection.connection.Select(container, *query)
+	err = connection.Select(container, *query)
 	if err != nil {
 		return false, err
 	}
@@ -160,19 +168,47 @@ func (c *Controller) readTransaction(container interface{}, databaseConnection *
 	return false, nil
 }
 
-func (c *Controller) PrepareSrcDatabaseForUpgrade() error {
-	err := c.ensureUpgradeUser()
+// The existing replication slot is kept for a reused snapshot, since it holds the changes made after the snapshot was taken.
+// Its publication is kept as well, since pgoutput looks it up as of the changes being decoded, which predate a new one.
+func (c *Controller) PrepareSrcDatabaseForUpgrade(keepReplicationSlot bool) error {
+	err := c.ensureUpgradeUser(c.srcDatabaseConnection)
 	if err != nil {
 		return err
 	}
 
 	publicationName := PUBLICATION_NAME
-	err = c.ensurePublication(&publicationName)
+	replicationSlotName := REPLICATION_SLOT_NAME
+	if keepReplicationSlot {
+		exists, err := c.logicalReplicationSlotExists(c.srcDatabaseConnection, &replicationSlotName)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			publicationExists, err := c.publicationExists(c.srcDatabaseConnection, &publicationName)
+			if err != nil {
+				return err
+			}
+
+			if !publicationExists {
+				return errors.New(fmt.Sprintf(
+					"Publication: '%s' of the kept replication slot: '%s' is missing. The snapshot can not be reused!",
+					publicationName,
+					replicationSlotName,
+				))
+			}
+
+			log.Infof("Keeping an existing replication slot: '%s' and publication: '%s'", replicationSlotName, publicationName)
+			return nil
+		}
+	}
+
+	err = c.ensurePublication(c.srcDatabaseConnection, &publicationName)
 	if err != nil {
 		return err
 	}
 
-	err = c.ensureLogicalReplicationSlot()
+	err = c.ensureLogicalReplicationSlot(c.srcDatabaseConnection, &replicationSlotName)
 	if err != nil {
 		return err
 	}
@@ -200,12 +236,20 @@ func (c *Controller) PrepareDstDatabaseForUpgrade(latestUnhealthyLSN *string) er
 }
 
 func (c *Controller) WaitUntilSync() error {
-	startTime := time.Now()
-	waitTimeout := time.Minute * WAIT_UNTIL_SYNC_TIMEOUT
-	checkInterval := time.Second * 10
 	replicationSlotName := REPLICATION_SLOT_NAME
 
-	currentLSNDistance, err := c.getLSNDistanceForLogicalReplicationSlot(&replicationSlotName)
+	return c.waitUntilSync(
+		c.srcDatabaseConnection,
+		&replicationSlotName,
+		time.Minute*WAIT_UNTIL_SYNC_TIMEOUT,
+		time.Second*WAIT_UNTIL_SYNC_CHECK_INTERVAL,
+	)
+}
+
+func (c *Controller) waitUntilSync(databaseConnection *databaseConnection, replicationSlotName *string, waitTimeout time.Duration, checkInterval time.Duration) error {
+	startTime := time.Now()
+
+	currentLSNDistance, err := c.getLSNDistanceForLogicalReplicationSlot(databaseConnection, replicationSlotName)
 	if err != nil {
 		return err
 	}
@@ -222,7 +266,7 @@ func (c *Controller) WaitUntilSync() error {
 
 		time.Sleep(checkInterval)
 
-		currentLSNDistance, err = c.getLSNDistanceForLogicalReplicationSlot(&replicationSlotName)
+		currentLSNDistance, err = c.getLSNDistanceForLogicalReplicationSlot(databaseConnection, replicationSlotName)
 		if err != nil {
 			return err
 		}
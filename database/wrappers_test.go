@@ -13,6 +13,7 @@ package database
 import (
 	"database/sql/driver"
 	thelper "db_relocate/testing"
+	"db_relocate/types"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -197,6 +198,16 @@ func TestGetContainerLength(t *testing.T) {
 			container: &[]subscription{},
 			expected:  0,
 		},
+		{
+			name:      "Non empty ReplicationLag slice",
+			container: &[]types.ReplicationLag{{ByteLag: 1024}},
+			expected:  1,
+		},
+		{
+			name:      "Empty ReplicationLag slice",
+			container: &[]types.ReplicationLag{},
+			expected:  0,
+		},
 		{
 			name:      "Unmatched non-empty container",
 			container: &[]float64{1.10, 2.0, 3},
@@ -287,3 +298,74 @@ func TestReadTransaction(t *testing.T) {
 		t.Run(test.name, testFunction)
 	}
 }
+
+func TestPrepareSrcDatabaseForUpgrade(t *testing.T) {
+	tests := []struct {
+		name                string
+		keepReplicationSlot bool
+		expect              func(mock sqlmock.Sqlmock)
+		expectedError       bool
+	}{
+		{
+			name: "publication and slot are created from scratch",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectEnsureUpgradeUser(mock)
+				expectRead(mock, "WHERE p.pubname = 'upgrade';", []string{"name"}, []driver.Value{"upgrade"})
+				expectWrite(mock, "DROP publication upgrade;")
+				expectWrite(mock, "CREATE publication upgrade")
+				expectRead(mock, "WHERE slot_name = 'upgrade';", []string{"name"})
+				expectWrite(mock, "SELECT pg_create_logical_replication_slot('upgrade', 'pgoutput');")
+			},
+		},
+		{
+			name:                "publication of a kept slot is not recreated",
+			keepReplicationSlot: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectEnsureUpgradeUser(mock)
+				expectRead(mock, "WHERE slot_name = 'upgrade';", []string{"name"}, []driver.Value{"upgrade"})
+				expectRead(mock, "WHERE p.pubname = 'upgrade';", []string{"name"}, []driver.Value{"upgrade"})
+			},
+		},
+		{
+			name:                "kept slot without its publication can not be used",
+			keepReplicationSlot: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectEnsureUpgradeUser(mock)
+				expectRead(mock, "WHERE slot_name = 'upgrade';", []string{"name"}, []driver.Value{"upgrade"})
+				expectRead(mock, "WHERE p.pubname = 'upgrade';", []string{"name"})
+			},
+			expectedError: true,
+		},
+		{
+			name:                "missing slot is created together with a new publication",
+			keepReplicationSlot: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectEnsureUpgradeUser(mock)
+				expectRead(mock, "WHERE slot_name = 'upgrade';", []string{"name"})
+				expectRead(mock, "WHERE p.pubname = 'upgrade';", []string{"name"})
+				expectWrite(mock, "CREATE publication upgrade")
+				expectRead(mock, "WHERE slot_name = 'upgrade';", []string{"name"})
+				expectWrite(mock, "SELECT pg_create_logical_replication_slot('upgrade', 'pgoutput');")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			c, mock := setupReverseReplicationMockData()
+			test.expect(*mock)
+
+			err := c.PrepareSrcDatabaseForUpgrade(test.keepReplicationSlot)
+			if test.expectedError {
+				assert.Error(t, err, "error must be raised")
+			} else {
+				assert.NoError(t, err, "no error must be raised")
+			}
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
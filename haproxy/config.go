@@ -0,0 +1,83 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package haproxy
+
+import (
+	"db_relocate/log"
+	"os"
+	"text/template"
+)
+
+const configurationTemplate = `global
+    stats socket {{ .StatsSocket }} level admin
+    stats timeout 2m
+
+defaults
+    mode tcp
+    timeout connect 5s
+    timeout client 30m
+    timeout server 30m
+
+frontend {{ .Backend }}
+    bind {{ .Bind }}
+    default_backend {{ .Backend }}
+
+backend {{ .Backend }}
+    option tcp-check
+    server {{ .SrcServerName }} {{ .SrcAddress }} check
+    server {{ .DstServerName }} {{ .DstAddress }} check disabled
+`
+
+type configurationData struct {
+	StatsSocket   string
+	Bind          string
+	Backend       string
+	SrcServerName string
+	SrcAddress    string
+	DstServerName string
+	DstAddress    string
+}
+
+func (c *Controller) buildStatsSocket() string {
+	if c.network == "unix" {
+		return c.address + " mode 600"
+	}
+
+	return "ipv4@" + c.address
+}
+
+// The source database is the active server, the destination one stays disabled until the switchover.
+func (c *Controller) GenerateConfiguration() error {
+	log.Infof("Generating HAProxy configuration file: '%s'", c.configuration.Items.HAProxy.ConfigPath)
+
+	configurationTemplate, err := template.New("haproxy").Parse(configurationTemplate)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(c.configuration.Items.HAProxy.ConfigPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data := &configurationData{
+		StatsSocket:   c.buildStatsSocket(),
+		Bind:          c.configuration.Items.HAProxy.Bind,
+		Backend:       c.configuration.Items.HAProxy.Backend,
+		SrcServerName: SRC_SERVER_NAME,
+		SrcAddress:    c.configuration.Items.Src.Host + ":" + c.configuration.Items.Src.Port,
+		DstServerName: DST_SERVER_NAME,
+		DstAddress:    c.configuration.Items.Dst.Host + ":" + c.configuration.Items.Dst.Port,
+	}
+
+	return configurationTemplate.Execute(file, data)
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package haproxy
+
+import (
+	"db_relocate/log"
+	"db_relocate/types"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+const (
+	SRC_SERVER_NAME string = "src"
+	DST_SERVER_NAME string = "dst"
+)
+
+type Controller struct {
+	network       string
+	address       string
+	errorChannel  chan error
+	configuration *types.Configuration
+}
+
+// Runtime API address is expected in a form of 'unix:///path/to/haproxy.sock' or 'tcp://host:port'.
+func parseRuntimeAPI(runtimeAPI *string) (string, string, error) {
+	runtimeAPIURL, err := url.Parse(*runtimeAPI)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch runtimeAPIURL.Scheme {
+	case "unix":
+		return runtimeAPIURL.Scheme, runtimeAPIURL.Path, nil
+	case "tcp":
+		return runtimeAPIURL.Scheme, runtimeAPIURL.Host, nil
+	}
+
+	return "", "", errors.New(fmt.Sprintf(
+		"Unsupported HAProxy runtime API address: '%s'. Must start with 'unix://' or 'tcp://'!",
+		*runtimeAPI,
+	))
+}
+
+func NewController(configuration *types.Configuration, errorChannel chan error) (*Controller, error) {
+	log.Infoln("Initializing haproxy controller")
+
+	controller := &Controller{
+		errorChannel:  errorChannel,
+		configuration: configuration,
+	}
+
+	if !controller.Enabled() {
+		return controller, nil
+	}
+
+	network, address, err := parseRuntimeAPI(&configuration.Items.HAProxy.RuntimeAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	controller.network = network
+	controller.address = address
+
+	return controller, nil
+}
+
+func (c *Controller) Enabled() bool {
+	return c.configuration.Items.HAProxy.RuntimeAPI != ""
+}
@@ -0,0 +1,207 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package haproxy
+
+import (
+	"bufio"
+	"db_relocate/log"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RUNTIME_API_TIMEOUT  time.Duration = 5 // seconds
+	DRAIN_CHECK_INTERVAL time.Duration = 1 // seconds
+)
+
+// Runtime API closes the connection after every command in non-interactive mode.
+func (c *Controller) executeCommand(command string) (string, error) {
+	log.Debugf("Executing HAProxy runtime API command: '%s'", command)
+
+	connection, err := net.DialTimeout(c.network, c.address, time.Second*RUNTIME_API_TIMEOUT)
+	if err != nil {
+		return "", err
+	}
+	defer connection.Close()
+
+	err = connection.SetDeadline(time.Now().Add(time.Second * RUNTIME_API_TIMEOUT))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = fmt.Fprintf(connection, "%s\n", command)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := io.ReadAll(bufio.NewReader(connection))
+	if err != nil {
+		return "", err
+	}
+
+	return string(response), nil
+}
+
+// Successful state changes produce an empty response, anything else is an error message.
+func (c *Controller) setServerState(server string, state string) error {
+	log.Infof("Setting HAProxy server: '%s/%s' state to: '%s'", c.configuration.Items.HAProxy.Backend, server, state)
+
+	response, err := c.executeCommand(fmt.Sprintf(
+		"set server %s/%s state %s",
+		c.configuration.Items.HAProxy.Backend,
+		server,
+		state,
+	))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(response) != "" {
+		return errors.New(fmt.Sprintf(
+			"Failed to set HAProxy server: '%s' state to: '%s'. Received: %s",
+			server,
+			state,
+			strings.TrimSpace(response),
+		))
+	}
+
+	return nil
+}
+
+func (c *Controller) shutdownServerSessions(server string) error {
+	log.Warnf("Shutting down remaining sessions on HAProxy server: '%s/%s'", c.configuration.Items.HAProxy.Backend, server)
+
+	response, err := c.executeCommand(fmt.Sprintf(
+		"shutdown sessions server %s/%s",
+		c.configuration.Items.HAProxy.Backend,
+		server,
+	))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(response) != "" {
+		return errors.New(fmt.Sprintf(
+			"Failed to shut down sessions on HAProxy server: '%s'. Received: %s",
+			server,
+			strings.TrimSpace(response),
+		))
+	}
+
+	return nil
+}
+
+// Reads the current number of sessions ('scur' column) from 'show stat' CSV output.
+func (c *Controller) getServerCurrentSessions(server string) (int, error) {
+	response, err := c.executeCommand("show stat")
+	if err != nil {
+		return 0, err
+	}
+
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(response, "# ")))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(records) == 0 {
+		return 0, errors.New("Received an empty response from HAProxy 'show stat' command!")
+	}
+
+	columns := map[string]int{}
+	for idx, column := range records[0] {
+		columns[column] = idx
+	}
+
+	for _, record := range records[1:] {
+		if record[columns["pxname"]] == c.configuration.Items.HAProxy.Backend && record[columns["svname"]] == server {
+			return strconv.Atoi(record[columns["scur"]])
+		}
+	}
+
+	return 0, errors.New(fmt.Sprintf(
+		"HAProxy server: '%s/%s' is missing!",
+		c.configuration.Items.HAProxy.Backend,
+		server,
+	))
+}
+
+// Waits until all the sessions are gone from the server. Remaining ones are shut down after the timeout.
+func (c *Controller) waitUntilDrained(server string) error {
+	timeout := time.After(c.configuration.Items.HAProxy.DrainTimeout)
+	ticker := time.NewTicker(time.Second * DRAIN_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		currentSessions, err := c.getServerCurrentSessions(server)
+		if err != nil {
+			return err
+		}
+
+		if currentSessions == 0 {
+			log.Infof("HAProxy server: '%s' has been drained.", server)
+			return nil
+		}
+
+		log.Infof("Waiting for %d sessions to finish on HAProxy server: '%s'", currentSessions, server)
+
+		select {
+		case <-timeout:
+			return c.shutdownServerSessions(server)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) EnsureRuntimeAPIIsReachable() error {
+	_, err := c.getServerCurrentSessions(SRC_SERVER_NAME)
+	return err
+}
+
+func (c *Controller) SwitchToDestination() error {
+	err := c.setServerState(DST_SERVER_NAME, "ready")
+	if err != nil {
+		return err
+	}
+
+	err = c.setServerState(SRC_SERVER_NAME, "drain")
+	if err != nil {
+		return err
+	}
+
+	err = c.waitUntilDrained(SRC_SERVER_NAME)
+	if err != nil {
+		return err
+	}
+
+	return c.setServerState(SRC_SERVER_NAME, "maint")
+}
+
+func (c *Controller) SwitchToSource() error {
+	err := c.setServerState(SRC_SERVER_NAME, "ready")
+	if err != nil {
+		return err
+	}
+
+	err = c.setServerState(DST_SERVER_NAME, "maint")
+	if err != nil {
+		return err
+	}
+
+	return c.shutdownServerSessions(DST_SERVER_NAME)
+}
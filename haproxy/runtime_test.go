@@ -0,0 +1,207 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package haproxy
+
+import (
+	"bufio"
+	"db_relocate/types"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const showStatHeader = "# pxname,svname,qcur,qmax,scur,smax,slim,stot\n"
+
+type runtimeAPIStandIn struct {
+	listener        net.Listener
+	mutex           sync.Mutex
+	commands        []string
+	currentSessions []string
+}
+
+// Accepts a single command per connection, the same way HAProxy does in non-interactive mode.
+func (s *runtimeAPIStandIn) serve() {
+	for {
+		connection, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		command, _ := bufio.NewReader(connection).ReadString('\n')
+		command = strings.TrimSpace(command)
+
+		s.mutex.Lock()
+		s.commands = append(s.commands, command)
+		if command == "show stat" {
+			currentSessions := s.currentSessions[0]
+			if len(s.currentSessions) > 1 {
+				s.currentSessions = s.currentSessions[1:]
+			}
+			connection.Write([]byte(showStatHeader +
+				"postgres,FRONTEND,,,0,1,100,1\n" +
+				"postgres,src," + "0,0," + currentSessions + ",1,,1\n" +
+				"postgres,dst,0,0,0,0,,0\n\n"))
+		}
+		if command == "set server postgres/missing state ready" {
+			connection.Write([]byte("No such server.\n"))
+		}
+		s.mutex.Unlock()
+
+		connection.Close()
+	}
+}
+
+func setupRuntimeAPIStandIn(t *testing.T, currentSessions []string) (*Controller, *runtimeAPIStandIn) {
+	socketPath := filepath.Join(t.TempDir(), "haproxy.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to start runtime API stand-in! Received an error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	standIn := &runtimeAPIStandIn{listener: listener, currentSessions: currentSessions}
+	go standIn.serve()
+
+	configuration := &types.Configuration{
+		Items: &types.Items{
+			Src: &types.DBInstanceDetails{Host: "old.example.com", Port: "5432"},
+			Dst: &types.DBInstanceDetails{Host: "new.example.com", Port: "5433"},
+			HAProxy: &types.HAProxyDetails{
+				ConfigPath:   filepath.Join(t.TempDir(), "haproxy.cfg"),
+				RuntimeAPI:   "unix://" + socketPath,
+				Bind:         ":5432",
+				Backend:      "postgres",
+				DrainTimeout: time.Millisecond * 1500,
+			},
+		},
+	}
+
+	controller, err := NewController(configuration, nil)
+	if err != nil {
+		t.Fatalf("Failed to initialize haproxy controller! Received an error: %v", err)
+	}
+
+	return controller, standIn
+}
+
+func TestParseRuntimeAPI(t *testing.T) {
+	tests := []struct {
+		name            string
+		runtimeAPI      string
+		expectedNetwork string
+		expectedAddress string
+		expectedError   bool
+	}{
+		{
+			name:            "unix socket",
+			runtimeAPI:      "unix:///var/run/haproxy.sock",
+			expectedNetwork: "unix",
+			expectedAddress: "/var/run/haproxy.sock",
+		},
+		{
+			name:            "tcp socket",
+			runtimeAPI:      "tcp://127.0.0.1:9999",
+			expectedNetwork: "tcp",
+			expectedAddress: "127.0.0.1:9999",
+		},
+		{
+			name:          "unsupported scheme",
+			runtimeAPI:    "http://127.0.0.1:9999",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			network, address, err := parseRuntimeAPI(&test.runtimeAPI)
+			if test.expectedError {
+				assert.Error(t, err, "error must be raised")
+				return
+			}
+			assert.NoError(t, err, "no error must be raised")
+			assert.Equal(t, test.expectedNetwork, network, "received network must match expected network")
+			assert.Equal(t, test.expectedAddress, address, "received address must match expected address")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestSwitchToDestination(t *testing.T) {
+	tests := []struct {
+		name             string
+		currentSessions  []string
+		expectedCommands []string
+	}{
+		{
+			name:            "sessions are drained before the timeout",
+			currentSessions: []string{"2", "0"},
+			expectedCommands: []string{
+				"set server postgres/dst state ready",
+				"set server postgres/src state drain",
+				"show stat",
+				"show stat",
+				"set server postgres/src state maint",
+			},
+		},
+		{
+			name:            "remaining sessions are shut down after the timeout",
+			currentSessions: []string{"1"},
+			expectedCommands: []string{
+				"set server postgres/dst state ready",
+				"set server postgres/src state drain",
+				"show stat",
+				"show stat",
+				"shutdown sessions server postgres/src",
+				"set server postgres/src state maint",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			c, standIn := setupRuntimeAPIStandIn(t, test.currentSessions)
+
+			err := c.SwitchToDestination()
+			assert.NoError(t, err, "no error must be raised")
+
+			standIn.mutex.Lock()
+			defer standIn.mutex.Unlock()
+			assert.Equal(t, test.expectedCommands, standIn.commands, "executed commands must match expected commands")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestSetServerStateReturnsRuntimeAPIError(t *testing.T) {
+	c, _ := setupRuntimeAPIStandIn(t, []string{"0"})
+
+	err := c.setServerState("missing", "ready")
+	assert.ErrorContains(t, err, "No such server.", "runtime API error must be returned")
+}
+
+func TestGenerateConfiguration(t *testing.T) {
+	c, _ := setupRuntimeAPIStandIn(t, []string{"0"})
+
+	err := c.GenerateConfiguration()
+	assert.NoError(t, err, "no error must be raised")
+
+	configuration, err := os.ReadFile(c.configuration.Items.HAProxy.ConfigPath)
+	assert.NoError(t, err, "no error must be raised")
+	assert.Contains(t, string(configuration), "server src old.example.com:5432 check\n", "source server must be active")
+	assert.Contains(t, string(configuration), "server dst new.example.com:5433 check disabled\n", "destination server must be disabled")
+	assert.Contains(t, string(configuration), "level admin", "stats socket must allow state changes")
+}
@@ -14,10 +14,14 @@ import (
 	"bufio"
 	"db_relocate/log"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
 
+// Shared between prompts, so no buffered responses are lost in between.
+var reader = bufio.NewReader(os.Stdin)
+
 type BinaryInputMetadata struct {
 	Message          string
 	PositiveResponse string
@@ -25,9 +29,12 @@ type BinaryInputMetadata struct {
 	Handler          func() error
 }
 
-func (b *BinaryInputMetadata) readResponse() (*string, error) {
-	reader := bufio.NewReaderSize(os.Stdin, 4)
+// Replaces standard input as a source of responses, e.g. with prepared answers in tests.
+func SetReader(r io.Reader) {
+	reader = bufio.NewReader(r)
+}
 
+func (b *BinaryInputMetadata) readResponse() (*string, error) {
 	response, err := reader.ReadString('\n')
 	if err != nil {
 		return nil, err
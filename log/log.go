@@ -11,20 +11,60 @@
 package log
 
 import (
+	"strings"
+	"sync"
+
 	"github.com/sirupsen/logrus"
 )
 
+const REDACTED_VALUE string = "********"
+
 var (
 	l *logrus.Logger
+	// Values which must never show up in the logs, e.g. passwords.
+	sensitiveValues      []string
+	sensitiveValuesMutex sync.RWMutex
 )
 
+// Replaces sensitive values in the message before it is formatted, so JSON escaping can't get in the way.
+type redactingFormatter struct {
+	formatter logrus.Formatter
+}
+
+func (rf *redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	entry.Message = Redact(entry.Message)
+	return rf.formatter.Format(entry)
+}
+
 func init() {
 	l = logrus.New()
 
-	l.SetFormatter(&logrus.JSONFormatter{})
+	l.SetFormatter(&redactingFormatter{formatter: &logrus.JSONFormatter{}})
 	l.SetReportCaller(false)
 }
 
+func AddSensitiveValue(value string) {
+	if value == "" {
+		return
+	}
+
+	sensitiveValuesMutex.Lock()
+	defer sensitiveValuesMutex.Unlock()
+
+	sensitiveValues = append(sensitiveValues, value)
+}
+
+func Redact(message string) string {
+	sensitiveValuesMutex.RLock()
+	defer sensitiveValuesMutex.RUnlock()
+
+	for idx := range sensitiveValues {
+		message = strings.ReplaceAll(message, sensitiveValues[idx], REDACTED_VALUE)
+	}
+
+	return message
+}
+
 func SetLogLevel(level *string) {
 	logLevel, err := logrus.ParseLevel(*level)
 	if err != nil {
@@ -26,7 +26,12 @@ var (
 var cli struct {
 	ConfigPath string `name:"config" short:"c" default:"." help:"Directory to search for config.yaml file" type:"path"`
 
-	Run cmd.RunCmd `cmd:"" run:"initiate relocate routine"`
+	Run        cmd.RunCmd        `cmd:"" run:"initiate relocate routine"`
+	Switchover cmd.SwitchoverCmd `cmd:"" help:"freeze writes on the old instance and switch over to the new one"`
+	Fallback   cmd.FallbackCmd   `cmd:"" help:"return to the old instance when reverse replication is enabled"`
+	Schedule   cmd.ScheduleCmd   `cmd:"" help:"find the next start time clear of service windows and blackouts"`
+	Advise     cmd.AdviseCmd     `cmd:"" help:"recommend the storage and the instance class of the new instance from the CloudWatch history of the old one"`
+	RestoreTTL cmd.RestoreTTLCmd `cmd:"" name:"restore-ttl" help:"restore the original TTL of the Route53 CNAME record lowered by the run"`
 }
 
 func initConfig(path string) *viper.Viper {
@@ -0,0 +1,42 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package pgbouncer
+
+import (
+	"db_relocate/log"
+	"fmt"
+	"os"
+)
+
+// The file is managed by the tool and must be included into the main PgBouncer configuration with '%include'.
+func (c *Controller) writeIncludeFile(host string, port string) error {
+	log.Infof(
+		"Pointing PgBouncer database: '%s' to host: '%s' port: '%s' in file: '%s'",
+		c.database(),
+		host,
+		port,
+		c.configuration.Items.PgBouncer.IncludePath,
+	)
+
+	content := fmt.Sprintf(
+		"[databases]\n%s = host=%s port=%s dbname=%s\n",
+		c.database(),
+		host,
+		port,
+		c.configuration.Items.Src.Name,
+	)
+
+	return os.WriteFile(c.configuration.Items.PgBouncer.IncludePath, []byte(content), 0644)
+}
+
+func (c *Controller) GenerateIncludeFile() error {
+	return c.writeIncludeFile(c.configuration.Items.Src.Host, c.configuration.Items.Src.Port)
+}
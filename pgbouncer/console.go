@@ -0,0 +1,149 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package pgbouncer
+
+import (
+	"context"
+	"db_relocate/log"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (c *Controller) executeCommand(command string) error {
+	log.Debugf("Executing PgBouncer admin console command: '%s'", command)
+
+	// No arguments are passed, so the query is sent through simple query protocol.
+	_, err := c.connection.Exec(command)
+
+	return err
+}
+
+func (c *Controller) resume() error {
+	if !c.paused {
+		return nil
+	}
+
+	log.Infof("Resuming PgBouncer database: '%s'", c.database())
+
+	err := c.executeCommand(fmt.Sprintf("RESUME %s;", c.database()))
+	if err != nil {
+		return err
+	}
+
+	c.paused = false
+
+	return nil
+}
+
+// PAUSE waits until all server connections of the database have been released, so it is already bounded by the pause deadline.
+func (c *Controller) Pause() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	log.Infof("Pausing PgBouncer database: '%s'", c.database())
+
+	deadline := time.Now().Add(c.configuration.Items.PgBouncer.PauseTimeout)
+	ctx, cancel := context.WithDeadline(*c.configuration.Context, deadline)
+	defer cancel()
+
+	_, err := c.connection.ExecContext(ctx, fmt.Sprintf("PAUSE %s;", c.database()))
+	if err != nil {
+		if ctx.Err() == nil {
+			return err
+		}
+
+		// The database may have been paused partially, so clients are released explicitly.
+		resumeErr := c.executeCommand(fmt.Sprintf("RESUME %s;", c.database()))
+		if resumeErr != nil {
+			log.Errorf("Failed to resume PgBouncer database: '%s': %s", c.database(), resumeErr)
+		}
+
+		return errors.New(fmt.Sprintf(
+			"PgBouncer database: '%s' could not be paused within %s! Some server connections are still in use.",
+			c.database(),
+			c.configuration.Items.PgBouncer.PauseTimeout,
+		))
+	}
+
+	c.paused = true
+	c.pauseDeadline = deadline
+
+	return nil
+}
+
+// The switchover steps, which keep the clients stalled, must fit into the remaining time.
+func (c *Controller) RemainingPauseTime() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	remaining := time.Until(c.pauseDeadline)
+	if !c.paused || remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// Must be checked before the switchover can no longer be rolled back, so clients are only resumed once the old instance is writable again.
+func (c *Controller) EnsurePauseHasNotExpired() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.paused && time.Now().Before(c.pauseDeadline) {
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf(
+		"PgBouncer database: '%s' has been paused for longer than %s!",
+		c.database(),
+		c.configuration.Items.PgBouncer.PauseTimeout,
+	))
+}
+
+func (c *Controller) Resume() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.resume()
+}
+
+func (c *Controller) reconfigure(host string, port string) error {
+	err := c.writeIncludeFile(host, port)
+	if err != nil {
+		return err
+	}
+
+	return c.executeCommand("RELOAD;")
+}
+
+func (c *Controller) SwitchToDestination() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.reconfigure(c.configuration.Items.Dst.Host, c.configuration.Items.Dst.Port)
+	if err != nil {
+		return err
+	}
+
+	return c.resume()
+}
+
+func (c *Controller) SwitchToSource() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.reconfigure(c.configuration.Items.Src.Host, c.configuration.Items.Src.Port)
+}
+
+func (c *Controller) EnsureAdminConsoleIsReachable() error {
+	return c.executeCommand("SHOW VERSION;")
+}
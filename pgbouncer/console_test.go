@@ -0,0 +1,110 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package pgbouncer
+
+import (
+	thelper "db_relocate/testing"
+	"db_relocate/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPgBouncerMockData(t *testing.T, pauseTimeout time.Duration) (*Controller, *sqlmock.Sqlmock) {
+	databaseMockData := thelper.SetupDatabaseMockData()
+
+	return &Controller{
+		connection: databaseMockData.Connection,
+		configuration: &types.Configuration{
+			Context: databaseMockData.Context,
+			Items: &types.Items{
+				Src: &types.DBInstanceDetails{Host: "old.example.com", Port: "5432", Name: "postgres"},
+				Dst: &types.DBInstanceDetails{Host: "new.example.com", Port: "5433"},
+				PgBouncer: &types.PgBouncerDetails{
+					Host:         "127.0.0.1",
+					IncludePath:  filepath.Join(t.TempDir(), "pgbouncer_databases.ini"),
+					PauseTimeout: pauseTimeout,
+				},
+			},
+		},
+	}, databaseMockData.Mock
+}
+
+func TestSwitchToDestination(t *testing.T) {
+	c, mock := setupPgBouncerMockData(t, time.Minute)
+
+	(*mock).ExpectExec(regexp.QuoteMeta("PAUSE postgres;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	(*mock).ExpectExec(regexp.QuoteMeta("RELOAD;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	(*mock).ExpectExec(regexp.QuoteMeta("RESUME postgres;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := c.Pause()
+	assert.NoError(t, err, "no error must be raised")
+
+	err = c.SwitchToDestination()
+	assert.NoError(t, err, "no error must be raised")
+
+	content, err := os.ReadFile(c.configuration.Items.PgBouncer.IncludePath)
+	assert.NoError(t, err, "no error must be raised")
+	assert.Equal(
+		t,
+		"[databases]\npostgres = host=new.example.com port=5433 dbname=postgres\n",
+		string(content),
+		"include file must point to the new instance",
+	)
+
+	// Database is no longer paused, so no command must be sent.
+	err = c.Resume()
+	assert.NoError(t, err, "no error must be raised")
+
+	if err := (*mock).ExpectationsWereMet(); err != nil {
+		assert.NoError(t, err, "expectation must be fulfilled")
+	}
+}
+
+func TestPauseExpires(t *testing.T) {
+	c, mock := setupPgBouncerMockData(t, time.Millisecond*10)
+
+	(*mock).ExpectExec(regexp.QuoteMeta("PAUSE postgres;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := c.Pause()
+	assert.NoError(t, err, "no error must be raised")
+	assert.NoError(t, c.EnsurePauseHasNotExpired(), "pause must not have expired yet")
+
+	time.Sleep(time.Millisecond * 100)
+
+	// Clients must stay paused until the switchover is rolled back, so no RESUME is expected here.
+	assert.Error(t, c.EnsurePauseHasNotExpired(), "pause must have expired")
+	assert.Equal(t, time.Duration(0), c.RemainingPauseTime(), "no pause time must be left")
+
+	if err := (*mock).ExpectationsWereMet(); err != nil {
+		assert.NoError(t, err, "expectation must be fulfilled")
+	}
+}
+
+func TestPauseIsAbortedAfterTimeout(t *testing.T) {
+	c, mock := setupPgBouncerMockData(t, time.Millisecond*10)
+
+	(*mock).ExpectExec(regexp.QuoteMeta("PAUSE postgres;")).WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 0))
+	(*mock).ExpectExec(regexp.QuoteMeta("RESUME postgres;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := c.Pause()
+	assert.Error(t, err, "pause must be aborted once the deadline has passed")
+	assert.Error(t, c.EnsurePauseHasNotExpired(), "database must not be considered paused")
+
+	if err := (*mock).ExpectationsWereMet(); err != nil {
+		assert.NoError(t, err, "expectation must be fulfilled")
+	}
+}
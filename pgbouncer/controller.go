@@ -0,0 +1,89 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package pgbouncer
+
+import (
+	"db_relocate/log"
+	"db_relocate/types"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+const (
+	ADMIN_CONSOLE_DATABASE_NAME string = "pgbouncer"
+)
+
+type Controller struct {
+	connection    *sqlx.DB
+	mutex         sync.Mutex
+	paused        bool
+	pauseDeadline time.Time
+	errorChannel  chan error
+	configuration *types.Configuration
+}
+
+func NewController(configuration *types.Configuration, errorChannel chan error) (*Controller, error) {
+	log.Infoln("Initializing pgbouncer controller")
+
+	controller := &Controller{
+		errorChannel:  errorChannel,
+		configuration: configuration,
+	}
+
+	if !controller.Enabled() {
+		return controller, nil
+	}
+
+	// Admin console only supports simple query protocol, so the connection is not verified with a ping here.
+	connection, err := sqlx.Open("postgres", fmt.Sprintf(
+		"user=%s password=%s host=%s port=%s dbname=%s sslmode=%s",
+		configuration.Items.PgBouncer.User,
+		configuration.Items.PgBouncer.Password,
+		configuration.Items.PgBouncer.Host,
+		configuration.Items.PgBouncer.Port,
+		ADMIN_CONSOLE_DATABASE_NAME,
+		configuration.Items.PgBouncer.SSLMode,
+	))
+	if err != nil {
+		return nil, err
+	}
+	connection.SetMaxOpenConns(1)
+
+	controller.connection = connection
+
+	return controller, nil
+}
+
+// Allows to run the controller against any admin console connection, e.g. a mocked one.
+func NewControllerWithConnection(configuration *types.Configuration, connection *sqlx.DB, errorChannel chan error) *Controller {
+	return &Controller{
+		connection:    connection,
+		errorChannel:  errorChannel,
+		configuration: configuration,
+	}
+}
+
+func (c *Controller) Enabled() bool {
+	return c.configuration.Items.PgBouncer.Host != ""
+}
+
+// PgBouncer database name defaults to the source database name.
+func (c *Controller) database() string {
+	if c.configuration.Items.PgBouncer.Database != "" {
+		return c.configuration.Items.PgBouncer.Database
+	}
+
+	return c.configuration.Items.Src.Name
+}
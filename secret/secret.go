@@ -0,0 +1,280 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package secret
+
+import (
+	"db_relocate/log"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	c "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+const (
+	ENV_PREFIX             string = "env:"
+	FILE_PREFIX            string = "file:"
+	EXEC_PREFIX            string = "exec:"
+	SECRETS_MANAGER_PREFIX string = "aws-secretsmanager:"
+	SSM_PREFIX             string = "aws-ssm:"
+	// Separates the ARN of a secret from the key of a value in its JSON, e.g. 'arn:...:secret:db#password'.
+	SECRET_KEY_SEPARATOR string = "#"
+)
+
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// Resolves references like 'env:PGPASSWORD' to the values they point to. Other values are returned as they are.
+// The AWS clients are only created once a reference needs them, so no credentials are required otherwise.
+type Resolver struct {
+	context              *context.Context
+	profile              string
+	region               string
+	endpoint             string
+	secretsManagerClient SecretsManagerAPI
+	ssmClient            SSMAPI
+	// Secret strings keyed by the secret ARN, since a secret usually holds several values, e.g. the user and the password.
+	secretStrings map[string]string
+}
+
+func NewResolver(context *context.Context, profile string, region string, endpoint string) *Resolver {
+	return &Resolver{
+		context:       context,
+		profile:       profile,
+		region:        region,
+		endpoint:      endpoint,
+		secretStrings: make(map[string]string),
+	}
+}
+
+// Allows to resolve the references against any implementation of the AWS APIs, e.g. an in-memory fake.
+func NewResolverWithClients(context *context.Context, secretsManagerClient SecretsManagerAPI, ssmClient SSMAPI) *Resolver {
+	return &Resolver{
+		context:              context,
+		secretsManagerClient: secretsManagerClient,
+		ssmClient:            ssmClient,
+		secretStrings:        make(map[string]string),
+	}
+}
+
+func IsReference(value string) bool {
+	for _, prefix := range []string{ENV_PREFIX, FILE_PREFIX, EXEC_PREFIX, SECRETS_MANAGER_PREFIX, SSM_PREFIX} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Errors name the reference, never the resolved value.
+func (r *Resolver) Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, ENV_PREFIX):
+		return resolveEnv(strings.TrimPrefix(value, ENV_PREFIX))
+	case strings.HasPrefix(value, FILE_PREFIX):
+		return resolveFile(strings.TrimPrefix(value, FILE_PREFIX))
+	case strings.HasPrefix(value, EXEC_PREFIX):
+		return r.resolveExec(strings.TrimPrefix(value, EXEC_PREFIX))
+	case strings.HasPrefix(value, SECRETS_MANAGER_PREFIX):
+		return r.resolveSecretsManager(strings.TrimPrefix(value, SECRETS_MANAGER_PREFIX))
+	case strings.HasPrefix(value, SSM_PREFIX):
+		return r.resolveSSM(strings.TrimPrefix(value, SSM_PREFIX))
+	}
+
+	return value, nil
+}
+
+func resolveEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Environment variable: '%s' is not set!", name))
+	}
+
+	return value, nil
+}
+
+// A trailing newline is dropped, as most editors and 'echo' add one.
+func resolveFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Failed to read secret file: '%s': %v", path, err))
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// The command is run by the shell, so it may contain arguments and pipes. Only its standard output is taken.
+func (r *Resolver) resolveExec(command string) (string, error) {
+	output, err := exec.CommandContext(*r.context, "sh", "-c", command).Output()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Failed to run secret command: '%s': %v", command, err))
+	}
+
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+func (r *Resolver) loadSession() (*a.Config, error) {
+	if r.profile != "" {
+		config, err := c.LoadDefaultConfig(*r.context, c.WithRegion(r.region), c.WithSharedConfigProfile(r.profile))
+		if err != nil {
+			return nil, err
+		}
+
+		return &config, nil
+	}
+
+	config, err := c.LoadDefaultConfig(*r.context, c.WithRegion(r.region), c.WithCredentialsProvider(ec2rolecreds.New()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Endpoint can be overridden to run against a local Secrets Manager stand-in.
+func (r *Resolver) getSecretsManagerClient() (SecretsManagerAPI, error) {
+	if r.secretsManagerClient != nil {
+		return r.secretsManagerClient, nil
+	}
+
+	session, err := r.loadSession()
+	if err != nil {
+		return nil, err
+	}
+
+	optFns := []func(*secretsmanager.Options){}
+	if r.endpoint != "" {
+		optFns = append(optFns, secretsmanager.WithEndpointResolver(secretsmanager.EndpointResolverFromURL(r.endpoint)))
+	}
+	r.secretsManagerClient = secretsmanager.NewFromConfig(*session, optFns...)
+
+	return r.secretsManagerClient, nil
+}
+
+// Endpoint can be overridden to run against a local SSM stand-in.
+func (r *Resolver) getSSMClient() (SSMAPI, error) {
+	if r.ssmClient != nil {
+		return r.ssmClient, nil
+	}
+
+	session, err := r.loadSession()
+	if err != nil {
+		return nil, err
+	}
+
+	optFns := []func(*ssm.Options){}
+	if r.endpoint != "" {
+		optFns = append(optFns, ssm.WithEndpointResolver(ssm.EndpointResolverFromURL(r.endpoint)))
+	}
+	r.ssmClient = ssm.NewFromConfig(*session, optFns...)
+
+	return r.ssmClient, nil
+}
+
+func (r *Resolver) getSecretString(secretID string) (string, error) {
+	if secretString, ok := r.secretStrings[secretID]; ok {
+		return secretString, nil
+	}
+
+	client, err := r.getSecretsManagerClient()
+	if err != nil {
+		return "", err
+	}
+
+	// A secret of another region is read there, the region is part of its ARN.
+	optFns := []func(*secretsmanager.Options){}
+	if secretArn, err := arn.Parse(secretID); err == nil && secretArn.Region != "" {
+		optFns = append(optFns, func(options *secretsmanager.Options) {
+			options.Region = secretArn.Region
+		})
+	}
+
+	log.Infof("Reading secret: '%s' from Secrets Manager", secretID)
+	output, err := client.GetSecretValue(*r.context, &secretsmanager.GetSecretValueInput{SecretId: a.String(secretID)}, optFns...)
+	if err != nil {
+		return "", err
+	}
+
+	if output.SecretString == nil {
+		return "", errors.New(fmt.Sprintf("Secret: '%s' has no secret string!", secretID))
+	}
+
+	r.secretStrings[secretID] = *output.SecretString
+
+	return *output.SecretString, nil
+}
+
+// Without a key the whole secret string is the value, otherwise it is looked up in the JSON of the secret.
+func (r *Resolver) resolveSecretsManager(reference string) (string, error) {
+	secretID, key, hasKey := strings.Cut(reference, SECRET_KEY_SEPARATOR)
+
+	secretString, err := r.getSecretString(secretID)
+	if err != nil {
+		return "", err
+	}
+
+	if !hasKey {
+		return secretString, nil
+	}
+
+	values := make(map[string]interface{})
+	decoder := json.NewDecoder(strings.NewReader(secretString))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return "", errors.New(fmt.Sprintf("Secret: '%s' is not a JSON object!", secretID))
+	}
+
+	value, ok := values[key]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Secret: '%s' has no key: '%s'!", secretID, key))
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+// SecureString parameters are decrypted, other ones are returned as they are.
+func (r *Resolver) resolveSSM(name string) (string, error) {
+	client, err := r.getSSMClient()
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("Reading parameter: '%s' from SSM", name)
+	output, err := client.GetParameter(*r.context, &ssm.GetParameterInput{
+		Name:           a.String(name),
+		WithDecryption: a.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if output.Parameter == nil || output.Parameter.Value == nil {
+		return "", errors.New(fmt.Sprintf("Parameter: '%s' has no value!", name))
+	}
+
+	return *output.Parameter.Value, nil
+}
@@ -0,0 +1,149 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package secret
+
+import (
+	"context"
+	"db_relocate/testing/fakeaws"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const TEST_SECRET_ARN string = "arn:aws:secretsmanager:us-east-1:123456789012:secret:test-db-AbCdEf"
+
+func TestResolve(t *testing.T) {
+	directory := t.TempDir()
+	secretFile := filepath.Join(directory, "password")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("file-secret\n"), 0600))
+
+	t.Setenv("DB_RELOCATE_TEST_PASSWORD", "env-secret")
+
+	tests := []struct {
+		name          string
+		value         string
+		expectedValue string
+		expectedError bool
+	}{
+		{
+			name:          "plain value is kept",
+			value:         "plain-secret",
+			expectedValue: "plain-secret",
+		},
+		{
+			name:          "environment variable",
+			value:         "env:DB_RELOCATE_TEST_PASSWORD",
+			expectedValue: "env-secret",
+		},
+		{
+			name:          "environment variable which is not set",
+			value:         "env:DB_RELOCATE_TEST_MISSING",
+			expectedError: true,
+		},
+		{
+			name:          "file without the trailing newline",
+			value:         "file:" + secretFile,
+			expectedValue: "file-secret",
+		},
+		{
+			name:          "file which does not exist",
+			value:         "file:" + filepath.Join(directory, "missing"),
+			expectedError: true,
+		},
+		{
+			name:          "output of a command",
+			value:         "exec:echo exec-secret",
+			expectedValue: "exec-secret",
+		},
+		{
+			name:          "command which fails",
+			value:         "exec:exit 1",
+			expectedError: true,
+		},
+		{
+			name:          "key of a secret",
+			value:         "aws-secretsmanager:" + TEST_SECRET_ARN + "#password",
+			expectedValue: "secretsmanager-secret",
+		},
+		{
+			name:          "numeric key of a secret",
+			value:         "aws-secretsmanager:" + TEST_SECRET_ARN + "#port",
+			expectedValue: "5432",
+		},
+		{
+			name:          "whole secret string",
+			value:         "aws-secretsmanager:plain-secret",
+			expectedValue: "whole-secret",
+		},
+		{
+			name:          "missing key of a secret",
+			value:         "aws-secretsmanager:" + TEST_SECRET_ARN + "#missing",
+			expectedError: true,
+		},
+		{
+			name:          "missing secret",
+			value:         "aws-secretsmanager:missing-secret#password",
+			expectedError: true,
+		},
+		{
+			name:          "SSM parameter",
+			value:         "aws-ssm:/db/password",
+			expectedValue: "ssm-secret",
+		},
+		{
+			name:          "missing SSM parameter",
+			value:         "aws-ssm:/db/missing",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := fakeaws.NewCloud()
+			cloud.Secrets[TEST_SECRET_ARN] = `{"username": "ops", "password": "secretsmanager-secret", "port": 5432}`
+			cloud.Secrets["plain-secret"] = "whole-secret"
+			cloud.Parameters["/db/password"] = "ssm-secret"
+
+			cont := context.TODO()
+			resolver := NewResolverWithClients(&cont, cloud, cloud)
+
+			value, err := resolver.Resolve(test.value)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, value)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestResolveReadsSecretOnce(t *testing.T) {
+	cloud := fakeaws.NewCloud()
+	cloud.Secrets[TEST_SECRET_ARN] = `{"username": "ops", "password": "secretsmanager-secret"}`
+
+	cont := context.TODO()
+	resolver := NewResolverWithClients(&cont, cloud, cloud)
+
+	user, err := resolver.Resolve("aws-secretsmanager:" + TEST_SECRET_ARN + "#username")
+	assert.NoError(t, err)
+	assert.Equal(t, "ops", user)
+
+	password, err := resolver.Resolve("aws-secretsmanager:" + TEST_SECRET_ARN + "#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "secretsmanager-secret", password)
+
+	assert.Equal(t, []string{"GetSecretValue"}, cloud.Calls())
+}
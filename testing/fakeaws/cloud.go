@@ -0,0 +1,210 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"fmt"
+	"sync"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	kmsTypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	route53Types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	STATUS_AVAILABLE string = "available"
+	STATUS_FAILED    string = "failed"
+	DEFAULT_REGION   string = "us-east-1"
+	ACCOUNT_ID       string = "123456789012"
+)
+
+type ParameterGroup struct {
+	Group      rdsTypes.DBParameterGroup
+	Parameters map[string]rdsTypes.Parameter
+}
+
+type ClusterParameterGroup struct {
+	Group      rdsTypes.DBClusterParameterGroup
+	Parameters map[string]rdsTypes.Parameter
+}
+
+// Cloud is an in-memory model of the AWS APIs used by the aws.Controller.
+// A single value implements RDS, EC2, KMS, CloudWatch and Route53 client interfaces.
+//
+// Resources that are being created or modified stay in an intermediate status
+// until they have been described once, so waiters observe a state transition.
+type Cloud struct {
+	mutex sync.Mutex
+
+	Region    string
+	AccountID string
+	Instances map[string]*rdsTypes.DBInstance
+	Clusters  map[string]*rdsTypes.DBCluster
+	Snapshots map[string]*rdsTypes.DBSnapshot
+	// Accounts each snapshot has been shared with, keyed by the snapshot identifier.
+	SharedSnapshots        map[string][]string
+	ParameterGroups        map[string]*ParameterGroup
+	ClusterParameterGroups map[string]*ClusterParameterGroup
+	SubnetGroups           map[string]*rdsTypes.DBSubnetGroup
+	// Pending maintenance actions keyed by the ARN of the resource.
+	PendingMaintenanceActions map[string][]rdsTypes.PendingMaintenanceAction
+	EngineVersions            []rdsTypes.DBEngineVersion
+	EngineDefaults            map[string][]rdsTypes.Parameter
+	ClusterEngineDefaults     map[string][]rdsTypes.Parameter
+	InstanceClasses           []string
+	StorageTypes              []string
+	Certificates              []rdsTypes.Certificate
+	LogFiles                  map[string]map[string]string
+	// Events returned by DescribeEvents, filtered by the source and the start time.
+	Events           []rdsTypes.Event
+	FreeStorageSpace float64
+	// Data points of a metric keyed by the metric name, one per period with the last one at the end time.
+	MetricHistory map[string][]float64
+	// Instance classes orderable for an engine version. Versions which are not listed fall back to InstanceClasses.
+	InstanceClassesByEngineVersion map[string][]string
+	// Blue/green deployments keyed by the system-generated identifier, e.g. 'bgd-000001'.
+	BlueGreenDeployments map[string]*rdsTypes.BlueGreenDeployment
+	Vpcs                 []ec2Types.Vpc
+	InstanceTypes        []ec2Types.InstanceTypeInfo
+	SecurityGroups       []ec2Types.SecurityGroup
+	Subnets              []ec2Types.Subnet
+	NetworkAcls          []ec2Types.NetworkAcl
+	Keys                 []kmsTypes.KeyListEntry
+	Aliases              []kmsTypes.AliasListEntry
+	Records              map[string]*route53Types.ResourceRecordSet
+	// CloudWatch metric alarms keyed by the alarm name.
+	Alarms map[string]*cwTypes.MetricAlarm
+	// Custom metric data points published with PutMetricData, keyed by the namespace.
+	MetricData map[string][]cwTypes.MetricDatum
+	// Secret strings keyed by the secret ARN or name.
+	Secrets map[string]string
+	// Values of SSM parameters keyed by the parameter name.
+	Parameters map[string]string
+	// Keys returned by DescribeKey, keyed by the key ARN. Includes keys of other accounts this one may use.
+	KeyMetadata map[string]kmsTypes.KeyMetadata
+	// Clouds of other regions or accounts, used to resolve snapshot copies by the snapshot ARN.
+	Peers []*Cloud
+
+	// Writer instance identifiers keyed by the cluster identifier.
+	clusterWriters    map[string]string
+	pendingStatuses   map[string]string
+	failures          map[string]error
+	failedTransitions map[string]bool
+	calls             []string
+
+	// Names of the actions applied to a resource, which are still listed as pending until they start.
+	appliedMaintenanceActions map[string][]string
+}
+
+func NewCloud() *Cloud {
+	return &Cloud{
+		Region:                    DEFAULT_REGION,
+		AccountID:                 ACCOUNT_ID,
+		Instances:                 make(map[string]*rdsTypes.DBInstance),
+		Clusters:                  make(map[string]*rdsTypes.DBCluster),
+		Snapshots:                 make(map[string]*rdsTypes.DBSnapshot),
+		SharedSnapshots:           make(map[string][]string),
+		ParameterGroups:           make(map[string]*ParameterGroup),
+		ClusterParameterGroups:    make(map[string]*ClusterParameterGroup),
+		SubnetGroups:              make(map[string]*rdsTypes.DBSubnetGroup),
+		PendingMaintenanceActions: make(map[string][]rdsTypes.PendingMaintenanceAction),
+		EngineDefaults:            make(map[string][]rdsTypes.Parameter),
+		ClusterEngineDefaults:     make(map[string][]rdsTypes.Parameter),
+		LogFiles:                  make(map[string]map[string]string),
+		Records:                   make(map[string]*route53Types.ResourceRecordSet),
+		KeyMetadata:               make(map[string]kmsTypes.KeyMetadata),
+		BlueGreenDeployments:      make(map[string]*rdsTypes.BlueGreenDeployment),
+		Alarms:                    make(map[string]*cwTypes.MetricAlarm),
+		MetricData:                make(map[string][]cwTypes.MetricDatum),
+		MetricHistory:             make(map[string][]float64),
+		Secrets:                   make(map[string]string),
+		Parameters:                make(map[string]string),
+		clusterWriters:            make(map[string]string),
+		pendingStatuses:           make(map[string]string),
+		appliedMaintenanceActions: make(map[string][]string),
+		failures:                  make(map[string]error),
+		failedTransitions:         make(map[string]bool),
+	}
+}
+
+// FailOn makes every subsequent call of the operation, e.g. 'CreateDBSnapshot', return the error.
+func (c *Cloud) FailOn(operation string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.failures[operation] = err
+}
+
+// FailStateTransition makes an instance, a cluster or a snapshot end up in 'failed' status instead of 'available'.
+// Blue/green deployments are referenced by their name.
+// SDK waiters keep retrying on API errors, so this is the way to make them fail.
+func (c *Cloud) FailStateTransition(identifier string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.failedTransitions[identifier] = true
+}
+
+// Calls returns the names of all the operations called so far in order.
+func (c *Cloud) Calls() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]string{}, c.calls...)
+}
+
+// Must be called with the mutex held.
+func (c *Cloud) call(operation string) error {
+	c.calls = append(c.calls, operation)
+
+	return c.failures[operation]
+}
+
+// Must be called with the mutex held.
+func (c *Cloud) setPendingStatus(identifier string, status **string, intermediateStatus string, finalStatus string) {
+	*status = a.String(intermediateStatus)
+
+	if c.failedTransitions[identifier] {
+		finalStatus = STATUS_FAILED
+	}
+	c.pendingStatuses[identifier] = finalStatus
+}
+
+// Must be called with the mutex held.
+func (c *Cloud) completePendingStatus(identifier string, status **string) {
+	finalStatus, ok := c.pendingStatuses[identifier]
+	if !ok {
+		return
+	}
+
+	*status = a.String(finalStatus)
+	delete(c.pendingStatuses, identifier)
+}
+
+func (c *Cloud) instanceArn(identifier *string) *string {
+	return a.String(fmt.Sprintf("arn:aws:rds:%s:%s:db:%s", c.Region, c.AccountID, *identifier))
+}
+
+func (c *Cloud) clusterArn(identifier *string) *string {
+	return a.String(fmt.Sprintf("arn:aws:rds:%s:%s:cluster:%s", c.Region, c.AccountID, *identifier))
+}
+
+func (c *Cloud) snapshotArn(identifier *string) *string {
+	return a.String(fmt.Sprintf("arn:aws:rds:%s:%s:snapshot:%s", c.Region, c.AccountID, *identifier))
+}
+
+func notFoundMessage(resource string, identifier *string) *string {
+	message := fmt.Sprintf("%s %s not found.", resource, *identifier)
+	return &message
+}
@@ -0,0 +1,155 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Metric queries are answered with the configured history, otherwise with the replication lag or free storage space in bytes.
+func (c *Cloud) GetMetricData(ctx context.Context, params *cloudwatch.GetMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("GetMetricData"); err != nil {
+		return nil, err
+	}
+
+	output := &cloudwatch.GetMetricDataOutput{}
+	for idx := range params.MetricDataQueries {
+		metricStat := params.MetricDataQueries[idx].MetricStat
+		metricName := a.ToString(metricStat.Metric.MetricName)
+
+		values, ok := c.MetricHistory[metricName]
+		if !ok {
+			values = []float64{c.FreeStorageSpace}
+		}
+
+		period := time.Duration(a.ToInt32(metricStat.Period)) * time.Second
+		timestamps := []time.Time{}
+		for position := range values {
+			timestamps = append(timestamps, params.EndTime.Add(-time.Duration(len(values)-1-position)*period))
+		}
+
+		output.MetricDataResults = append(output.MetricDataResults, cwTypes.MetricDataResult{
+			Id:         params.MetricDataQueries[idx].Id,
+			Timestamps: timestamps,
+			Values:     values,
+			StatusCode: cwTypes.StatusCodeComplete,
+		})
+	}
+
+	return output, nil
+}
+
+// Alarms are listed in a single page, sorted by the name like CloudWatch does.
+func (c *Cloud) DescribeAlarms(ctx context.Context, params *cloudwatch.DescribeAlarmsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.DescribeAlarmsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeAlarms"); err != nil {
+		return nil, err
+	}
+
+	alarmNames := []string{}
+	for alarmName := range c.Alarms {
+		alarmNames = append(alarmNames, alarmName)
+	}
+	sort.Strings(alarmNames)
+
+	output := &cloudwatch.DescribeAlarmsOutput{}
+	for _, alarmName := range alarmNames {
+		output.MetricAlarms = append(output.MetricAlarms, *c.Alarms[alarmName])
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) PutMetricAlarm(ctx context.Context, params *cloudwatch.PutMetricAlarmInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricAlarmOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("PutMetricAlarm"); err != nil {
+		return nil, err
+	}
+
+	actionsEnabled := params.ActionsEnabled
+	if actionsEnabled == nil {
+		actionsEnabled = a.Bool(true)
+	}
+
+	c.Alarms[*params.AlarmName] = &cwTypes.MetricAlarm{
+		AlarmName:                        params.AlarmName,
+		AlarmArn:                         a.String(fmt.Sprintf("arn:aws:cloudwatch:%s:%s:alarm:%s", c.Region, c.AccountID, *params.AlarmName)),
+		ActionsEnabled:                   actionsEnabled,
+		AlarmActions:                     params.AlarmActions,
+		AlarmDescription:                 params.AlarmDescription,
+		ComparisonOperator:               params.ComparisonOperator,
+		DatapointsToAlarm:                params.DatapointsToAlarm,
+		Dimensions:                       params.Dimensions,
+		EvaluateLowSampleCountPercentile: params.EvaluateLowSampleCountPercentile,
+		EvaluationPeriods:                params.EvaluationPeriods,
+		ExtendedStatistic:                params.ExtendedStatistic,
+		InsufficientDataActions:          params.InsufficientDataActions,
+		MetricName:                       params.MetricName,
+		Metrics:                          params.Metrics,
+		Namespace:                        params.Namespace,
+		OKActions:                        params.OKActions,
+		Period:                           params.Period,
+		Statistic:                        params.Statistic,
+		StateValue:                       cwTypes.StateValueInsufficientData,
+		Threshold:                        params.Threshold,
+		ThresholdMetricId:                params.ThresholdMetricId,
+		TreatMissingData:                 params.TreatMissingData,
+		Unit:                             params.Unit,
+	}
+
+	return &cloudwatch.PutMetricAlarmOutput{}, nil
+}
+
+// Unknown alarm names are ignored, like CloudWatch does.
+func (c *Cloud) DisableAlarmActions(ctx context.Context, params *cloudwatch.DisableAlarmActionsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.DisableAlarmActionsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DisableAlarmActions"); err != nil {
+		return nil, err
+	}
+
+	for _, alarmName := range params.AlarmNames {
+		if alarm, ok := c.Alarms[alarmName]; ok {
+			alarm.ActionsEnabled = a.Bool(false)
+		}
+	}
+
+	return &cloudwatch.DisableAlarmActionsOutput{}, nil
+}
+
+func (c *Cloud) PutMetricData(ctx context.Context, params *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("PutMetricData"); err != nil {
+		return nil, err
+	}
+
+	namespace := a.ToString(params.Namespace)
+	c.MetricData[namespace] = append(c.MetricData[namespace], params.MetricData...)
+
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"context"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func containsString(items []string, item *string) bool {
+	if item == nil {
+		return false
+	}
+
+	for idx := range items {
+		if items[idx] == *item {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Cloud) DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeVpcs"); err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeVpcsOutput{}
+	for idx := range c.Vpcs {
+		if len(params.VpcIds) == 0 || containsString(params.VpcIds, c.Vpcs[idx].VpcId) {
+			output.Vpcs = append(output.Vpcs, c.Vpcs[idx])
+		}
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeSecurityGroups(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeSecurityGroups"); err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeSecurityGroupsOutput{SecurityGroups: []ec2Types.SecurityGroup{}}
+	for idx := range c.SecurityGroups {
+		if len(params.GroupIds) == 0 || containsString(params.GroupIds, c.SecurityGroups[idx].GroupId) {
+			output.SecurityGroups = append(output.SecurityGroups, c.SecurityGroups[idx])
+		}
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeSubnets"); err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeSubnetsOutput{Subnets: []ec2Types.Subnet{}}
+	for idx := range c.Subnets {
+		if len(params.SubnetIds) == 0 || containsString(params.SubnetIds, c.Subnets[idx].SubnetId) {
+			output.Subnets = append(output.Subnets, c.Subnets[idx])
+		}
+	}
+
+	return output, nil
+}
+
+// Only the 'association.subnet-id' filter is supported, the same one the controller uses.
+func (c *Cloud) DescribeNetworkAcls(ctx context.Context, params *ec2.DescribeNetworkAclsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeNetworkAclsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeNetworkAcls"); err != nil {
+		return nil, err
+	}
+
+	subnetIDs := []string{}
+	for idx := range params.Filters {
+		if a.ToString(params.Filters[idx].Name) == "association.subnet-id" {
+			subnetIDs = append(subnetIDs, params.Filters[idx].Values...)
+		}
+	}
+
+	output := &ec2.DescribeNetworkAclsOutput{NetworkAcls: []ec2Types.NetworkAcl{}}
+	for idx := range c.NetworkAcls {
+		for associationIdx := range c.NetworkAcls[idx].Associations {
+			if len(subnetIDs) == 0 || containsString(subnetIDs, c.NetworkAcls[idx].Associations[associationIdx].SubnetId) {
+				output.NetworkAcls = append(output.NetworkAcls, c.NetworkAcls[idx])
+				break
+			}
+		}
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeInstanceTypes(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeInstanceTypes"); err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeInstanceTypesOutput{InstanceTypes: []ec2Types.InstanceTypeInfo{}}
+	for idx := range c.InstanceTypes {
+		for _, instanceType := range params.InstanceTypes {
+			if instanceType == c.InstanceTypes[idx].InstanceType {
+				output.InstanceTypes = append(output.InstanceTypes, c.InstanceTypes[idx])
+			}
+		}
+	}
+
+	return output, nil
+}
@@ -0,0 +1,57 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"context"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmsTypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+func (c *Cloud) ListAliases(ctx context.Context, params *kms.ListAliasesInput, optFns ...func(*kms.Options)) (*kms.ListAliasesOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ListAliases"); err != nil {
+		return nil, err
+	}
+
+	return &kms.ListAliasesOutput{Aliases: c.Aliases}, nil
+}
+
+func (c *Cloud) ListKeys(ctx context.Context, params *kms.ListKeysInput, optFns ...func(*kms.Options)) (*kms.ListKeysOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ListKeys"); err != nil {
+		return nil, err
+	}
+
+	return &kms.ListKeysOutput{Keys: c.Keys}, nil
+}
+
+func (c *Cloud) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeKey"); err != nil {
+		return nil, err
+	}
+
+	metadata, ok := c.KeyMetadata[a.ToString(params.KeyId)]
+	if !ok {
+		return nil, &kmsTypes.NotFoundException{Message: notFoundMessage("Key", params.KeyId)}
+	}
+
+	return &kms.DescribeKeyOutput{KeyMetadata: &metadata}, nil
+}
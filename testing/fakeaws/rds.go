@@ -0,0 +1,1079 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+const (
+	UNHEALTHY_LSN        string = "0/3000060"
+	LOG_FILE_NAME        string = "error/postgresql.log"
+	LOG_FILE_TIME_LAYOUT string = "2006-01-02 15:04:05"
+	DEFAULT_PORT         int32  = 5432
+	SNAPSHOT_PAGE_SIZE   int    = 100
+)
+
+// Returned values are copies, so the callers do not observe later state changes.
+func copyDBInstance(instance *rdsTypes.DBInstance) rdsTypes.DBInstance {
+	instanceCopy := *instance
+	instanceCopy.DBParameterGroups = append([]rdsTypes.DBParameterGroupStatus{}, instance.DBParameterGroups...)
+	instanceCopy.VpcSecurityGroups = append([]rdsTypes.VpcSecurityGroupMembership{}, instance.VpcSecurityGroups...)
+	instanceCopy.ReadReplicaDBInstanceIdentifiers = append([]string{}, instance.ReadReplicaDBInstanceIdentifiers...)
+	instanceCopy.OptionGroupMemberships = append([]rdsTypes.OptionGroupMembership{}, instance.OptionGroupMemberships...)
+	instanceCopy.EnabledCloudwatchLogsExports = append([]string{}, instance.EnabledCloudwatchLogsExports...)
+	instanceCopy.AssociatedRoles = append([]rdsTypes.DBInstanceRole{}, instance.AssociatedRoles...)
+	if instance.PendingModifiedValues != nil {
+		pendingModifiedValues := *instance.PendingModifiedValues
+		instanceCopy.PendingModifiedValues = &pendingModifiedValues
+	}
+
+	return instanceCopy
+}
+
+func (c *Cloud) DescribeDBInstances(ctx context.Context, params *rds.DescribeDBInstancesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBInstances"); err != nil {
+		return nil, err
+	}
+
+	output := &rds.DescribeDBInstancesOutput{}
+
+	if params.DBInstanceIdentifier == nil {
+		for identifier, instance := range c.Instances {
+			output.DBInstances = append(output.DBInstances, copyDBInstance(instance))
+			c.completePendingStatus(identifier, &instance.DBInstanceStatus)
+		}
+		return output, nil
+	}
+
+	instance, ok := c.Instances[*params.DBInstanceIdentifier]
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.DBInstanceIdentifier)}
+	}
+
+	output.DBInstances = append(output.DBInstances, copyDBInstance(instance))
+	c.completePendingStatus(*params.DBInstanceIdentifier, &instance.DBInstanceStatus)
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeDBSnapshots(ctx context.Context, params *rds.DescribeDBSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBSnapshots"); err != nil {
+		return nil, err
+	}
+
+	// Without an identifier all manual snapshots of the instance are listed in pages, like RDS does.
+	if params.DBSnapshotIdentifier == nil {
+		snapshotIDs := []string{}
+		for snapshotID, snapshot := range c.Snapshots {
+			if a.ToString(snapshot.DBInstanceIdentifier) == a.ToString(params.DBInstanceIdentifier) {
+				snapshotIDs = append(snapshotIDs, snapshotID)
+			}
+		}
+		sort.Strings(snapshotIDs)
+
+		start, _ := strconv.Atoi(a.ToString(params.Marker))
+		end := start + SNAPSHOT_PAGE_SIZE
+
+		output := &rds.DescribeDBSnapshotsOutput{}
+		if end < len(snapshotIDs) {
+			output.Marker = a.String(strconv.Itoa(end))
+		} else {
+			end = len(snapshotIDs)
+		}
+
+		for _, snapshotID := range snapshotIDs[start:end] {
+			snapshot := c.Snapshots[snapshotID]
+			c.completePendingStatus(*snapshot.DBSnapshotIdentifier, &snapshot.Status)
+			output.DBSnapshots = append(output.DBSnapshots, *snapshot)
+		}
+
+		return output, nil
+	}
+
+	snapshot, ok := c.Snapshots[a.ToString(params.DBSnapshotIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBSnapshotNotFoundFault{Message: notFoundMessage("DBSnapshot", params.DBSnapshotIdentifier)}
+	}
+
+	output := &rds.DescribeDBSnapshotsOutput{
+		DBSnapshots: []rdsTypes.DBSnapshot{*snapshot},
+	}
+	c.completePendingStatus(*snapshot.DBSnapshotIdentifier, &snapshot.Status)
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeEvents(ctx context.Context, params *rds.DescribeEventsInput, optFns ...func(*rds.Options)) (*rds.DescribeEventsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeEvents"); err != nil {
+		return nil, err
+	}
+
+	output := &rds.DescribeEventsOutput{}
+	for _, event := range c.Events {
+		if params.SourceIdentifier != nil && a.ToString(event.SourceIdentifier) != *params.SourceIdentifier {
+			continue
+		}
+		if params.SourceType != "" && event.SourceType != params.SourceType {
+			continue
+		}
+		if params.StartTime != nil && event.Date.Before(*params.StartTime) {
+			continue
+		}
+		output.Events = append(output.Events, event)
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeCertificates(ctx context.Context, params *rds.DescribeCertificatesInput, optFns ...func(*rds.Options)) (*rds.DescribeCertificatesOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeCertificates"); err != nil {
+		return nil, err
+	}
+
+	return &rds.DescribeCertificatesOutput{Certificates: c.Certificates}, nil
+}
+
+func (c *Cloud) DescribeDBEngineVersions(ctx context.Context, params *rds.DescribeDBEngineVersionsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBEngineVersionsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBEngineVersions"); err != nil {
+		return nil, err
+	}
+
+	output := &rds.DescribeDBEngineVersionsOutput{}
+	for idx := range c.EngineVersions {
+		if params.Engine != nil && *params.Engine != a.ToString(c.EngineVersions[idx].Engine) {
+			continue
+		}
+		if params.EngineVersion != nil && *params.EngineVersion != a.ToString(c.EngineVersions[idx].EngineVersion) {
+			continue
+		}
+		output.DBEngineVersions = append(output.DBEngineVersions, c.EngineVersions[idx])
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeDBLogFiles(ctx context.Context, params *rds.DescribeDBLogFilesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBLogFilesOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBLogFiles"); err != nil {
+		return nil, err
+	}
+
+	output := &rds.DescribeDBLogFilesOutput{}
+	for name, data := range c.LogFiles[a.ToString(params.DBInstanceIdentifier)] {
+		output.DescribeDBLogFiles = append(output.DescribeDBLogFiles, rdsTypes.DescribeDBLogFilesDetails{
+			LogFileName: a.String(name),
+			LastWritten: time.Now().UnixMilli(),
+			Size:        int64(len(data)),
+		})
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DownloadDBLogFilePortion(ctx context.Context, params *rds.DownloadDBLogFilePortionInput, optFns ...func(*rds.Options)) (*rds.DownloadDBLogFilePortionOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DownloadDBLogFilePortion"); err != nil {
+		return nil, err
+	}
+
+	data, ok := c.LogFiles[a.ToString(params.DBInstanceIdentifier)][a.ToString(params.LogFileName)]
+	if !ok {
+		return nil, fmt.Errorf("log file %s not found", a.ToString(params.LogFileName))
+	}
+
+	return &rds.DownloadDBLogFilePortionOutput{LogFileData: a.String(data)}, nil
+}
+
+func (c *Cloud) DescribeDBParameterGroups(ctx context.Context, params *rds.DescribeDBParameterGroupsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBParameterGroupsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBParameterGroups"); err != nil {
+		return nil, err
+	}
+
+	parameterGroup, ok := c.ParameterGroups[a.ToString(params.DBParameterGroupName)]
+	if !ok {
+		return nil, &rdsTypes.DBParameterGroupNotFoundFault{Message: notFoundMessage("DBParameterGroup", params.DBParameterGroupName)}
+	}
+
+	return &rds.DescribeDBParameterGroupsOutput{DBParameterGroups: []rdsTypes.DBParameterGroup{parameterGroup.Group}}, nil
+}
+
+func (c *Cloud) DescribeDBParameters(ctx context.Context, params *rds.DescribeDBParametersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBParametersOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBParameters"); err != nil {
+		return nil, err
+	}
+
+	parameterGroup, ok := c.ParameterGroups[a.ToString(params.DBParameterGroupName)]
+	if !ok {
+		return nil, &rdsTypes.DBParameterGroupNotFoundFault{Message: notFoundMessage("DBParameterGroup", params.DBParameterGroupName)}
+	}
+
+	output := &rds.DescribeDBParametersOutput{}
+	for _, parameter := range parameterGroup.Parameters {
+		if params.Source != nil && *params.Source != a.ToString(parameter.Source) {
+			continue
+		}
+		output.Parameters = append(output.Parameters, parameter)
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeEngineDefaultParameters(ctx context.Context, params *rds.DescribeEngineDefaultParametersInput, optFns ...func(*rds.Options)) (*rds.DescribeEngineDefaultParametersOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeEngineDefaultParameters"); err != nil {
+		return nil, err
+	}
+
+	return &rds.DescribeEngineDefaultParametersOutput{
+		EngineDefaults: &rdsTypes.EngineDefaults{
+			DBParameterGroupFamily: params.DBParameterGroupFamily,
+			Parameters:             c.EngineDefaults[a.ToString(params.DBParameterGroupFamily)],
+		},
+	}, nil
+}
+
+// New groups start with the engine defaults of their family.
+func (c *Cloud) CreateDBParameterGroup(ctx context.Context, params *rds.CreateDBParameterGroupInput, optFns ...func(*rds.Options)) (*rds.CreateDBParameterGroupOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("CreateDBParameterGroup"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := c.ParameterGroups[a.ToString(params.DBParameterGroupName)]; ok {
+		return nil, &rdsTypes.DBParameterGroupAlreadyExistsFault{Message: a.String(fmt.Sprintf("DBParameterGroup %s already exists.", *params.DBParameterGroupName))}
+	}
+
+	parameterGroup := &ParameterGroup{
+		Group: rdsTypes.DBParameterGroup{
+			DBParameterGroupName:   params.DBParameterGroupName,
+			DBParameterGroupFamily: params.DBParameterGroupFamily,
+			Description:            params.Description,
+		},
+		Parameters: make(map[string]rdsTypes.Parameter),
+	}
+	for _, parameter := range c.EngineDefaults[a.ToString(params.DBParameterGroupFamily)] {
+		parameterGroup.Parameters[*parameter.ParameterName] = parameter
+	}
+	c.ParameterGroups[*params.DBParameterGroupName] = parameterGroup
+
+	groupCopy := parameterGroup.Group
+	return &rds.CreateDBParameterGroupOutput{DBParameterGroup: &groupCopy}, nil
+}
+
+func (c *Cloud) DescribeDBSubnetGroups(ctx context.Context, params *rds.DescribeDBSubnetGroupsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSubnetGroupsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBSubnetGroups"); err != nil {
+		return nil, err
+	}
+
+	subnetGroup, ok := c.SubnetGroups[a.ToString(params.DBSubnetGroupName)]
+	if !ok {
+		return nil, &rdsTypes.DBSubnetGroupNotFoundFault{Message: notFoundMessage("DBSubnetGroup", params.DBSubnetGroupName)}
+	}
+
+	return &rds.DescribeDBSubnetGroupsOutput{DBSubnetGroups: []rdsTypes.DBSubnetGroup{*subnetGroup}}, nil
+}
+
+func (c *Cloud) DescribeOrderableDBInstanceOptions(ctx context.Context, params *rds.DescribeOrderableDBInstanceOptionsInput, optFns ...func(*rds.Options)) (*rds.DescribeOrderableDBInstanceOptionsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeOrderableDBInstanceOptions"); err != nil {
+		return nil, err
+	}
+
+	instanceClasses, ok := c.InstanceClassesByEngineVersion[a.ToString(params.EngineVersion)]
+	if !ok {
+		instanceClasses = c.InstanceClasses
+	}
+
+	output := &rds.DescribeOrderableDBInstanceOptionsOutput{}
+	for idx := range instanceClasses {
+		output.OrderableDBInstanceOptions = append(output.OrderableDBInstanceOptions, rdsTypes.OrderableDBInstanceOption{
+			DBInstanceClass: a.String(instanceClasses[idx]),
+			Engine:          params.Engine,
+			EngineVersion:   params.EngineVersion,
+		})
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeValidDBInstanceModifications(ctx context.Context, params *rds.DescribeValidDBInstanceModificationsInput, optFns ...func(*rds.Options)) (*rds.DescribeValidDBInstanceModificationsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeValidDBInstanceModifications"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]; !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.DBInstanceIdentifier)}
+	}
+
+	validModifications := &rdsTypes.ValidDBInstanceModificationsMessage{}
+	for idx := range c.StorageTypes {
+		validModifications.Storage = append(validModifications.Storage, rdsTypes.ValidStorageOptions{
+			StorageType: a.String(c.StorageTypes[idx]),
+		})
+	}
+
+	return &rds.DescribeValidDBInstanceModificationsOutput{ValidDBInstanceModificationsMessage: validModifications}, nil
+}
+
+func (c *Cloud) ModifyDBParameterGroup(ctx context.Context, params *rds.ModifyDBParameterGroupInput, optFns ...func(*rds.Options)) (*rds.ModifyDBParameterGroupOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ModifyDBParameterGroup"); err != nil {
+		return nil, err
+	}
+
+	parameterGroup, ok := c.ParameterGroups[a.ToString(params.DBParameterGroupName)]
+	if !ok {
+		return nil, &rdsTypes.DBParameterGroupNotFoundFault{Message: notFoundMessage("DBParameterGroup", params.DBParameterGroupName)}
+	}
+
+	for idx := range params.Parameters {
+		parameter := parameterGroup.Parameters[*params.Parameters[idx].ParameterName]
+		parameter.ParameterName = params.Parameters[idx].ParameterName
+		parameter.ParameterValue = params.Parameters[idx].ParameterValue
+		parameter.IsModifiable = true
+		parameter.Source = a.String("user")
+		parameterGroup.Parameters[*params.Parameters[idx].ParameterName] = parameter
+	}
+
+	// Static parameters are only applied after a reboot.
+	for _, instance := range c.Instances {
+		for idx := range instance.DBParameterGroups {
+			if *instance.DBParameterGroups[idx].DBParameterGroupName == *params.DBParameterGroupName {
+				instance.DBParameterGroups[idx].ParameterApplyStatus = a.String("pending-reboot")
+			}
+		}
+	}
+
+	return &rds.ModifyDBParameterGroupOutput{DBParameterGroupName: params.DBParameterGroupName}, nil
+}
+
+func (c *Cloud) RebootDBInstance(ctx context.Context, params *rds.RebootDBInstanceInput, optFns ...func(*rds.Options)) (*rds.RebootDBInstanceOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("RebootDBInstance"); err != nil {
+		return nil, err
+	}
+
+	instance, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.DBInstanceIdentifier)}
+	}
+
+	for idx := range instance.DBParameterGroups {
+		instance.DBParameterGroups[idx].ParameterApplyStatus = a.String("in-sync")
+	}
+	instance.PendingModifiedValues = &rdsTypes.PendingModifiedValues{}
+	c.setPendingStatus(*instance.DBInstanceIdentifier, &instance.DBInstanceStatus, "rebooting", STATUS_AVAILABLE)
+
+	instanceCopy := copyDBInstance(instance)
+	return &rds.RebootDBInstanceOutput{DBInstance: &instanceCopy}, nil
+}
+
+func (c *Cloud) ModifyDBInstance(ctx context.Context, params *rds.ModifyDBInstanceInput, optFns ...func(*rds.Options)) (*rds.ModifyDBInstanceOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ModifyDBInstance"); err != nil {
+		return nil, err
+	}
+
+	instance, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.DBInstanceIdentifier)}
+	}
+
+	if params.CACertificateIdentifier != nil {
+		instance.CACertificateIdentifier = params.CACertificateIdentifier
+	}
+	if params.DBInstanceClass != nil {
+		instance.DBInstanceClass = params.DBInstanceClass
+	}
+	if params.AllocatedStorage != nil {
+		instance.AllocatedStorage = *params.AllocatedStorage
+	}
+	if params.StorageType != nil {
+		instance.StorageType = params.StorageType
+	}
+	if params.BackupRetentionPeriod != nil {
+		instance.BackupRetentionPeriod = *params.BackupRetentionPeriod
+	}
+	if params.PreferredBackupWindow != nil {
+		instance.PreferredBackupWindow = params.PreferredBackupWindow
+	}
+	if params.PreferredMaintenanceWindow != nil {
+		instance.PreferredMaintenanceWindow = params.PreferredMaintenanceWindow
+	}
+	if params.MaxAllocatedStorage != nil {
+		instance.MaxAllocatedStorage = params.MaxAllocatedStorage
+	}
+	if params.MonitoringInterval != nil {
+		instance.MonitoringInterval = params.MonitoringInterval
+	}
+	if params.MonitoringRoleArn != nil {
+		instance.MonitoringRoleArn = params.MonitoringRoleArn
+	}
+	if params.EnablePerformanceInsights != nil {
+		instance.PerformanceInsightsEnabled = params.EnablePerformanceInsights
+	}
+	if params.PerformanceInsightsKMSKeyId != nil {
+		instance.PerformanceInsightsKMSKeyId = params.PerformanceInsightsKMSKeyId
+	}
+	if params.PerformanceInsightsRetentionPeriod != nil {
+		instance.PerformanceInsightsRetentionPeriod = params.PerformanceInsightsRetentionPeriod
+	}
+	if a.ToBool(params.ManageMasterUserPassword) {
+		instance.MasterUserSecret = c.manageMasterUserPassword(*instance.DBInstanceIdentifier, instance.MasterUsername, params.MasterUserSecretKmsKeyId)
+	}
+	c.setPendingStatus(*instance.DBInstanceIdentifier, &instance.DBInstanceStatus, "modifying", STATUS_AVAILABLE)
+
+	instanceCopy := copyDBInstance(instance)
+	return &rds.ModifyDBInstanceOutput{DBInstance: &instanceCopy}, nil
+}
+
+func (c *Cloud) AddRoleToDBInstance(ctx context.Context, params *rds.AddRoleToDBInstanceInput, optFns ...func(*rds.Options)) (*rds.AddRoleToDBInstanceOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("AddRoleToDBInstance"); err != nil {
+		return nil, err
+	}
+
+	instance, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.DBInstanceIdentifier)}
+	}
+
+	for idx := range instance.AssociatedRoles {
+		if a.ToString(instance.AssociatedRoles[idx].FeatureName) == a.ToString(params.FeatureName) {
+			return nil, &rdsTypes.DBInstanceRoleAlreadyExistsFault{
+				Message: a.String(fmt.Sprintf("Feature %s already has an associated role.", *params.FeatureName)),
+			}
+		}
+	}
+
+	instance.AssociatedRoles = append(instance.AssociatedRoles, rdsTypes.DBInstanceRole{
+		FeatureName: params.FeatureName,
+		RoleArn:     params.RoleArn,
+		Status:      a.String("ACTIVE"),
+	})
+
+	return &rds.AddRoleToDBInstanceOutput{}, nil
+}
+
+// Only instances can be tagged. Existing tags with the same key are replaced.
+func (c *Cloud) AddTagsToResource(ctx context.Context, params *rds.AddTagsToResourceInput, optFns ...func(*rds.Options)) (*rds.AddTagsToResourceOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("AddTagsToResource"); err != nil {
+		return nil, err
+	}
+
+	instance, ok := c.findDBInstanceByArn(params.ResourceName)
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.ResourceName)}
+	}
+
+	tags := []rdsTypes.Tag{}
+	for _, tag := range instance.TagList {
+		replaced := false
+		for _, newTag := range params.Tags {
+			replaced = replaced || a.ToString(tag.Key) == a.ToString(newTag.Key)
+		}
+		if !replaced {
+			tags = append(tags, tag)
+		}
+	}
+	instance.TagList = append(tags, params.Tags...)
+
+	return &rds.AddTagsToResourceOutput{}, nil
+}
+
+func (c *Cloud) RemoveTagsFromResource(ctx context.Context, params *rds.RemoveTagsFromResourceInput, optFns ...func(*rds.Options)) (*rds.RemoveTagsFromResourceOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("RemoveTagsFromResource"); err != nil {
+		return nil, err
+	}
+
+	instance, ok := c.findDBInstanceByArn(params.ResourceName)
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.ResourceName)}
+	}
+
+	tags := []rdsTypes.Tag{}
+	for _, tag := range instance.TagList {
+		removed := false
+		for _, key := range params.TagKeys {
+			removed = removed || a.ToString(tag.Key) == key
+		}
+		if !removed {
+			tags = append(tags, tag)
+		}
+	}
+	instance.TagList = tags
+
+	return &rds.RemoveTagsFromResourceOutput{}, nil
+}
+
+// Applied actions are still listed once and only then start, which takes the instance through a 'modifying' status.
+func (c *Cloud) DescribePendingMaintenanceActions(ctx context.Context, params *rds.DescribePendingMaintenanceActionsInput, optFns ...func(*rds.Options)) (*rds.DescribePendingMaintenanceActionsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribePendingMaintenanceActions"); err != nil {
+		return nil, err
+	}
+
+	output := &rds.DescribePendingMaintenanceActionsOutput{}
+	for resourceIdentifier, actions := range c.PendingMaintenanceActions {
+		if params.ResourceIdentifier != nil && *params.ResourceIdentifier != resourceIdentifier || len(actions) == 0 {
+			continue
+		}
+		output.PendingMaintenanceActions = append(output.PendingMaintenanceActions, rdsTypes.ResourcePendingMaintenanceActions{
+			ResourceIdentifier:              a.String(resourceIdentifier),
+			PendingMaintenanceActionDetails: append([]rdsTypes.PendingMaintenanceAction{}, actions...),
+		})
+	}
+
+	for resourceIdentifier := range c.appliedMaintenanceActions {
+		if params.ResourceIdentifier == nil || *params.ResourceIdentifier == resourceIdentifier {
+			c.startAppliedMaintenanceActions(resourceIdentifier)
+		}
+	}
+
+	return output, nil
+}
+
+// Must be called with the mutex held.
+func (c *Cloud) startAppliedMaintenanceActions(resourceIdentifier string) {
+	actions := []rdsTypes.PendingMaintenanceAction{}
+	for _, action := range c.PendingMaintenanceActions[resourceIdentifier] {
+		started := false
+		for _, appliedAction := range c.appliedMaintenanceActions[resourceIdentifier] {
+			started = started || a.ToString(action.Action) == appliedAction
+		}
+		if !started {
+			actions = append(actions, action)
+		}
+	}
+	c.PendingMaintenanceActions[resourceIdentifier] = actions
+	delete(c.appliedMaintenanceActions, resourceIdentifier)
+
+	for _, instance := range c.Instances {
+		if a.ToString(instance.DBInstanceArn) == resourceIdentifier {
+			c.setPendingStatus(*instance.DBInstanceIdentifier, &instance.DBInstanceStatus, "modifying", STATUS_AVAILABLE)
+		}
+	}
+}
+
+// Immediately applied actions are opted in, but keep the instance 'available' until they start.
+func (c *Cloud) ApplyPendingMaintenanceAction(ctx context.Context, params *rds.ApplyPendingMaintenanceActionInput, optFns ...func(*rds.Options)) (*rds.ApplyPendingMaintenanceActionOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ApplyPendingMaintenanceAction"); err != nil {
+		return nil, err
+	}
+
+	resourceIdentifier := a.ToString(params.ResourceIdentifier)
+	actions := c.PendingMaintenanceActions[resourceIdentifier]
+	for idx := range actions {
+		if a.ToString(actions[idx].Action) != a.ToString(params.ApplyAction) {
+			continue
+		}
+
+		actions[idx].OptInStatus = params.OptInType
+		actions[idx].CurrentApplyDate = a.Time(time.Now().UTC())
+		c.appliedMaintenanceActions[resourceIdentifier] = append(c.appliedMaintenanceActions[resourceIdentifier], *params.ApplyAction)
+
+		return &rds.ApplyPendingMaintenanceActionOutput{
+			ResourcePendingMaintenanceActions: &rdsTypes.ResourcePendingMaintenanceActions{
+				ResourceIdentifier: params.ResourceIdentifier,
+			},
+		}, nil
+	}
+
+	return nil, &rdsTypes.ResourceNotFoundFault{
+		Message: a.String(fmt.Sprintf("Pending maintenance action %s not found.", a.ToString(params.ApplyAction))),
+	}
+}
+
+func (c *Cloud) StopDBInstance(ctx context.Context, params *rds.StopDBInstanceInput, optFns ...func(*rds.Options)) (*rds.StopDBInstanceOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("StopDBInstance"); err != nil {
+		return nil, err
+	}
+
+	instance, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.DBInstanceIdentifier)}
+	}
+
+	c.setPendingStatus(*instance.DBInstanceIdentifier, &instance.DBInstanceStatus, "stopping", "stopped")
+
+	instanceCopy := copyDBInstance(instance)
+	return &rds.StopDBInstanceOutput{DBInstance: &instanceCopy}, nil
+}
+
+// Members of a blue/green deployment can not be deleted, same as in RDS.
+func (c *Cloud) DeleteDBInstance(ctx context.Context, params *rds.DeleteDBInstanceInput, optFns ...func(*rds.Options)) (*rds.DeleteDBInstanceOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DeleteDBInstance"); err != nil {
+		return nil, err
+	}
+
+	instance, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.DBInstanceIdentifier)}
+	}
+
+	if c.isBlueGreenDeploymentMember(instance) {
+		return nil, &rdsTypes.InvalidDBInstanceStateFault{
+			Message: a.String(fmt.Sprintf("DBInstance %s is a part of a blue/green deployment.", *instance.DBInstanceIdentifier)),
+		}
+	}
+
+	if params.FinalDBSnapshotIdentifier != nil {
+		c.Snapshots[*params.FinalDBSnapshotIdentifier] = &rdsTypes.DBSnapshot{
+			DBSnapshotIdentifier: params.FinalDBSnapshotIdentifier,
+			DBSnapshotArn:        c.snapshotArn(params.FinalDBSnapshotIdentifier),
+			DBInstanceIdentifier: instance.DBInstanceIdentifier,
+			AllocatedStorage:     instance.AllocatedStorage,
+			StorageType:          instance.StorageType,
+			Engine:               instance.Engine,
+			EngineVersion:        instance.EngineVersion,
+			Encrypted:            instance.StorageEncrypted,
+			KmsKeyId:             instance.KmsKeyId,
+			Status:               a.String(STATUS_AVAILABLE),
+		}
+	}
+	delete(c.Instances, *instance.DBInstanceIdentifier)
+
+	instanceCopy := copyDBInstance(instance)
+	return &rds.DeleteDBInstanceOutput{DBInstance: &instanceCopy}, nil
+}
+
+func (c *Cloud) CreateDBSnapshot(ctx context.Context, params *rds.CreateDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.CreateDBSnapshotOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("CreateDBSnapshot"); err != nil {
+		return nil, err
+	}
+
+	instance, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.DBInstanceIdentifier)}
+	}
+
+	if _, ok := c.Snapshots[a.ToString(params.DBSnapshotIdentifier)]; ok {
+		return nil, &rdsTypes.DBSnapshotAlreadyExistsFault{Message: a.String(fmt.Sprintf("DBSnapshot %s already exists.", *params.DBSnapshotIdentifier))}
+	}
+
+	snapshot := &rdsTypes.DBSnapshot{
+		DBSnapshotIdentifier: params.DBSnapshotIdentifier,
+		DBSnapshotArn:        c.snapshotArn(params.DBSnapshotIdentifier),
+		DBInstanceIdentifier: instance.DBInstanceIdentifier,
+		AllocatedStorage:     instance.AllocatedStorage,
+		StorageType:          instance.StorageType,
+		Engine:               instance.Engine,
+		EngineVersion:        instance.EngineVersion,
+		Encrypted:            instance.StorageEncrypted,
+		KmsKeyId:             instance.KmsKeyId,
+		MasterUsername:       instance.MasterUsername,
+		TagList:              params.Tags,
+	}
+	c.setPendingStatus(*snapshot.DBSnapshotIdentifier, &snapshot.Status, "creating", STATUS_AVAILABLE)
+	c.Snapshots[*snapshot.DBSnapshotIdentifier] = snapshot
+
+	snapshotCopy := *snapshot
+	return &rds.CreateDBSnapshotOutput{DBSnapshot: &snapshotCopy}, nil
+}
+
+func (c *Cloud) DeleteDBSnapshot(ctx context.Context, params *rds.DeleteDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.DeleteDBSnapshotOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DeleteDBSnapshot"); err != nil {
+		return nil, err
+	}
+
+	snapshot, ok := c.Snapshots[a.ToString(params.DBSnapshotIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBSnapshotNotFoundFault{Message: notFoundMessage("DBSnapshot", params.DBSnapshotIdentifier)}
+	}
+	delete(c.Snapshots, *snapshot.DBSnapshotIdentifier)
+	delete(c.SharedSnapshots, *snapshot.DBSnapshotIdentifier)
+
+	snapshotCopy := *snapshot
+	snapshotCopy.Status = a.String("deleted")
+	return &rds.DeleteDBSnapshotOutput{DBSnapshot: &snapshotCopy}, nil
+}
+
+func (c *Cloud) CopyDBSnapshot(ctx context.Context, params *rds.CopyDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.CopyDBSnapshotOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("CopyDBSnapshot"); err != nil {
+		return nil, err
+	}
+
+	sourceSnapshot, ok := c.findSourceDBSnapshot(a.ToString(params.SourceDBSnapshotIdentifier))
+	if !ok {
+		return nil, &rdsTypes.DBSnapshotNotFoundFault{Message: notFoundMessage("DBSnapshot", params.SourceDBSnapshotIdentifier)}
+	}
+
+	snapshot := sourceSnapshot
+	snapshot.DBSnapshotIdentifier = params.TargetDBSnapshotIdentifier
+	snapshot.DBSnapshotArn = c.snapshotArn(params.TargetDBSnapshotIdentifier)
+	if params.KmsKeyId != nil {
+		snapshot.Encrypted = true
+		snapshot.KmsKeyId = params.KmsKeyId
+	}
+	c.setPendingStatus(*snapshot.DBSnapshotIdentifier, &snapshot.Status, "creating", STATUS_AVAILABLE)
+	c.Snapshots[*snapshot.DBSnapshotIdentifier] = &snapshot
+
+	snapshotCopy := snapshot
+	return &rds.CopyDBSnapshotOutput{DBSnapshot: &snapshotCopy}, nil
+}
+
+// Must be called with the mutex held.
+// Snapshots of other regions or accounts are referenced by their ARN and looked up in the peer cloud they belong to.
+// Snapshots of another account must be shared with this one.
+func (c *Cloud) findSourceDBSnapshot(identifier string) (rdsTypes.DBSnapshot, bool) {
+	if !arn.IsARN(identifier) {
+		snapshot, ok := c.Snapshots[identifier]
+		if !ok {
+			return rdsTypes.DBSnapshot{}, false
+		}
+		return *snapshot, true
+	}
+
+	snapshotArn, err := arn.Parse(identifier)
+	if err != nil {
+		return rdsTypes.DBSnapshot{}, false
+	}
+
+	if snapshotArn.Region == c.Region && snapshotArn.AccountID == c.AccountID {
+		snapshot, ok := c.Snapshots[strings.TrimPrefix(snapshotArn.Resource, "snapshot:")]
+		if !ok {
+			return rdsTypes.DBSnapshot{}, false
+		}
+		return *snapshot, true
+	}
+
+	for _, peer := range c.Peers {
+		if peer.Region != snapshotArn.Region || peer.AccountID != snapshotArn.AccountID {
+			continue
+		}
+
+		peer.mutex.Lock()
+		defer peer.mutex.Unlock()
+
+		snapshotIdentifier := strings.TrimPrefix(snapshotArn.Resource, "snapshot:")
+		snapshot, ok := peer.Snapshots[snapshotIdentifier]
+		if !ok {
+			return rdsTypes.DBSnapshot{}, false
+		}
+
+		if peer.AccountID != c.AccountID && !peer.isSnapshotSharedWith(snapshotIdentifier, c.AccountID) {
+			return rdsTypes.DBSnapshot{}, false
+		}
+
+		return *snapshot, true
+	}
+
+	return rdsTypes.DBSnapshot{}, false
+}
+
+// Must be called with the mutex held.
+func (c *Cloud) isSnapshotSharedWith(identifier string, accountID string) bool {
+	for _, sharedAccountID := range c.SharedSnapshots[identifier] {
+		if sharedAccountID == accountID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Cloud) ModifyDBSnapshotAttribute(ctx context.Context, params *rds.ModifyDBSnapshotAttributeInput, optFns ...func(*rds.Options)) (*rds.ModifyDBSnapshotAttributeOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ModifyDBSnapshotAttribute"); err != nil {
+		return nil, err
+	}
+
+	identifier := a.ToString(params.DBSnapshotIdentifier)
+	if _, ok := c.Snapshots[identifier]; !ok {
+		return nil, &rdsTypes.DBSnapshotNotFoundFault{Message: notFoundMessage("DBSnapshot", params.DBSnapshotIdentifier)}
+	}
+
+	sharedAccountIDs := []string{}
+	for _, accountID := range c.SharedSnapshots[identifier] {
+		removed := false
+		for _, removedAccountID := range params.ValuesToRemove {
+			removed = removed || accountID == removedAccountID
+		}
+		if !removed {
+			sharedAccountIDs = append(sharedAccountIDs, accountID)
+		}
+	}
+	c.SharedSnapshots[identifier] = append(sharedAccountIDs, params.ValuesToAdd...)
+
+	return &rds.ModifyDBSnapshotAttributeOutput{}, nil
+}
+
+func (c *Cloud) ModifyDBSnapshot(ctx context.Context, params *rds.ModifyDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.ModifyDBSnapshotOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ModifyDBSnapshot"); err != nil {
+		return nil, err
+	}
+
+	snapshot, ok := c.Snapshots[a.ToString(params.DBSnapshotIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBSnapshotNotFoundFault{Message: notFoundMessage("DBSnapshot", params.DBSnapshotIdentifier)}
+	}
+
+	if params.EngineVersion != nil {
+		snapshot.EngineVersion = params.EngineVersion
+	}
+	c.setPendingStatus(*snapshot.DBSnapshotIdentifier, &snapshot.Status, "upgrading", STATUS_AVAILABLE)
+
+	snapshotCopy := *snapshot
+	return &rds.ModifyDBSnapshotOutput{DBSnapshot: &snapshotCopy}, nil
+}
+
+// The restored instance gets a log file with an unhealthy WAL record, the same way RDS reports the end of recovery.
+func (c *Cloud) RestoreDBInstanceFromDBSnapshot(ctx context.Context, params *rds.RestoreDBInstanceFromDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("RestoreDBInstanceFromDBSnapshot"); err != nil {
+		return nil, err
+	}
+
+	snapshot, ok := c.Snapshots[a.ToString(params.DBSnapshotIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBSnapshotNotFoundFault{Message: notFoundMessage("DBSnapshot", params.DBSnapshotIdentifier)}
+	}
+
+	if _, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]; ok {
+		return nil, &rdsTypes.DBInstanceAlreadyExistsFault{Message: a.String(fmt.Sprintf("DBInstance %s already exists.", *params.DBInstanceIdentifier))}
+	}
+
+	instance := &rdsTypes.DBInstance{
+		DBInstanceIdentifier: params.DBInstanceIdentifier,
+		DBInstanceArn:        c.instanceArn(params.DBInstanceIdentifier),
+		DBInstanceClass:      params.DBInstanceClass,
+		Engine:               snapshot.Engine,
+		EngineVersion:        snapshot.EngineVersion,
+		AllocatedStorage:     a.ToInt32(params.AllocatedStorage),
+		StorageType:          params.StorageType,
+		Iops:                 params.Iops,
+		StorageThroughput:    params.StorageThroughput,
+		StorageEncrypted:     snapshot.Encrypted,
+		KmsKeyId:             snapshot.KmsKeyId,
+		MasterUsername:       snapshot.MasterUsername,
+		MultiAZ:              a.ToBool(params.MultiAZ),
+		DeletionProtection:   a.ToBool(params.DeletionProtection),
+		PubliclyAccessible:   a.ToBool(params.PubliclyAccessible),
+		Endpoint: &rdsTypes.Endpoint{
+			Address: a.String(fmt.Sprintf("%s.fake.rds.amazonaws.com", *params.DBInstanceIdentifier)),
+			Port:    DEFAULT_PORT,
+		},
+		EnabledCloudwatchLogsExports:     params.EnableCloudwatchLogsExports,
+		IAMDatabaseAuthenticationEnabled: a.ToBool(params.EnableIAMDatabaseAuthentication),
+		DBParameterGroups: []rdsTypes.DBParameterGroupStatus{
+			{
+				DBParameterGroupName: params.DBParameterGroupName,
+				ParameterApplyStatus: a.String("in-sync"),
+			},
+		},
+		PendingModifiedValues: &rdsTypes.PendingModifiedValues{},
+		TagList:               params.Tags,
+	}
+	if subnetGroup, ok := c.SubnetGroups[a.ToString(params.DBSubnetGroupName)]; ok {
+		instance.DBSubnetGroup = subnetGroup
+	}
+	if params.Port != nil {
+		instance.Endpoint.Port = *params.Port
+	}
+	instance.OptionGroupMemberships = []rdsTypes.OptionGroupMembership{
+		{OptionGroupName: a.String(fmt.Sprintf("default:postgres-%s", strings.Split(*snapshot.EngineVersion, ".")[0]))},
+	}
+	if params.OptionGroupName != nil {
+		instance.OptionGroupMemberships[0].OptionGroupName = params.OptionGroupName
+	}
+	for idx := range params.VpcSecurityGroupIds {
+		instance.VpcSecurityGroups = append(instance.VpcSecurityGroups, rdsTypes.VpcSecurityGroupMembership{
+			VpcSecurityGroupId: a.String(params.VpcSecurityGroupIds[idx]),
+			Status:             a.String("active"),
+		})
+	}
+	c.setPendingStatus(*instance.DBInstanceIdentifier, &instance.DBInstanceStatus, "creating", STATUS_AVAILABLE)
+	c.Instances[*instance.DBInstanceIdentifier] = instance
+	c.writeRecoveryLogFile(*instance.DBInstanceIdentifier)
+
+	instanceCopy := copyDBInstance(instance)
+	return &rds.RestoreDBInstanceFromDBSnapshotOutput{DBInstance: &instanceCopy}, nil
+}
+
+// The record is written at the next full second, so it is guaranteed to be newer than any time taken before the call.
+// Must be called with the mutex held.
+func (c *Cloud) writeRecoveryLogFile(identifier string) {
+	now := time.Now().UTC()
+	recordTime := now.Truncate(time.Second).Add(time.Second)
+	time.Sleep(recordTime.Sub(now))
+
+	c.LogFiles[identifier] = map[string]string{
+		LOG_FILE_NAME: fmt.Sprintf(
+			"%s UTC::@:[4242]:LOG:  invalid record length at %s: wanted 24, got 0\n",
+			recordTime.Format(LOG_FILE_TIME_LAYOUT),
+			UNHEALTHY_LSN,
+		),
+	}
+}
+
+// Source instances from other regions are referenced by ARN and are not known to this cloud,
+// so their replicas only get the attributes passed in the request.
+func (c *Cloud) CreateDBInstanceReadReplica(ctx context.Context, params *rds.CreateDBInstanceReadReplicaInput, optFns ...func(*rds.Options)) (*rds.CreateDBInstanceReadReplicaOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("CreateDBInstanceReadReplica"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]; ok {
+		return nil, &rdsTypes.DBInstanceAlreadyExistsFault{Message: a.String(fmt.Sprintf("DBInstance %s already exists.", *params.DBInstanceIdentifier))}
+	}
+
+	source, ok := c.Instances[a.ToString(params.SourceDBInstanceIdentifier)]
+	if !ok && params.SourceRegion == nil {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.SourceDBInstanceIdentifier)}
+	}
+
+	instance := &rdsTypes.DBInstance{
+		DBInstanceIdentifier:                  params.DBInstanceIdentifier,
+		DBInstanceArn:                         c.instanceArn(params.DBInstanceIdentifier),
+		DBInstanceClass:                       params.DBInstanceClass,
+		ReadReplicaSourceDBInstanceIdentifier: params.SourceDBInstanceIdentifier,
+		AvailabilityZone:                      params.AvailabilityZone,
+		StorageType:                           params.StorageType,
+		Iops:                                  params.Iops,
+		StorageThroughput:                     params.StorageThroughput,
+		MaxAllocatedStorage:                   params.MaxAllocatedStorage,
+		MultiAZ:                               a.ToBool(params.MultiAZ),
+		PubliclyAccessible:                    a.ToBool(params.PubliclyAccessible),
+		MonitoringInterval:                    params.MonitoringInterval,
+		MonitoringRoleArn:                     params.MonitoringRoleArn,
+		PerformanceInsightsEnabled:            params.EnablePerformanceInsights,
+		KmsKeyId:                              params.KmsKeyId,
+		Endpoint: &rdsTypes.Endpoint{
+			Address: a.String(fmt.Sprintf("%s.fake.rds.amazonaws.com", *params.DBInstanceIdentifier)),
+			Port:    5432,
+		},
+		PendingModifiedValues: &rdsTypes.PendingModifiedValues{},
+		TagList:               params.Tags,
+	}
+	if params.DBParameterGroupName != nil {
+		instance.DBParameterGroups = []rdsTypes.DBParameterGroupStatus{
+			{
+				DBParameterGroupName: params.DBParameterGroupName,
+				ParameterApplyStatus: a.String("in-sync"),
+			},
+		}
+	}
+	if source != nil {
+		instance.Engine = source.Engine
+		instance.EngineVersion = source.EngineVersion
+		instance.StorageEncrypted = source.StorageEncrypted
+		instance.KmsKeyId = source.KmsKeyId
+		source.ReadReplicaDBInstanceIdentifiers = append(source.ReadReplicaDBInstanceIdentifiers, *params.DBInstanceIdentifier)
+	}
+	for idx := range params.VpcSecurityGroupIds {
+		instance.VpcSecurityGroups = append(instance.VpcSecurityGroups, rdsTypes.VpcSecurityGroupMembership{
+			VpcSecurityGroupId: a.String(params.VpcSecurityGroupIds[idx]),
+			Status:             a.String("active"),
+		})
+	}
+	c.setPendingStatus(*instance.DBInstanceIdentifier, &instance.DBInstanceStatus, "creating", STATUS_AVAILABLE)
+	c.Instances[*instance.DBInstanceIdentifier] = instance
+
+	instanceCopy := copyDBInstance(instance)
+	return &rds.CreateDBInstanceReadReplicaOutput{DBInstance: &instanceCopy}, nil
+}
+
+// Default parameter groups are named after the engine family, e.g. 'default.postgres14'.
+func DefaultParameterGroupName(engineVersion string) string {
+	return fmt.Sprintf("default.postgres%s", strings.Split(engineVersion, ".")[0])
+}
@@ -0,0 +1,236 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+const (
+	BLUE_GREEN_STATUS_PROVISIONING         string = "PROVISIONING"
+	BLUE_GREEN_STATUS_AVAILABLE            string = "AVAILABLE"
+	BLUE_GREEN_STATUS_SWITCHOVER_PROGRESS  string = "SWITCHOVER_IN_PROGRESS"
+	BLUE_GREEN_STATUS_SWITCHOVER_COMPLETED string = "SWITCHOVER_COMPLETED"
+	OLD_INSTANCE_IDENTIFIER_SUFFIX         string = "-old1"
+)
+
+func copyBlueGreenDeployment(deployment *rdsTypes.BlueGreenDeployment) rdsTypes.BlueGreenDeployment {
+	deploymentCopy := *deployment
+	deploymentCopy.TagList = append([]rdsTypes.Tag{}, deployment.TagList...)
+
+	return deploymentCopy
+}
+
+// Must be called with the mutex held.
+func (c *Cloud) findDBInstanceByArn(instanceArn *string) (*rdsTypes.DBInstance, bool) {
+	parsedArn, err := arn.Parse(a.ToString(instanceArn))
+	if err != nil {
+		return nil, false
+	}
+
+	instance, ok := c.Instances[strings.TrimPrefix(parsedArn.Resource, "db:")]
+
+	return instance, ok
+}
+
+// Must be called with the mutex held.
+func (c *Cloud) isBlueGreenDeploymentMember(instance *rdsTypes.DBInstance) bool {
+	for _, deployment := range c.BlueGreenDeployments {
+		if *deployment.Source == *instance.DBInstanceArn || *deployment.Target == *instance.DBInstanceArn {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Must be called with the mutex held.
+func (c *Cloud) renameDBInstance(instance *rdsTypes.DBInstance, identifier string) {
+	delete(c.Instances, *instance.DBInstanceIdentifier)
+
+	instance.DBInstanceIdentifier = a.String(identifier)
+	instance.DBInstanceArn = c.instanceArn(instance.DBInstanceIdentifier)
+	instance.Endpoint = &rdsTypes.Endpoint{
+		Address: a.String(fmt.Sprintf("%s.fake.rds.amazonaws.com", identifier)),
+		Port:    instance.Endpoint.Port,
+	}
+	c.Instances[identifier] = instance
+}
+
+// Deployments are described by the identifier or filtered by the name.
+func (c *Cloud) DescribeBlueGreenDeployments(ctx context.Context, params *rds.DescribeBlueGreenDeploymentsInput, optFns ...func(*rds.Options)) (*rds.DescribeBlueGreenDeploymentsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeBlueGreenDeployments"); err != nil {
+		return nil, err
+	}
+
+	output := &rds.DescribeBlueGreenDeploymentsOutput{}
+
+	if params.BlueGreenDeploymentIdentifier != nil {
+		deployment, ok := c.BlueGreenDeployments[*params.BlueGreenDeploymentIdentifier]
+		if !ok {
+			return nil, &rdsTypes.BlueGreenDeploymentNotFoundFault{Message: notFoundMessage("BlueGreenDeployment", params.BlueGreenDeploymentIdentifier)}
+		}
+
+		output.BlueGreenDeployments = append(output.BlueGreenDeployments, copyBlueGreenDeployment(deployment))
+		c.completePendingStatus(*deployment.BlueGreenDeploymentName, &deployment.Status)
+
+		return output, nil
+	}
+
+	names := map[string]bool{}
+	for idx := range params.Filters {
+		if a.ToString(params.Filters[idx].Name) != "blue-green-deployment-name" {
+			continue
+		}
+		for _, value := range params.Filters[idx].Values {
+			names[value] = true
+		}
+	}
+
+	for _, deployment := range c.BlueGreenDeployments {
+		if len(names) > 0 && !names[*deployment.BlueGreenDeploymentName] {
+			continue
+		}
+		output.BlueGreenDeployments = append(output.BlueGreenDeployments, copyBlueGreenDeployment(deployment))
+		c.completePendingStatus(*deployment.BlueGreenDeploymentName, &deployment.Status)
+	}
+
+	return output, nil
+}
+
+// The green instance is a copy of the source one running the target engine version with the target parameter group.
+func (c *Cloud) CreateBlueGreenDeployment(ctx context.Context, params *rds.CreateBlueGreenDeploymentInput, optFns ...func(*rds.Options)) (*rds.CreateBlueGreenDeploymentOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("CreateBlueGreenDeployment"); err != nil {
+		return nil, err
+	}
+
+	source, ok := c.findDBInstanceByArn(params.Source)
+	if !ok {
+		return nil, &rdsTypes.DBInstanceNotFoundFault{Message: notFoundMessage("DBInstance", params.Source)}
+	}
+
+	for _, deployment := range c.BlueGreenDeployments {
+		if *deployment.BlueGreenDeploymentName == a.ToString(params.BlueGreenDeploymentName) {
+			return nil, &rdsTypes.BlueGreenDeploymentAlreadyExistsFault{
+				Message: a.String(fmt.Sprintf("BlueGreenDeployment %s already exists.", *params.BlueGreenDeploymentName)),
+			}
+		}
+	}
+
+	deploymentIdentifier := fmt.Sprintf("bgd-%06d", len(c.BlueGreenDeployments)+1)
+	greenIdentifier := fmt.Sprintf("%s-green-%06d", *source.DBInstanceIdentifier, len(c.BlueGreenDeployments)+1)
+
+	green := copyDBInstance(source)
+	green.DBInstanceIdentifier = a.String(greenIdentifier)
+	green.DBInstanceArn = c.instanceArn(green.DBInstanceIdentifier)
+	green.EngineVersion = params.TargetEngineVersion
+	green.ReadReplicaDBInstanceIdentifiers = nil
+	green.Endpoint = &rdsTypes.Endpoint{
+		Address: a.String(fmt.Sprintf("%s.fake.rds.amazonaws.com", greenIdentifier)),
+		Port:    source.Endpoint.Port,
+	}
+	if params.TargetDBParameterGroupName != nil {
+		green.DBParameterGroups = []rdsTypes.DBParameterGroupStatus{
+			{DBParameterGroupName: params.TargetDBParameterGroupName, ParameterApplyStatus: a.String("in-sync")},
+		}
+	}
+	c.setPendingStatus(greenIdentifier, &green.DBInstanceStatus, "creating", STATUS_AVAILABLE)
+	c.Instances[greenIdentifier] = &green
+
+	deployment := &rdsTypes.BlueGreenDeployment{
+		BlueGreenDeploymentIdentifier: a.String(deploymentIdentifier),
+		BlueGreenDeploymentName:       params.BlueGreenDeploymentName,
+		Source:                        source.DBInstanceArn,
+		Target:                        green.DBInstanceArn,
+		TagList:                       params.Tags,
+	}
+	c.setPendingStatus(*deployment.BlueGreenDeploymentName, &deployment.Status, BLUE_GREEN_STATUS_PROVISIONING, BLUE_GREEN_STATUS_AVAILABLE)
+	c.BlueGreenDeployments[deploymentIdentifier] = deployment
+
+	deploymentCopy := copyBlueGreenDeployment(deployment)
+	return &rds.CreateBlueGreenDeploymentOutput{BlueGreenDeployment: &deploymentCopy}, nil
+}
+
+// The blue instance is renamed with a suffix and the green one takes over its identifier and endpoint.
+func (c *Cloud) SwitchoverBlueGreenDeployment(ctx context.Context, params *rds.SwitchoverBlueGreenDeploymentInput, optFns ...func(*rds.Options)) (*rds.SwitchoverBlueGreenDeploymentOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("SwitchoverBlueGreenDeployment"); err != nil {
+		return nil, err
+	}
+
+	deployment, ok := c.BlueGreenDeployments[a.ToString(params.BlueGreenDeploymentIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.BlueGreenDeploymentNotFoundFault{Message: notFoundMessage("BlueGreenDeployment", params.BlueGreenDeploymentIdentifier)}
+	}
+
+	if *deployment.Status != BLUE_GREEN_STATUS_AVAILABLE {
+		return nil, &rdsTypes.InvalidBlueGreenDeploymentStateFault{
+			Message: a.String(fmt.Sprintf("BlueGreenDeployment %s is in status %s.", *deployment.BlueGreenDeploymentName, *deployment.Status)),
+		}
+	}
+
+	blue, _ := c.findDBInstanceByArn(deployment.Source)
+	green, _ := c.findDBInstanceByArn(deployment.Target)
+	blueIdentifier := *blue.DBInstanceIdentifier
+	blueEndpoint := *blue.Endpoint
+
+	c.renameDBInstance(blue, blueIdentifier+OLD_INSTANCE_IDENTIFIER_SUFFIX)
+	c.renameDBInstance(green, blueIdentifier)
+	green.Endpoint = &blueEndpoint
+	green.ReadReplicaDBInstanceIdentifiers = blue.ReadReplicaDBInstanceIdentifiers
+	blue.ReadReplicaDBInstanceIdentifiers = nil
+
+	deployment.Source = blue.DBInstanceArn
+	deployment.Target = green.DBInstanceArn
+	c.setPendingStatus(*deployment.BlueGreenDeploymentName, &deployment.Status, BLUE_GREEN_STATUS_SWITCHOVER_PROGRESS, BLUE_GREEN_STATUS_SWITCHOVER_COMPLETED)
+
+	deploymentCopy := copyBlueGreenDeployment(deployment)
+	return &rds.SwitchoverBlueGreenDeploymentOutput{BlueGreenDeployment: &deploymentCopy}, nil
+}
+
+func (c *Cloud) DeleteBlueGreenDeployment(ctx context.Context, params *rds.DeleteBlueGreenDeploymentInput, optFns ...func(*rds.Options)) (*rds.DeleteBlueGreenDeploymentOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DeleteBlueGreenDeployment"); err != nil {
+		return nil, err
+	}
+
+	deployment, ok := c.BlueGreenDeployments[a.ToString(params.BlueGreenDeploymentIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.BlueGreenDeploymentNotFoundFault{Message: notFoundMessage("BlueGreenDeployment", params.BlueGreenDeploymentIdentifier)}
+	}
+
+	if a.ToBool(params.DeleteTarget) && *deployment.Status != BLUE_GREEN_STATUS_SWITCHOVER_COMPLETED {
+		if green, ok := c.findDBInstanceByArn(deployment.Target); ok {
+			delete(c.Instances, *green.DBInstanceIdentifier)
+		}
+	}
+	delete(c.BlueGreenDeployments, *params.BlueGreenDeploymentIdentifier)
+
+	deploymentCopy := copyBlueGreenDeployment(deployment)
+	return &rds.DeleteBlueGreenDeploymentOutput{BlueGreenDeployment: &deploymentCopy}, nil
+}
@@ -0,0 +1,399 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+const (
+	AURORA_POSTGRESQL_ENGINE string = "aurora-postgresql"
+)
+
+// Members are derived from the instances, so the returned value is always up to date.
+// Must be called with the mutex held.
+func (c *Cloud) copyDBCluster(cluster *rdsTypes.DBCluster) rdsTypes.DBCluster {
+	clusterCopy := *cluster
+	clusterCopy.AssociatedRoles = append([]rdsTypes.DBClusterRole{}, cluster.AssociatedRoles...)
+	clusterCopy.EnabledCloudwatchLogsExports = append([]string{}, cluster.EnabledCloudwatchLogsExports...)
+	clusterCopy.VpcSecurityGroups = append([]rdsTypes.VpcSecurityGroupMembership{}, cluster.VpcSecurityGroups...)
+	clusterCopy.DBClusterMembers = []rdsTypes.DBClusterMember{}
+	for _, instance := range c.Instances {
+		if a.ToString(instance.DBClusterIdentifier) != *cluster.DBClusterIdentifier {
+			continue
+		}
+		clusterCopy.DBClusterMembers = append(clusterCopy.DBClusterMembers, rdsTypes.DBClusterMember{
+			DBInstanceIdentifier:          instance.DBInstanceIdentifier,
+			DBClusterParameterGroupStatus: a.String("in-sync"),
+			IsClusterWriter:               c.clusterWriters[*cluster.DBClusterIdentifier] == *instance.DBInstanceIdentifier,
+		})
+	}
+
+	return clusterCopy
+}
+
+func (c *Cloud) DescribeDBClusters(ctx context.Context, params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBClusters"); err != nil {
+		return nil, err
+	}
+
+	if params.DBClusterIdentifier == nil {
+		output := &rds.DescribeDBClustersOutput{}
+		for identifier, cluster := range c.Clusters {
+			output.DBClusters = append(output.DBClusters, c.copyDBCluster(cluster))
+			c.completePendingStatus(identifier, &cluster.Status)
+		}
+		return output, nil
+	}
+
+	cluster, ok := c.Clusters[a.ToString(params.DBClusterIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBClusterNotFoundFault{Message: notFoundMessage("DBCluster", params.DBClusterIdentifier)}
+	}
+
+	output := &rds.DescribeDBClustersOutput{
+		DBClusters: []rdsTypes.DBCluster{c.copyDBCluster(cluster)},
+	}
+	c.completePendingStatus(*cluster.DBClusterIdentifier, &cluster.Status)
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeDBClusterParameterGroups(ctx context.Context, params *rds.DescribeDBClusterParameterGroupsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterParameterGroupsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBClusterParameterGroups"); err != nil {
+		return nil, err
+	}
+
+	parameterGroup, ok := c.ClusterParameterGroups[a.ToString(params.DBClusterParameterGroupName)]
+	if !ok {
+		return nil, &rdsTypes.DBParameterGroupNotFoundFault{Message: notFoundMessage("DBClusterParameterGroup", params.DBClusterParameterGroupName)}
+	}
+
+	return &rds.DescribeDBClusterParameterGroupsOutput{DBClusterParameterGroups: []rdsTypes.DBClusterParameterGroup{parameterGroup.Group}}, nil
+}
+
+func (c *Cloud) DescribeDBClusterParameters(ctx context.Context, params *rds.DescribeDBClusterParametersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterParametersOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeDBClusterParameters"); err != nil {
+		return nil, err
+	}
+
+	parameterGroup, ok := c.ClusterParameterGroups[a.ToString(params.DBClusterParameterGroupName)]
+	if !ok {
+		return nil, &rdsTypes.DBParameterGroupNotFoundFault{Message: notFoundMessage("DBClusterParameterGroup", params.DBClusterParameterGroupName)}
+	}
+
+	output := &rds.DescribeDBClusterParametersOutput{}
+	for _, parameter := range parameterGroup.Parameters {
+		if params.Source != nil && *params.Source != a.ToString(parameter.Source) {
+			continue
+		}
+		output.Parameters = append(output.Parameters, parameter)
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) DescribeEngineDefaultClusterParameters(ctx context.Context, params *rds.DescribeEngineDefaultClusterParametersInput, optFns ...func(*rds.Options)) (*rds.DescribeEngineDefaultClusterParametersOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("DescribeEngineDefaultClusterParameters"); err != nil {
+		return nil, err
+	}
+
+	return &rds.DescribeEngineDefaultClusterParametersOutput{
+		EngineDefaults: &rdsTypes.EngineDefaults{
+			DBParameterGroupFamily: params.DBParameterGroupFamily,
+			Parameters:             c.ClusterEngineDefaults[a.ToString(params.DBParameterGroupFamily)],
+		},
+	}, nil
+}
+
+// New groups start with the cluster engine defaults of their family.
+func (c *Cloud) CreateDBClusterParameterGroup(ctx context.Context, params *rds.CreateDBClusterParameterGroupInput, optFns ...func(*rds.Options)) (*rds.CreateDBClusterParameterGroupOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("CreateDBClusterParameterGroup"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := c.ClusterParameterGroups[a.ToString(params.DBClusterParameterGroupName)]; ok {
+		return nil, &rdsTypes.DBParameterGroupAlreadyExistsFault{
+			Message: a.String(fmt.Sprintf("DBClusterParameterGroup %s already exists.", *params.DBClusterParameterGroupName)),
+		}
+	}
+
+	parameterGroup := &ClusterParameterGroup{
+		Group: rdsTypes.DBClusterParameterGroup{
+			DBClusterParameterGroupName: params.DBClusterParameterGroupName,
+			DBParameterGroupFamily:      params.DBParameterGroupFamily,
+			Description:                 params.Description,
+		},
+		Parameters: make(map[string]rdsTypes.Parameter),
+	}
+	for _, parameter := range c.ClusterEngineDefaults[a.ToString(params.DBParameterGroupFamily)] {
+		parameterGroup.Parameters[*parameter.ParameterName] = parameter
+	}
+	c.ClusterParameterGroups[*params.DBClusterParameterGroupName] = parameterGroup
+
+	groupCopy := parameterGroup.Group
+	return &rds.CreateDBClusterParameterGroupOutput{DBClusterParameterGroup: &groupCopy}, nil
+}
+
+// Static parameters are only applied after a reboot, which is reported by the instances of the cluster.
+func (c *Cloud) ModifyDBClusterParameterGroup(ctx context.Context, params *rds.ModifyDBClusterParameterGroupInput, optFns ...func(*rds.Options)) (*rds.ModifyDBClusterParameterGroupOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ModifyDBClusterParameterGroup"); err != nil {
+		return nil, err
+	}
+
+	parameterGroup, ok := c.ClusterParameterGroups[a.ToString(params.DBClusterParameterGroupName)]
+	if !ok {
+		return nil, &rdsTypes.DBParameterGroupNotFoundFault{Message: notFoundMessage("DBClusterParameterGroup", params.DBClusterParameterGroupName)}
+	}
+
+	for idx := range params.Parameters {
+		parameter := parameterGroup.Parameters[*params.Parameters[idx].ParameterName]
+		parameter.ParameterName = params.Parameters[idx].ParameterName
+		parameter.ParameterValue = params.Parameters[idx].ParameterValue
+		parameter.IsModifiable = true
+		parameter.Source = a.String("user")
+		parameterGroup.Parameters[*params.Parameters[idx].ParameterName] = parameter
+	}
+
+	for _, instance := range c.Instances {
+		cluster, ok := c.Clusters[a.ToString(instance.DBClusterIdentifier)]
+		if !ok || a.ToString(cluster.DBClusterParameterGroup) != *params.DBClusterParameterGroupName {
+			continue
+		}
+		for idx := range instance.DBParameterGroups {
+			instance.DBParameterGroups[idx].ParameterApplyStatus = a.String("pending-reboot")
+		}
+	}
+
+	return &rds.ModifyDBClusterParameterGroupOutput{DBClusterParameterGroupName: params.DBClusterParameterGroupName}, nil
+}
+
+// Snapshots are referenced by their ARN, so the ones of the source region and account are found in the peer clouds.
+func (c *Cloud) RestoreDBClusterFromSnapshot(ctx context.Context, params *rds.RestoreDBClusterFromSnapshotInput, optFns ...func(*rds.Options)) (*rds.RestoreDBClusterFromSnapshotOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("RestoreDBClusterFromSnapshot"); err != nil {
+		return nil, err
+	}
+
+	snapshot, ok := c.findSourceDBSnapshot(a.ToString(params.SnapshotIdentifier))
+	if !ok {
+		return nil, &rdsTypes.DBSnapshotNotFoundFault{Message: notFoundMessage("DBSnapshot", params.SnapshotIdentifier)}
+	}
+
+	if _, ok := c.Clusters[a.ToString(params.DBClusterIdentifier)]; ok {
+		return nil, &rdsTypes.DBClusterAlreadyExistsFault{Message: a.String(fmt.Sprintf("DBCluster %s already exists.", *params.DBClusterIdentifier))}
+	}
+
+	engineVersion := snapshot.EngineVersion
+	if params.EngineVersion != nil {
+		engineVersion = params.EngineVersion
+	}
+
+	cluster := &rdsTypes.DBCluster{
+		DBClusterIdentifier:              params.DBClusterIdentifier,
+		DBClusterArn:                     c.clusterArn(params.DBClusterIdentifier),
+		Engine:                           params.Engine,
+		EngineVersion:                    engineVersion,
+		DBClusterParameterGroup:          params.DBClusterParameterGroupName,
+		DBSubnetGroup:                    params.DBSubnetGroupName,
+		StorageEncrypted:                 snapshot.Encrypted,
+		KmsKeyId:                         snapshot.KmsKeyId,
+		MasterUsername:                   snapshot.MasterUsername,
+		DeletionProtection:               params.DeletionProtection,
+		CopyTagsToSnapshot:               params.CopyTagsToSnapshot,
+		IAMDatabaseAuthenticationEnabled: params.EnableIAMDatabaseAuthentication,
+		EnabledCloudwatchLogsExports:     params.EnableCloudwatchLogsExports,
+		Endpoint:                         a.String(fmt.Sprintf("%s.cluster-fake.rds.amazonaws.com", *params.DBClusterIdentifier)),
+		ReaderEndpoint:                   a.String(fmt.Sprintf("%s.cluster-ro-fake.rds.amazonaws.com", *params.DBClusterIdentifier)),
+		Port:                             a.Int32(DEFAULT_PORT),
+		BackupRetentionPeriod:            a.Int32(1),
+		TagList:                          params.Tags,
+	}
+	if cluster.DBClusterParameterGroup == nil {
+		cluster.DBClusterParameterGroup = a.String(DefaultAuroraParameterGroupName(*engineVersion))
+	}
+	if params.Port != nil {
+		cluster.Port = params.Port
+	}
+	for idx := range params.VpcSecurityGroupIds {
+		cluster.VpcSecurityGroups = append(cluster.VpcSecurityGroups, rdsTypes.VpcSecurityGroupMembership{
+			VpcSecurityGroupId: a.String(params.VpcSecurityGroupIds[idx]),
+			Status:             a.String("active"),
+		})
+	}
+	c.setPendingStatus(*cluster.DBClusterIdentifier, &cluster.Status, "creating", STATUS_AVAILABLE)
+	c.Clusters[*cluster.DBClusterIdentifier] = cluster
+
+	clusterCopy := c.copyDBCluster(cluster)
+	return &rds.RestoreDBClusterFromSnapshotOutput{DBCluster: &clusterCopy}, nil
+}
+
+func (c *Cloud) ModifyDBCluster(ctx context.Context, params *rds.ModifyDBClusterInput, optFns ...func(*rds.Options)) (*rds.ModifyDBClusterOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ModifyDBCluster"); err != nil {
+		return nil, err
+	}
+
+	cluster, ok := c.Clusters[a.ToString(params.DBClusterIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBClusterNotFoundFault{Message: notFoundMessage("DBCluster", params.DBClusterIdentifier)}
+	}
+
+	if params.BackupRetentionPeriod != nil {
+		cluster.BackupRetentionPeriod = params.BackupRetentionPeriod
+	}
+	if params.PreferredBackupWindow != nil {
+		cluster.PreferredBackupWindow = params.PreferredBackupWindow
+	}
+	if params.PreferredMaintenanceWindow != nil {
+		cluster.PreferredMaintenanceWindow = params.PreferredMaintenanceWindow
+	}
+	if a.ToBool(params.ManageMasterUserPassword) {
+		cluster.MasterUserSecret = c.manageMasterUserPassword(*cluster.DBClusterIdentifier, cluster.MasterUsername, params.MasterUserSecretKmsKeyId)
+	}
+	c.setPendingStatus(*cluster.DBClusterIdentifier, &cluster.Status, "modifying", STATUS_AVAILABLE)
+
+	clusterCopy := c.copyDBCluster(cluster)
+	return &rds.ModifyDBClusterOutput{DBCluster: &clusterCopy}, nil
+}
+
+func (c *Cloud) AddRoleToDBCluster(ctx context.Context, params *rds.AddRoleToDBClusterInput, optFns ...func(*rds.Options)) (*rds.AddRoleToDBClusterOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("AddRoleToDBCluster"); err != nil {
+		return nil, err
+	}
+
+	cluster, ok := c.Clusters[a.ToString(params.DBClusterIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBClusterNotFoundFault{Message: notFoundMessage("DBCluster", params.DBClusterIdentifier)}
+	}
+
+	for idx := range cluster.AssociatedRoles {
+		if a.ToString(cluster.AssociatedRoles[idx].FeatureName) == a.ToString(params.FeatureName) {
+			return nil, &rdsTypes.DBClusterRoleAlreadyExistsFault{
+				Message: a.String(fmt.Sprintf("Feature %s already has an associated role.", *params.FeatureName)),
+			}
+		}
+	}
+
+	cluster.AssociatedRoles = append(cluster.AssociatedRoles, rdsTypes.DBClusterRole{
+		FeatureName: params.FeatureName,
+		RoleArn:     params.RoleArn,
+		Status:      a.String("ACTIVE"),
+	})
+
+	return &rds.AddRoleToDBClusterOutput{}, nil
+}
+
+// Only instances of a cluster are supported. The first one becomes the writer and gets the log file
+// with an unhealthy WAL record, the same way RDS reports the end of recovery.
+func (c *Cloud) CreateDBInstance(ctx context.Context, params *rds.CreateDBInstanceInput, optFns ...func(*rds.Options)) (*rds.CreateDBInstanceOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("CreateDBInstance"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := c.Instances[a.ToString(params.DBInstanceIdentifier)]; ok {
+		return nil, &rdsTypes.DBInstanceAlreadyExistsFault{Message: a.String(fmt.Sprintf("DBInstance %s already exists.", *params.DBInstanceIdentifier))}
+	}
+
+	cluster, ok := c.Clusters[a.ToString(params.DBClusterIdentifier)]
+	if !ok {
+		return nil, &rdsTypes.DBClusterNotFoundFault{Message: notFoundMessage("DBCluster", params.DBClusterIdentifier)}
+	}
+
+	parameterGroupName := params.DBParameterGroupName
+	if parameterGroupName == nil {
+		parameterGroupName = a.String(DefaultAuroraParameterGroupName(*cluster.EngineVersion))
+	}
+
+	instance := &rdsTypes.DBInstance{
+		DBInstanceIdentifier:               params.DBInstanceIdentifier,
+		DBInstanceArn:                      c.instanceArn(params.DBInstanceIdentifier),
+		DBClusterIdentifier:                params.DBClusterIdentifier,
+		DBInstanceClass:                    params.DBInstanceClass,
+		Engine:                             cluster.Engine,
+		EngineVersion:                      cluster.EngineVersion,
+		AvailabilityZone:                   params.AvailabilityZone,
+		StorageEncrypted:                   cluster.StorageEncrypted,
+		KmsKeyId:                           cluster.KmsKeyId,
+		PubliclyAccessible:                 a.ToBool(params.PubliclyAccessible),
+		AutoMinorVersionUpgrade:            a.ToBool(params.AutoMinorVersionUpgrade),
+		MonitoringInterval:                 params.MonitoringInterval,
+		MonitoringRoleArn:                  params.MonitoringRoleArn,
+		PerformanceInsightsEnabled:         params.EnablePerformanceInsights,
+		PerformanceInsightsKMSKeyId:        params.PerformanceInsightsKMSKeyId,
+		PerformanceInsightsRetentionPeriod: params.PerformanceInsightsRetentionPeriod,
+		VpcSecurityGroups:                  append([]rdsTypes.VpcSecurityGroupMembership{}, cluster.VpcSecurityGroups...),
+		Endpoint: &rdsTypes.Endpoint{
+			Address: a.String(fmt.Sprintf("%s.fake.rds.amazonaws.com", *params.DBInstanceIdentifier)),
+			Port:    a.ToInt32(cluster.Port),
+		},
+		DBParameterGroups: []rdsTypes.DBParameterGroupStatus{
+			{
+				DBParameterGroupName: parameterGroupName,
+				ParameterApplyStatus: a.String("in-sync"),
+			},
+		},
+		PendingModifiedValues: &rdsTypes.PendingModifiedValues{},
+		TagList:               params.Tags,
+	}
+	if subnetGroup, ok := c.SubnetGroups[a.ToString(cluster.DBSubnetGroup)]; ok {
+		instance.DBSubnetGroup = subnetGroup
+	}
+	c.setPendingStatus(*instance.DBInstanceIdentifier, &instance.DBInstanceStatus, "creating", STATUS_AVAILABLE)
+	c.Instances[*instance.DBInstanceIdentifier] = instance
+
+	if _, ok := c.clusterWriters[*cluster.DBClusterIdentifier]; !ok {
+		c.clusterWriters[*cluster.DBClusterIdentifier] = *instance.DBInstanceIdentifier
+		c.writeRecoveryLogFile(*instance.DBInstanceIdentifier)
+	}
+
+	instanceCopy := copyDBInstance(instance)
+	return &rds.CreateDBInstanceOutput{DBInstance: &instanceCopy}, nil
+}
+
+// Default instance and cluster parameter groups are both named after the engine family, e.g. 'default.aurora-postgresql14'.
+func DefaultAuroraParameterGroupName(engineVersion string) string {
+	return fmt.Sprintf("default.%s%s", AURORA_POSTGRESQL_ENGINE, strings.Split(engineVersion, ".")[0])
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53Types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Records are keyed by the fully qualified name, the same way Route53 returns them.
+func normalizeRecordName(name *string) string {
+	return strings.ToLower(strings.TrimSuffix(a.ToString(name), ".")) + "."
+}
+
+func (c *Cloud) ListResourceRecordSets(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ListResourceRecordSets"); err != nil {
+		return nil, err
+	}
+
+	output := &route53.ListResourceRecordSetsOutput{}
+	if record, ok := c.Records[normalizeRecordName(params.StartRecordName)]; ok {
+		recordCopy := *record
+		recordCopy.ResourceRecords = append([]route53Types.ResourceRecord{}, record.ResourceRecords...)
+		output.ResourceRecordSets = append(output.ResourceRecordSets, recordCopy)
+	}
+
+	return output, nil
+}
+
+func (c *Cloud) ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("ChangeResourceRecordSets"); err != nil {
+		return nil, err
+	}
+
+	for idx := range params.ChangeBatch.Changes {
+		change := params.ChangeBatch.Changes[idx]
+		name := normalizeRecordName(change.ResourceRecordSet.Name)
+
+		switch change.Action {
+		case route53Types.ChangeActionUpsert, route53Types.ChangeActionCreate:
+			record := *change.ResourceRecordSet
+			record.Name = a.String(name)
+			c.Records[name] = &record
+		case route53Types.ChangeActionDelete:
+			delete(c.Records, name)
+		}
+	}
+
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53Types.ChangeInfo{
+			Id:     a.String(fmt.Sprintf("/change/C%d", len(c.calls))),
+			Status: route53Types.ChangeStatusPending,
+		},
+	}, nil
+}
+
+// Changes are propagated instantly.
+func (c *Cloud) GetChange(ctx context.Context, params *route53.GetChangeInput, optFns ...func(*route53.Options)) (*route53.GetChangeOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("GetChange"); err != nil {
+		return nil, err
+	}
+
+	return &route53.GetChangeOutput{
+		ChangeInfo: &route53Types.ChangeInfo{
+			Id:     params.Id,
+			Status: route53Types.ChangeStatusInsync,
+		},
+	}, nil
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package fakeaws
+
+import (
+	"context"
+	"fmt"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smTypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func (c *Cloud) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("GetSecretValue"); err != nil {
+		return nil, err
+	}
+
+	secretString, ok := c.Secrets[a.ToString(params.SecretId)]
+	if !ok {
+		return nil, &smTypes.ResourceNotFoundException{Message: notFoundMessage("Secret", params.SecretId)}
+	}
+
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:          params.SecretId,
+		SecretString: a.String(secretString),
+	}, nil
+}
+
+func (c *Cloud) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.call("GetParameter"); err != nil {
+		return nil, err
+	}
+
+	value, ok := c.Parameters[a.ToString(params.Name)]
+	if !ok {
+		return nil, &ssmTypes.ParameterNotFound{Message: notFoundMessage("Parameter", params.Name)}
+	}
+
+	return &ssm.GetParameterOutput{
+		Parameter: &ssmTypes.Parameter{
+			Name:  params.Name,
+			Value: a.String(value),
+		},
+	}, nil
+}
+
+// RDS generates a new master user password and keeps it in a secret of its own, named after the resource.
+func (c *Cloud) manageMasterUserPassword(identifier string, masterUsername *string, kmsKeyID *string) *rdsTypes.MasterUserSecret {
+	secretArn := fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:rds!%s", c.Region, c.AccountID, identifier)
+	c.Secrets[secretArn] = fmt.Sprintf(`{"username":"%s","password":"generated-%s"}`, a.ToString(masterUsername), identifier)
+
+	return &rdsTypes.MasterUserSecret{
+		SecretArn:    a.String(secretArn),
+		KmsKeyId:     kmsKeyID,
+		SecretStatus: a.String("active"),
+	}
+}
@@ -12,8 +12,13 @@ package types
 
 import (
 	"db_relocate/log"
+	"db_relocate/secret"
 
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -26,29 +31,141 @@ type DBInstanceDetails struct {
 	Port       string
 	Host       string
 	InstanceID string
+	// Connect with RDS IAM auth tokens instead of the password.
+	IAMAuth bool
 }
 
 type UpgradeDetails struct {
-	CAIdentifier      string
-	SubnetGroupName   string
-	EngineVersion     string
-	KMSID             string
-	SecurityGroupIDs  []string
-	ParameterGroup    string
-	InstanceClass     string
-	StorageType       string
-	StorageSize       int32
-	StorageIOPS       int32
-	StorageThroughput int32
-	Password          string
-	User              string
-	VPCID             string
+	CAIdentifier       string
+	SubnetGroupName    string
+	EngineVersion      string
+	KMSID              string
+	SecurityGroupIDs   []string
+	ParameterGroup     string
+	InstanceClass      string
+	StorageType        string
+	StorageSize        int32
+	StorageIOPS        int32
+	StorageThroughput  int32
+	Password           string
+	User               string
+	VPCID              string
+	ReverseReplication bool
+	ReadReplicas       bool
+	ExpectedDuration   time.Duration
+	PendingMaintenance string
+	// Empty means the region of the source instance.
+	TargetRegion string
+	// Role assumed in another account to create the destination instance there. Empty means the source account.
+	TargetAccountRoleArn string
+	// Either 'postgres' or 'aurora-postgresql'.
+	TargetEngine string
+	// Only used by Aurora targets. Empty means generated from the source parameter group.
+	ClusterParameterGroup string
+	// Either 'snapshot' or 'blue_green'.
+	Strategy                   string
+	BlueGreenSwitchoverTimeout time.Duration
+	// Reuse a snapshot of a previous run that has already been upgraded, instead of taking a new one.
+	ReuseSnapshot bool
+	// Either 'all', 'restored' or 'none'.
+	SnapshotRetention string
+	// Copy the CloudWatch alarms of the source instance and its read replicas onto the new ones.
+	CloneAlarms bool
+	// Attributes copied from the source instance unless overridden. Nil means not overridden.
+	OptionGroup                  string
+	Port                         *int32
+	PubliclyAccessible           *bool
+	CloudwatchLogsExports        []string
+	BackupRetentionPeriod        *int32
+	BackupWindow                 string
+	MaintenanceWindow            string
+	MaxAllocatedStorage          *int32
+	MonitoringInterval           *int32
+	MonitoringRoleArn            string
+	PerformanceInsights          *bool
+	PerformanceInsightsKMSKeyID  string
+	PerformanceInsightsRetention *int32
+	IAMRoles                     []string
+}
+
+type SwitchoverDetails struct {
+	ApplicationRoles []string
+	SyncTimeout      time.Duration
+}
+
+type HAProxyDetails struct {
+	ConfigPath   string
+	RuntimeAPI   string
+	Bind         string
+	Backend      string
+	DrainTimeout time.Duration
+}
+
+type PgBouncerDetails struct {
+	Host         string
+	Port         string
+	User         string
+	Password     string
+	SSLMode      string
+	Database     string
+	IncludePath  string
+	PauseTimeout time.Duration
+}
+
+type ScheduleDetails struct {
+	Blackouts []string
+	Timezone  string
+	Horizon   time.Duration
+}
+
+// Sizing recommendations for the destination, based on the CloudWatch history of the source.
+type SizingDetails struct {
+	Lookback     time.Duration
+	Horizon      time.Duration
+	ApplyStorage bool
 }
 
 type Items struct {
-	Src     *DBInstanceDetails
-	Dst     *DBInstanceDetails
-	Upgrade *UpgradeDetails
+	Src        *DBInstanceDetails
+	Dst        *DBInstanceDetails
+	Upgrade    *UpgradeDetails
+	Switchover *SwitchoverDetails
+	HAProxy    *HAProxyDetails
+	PgBouncer  *PgBouncerDetails
+	Schedule   *ScheduleDetails
+	Sizing     *SizingDetails
+}
+
+type Route53Details struct {
+	HostedZoneID string
+	RecordName   string
+	LoweredTTL   int64
+	Endpoint     string
+}
+
+// Retries of throttled and transient AWS errors. Zero values mean the SDK defaults.
+type RetryDetails struct {
+	MaxAttempts int
+	MaxBackoff  time.Duration
+}
+
+// Lag of the logical replication as seen by the replication slot on the publisher.
+type ReplicationLag struct {
+	ByteLag     int64   `db:"byte_lag"`
+	TimeLag     float64 `db:"time_lag"`
+	RetainedWAL int64   `db:"retained_wal"`
+}
+
+// Custom CloudWatch metrics about the progress of a relocation.
+type MetricsDetails struct {
+	Enabled   bool
+	Namespace string
+	Interval  time.Duration
+}
+
+// Secret references like 'aws-ssm:/db/password' are resolved with these settings.
+type SecretsDetails struct {
+	Endpoint string
 }
 
 type Configuration struct {
@@ -58,6 +175,14 @@ type Configuration struct {
 	LoggingLevel string
 	AWSProfile   string
 	AWSRegion    string
+	AWSRoute53   *Route53Details
+	AWSRetry     *RetryDetails
+	// Overridden timeouts of the long running AWS operations, keyed by the operation name.
+	AWSTimeouts map[string]string
+	// Interval of the progress reports while waiting for AWS resources. Zero disables them.
+	AWSProgressInterval time.Duration
+	AWSMetrics          *MetricsDetails
+	AWSSecrets          *SecretsDetails
 }
 
 func (c *Configuration) initLogger() {
@@ -75,13 +200,25 @@ func setDefault(v *viper.Viper) {
 	v.SetDefault("force", false)
 	v.SetDefault("aws.profile", "")
 	v.SetDefault("aws.region", "us-east-1")
+	v.SetDefault("aws.route53.hosted_zone_id", "")
+	v.SetDefault("aws.route53.record_name", "")
+	v.SetDefault("aws.route53.lowered_ttl", 60)
+	v.SetDefault("aws.route53.endpoint", "")
+	v.SetDefault("aws.retry.max_attempts", 10)
+	v.SetDefault("aws.retry.max_backoff", "30s")
+	v.SetDefault("aws.progress_interval", "1m")
+	v.SetDefault("aws.metrics.enabled", false)
+	v.SetDefault("aws.metrics.namespace", "db_relocate")
+	v.SetDefault("aws.metrics.interval", "1m")
+	v.SetDefault("aws.secrets.endpoint", "")
 	v.SetDefault("src.user", "ops")
-	v.SetDefault("src.password", "secret")
+	v.SetDefault("src.password", "")
 	v.SetDefault("src.schema", "public")
 	v.SetDefault("src.name", "postgres")
 	v.SetDefault("src.port", "5432")
 	v.SetDefault("src.host", "127.0.0.1")
 	v.SetDefault("src.instance_id", "")
+	v.SetDefault("src.iam_auth", false)
 	v.SetDefault("dst.user", "")
 	v.SetDefault("dst.password", "")
 	v.SetDefault("dst.schema", "public")
@@ -100,9 +237,48 @@ func setDefault(v *viper.Viper) {
 	v.SetDefault("upgrade.storage_iops", 0)
 	v.SetDefault("upgrade.storage_throughput", 0)
 	v.SetDefault("upgrade.user", "upgrade")
-	v.SetDefault("upgrade.password", "s4p3rs3cr3t!")
+	v.SetDefault("upgrade.password", "")
 	v.SetDefault("upgrade.vpc_id", "")
 	v.SetDefault("upgrade.ca_identifier", "")
+	v.SetDefault("upgrade.reverse_replication", false)
+	v.SetDefault("upgrade.read_replicas", true)
+	v.SetDefault("upgrade.expected_duration", "6h")
+	v.SetDefault("upgrade.pending_maintenance", "fail")
+	v.SetDefault("upgrade.target_region", "")
+	v.SetDefault("upgrade.target_account_role_arn", "")
+	v.SetDefault("upgrade.target_engine", "postgres")
+	v.SetDefault("upgrade.cluster_parameter_group", "")
+	v.SetDefault("upgrade.strategy", "snapshot")
+	v.SetDefault("upgrade.blue_green_switchover_timeout", "5m")
+	v.SetDefault("upgrade.reuse_snapshot", false)
+	v.SetDefault("upgrade.snapshot_retention", "restored")
+	v.SetDefault("upgrade.clone_alarms", true)
+	v.SetDefault("upgrade.option_group", "")
+	v.SetDefault("upgrade.backup_window", "")
+	v.SetDefault("upgrade.maintenance_window", "")
+	v.SetDefault("upgrade.monitoring_role_arn", "")
+	v.SetDefault("upgrade.performance_insights_kms_key_id", "")
+	v.SetDefault("switchover.application_roles", []string{})
+	v.SetDefault("switchover.sync_timeout", "30s")
+	v.SetDefault("haproxy.config_path", "haproxy.cfg")
+	v.SetDefault("haproxy.runtime_api", "")
+	v.SetDefault("haproxy.bind", ":5432")
+	v.SetDefault("haproxy.backend", "postgres")
+	v.SetDefault("haproxy.drain_timeout", "30s")
+	v.SetDefault("pgbouncer.host", "")
+	v.SetDefault("pgbouncer.port", "6432")
+	v.SetDefault("pgbouncer.user", "pgbouncer")
+	v.SetDefault("pgbouncer.password", "")
+	v.SetDefault("pgbouncer.ssl_mode", "require")
+	v.SetDefault("pgbouncer.database", "")
+	v.SetDefault("pgbouncer.include_path", "pgbouncer_databases.ini")
+	v.SetDefault("pgbouncer.pause_timeout", "15s")
+	v.SetDefault("schedule.blackouts", []string{})
+	v.SetDefault("schedule.timezone", "UTC")
+	v.SetDefault("schedule.horizon", "336h")
+	v.SetDefault("sizing.lookback", "336h")
+	v.SetDefault("sizing.horizon", "2160h")
+	v.SetDefault("sizing.apply_storage", false)
 }
 
 func getSrcDBDetails(v *viper.Viper) *DBInstanceDetails {
@@ -114,6 +290,11 @@ func getSrcDBDetails(v *viper.Viper) *DBInstanceDetails {
 		Port:       v.GetString("src.port"),
 		Host:       v.GetString("src.host"),
 		InstanceID: v.GetString("src.instance_id"),
+		IAMAuth:    v.GetBool("src.iam_auth"),
+	}
+	// Auth tokens replace the password, so it is neither resolved nor used.
+	if srcDBDetails.IAMAuth {
+		srcDBDetails.Password = ""
 	}
 	return srcDBDetails
 }
@@ -133,45 +314,239 @@ func getDstDBDetails(v *viper.Viper) *DBInstanceDetails {
 
 func getUpgradeDetails(v *viper.Viper) *UpgradeDetails {
 	upgradeDetails := &UpgradeDetails{
-		SubnetGroupName:   v.GetString("upgrade.subnet_group"),
-		EngineVersion:     v.GetString("upgrade.engine_version"),
-		KMSID:             v.GetString("upgrade.kms_id"),
-		SecurityGroupIDs:  v.GetStringSlice("upgrade.security_groups"),
-		ParameterGroup:    v.GetString("upgrade.parameter_group"),
-		InstanceClass:     v.GetString("upgrade.instance_class"),
-		StorageType:       v.GetString("upgrade.storage_type"),
-		StorageSize:       v.GetInt32("upgrade.storage_size"),
-		StorageIOPS:       v.GetInt32("upgrade.storage_iops"),
-		StorageThroughput: v.GetInt32("upgrade.storage_throughput"),
-		User:              v.GetString("upgrade.user"),
-		Password:          v.GetString("upgrade.password"),
-		VPCID:             v.GetString("upgrade.vpc_id"),
-		CAIdentifier:      v.GetString("upgrade.ca_identifier"),
+		SubnetGroupName:            v.GetString("upgrade.subnet_group"),
+		EngineVersion:              v.GetString("upgrade.engine_version"),
+		KMSID:                      v.GetString("upgrade.kms_id"),
+		SecurityGroupIDs:           v.GetStringSlice("upgrade.security_groups"),
+		ParameterGroup:             v.GetString("upgrade.parameter_group"),
+		InstanceClass:              v.GetString("upgrade.instance_class"),
+		StorageType:                v.GetString("upgrade.storage_type"),
+		StorageSize:                v.GetInt32("upgrade.storage_size"),
+		StorageIOPS:                v.GetInt32("upgrade.storage_iops"),
+		StorageThroughput:          v.GetInt32("upgrade.storage_throughput"),
+		User:                       v.GetString("upgrade.user"),
+		Password:                   v.GetString("upgrade.password"),
+		VPCID:                      v.GetString("upgrade.vpc_id"),
+		CAIdentifier:               v.GetString("upgrade.ca_identifier"),
+		ReverseReplication:         v.GetBool("upgrade.reverse_replication"),
+		ReadReplicas:               v.GetBool("upgrade.read_replicas"),
+		ExpectedDuration:           v.GetDuration("upgrade.expected_duration"),
+		PendingMaintenance:         v.GetString("upgrade.pending_maintenance"),
+		TargetRegion:               v.GetString("upgrade.target_region"),
+		TargetAccountRoleArn:       v.GetString("upgrade.target_account_role_arn"),
+		TargetEngine:               v.GetString("upgrade.target_engine"),
+		ClusterParameterGroup:      v.GetString("upgrade.cluster_parameter_group"),
+		Strategy:                   v.GetString("upgrade.strategy"),
+		BlueGreenSwitchoverTimeout: v.GetDuration("upgrade.blue_green_switchover_timeout"),
+		ReuseSnapshot:              v.GetBool("upgrade.reuse_snapshot"),
+		SnapshotRetention:          v.GetString("upgrade.snapshot_retention"),
+		CloneAlarms:                v.GetBool("upgrade.clone_alarms"),
+		// Overrides without a default are only applied when set explicitly.
+		OptionGroup:                  v.GetString("upgrade.option_group"),
+		Port:                         getOptionalInt32(v, "upgrade.port"),
+		PubliclyAccessible:           getOptionalBool(v, "upgrade.publicly_accessible"),
+		CloudwatchLogsExports:        getOptionalStringSlice(v, "upgrade.cloudwatch_logs_exports"),
+		BackupRetentionPeriod:        getOptionalInt32(v, "upgrade.backup_retention_period"),
+		BackupWindow:                 v.GetString("upgrade.backup_window"),
+		MaintenanceWindow:            v.GetString("upgrade.maintenance_window"),
+		MaxAllocatedStorage:          getOptionalInt32(v, "upgrade.max_allocated_storage"),
+		MonitoringInterval:           getOptionalInt32(v, "upgrade.monitoring_interval"),
+		MonitoringRoleArn:            v.GetString("upgrade.monitoring_role_arn"),
+		PerformanceInsights:          getOptionalBool(v, "upgrade.performance_insights"),
+		PerformanceInsightsKMSKeyID:  v.GetString("upgrade.performance_insights_kms_key_id"),
+		PerformanceInsightsRetention: getOptionalInt32(v, "upgrade.performance_insights_retention"),
+		IAMRoles:                     getOptionalStringSlice(v, "upgrade.iam_roles"),
 	}
 	return upgradeDetails
 }
 
+func getOptionalInt32(v *viper.Viper, key string) *int32 {
+	if !v.IsSet(key) {
+		return nil
+	}
+	value := v.GetInt32(key)
+	return &value
+}
+
+func getOptionalBool(v *viper.Viper, key string) *bool {
+	if !v.IsSet(key) {
+		return nil
+	}
+	value := v.GetBool(key)
+	return &value
+}
+
+// An empty list is a valid override, e.g. to disable all log exports.
+func getOptionalStringSlice(v *viper.Viper, key string) []string {
+	if !v.IsSet(key) {
+		return nil
+	}
+	return append([]string{}, v.GetStringSlice(key)...)
+}
+
+func getSwitchoverDetails(v *viper.Viper) *SwitchoverDetails {
+	switchoverDetails := &SwitchoverDetails{
+		ApplicationRoles: v.GetStringSlice("switchover.application_roles"),
+		SyncTimeout:      v.GetDuration("switchover.sync_timeout"),
+	}
+	return switchoverDetails
+}
+
+func getHAProxyDetails(v *viper.Viper) *HAProxyDetails {
+	haproxyDetails := &HAProxyDetails{
+		ConfigPath:   v.GetString("haproxy.config_path"),
+		RuntimeAPI:   v.GetString("haproxy.runtime_api"),
+		Bind:         v.GetString("haproxy.bind"),
+		Backend:      v.GetString("haproxy.backend"),
+		DrainTimeout: v.GetDuration("haproxy.drain_timeout"),
+	}
+	return haproxyDetails
+}
+
+func getPgBouncerDetails(v *viper.Viper) *PgBouncerDetails {
+	pgBouncerDetails := &PgBouncerDetails{
+		Host:         v.GetString("pgbouncer.host"),
+		Port:         v.GetString("pgbouncer.port"),
+		User:         v.GetString("pgbouncer.user"),
+		Password:     v.GetString("pgbouncer.password"),
+		SSLMode:      v.GetString("pgbouncer.ssl_mode"),
+		Database:     v.GetString("pgbouncer.database"),
+		IncludePath:  v.GetString("pgbouncer.include_path"),
+		PauseTimeout: v.GetDuration("pgbouncer.pause_timeout"),
+	}
+	return pgBouncerDetails
+}
+
+func getScheduleDetails(v *viper.Viper) *ScheduleDetails {
+	scheduleDetails := &ScheduleDetails{
+		Blackouts: v.GetStringSlice("schedule.blackouts"),
+		Timezone:  v.GetString("schedule.timezone"),
+		Horizon:   v.GetDuration("schedule.horizon"),
+	}
+	return scheduleDetails
+}
+
+func getSizingDetails(v *viper.Viper) *SizingDetails {
+	sizingDetails := &SizingDetails{
+		Lookback:     v.GetDuration("sizing.lookback"),
+		Horizon:      v.GetDuration("sizing.horizon"),
+		ApplyStorage: v.GetBool("sizing.apply_storage"),
+	}
+	return sizingDetails
+}
+
+func getRoute53Details(v *viper.Viper) *Route53Details {
+	route53Details := &Route53Details{
+		HostedZoneID: v.GetString("aws.route53.hosted_zone_id"),
+		RecordName:   v.GetString("aws.route53.record_name"),
+		LoweredTTL:   v.GetInt64("aws.route53.lowered_ttl"),
+		Endpoint:     v.GetString("aws.route53.endpoint"),
+	}
+	return route53Details
+}
+
+func getRetryDetails(v *viper.Viper) *RetryDetails {
+	retryDetails := &RetryDetails{
+		MaxAttempts: v.GetInt("aws.retry.max_attempts"),
+		MaxBackoff:  v.GetDuration("aws.retry.max_backoff"),
+	}
+	return retryDetails
+}
+
+func getMetricsDetails(v *viper.Viper) *MetricsDetails {
+	metricsDetails := &MetricsDetails{
+		Enabled:   v.GetBool("aws.metrics.enabled"),
+		Namespace: v.GetString("aws.metrics.namespace"),
+		Interval:  v.GetDuration("aws.metrics.interval"),
+	}
+	return metricsDetails
+}
+
+func getSecretsDetails(v *viper.Viper) *SecretsDetails {
+	secretsDetails := &SecretsDetails{
+		Endpoint: v.GetString("aws.secrets.endpoint"),
+	}
+	return secretsDetails
+}
+
 func readConfig(v *viper.Viper, configuration *Configuration) {
 	srcDBDetails := getSrcDBDetails(v)
 	dstDBDetails := getDstDBDetails(v)
 	upgradeDetails := getUpgradeDetails(v)
+	switchoverDetails := getSwitchoverDetails(v)
+	haproxyDetails := getHAProxyDetails(v)
+	pgBouncerDetails := getPgBouncerDetails(v)
+	scheduleDetails := getScheduleDetails(v)
+	sizingDetails := getSizingDetails(v)
 	items := &Items{
-		Src:     srcDBDetails,
-		Dst:     dstDBDetails,
-		Upgrade: upgradeDetails,
+		Src:        srcDBDetails,
+		Dst:        dstDBDetails,
+		Upgrade:    upgradeDetails,
+		Switchover: switchoverDetails,
+		HAProxy:    haproxyDetails,
+		PgBouncer:  pgBouncerDetails,
+		Schedule:   scheduleDetails,
+		Sizing:     sizingDetails,
 	}
 	configuration.LoggingLevel = v.GetString("logging.level")
 	configuration.Force = v.GetBool("force")
 	configuration.AWSRegion = v.GetString("aws.region")
 	configuration.AWSProfile = v.GetString("aws.profile")
+	configuration.AWSRoute53 = getRoute53Details(v)
+	configuration.AWSRetry = getRetryDetails(v)
+	configuration.AWSTimeouts = v.GetStringMapString("aws.timeouts")
+	configuration.AWSProgressInterval = v.GetDuration("aws.progress_interval")
+	configuration.AWSMetrics = getMetricsDetails(v)
+	configuration.AWSSecrets = getSecretsDetails(v)
 	configuration.Items = items
 }
 
-func ReadConfiguration(v *viper.Viper) *Configuration {
+// Settings which may be given as a secret reference, keyed by the configuration key.
+func (c *Configuration) secretSettings() map[string]*string {
+	return map[string]*string{
+		"src.user":           &c.Items.Src.User,
+		"src.password":       &c.Items.Src.Password,
+		"dst.user":           &c.Items.Dst.User,
+		"dst.password":       &c.Items.Dst.Password,
+		"upgrade.user":       &c.Items.Upgrade.User,
+		"upgrade.password":   &c.Items.Upgrade.Password,
+		"pgbouncer.user":     &c.Items.PgBouncer.User,
+		"pgbouncer.password": &c.Items.PgBouncer.Password,
+	}
+}
+
+// Only the references are logged. Passwords set by the user are redacted from the logs, whether they are resolved or not.
+// Passwords have no defaults, so an empty one has never been set and must not mangle unrelated log lines.
+func (c *Configuration) resolveSecrets(resolver *secret.Resolver) error {
+	for key, setting := range c.secretSettings() {
+		if secret.IsReference(*setting) {
+			log.Infof("Resolving '%s' from: '%s'", key, *setting)
+			value, err := resolver.Resolve(*setting)
+			if err != nil {
+				return errors.New(fmt.Sprintf("Failed to resolve '%s': %v", key, err))
+			}
+			*setting = value
+		}
+
+		if strings.HasSuffix(key, ".password") && *setting != "" {
+			log.AddSensitiveValue(*setting)
+		}
+	}
+
+	return nil
+}
+
+func ReadConfiguration(v *viper.Viper) (*Configuration, error) {
 	c := &Configuration{}
 	c.initContext()
 	setDefault(v)
 	readConfig(v, c)
 	c.initLogger()
-	return c
+
+	resolver := secret.NewResolver(c.Context, c.AWSProfile, c.AWSRegion, c.AWSSecrets.Endpoint)
+	if err := c.resolveSecrets(resolver); err != nil {
+		return nil, err
+	}
+
+	return c, nil
 }
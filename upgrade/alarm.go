@@ -0,0 +1,48 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/log"
+
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// The new instance is already being replicated to at this point, so a failure here must not be fatal.
+func (c *Controller) cloneAlarms(srcInstance *rdsTypes.DBInstance, dstInstance *rdsTypes.DBInstance) {
+	clonedAlarms, err := c.awsController.CloneDBInstanceAlarms(srcInstance, dstInstance)
+	if err != nil {
+		log.Warnf("Failed to clone CloudWatch alarms of the old instance: %s", err)
+		return
+	}
+
+	for idx := range clonedAlarms {
+		log.Infof(
+			"CloudWatch alarm: '%s' has been cloned as: '%s' for instance: '%s'",
+			*clonedAlarms[idx].SrcAlarmName,
+			*clonedAlarms[idx].AlarmName,
+			clonedAlarms[idx].DBInstanceIdentifier,
+		)
+	}
+}
+
+func (c *Controller) disableSrcAlarms(srcInstance *rdsTypes.DBInstance) error {
+	alarmNames, err := c.awsController.DisableSrcDBInstanceAlarms(srcInstance)
+	if err != nil {
+		return err
+	}
+
+	for idx := range alarmNames {
+		log.Infof("Actions of CloudWatch alarm: '%s' have been disabled", alarmNames[idx])
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunClonesAlarms(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	cloud.Alarms = map[string]*cwTypes.MetricAlarm{
+		"test-db-cpu-high": {
+			AlarmName:          a.String("test-db-cpu-high"),
+			ActionsEnabled:     a.Bool(true),
+			AlarmActions:       []string{"arn:aws:sns:us-east-1:123456789012:on-call"},
+			ComparisonOperator: cwTypes.ComparisonOperatorGreaterThanThreshold,
+			EvaluationPeriods:  a.Int32(3),
+			MetricName:         a.String("CPUUtilization"),
+			Namespace:          a.String("AWS/RDS"),
+			Dimensions:         []cwTypes.Dimension{{Name: a.String("DBInstanceIdentifier"), Value: a.String(TEST_SRC_INSTANCE_ID)}},
+			Period:             a.Int32(60),
+			Statistic:          cwTypes.StatisticAverage,
+			Threshold:          a.Float64(90),
+		},
+		"replica-lag": {
+			AlarmName:          a.String("replica-lag"),
+			ActionsEnabled:     a.Bool(true),
+			ComparisonOperator: cwTypes.ComparisonOperatorGreaterThanThreshold,
+			EvaluationPeriods:  a.Int32(1),
+			Metrics: []cwTypes.MetricDataQuery{
+				{
+					Id: a.String("lag"),
+					MetricStat: &cwTypes.MetricStat{
+						Metric: &cwTypes.Metric{
+							MetricName: a.String("ReplicaLag"),
+							Namespace:  a.String("AWS/RDS"),
+							Dimensions: []cwTypes.Dimension{{Name: a.String("DBInstanceIdentifier"), Value: a.String(TEST_SRC_REPLICA_ID)}},
+						},
+						Period: a.Int32(60),
+						Stat:   a.String("Maximum"),
+					},
+					ReturnData: a.Bool(true),
+				},
+			},
+			Threshold: a.Float64(300),
+		},
+		"other-db-cpu-high": {
+			AlarmName:      a.String("other-db-cpu-high"),
+			ActionsEnabled: a.Bool(true),
+			MetricName:     a.String("CPUUtilization"),
+			Namespace:      a.String("AWS/RDS"),
+			Dimensions:     []cwTypes.Dimension{{Name: a.String("DBInstanceIdentifier"), Value: a.String("other-db")}},
+		},
+	}
+	c, _ := setupUpgradeController(t, cloud, nil)
+	c.configuration.Items.Upgrade.CloneAlarms = true
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	alarm, ok := cloud.Alarms["test-db-v14-cpu-high"]
+	if assert.True(t, ok, "alarm of the instance must be cloned") {
+		assert.Equal(t, TEST_DST_INSTANCE_ID, *alarm.Dimensions[0].Value)
+		assert.Equal(t, 90.0, *alarm.Threshold)
+		assert.Equal(t, []string{"arn:aws:sns:us-east-1:123456789012:on-call"}, alarm.AlarmActions)
+		assert.True(t, *alarm.ActionsEnabled)
+	}
+
+	alarm, ok = cloud.Alarms["replica-lag-"+TEST_DST_REPLICA_ID]
+	if assert.True(t, ok, "alarm of the read replica must be cloned") {
+		assert.Equal(t, TEST_DST_REPLICA_ID, *alarm.Metrics[0].MetricStat.Metric.Dimensions[0].Value)
+	}
+	assert.Equal(t, TEST_SRC_REPLICA_ID, *cloud.Alarms["replica-lag"].Metrics[0].MetricStat.Metric.Dimensions[0].Value, "source alarm must not be modified")
+
+	assert.Len(t, cloud.Alarms, 5)
+	assert.False(t, *cloud.Alarms["test-db-cpu-high"].ActionsEnabled, "actions of the source alarms must be disabled at cleanup")
+	assert.False(t, *cloud.Alarms["replica-lag"].ActionsEnabled, "actions of the source alarms must be disabled at cleanup")
+	assert.True(t, *cloud.Alarms["other-db-cpu-high"].ActionsEnabled, "alarms of other instances must not be touched")
+}
@@ -0,0 +1,209 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/input"
+	"db_relocate/log"
+	"errors"
+	"fmt"
+	"time"
+
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// The green instance is read-only until the switchover, so the heartbeat is sent to the blue one and looked up on the green one.
+func (c *Controller) sendAndWaitForHeartBeatRecord(waitTimeout time.Duration) (*int64, error) {
+	timestamp, err := c.databaseController.SendHeartBeatRecord()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.databaseController.WaitForHeartBeatRecord(timestamp, waitTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return timestamp, nil
+}
+
+// The health check process is started before the deployment is created, since DDL changes are not replicated to the green instance.
+func (c *Controller) runBlueGreenDeployment(instance *rdsTypes.DBInstance) error {
+	heartBeatRecords := []int64{}
+	heartbeatTicker, heartBeatDoneChannel := c.databaseController.BeginHealthCheckProcess(&heartBeatRecords)
+
+	deployment, err := c.awsController.CreateBlueGreenDeployment(instance)
+	if err != nil {
+		return err
+	}
+
+	greenInstance, err := c.awsController.DescribeBlueGreenTargetDBInstance(deployment)
+	if err != nil {
+		return err
+	}
+
+	heartbeatTicker.Stop()
+	heartBeatDoneChannel <- true
+
+	err = c.databaseController.InitDestinationDatabaseConnection(greenInstance.DBInstanceIdentifier, greenInstance.Endpoint.Address, greenInstance.Endpoint.Port)
+	if err != nil {
+		return err
+	}
+
+	// The green instance has caught up, once the heartbeat record sent after all of the earlier ones has been received.
+	replicationTimeout, err := c.awsController.GetBlueGreenReplicationTimeout()
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := c.sendAndWaitForHeartBeatRecord(replicationTimeout)
+	if err != nil {
+		return err
+	}
+	heartBeatRecords = append(heartBeatRecords, *timestamp)
+
+	err = c.databaseController.CompareSendAndReceivedHeartbeatRecords(heartBeatRecords)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"Blue/green deployment: '%s' is available. Green instance: '%s' is in sync.",
+		*deployment.BlueGreenDeploymentName,
+		*greenInstance.DBInstanceIdentifier,
+	)
+	log.Infoln("Use 'switchover' command to switch over to the green instance.")
+
+	c.enterPhase(PHASE_REPLICATING)
+
+	return nil
+}
+
+// The old instance can only be deleted once it is no longer a part of the deployment.
+func (c *Controller) performBlueGreenCleanup(deployment *rdsTypes.BlueGreenDeployment) error {
+	log.Infoln("Running cleanup operations for blue/green deployment.")
+
+	deleteDeploymentInput := &input.BinaryInputMetadata{
+		Message:          "Ready to delete the blue/green deployment, the new instance is kept: y/n?",
+		PositiveResponse: "y",
+		NegativeResponse: "n",
+	}
+	positiveResponse, err := deleteDeploymentInput.ProcessBinaryInput()
+	if err != nil {
+		return err
+	}
+
+	if !positiveResponse {
+		log.Infoln("The old instance has been kept together with the blue/green deployment.")
+		return nil
+	}
+
+	err = c.awsController.DeleteBlueGreenDeployment(deployment)
+	if err != nil {
+		return err
+	}
+
+	deleteOldInstanceInput := &input.BinaryInputMetadata{
+		Message:          "Ready to delete the old instance, a final snapshot is taken first: y/n?",
+		PositiveResponse: "y",
+		NegativeResponse: "n",
+	}
+	positiveResponse, err = deleteOldInstanceInput.ProcessBinaryInput()
+	if err != nil {
+		return err
+	}
+
+	if positiveResponse {
+		err = c.awsController.DeleteBlueGreenSourceDBInstance(deployment)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Infoln("All cleanup operations have been completed! The health check table has been kept on the new instance.")
+
+	return nil
+}
+
+// RDS moves the endpoint of the old instance to the green one, so no traffic needs to be redirected by the tool.
+func (c *Controller) switchoverBlueGreenDeployment() error {
+	instances, err := c.awsController.DescribeDBInstance(&c.configuration.Items.Src.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	if len(instances) == 0 {
+		return errors.New(fmt.Sprintf(
+			"Failed to find source DB instance: '%s'!",
+			c.configuration.Items.Src.InstanceID,
+		))
+	}
+
+	deployment, err := c.awsController.DescribeBlueGreenDeployment(&instances[0])
+	if err != nil {
+		return err
+	}
+
+	if deployment == nil {
+		return errors.New(fmt.Sprintf(
+			"Blue/green deployment of DB instance: '%s' is missing. Nothing to switch over!",
+			c.configuration.Items.Src.InstanceID,
+		))
+	}
+
+	greenInstance, err := c.awsController.DescribeBlueGreenTargetDBInstance(deployment)
+	if err != nil {
+		return err
+	}
+
+	err = c.databaseController.InitDestinationDatabaseConnection(greenInstance.DBInstanceIdentifier, greenInstance.Endpoint.Address, greenInstance.Endpoint.Port)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.sendAndWaitForHeartBeatRecord(c.configuration.Items.Switchover.SyncTimeout)
+	if err != nil {
+		return err
+	}
+
+	switchoverInput := &input.BinaryInputMetadata{
+		Message:          "Application connections to the old instance will be dropped. Ready to switch over the blue/green deployment: y/n?",
+		PositiveResponse: "y",
+		NegativeResponse: "n",
+	}
+	positiveResponse, err := switchoverInput.ProcessBinaryInput()
+	if err != nil {
+		return err
+	}
+
+	if !positiveResponse {
+		return nil
+	}
+
+	stopMetricsProcess := c.beginMetricsProcess(PHASE_SWITCHOVER)
+	defer stopMetricsProcess()
+
+	switchoverStart := time.Now().UTC()
+
+	deployment, err = c.awsController.SwitchoverBlueGreenDeployment(deployment)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"Switchover has been completed in %s. The new instance has taken over the endpoint of the old one.",
+		time.Now().UTC().Sub(switchoverStart).Round(time.Second),
+	)
+
+	c.enterPhase(PHASE_COMPLETED)
+
+	return c.performBlueGreenCleanup(deployment)
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/testing/fakeaws"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCreatesBlueGreenDeployment(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	c, databaseController := setupUpgradeController(t, cloud, nil)
+	c.configuration.Items.Upgrade.Strategy = aws.STRATEGY_BLUE_GREEN
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+	assert.NotContains(t, cloud.Calls(), "CreateDBInstanceReadReplica")
+	assert.NotContains(t, databaseController.calls, "PrepareSrcDatabaseForUpgrade")
+	assert.Equal(t, "1", *cloud.ParameterGroups["test-db-pg13"].Parameters["rds.logical_replication"].ParameterValue)
+
+	if assert.Len(t, cloud.BlueGreenDeployments, 1) {
+		for _, deployment := range cloud.BlueGreenDeployments {
+			assert.Equal(t, TEST_SRC_INSTANCE_ID+aws.BLUE_GREEN_DEPLOYMENT_NAME_SUFFIX, *deployment.BlueGreenDeploymentName)
+			assert.Equal(t, TEST_SRC_INSTANCE_ARN, *deployment.Source)
+			assert.Equal(t, aws.BLUE_GREEN_STATUS_AVAILABLE, *deployment.Status)
+		}
+	}
+
+	green, ok := cloud.Instances["test-db-green-000001"]
+	if assert.True(t, ok, "green instance must be created") {
+		assert.Equal(t, "14.7", *green.EngineVersion)
+		assert.Equal(t, "test-db-pg14", *green.DBParameterGroups[0].DBParameterGroupName)
+		assert.Equal(t, *green.Endpoint.Address, databaseController.dstHost, "heartbeat must be verified on the green instance")
+	}
+
+	assert.Contains(t, databaseController.calls, "BeginHealthCheckProcess")
+	assert.Contains(t, databaseController.calls, "WaitForHeartBeatRecord")
+	assert.Equal(t, time.Minute*60, databaseController.heartBeatWaitTimeout, "green instance must be given the replication lag timeout to catch up")
+	assert.Contains(t, databaseController.calls, "CompareSendAndReceivedHeartbeatRecords")
+	assert.NotContains(t, cloud.Calls(), "SwitchoverBlueGreenDeployment")
+}
+
+func TestRunFailsBlueGreenDeployment(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(cloud *fakeaws.Cloud, c *Controller)
+		expectedCalls []string
+		missingCalls  []string
+	}{
+		{
+			name: "deployment becomes invalid",
+			setup: func(cloud *fakeaws.Cloud, c *Controller) {
+				cloud.FailStateTransition(TEST_SRC_INSTANCE_ID + aws.BLUE_GREEN_DEPLOYMENT_NAME_SUFFIX)
+			},
+			expectedCalls: []string{"CreateBlueGreenDeployment"},
+		},
+		{
+			name: "deployment already exists",
+			setup: func(cloud *fakeaws.Cloud, c *Controller) {
+				cloud.BlueGreenDeployments["bgd-000000"] = &rdsTypes.BlueGreenDeployment{
+					BlueGreenDeploymentIdentifier: a.String("bgd-000000"),
+					BlueGreenDeploymentName:       a.String(TEST_SRC_INSTANCE_ID + aws.BLUE_GREEN_DEPLOYMENT_NAME_SUFFIX),
+					Source:                        a.String(TEST_SRC_INSTANCE_ARN),
+					Target:                        a.String("arn:aws:rds:us-east-1:123456789012:db:test-db-green-000000"),
+					Status:                        a.String(aws.BLUE_GREEN_STATUS_AVAILABLE),
+				}
+			},
+			missingCalls: []string{"CreateBlueGreenDeployment"},
+		},
+		{
+			name: "combined with another target region",
+			setup: func(cloud *fakeaws.Cloud, c *Controller) {
+				c.configuration.Items.Upgrade.TargetRegion = "eu-west-1"
+			},
+			missingCalls: []string{"CreateBlueGreenDeployment"},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Upgrade.Strategy = aws.STRATEGY_BLUE_GREEN
+			test.setup(cloud, c)
+
+			err := c.Run()
+			assert.Error(t, err)
+			assert.NotContains(t, databaseController.calls, "WaitForHeartBeatRecord")
+
+			for _, call := range test.expectedCalls {
+				assert.Contains(t, cloud.Calls(), call)
+			}
+			for _, call := range test.missingCalls {
+				assert.NotContains(t, cloud.Calls(), call)
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestSwitchoverBlueGreenDeployment(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	c, databaseController := setupUpgradeController(t, cloud, nil)
+	c.configuration.Items.Upgrade.Strategy = aws.STRATEGY_BLUE_GREEN
+	c.configuration.Items.Upgrade.BlueGreenSwitchoverTimeout = time.Minute * 5
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	err = c.Switchover()
+	assert.NoError(t, err)
+
+	assert.Contains(t, cloud.Calls(), "SwitchoverBlueGreenDeployment")
+	assert.Contains(t, databaseController.calls, "WaitForHeartBeatRecord")
+	assert.Empty(t, cloud.BlueGreenDeployments, "deployment must be deleted")
+
+	instance, ok := cloud.Instances[TEST_SRC_INSTANCE_ID]
+	if assert.True(t, ok, "green instance must take over the identifier of the old one") {
+		assert.Equal(t, "14.7", *instance.EngineVersion)
+		assert.Equal(t, "test-db.fake.rds.amazonaws.com", *instance.Endpoint.Address)
+	}
+
+	assert.NotContains(t, cloud.Instances, TEST_SRC_INSTANCE_ID+fakeaws.OLD_INSTANCE_IDENTIFIER_SUFFIX, "old instance must be deleted")
+	assert.Contains(t, cloud.Snapshots, TEST_SRC_INSTANCE_ID+fakeaws.OLD_INSTANCE_IDENTIFIER_SUFFIX+aws.DB_INSTANCE_FINAL_SNAPSHOT_SUFFIX)
+}
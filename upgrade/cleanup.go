@@ -13,11 +13,64 @@ package upgrade
 import (
 	"db_relocate/input"
 	"db_relocate/log"
+	"errors"
 
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 )
 
+func (c *Controller) performReverseReplicationCleanup() error {
+	log.Infoln("Running cleanup operations for reverse replication mode.")
+
+	cleanupOperationsInput := []*input.BinaryInputMetadata{
+		{
+			Message:          "Application traffic must be switched to the new instance first. Ready to enable reverse replication to the old instance: y/n?",
+			PositiveResponse: "y",
+			NegativeResponse: "n",
+			Handler:          c.databaseController.EnableReverseReplication,
+		},
+		{
+			Message:          "Ready to drop a table that was used in an upgrade/migrations process for healthcheck purposes: y/n?",
+			PositiveResponse: "y",
+			NegativeResponse: "n",
+			Handler:          c.databaseController.DropHealthCheckTable,
+		},
+	}
+
+	// A low TTL lets a fallback reach the clients quickly, so it is up to the user to keep it.
+	if c.awsController.Route53Enabled() {
+		cleanupOperationsInput = append(cleanupOperationsInput, &input.BinaryInputMetadata{
+			Message:          "A low TTL of the CNAME record speeds up a possible fallback. Ready to restore the original TTL: y/n?",
+			PositiveResponse: "y",
+			NegativeResponse: "n",
+			Handler:          c.awsController.RestoreDNSRecordTTL,
+		})
+	}
+
+	for idx := range cleanupOperationsInput {
+		positiveResponse, err := cleanupOperationsInput[idx].ProcessBinaryInput()
+		if err != nil {
+			return err
+		}
+
+		if positiveResponse {
+			err = cleanupOperationsInput[idx].Handler()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The old instance, the upgrade user and the replication objects are kept for a possible fallback.
+	log.Infoln("The old instance has been kept running. Use 'fallback' command to return to it if needed.")
+
+	return nil
+}
+
 func (c *Controller) performCleanup(instance *rdsTypes.DBInstance) error {
+	if c.configuration.Items.Upgrade.ReverseReplication {
+		return c.performReverseReplicationCleanup()
+	}
+
 	log.Infoln("Running cleanup operations.")
 
 	cleanupOperationsInput := []*input.BinaryInputMetadata{
@@ -53,6 +106,27 @@ func (c *Controller) performCleanup(instance *rdsTypes.DBInstance) error {
 		},
 	}
 
+	if c.awsController.Route53Enabled() {
+		cleanupOperationsInput = append(cleanupOperationsInput, &input.BinaryInputMetadata{
+			Message:          "Application traffic must be switched to the new instance first. Ready to restore the original TTL of the CNAME record: y/n?",
+			PositiveResponse: "y",
+			NegativeResponse: "n",
+			Handler:          c.awsController.RestoreDNSRecordTTL,
+		})
+	}
+
+	// Stopped instances stop reporting metrics, which would trigger the alarms of the old instance.
+	if c.awsController.AlarmCloningEnabled() {
+		cleanupOperationsInput = append(cleanupOperationsInput, &input.BinaryInputMetadata{
+			Message:          "Ready to disable actions of the CloudWatch alarms of an RDS instance that was used as a donor in an upgrade/migrations process: y/n?",
+			PositiveResponse: "y",
+			NegativeResponse: "n",
+			Handler: func() error {
+				return c.disableSrcAlarms(instance)
+			},
+		})
+	}
+
 	for idx := range cleanupOperationsInput {
 		positiveResponse, err := cleanupOperationsInput[idx].ProcessBinaryInput()
 		if err != nil {
@@ -89,3 +163,12 @@ func (c *Controller) performCleanup(instance *rdsTypes.DBInstance) error {
 
 	return nil
 }
+
+// Restores the TTL lowered by an earlier run, e.g. if its cleanup has been declined or interrupted.
+func (c *Controller) RestoreDNSRecordTTL() error {
+	if !c.awsController.Route53Enabled() {
+		return errors.New("No CNAME record is configured. Set 'aws.route53.hosted_zone_id' and 'aws.route53.record_name'!")
+	}
+
+	return c.awsController.RestoreDNSRecordTTL()
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/input"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupRestoresDNSRecordTTL(t *testing.T) {
+	tests := []struct {
+		name               string
+		reverseReplication bool
+		responses          string
+		expectedTTL        int64
+	}{
+		{
+			name:        "original TTL is restored",
+			responses:   strings.Repeat("y\n", 10),
+			expectedTTL: 3600,
+		},
+		{
+			name:               "TTL is kept low for a possible fallback",
+			reverseReplication: true,
+			responses:          "y\ny\nn\n",
+			expectedTTL:        60,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			c, _ := setupUpgradeController(t, cloud, nil)
+			setupDNSRecord(c, cloud, 3600)
+			c.configuration.Items.Upgrade.ReverseReplication = test.reverseReplication
+			input.SetReader(strings.NewReader(test.responses))
+
+			err := c.Run()
+			assert.NoError(t, err)
+
+			assert.Equal(t, test.expectedTTL, *cloud.Records[TEST_DNS_RECORD_NAME].TTL)
+
+			// Any later process restores the original TTL from the tag of the old instance.
+			restoringController, _ := setupUpgradeController(t, cloud, nil)
+			restoringController.configuration.AWSRoute53 = c.configuration.AWSRoute53
+			err = restoringController.RestoreDNSRecordTTL()
+			assert.NoError(t, err)
+
+			assert.Equal(t, int64(3600), *cloud.Records[TEST_DNS_RECORD_NAME].TTL)
+			for _, tag := range cloud.Instances[TEST_SRC_INSTANCE_ID].TagList {
+				assert.NotEqual(t, aws.DNS_RECORD_ORIGINAL_TTL_TAG, *tag.Key, "tag must be removed once the TTL is restored")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
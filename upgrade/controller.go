@@ -12,26 +12,71 @@ package upgrade
 
 import (
 	"db_relocate/aws"
-	"db_relocate/database"
+	"db_relocate/haproxy"
 	"db_relocate/log"
+	"db_relocate/pgbouncer"
 
 	"db_relocate/types"
+	"time"
 )
 
+// DatabaseController lists the database operations used by the upgrade routines.
+// It is implemented by database.Controller.
+type DatabaseController interface {
+	InitSourceDatabaseConnection() error
+	InitDestinationDatabaseConnection(instanceID *string, host *string, port int32) error
+	CurrentUserCanProceed() (bool, error)
+	CurrentUserHasIAMRole() (bool, error)
+	UpgradeLogicalReplicationSlotExists() (bool, error)
+	GetUpgradeLogicalReplicationSlotLSN() (*string, error)
+	BeginHealthCheckProcess(heartBeatRecords *[]int64) (*time.Ticker, chan bool)
+	CompareSendAndReceivedHeartbeatRecords(sendHeartBeatRecords []int64) error
+	PrepareSrcDatabaseForUpgrade(keepReplicationSlot bool) error
+	PrepareDstDatabaseForUpgrade(latestUnhealthyLSN *string) error
+	WaitUntilSync() error
+	PerformPostUpgradeOperations() error
+	DeleteUpgradeSubscription() error
+	DeleteUpgradeUser() error
+	DropHealthCheckTable() error
+	DropUpgradeLogicalReplicationSlot() error
+	DropUpgradePublication() error
+	EnableReverseReplication() error
+	EnsureLogicalReplicationOnDstDatabase() error
+	FallbackToSourceDatabase() error
+	EnsureSwitchoverIsPossible() error
+	FreezeSrcDatabaseWrites() error
+	LiftSrcDatabaseWriteFreeze() error
+	TerminateSrcDatabaseSessions() error
+	SendHeartBeatRecord() (*int64, error)
+	WaitUntilSyncWithin(waitTimeout time.Duration) error
+	VerifyHeartBeatRecordReceived(timestamp *int64) error
+	WaitForHeartBeatRecord(timestamp *int64, waitTimeout time.Duration) error
+	IncrementSequenceValues() error
+	GetUpgradeReplicationLag() (*types.ReplicationLag, error)
+	CountSentHeartBeatRecords() (*int, error)
+	CountReceivedHeartBeatRecords() (*int, error)
+}
+
 type Controller struct {
-	awsController      *aws.Controller
-	databaseController *database.Controller
-	configuration      *types.Configuration
-	errorChannel       chan error
+	awsController       *aws.Controller
+	databaseController  DatabaseController
+	haproxyController   *haproxy.Controller
+	pgBouncerController *pgbouncer.Controller
+	configuration       *types.Configuration
+	errorChannel        chan error
+	progress            *relocationProgress
 }
 
-func NewController(configuration *types.Configuration, databaseController *database.Controller, awsController *aws.Controller, errorChannel chan error) *Controller {
+func NewController(configuration *types.Configuration, databaseController DatabaseController, awsController *aws.Controller, haproxyController *haproxy.Controller, pgBouncerController *pgbouncer.Controller, errorChannel chan error) *Controller {
 	log.Infoln("Initializing upgrade controller")
 
 	return &Controller{
-		awsController:      awsController,
-		databaseController: databaseController,
-		errorChannel:       errorChannel,
-		configuration:      configuration,
+		awsController:       awsController,
+		databaseController:  databaseController,
+		haproxyController:   haproxyController,
+		pgBouncerController: pgBouncerController,
+		errorChannel:        errorChannel,
+		configuration:       configuration,
+		progress:            &relocationProgress{},
 	}
 }
@@ -0,0 +1,136 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/input"
+	"db_relocate/log"
+	"errors"
+	"fmt"
+
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+func (c *Controller) describeSrcAndDstDBInstances() (*rdsTypes.DBInstance, *rdsTypes.DBInstance, error) {
+	instances, err := c.awsController.DescribeDBInstance(&c.configuration.Items.Src.InstanceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, nil, errors.New(fmt.Sprintf(
+			"Failed to find source DB instance: '%s'!",
+			c.configuration.Items.Src.InstanceID,
+		))
+	}
+
+	dstInstance, err := c.awsController.DescribeDstDBInstance(&instances[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &instances[0], dstInstance, nil
+}
+
+// The traffic is switched back in the reverse order of the switchover.
+func (c *Controller) switchTrafficToSource() error {
+	if c.haproxyController.Enabled() {
+		log.Infoln("Switching HAProxy traffic back to the old instance.")
+		err := c.haproxyController.SwitchToSource()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.awsController.Route53Enabled() {
+		log.Infoln("Pointing DNS record back to the old instance.")
+		err := c.awsController.SwitchDNSRecordToSource()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.pgBouncerController.Enabled() {
+		log.Infoln("Pointing PgBouncer back to the old instance.")
+		err := c.pgBouncerController.SwitchToSource()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) Fallback() error {
+	_, dstInstance, err := c.describeSrcAndDstDBInstances()
+	if err != nil {
+		return err
+	}
+
+	err = c.databaseController.InitDestinationDatabaseConnection(dstInstance.DBInstanceIdentifier, dstInstance.Endpoint.Address, dstInstance.Endpoint.Port)
+	if err != nil {
+		return err
+	}
+
+	// Traffic must not be left on the new instance once the old one is writable again.
+	if c.haproxyController.Enabled() {
+		err = c.haproxyController.EnsureRuntimeAPIIsReachable()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.pgBouncerController.Enabled() {
+		err = c.pgBouncerController.EnsureAdminConsoleIsReachable()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.awsController.Route53Enabled() {
+		err = c.awsController.EnsureDNSRecordExists()
+		if err != nil {
+			return err
+		}
+	}
+
+	fallbackInput := &input.BinaryInputMetadata{
+		Message:          "Application must stop writing to the new instance first. Ready to fall back to the old instance: y/n?",
+		PositiveResponse: "y",
+		NegativeResponse: "n",
+	}
+	positiveResponse, err := fallbackInput.ProcessBinaryInput()
+	if err != nil {
+		return err
+	}
+
+	if !positiveResponse {
+		return nil
+	}
+
+	err = c.databaseController.FallbackToSourceDatabase()
+	if err != nil {
+		return err
+	}
+
+	err = c.switchTrafficToSource()
+	if err != nil {
+		return err
+	}
+
+	log.Infoln("Fallback has been completed.")
+
+	if !c.haproxyController.Enabled() && !c.pgBouncerController.Enabled() && !c.awsController.Route53Enabled() {
+		log.Infoln("Point your application back to the old instance.")
+	}
+
+	return nil
+}
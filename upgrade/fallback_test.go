@@ -0,0 +1,169 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"bufio"
+	"db_relocate/haproxy"
+	"db_relocate/input"
+	"db_relocate/pgbouncer"
+	thelper "db_relocate/testing"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the runtime API commands and reports no sessions on any server.
+type runtimeAPIStandIn struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	commands []string
+}
+
+func (s *runtimeAPIStandIn) serve() {
+	for {
+		connection, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		command, _ := bufio.NewReader(connection).ReadString('\n')
+
+		s.mutex.Lock()
+		s.commands = append(s.commands, strings.TrimSpace(command))
+		s.mutex.Unlock()
+
+		if strings.TrimSpace(command) == "show stat" {
+			connection.Write([]byte("# pxname,svname,scur\npostgres,src,0\npostgres,dst,0\n\n"))
+		}
+
+		connection.Close()
+	}
+}
+
+func (s *runtimeAPIStandIn) executedCommands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string{}, s.commands...)
+}
+
+func setupProxies(t *testing.T, c *Controller) (*runtimeAPIStandIn, *sqlmock.Sqlmock) {
+	socketPath := filepath.Join(t.TempDir(), "haproxy.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to start runtime API stand-in! Received an error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	standIn := &runtimeAPIStandIn{listener: listener}
+	go standIn.serve()
+
+	c.configuration.Items.HAProxy.RuntimeAPI = "unix://" + socketPath
+	c.configuration.Items.HAProxy.Backend = "postgres"
+	c.haproxyController, err = haproxy.NewController(c.configuration, nil)
+	assert.NoError(t, err)
+
+	databaseMockData := thelper.SetupDatabaseMockData()
+	c.configuration.Items.PgBouncer.Host = "127.0.0.1"
+	c.configuration.Items.PgBouncer.IncludePath = filepath.Join(t.TempDir(), "pgbouncer_databases.ini")
+	c.pgBouncerController = pgbouncer.NewControllerWithConnection(c.configuration, databaseMockData.Connection, nil)
+
+	return standIn, databaseMockData.Mock
+}
+
+func TestFallback(t *testing.T) {
+	tests := []struct {
+		name             string
+		failingStep      string
+		expectedSwitched bool
+	}{
+		{
+			name:             "traffic is switched back to the old instance",
+			expectedSwitched: true,
+		},
+		{
+			name:        "traffic stays on the new instance if the old one has not been restored",
+			failingStep: "FallbackToSourceDatabase",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Src.Host = "test-db.fake.rds.amazonaws.com"
+
+			err := c.Run()
+			assert.NoError(t, err)
+
+			setupDNSRecord(c, cloud, 60)
+			cloud.Records[TEST_DNS_RECORD_NAME].ResourceRecords[0].Value = cloud.Instances[TEST_DST_INSTANCE_ID].Endpoint.Address
+			standIn, mock := setupProxies(t, c)
+			(*mock).ExpectExec(regexp.QuoteMeta("SHOW VERSION;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			if test.expectedSwitched {
+				(*mock).ExpectExec(regexp.QuoteMeta("RELOAD;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			databaseController.failOn = test.failingStep
+			input.SetReader(strings.NewReader("y\n"))
+
+			err = c.Fallback()
+			if test.expectedSwitched {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+
+			if !test.expectedSwitched {
+				assert.Equal(t, []string{"show stat"}, standIn.executedCommands(), "HAProxy must keep the new server")
+				assert.NoFileExists(t, c.configuration.Items.PgBouncer.IncludePath)
+				assert.Equal(t, "test-db-v14.fake.rds.amazonaws.com", *cloud.Records[TEST_DNS_RECORD_NAME].ResourceRecords[0].Value)
+				return
+			}
+
+			assert.Equal(
+				t,
+				[]string{
+					"show stat",
+					"set server postgres/src state ready",
+					"set server postgres/dst state maint",
+					"shutdown sessions server postgres/dst",
+				},
+				standIn.executedCommands(),
+				"HAProxy must send the traffic to the old server",
+			)
+
+			content, err := os.ReadFile(c.configuration.Items.PgBouncer.IncludePath)
+			assert.NoError(t, err)
+			assert.Equal(
+				t,
+				"[databases]\npostgres = host=test-db.fake.rds.amazonaws.com port=5432 dbname=postgres\n",
+				string(content),
+				"include file must point to the old instance",
+			)
+
+			assert.Equal(t, "test-db.fake.rds.amazonaws.com", *cloud.Records[TEST_DNS_RECORD_NAME].ResourceRecords[0].Value)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
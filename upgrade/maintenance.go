@@ -0,0 +1,55 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/log"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+func formatApplyDate(applyDate *time.Time) string {
+	if applyDate == nil {
+		return "none"
+	}
+	return applyDate.UTC().Format(time.RFC3339)
+}
+
+func (c *Controller) logPendingMaintenanceAction(action *rdsTypes.PendingMaintenanceAction) {
+	log.Warnf(
+		"Pending maintenance action: '%s' (%s) might be applied during the upgrade. Apply after: %s, forced apply: %s",
+		a.ToString(action.Action),
+		a.ToString(action.Description),
+		formatApplyDate(action.AutoAppliedAfterDate),
+		formatApplyDate(action.ForcedApplyDate),
+	)
+}
+
+// Applied to the source instance before anything else, so they do not interrupt the upgrade later on.
+func (c *Controller) applyPendingMaintenanceActions(instance *rdsTypes.DBInstance, now *time.Time) error {
+	if c.configuration.Items.Upgrade.PendingMaintenance != aws.PENDING_MAINTENANCE_APPLY {
+		return nil
+	}
+
+	actions, err := c.awsController.GetUrgentPendingMaintenanceActions(instance, now)
+	if err != nil {
+		return err
+	}
+
+	if len(actions) == 0 {
+		return nil
+	}
+
+	return c.awsController.ApplyPendingMaintenanceActions(instance, actions)
+}
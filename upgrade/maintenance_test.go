@@ -0,0 +1,119 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunHandlesPendingMaintenanceActions(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name                  string
+		mode                  string
+		action                rdsTypes.PendingMaintenanceAction
+		expectedError         bool
+		expectedApplied       bool
+		expectedRemainingSize int
+	}{
+		{
+			name: "Action scheduled after the expected duration is ignored.",
+			mode: aws.PENDING_MAINTENANCE_FAIL,
+			action: rdsTypes.PendingMaintenanceAction{
+				Action:          a.String("system-update"),
+				ForcedApplyDate: a.Time(now.Add(time.Hour * 24 * 7)),
+			},
+			expectedRemainingSize: 1,
+		},
+		{
+			name: "Urgent action fails the pre-flight checks.",
+			mode: aws.PENDING_MAINTENANCE_FAIL,
+			action: rdsTypes.PendingMaintenanceAction{
+				Action:               a.String("system-update"),
+				AutoAppliedAfterDate: a.Time(now.Add(time.Hour)),
+			},
+			expectedError:         true,
+			expectedRemainingSize: 1,
+		},
+		{
+			name: "Urgent action is applied before the upgrade.",
+			mode: aws.PENDING_MAINTENANCE_APPLY,
+			action: rdsTypes.PendingMaintenanceAction{
+				Action:          a.String("system-update"),
+				ForcedApplyDate: a.Time(now.Add(time.Hour)),
+			},
+			expectedApplied:       true,
+			expectedRemainingSize: 0,
+		},
+		{
+			name: "Urgent action is deferred.",
+			mode: aws.PENDING_MAINTENANCE_DEFER,
+			action: rdsTypes.PendingMaintenanceAction{
+				Action:               a.String("system-update"),
+				AutoAppliedAfterDate: a.Time(now.Add(-time.Hour)),
+			},
+			expectedRemainingSize: 1,
+		},
+		{
+			name: "Forced action can not be deferred.",
+			mode: aws.PENDING_MAINTENANCE_DEFER,
+			action: rdsTypes.PendingMaintenanceAction{
+				Action:          a.String("system-update"),
+				ForcedApplyDate: a.Time(now.Add(time.Hour)),
+			},
+			expectedError:         true,
+			expectedRemainingSize: 1,
+		},
+		{
+			name: "Unknown mode is rejected.",
+			mode: "aply",
+			action: rdsTypes.PendingMaintenanceAction{
+				Action:          a.String("system-update"),
+				ForcedApplyDate: a.Time(now.Add(time.Hour * 24 * 7)),
+			},
+			expectedError:         true,
+			expectedRemainingSize: 1,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(now)
+			cloud.PendingMaintenanceActions[TEST_SRC_INSTANCE_ARN] = []rdsTypes.PendingMaintenanceAction{test.action}
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Upgrade.PendingMaintenance = test.mode
+
+			err := c.Run()
+			if test.expectedError {
+				assert.Error(t, err)
+				assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+			} else {
+				assert.NoError(t, err)
+				assert.Contains(t, databaseController.calls, "PerformPostUpgradeOperations")
+			}
+
+			if test.expectedApplied {
+				assert.Contains(t, cloud.Calls(), "ApplyPendingMaintenanceAction")
+			} else {
+				assert.NotContains(t, cloud.Calls(), "ApplyPendingMaintenanceAction")
+			}
+			assert.Len(t, cloud.PendingMaintenanceActions[TEST_SRC_INSTANCE_ARN], test.expectedRemainingSize)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
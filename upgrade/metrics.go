@@ -0,0 +1,140 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/log"
+	"time"
+)
+
+const (
+	PHASE_PRE_FLIGHT_CHECKS     string = "pre_flight_checks"
+	PHASE_PREPARATION           string = "preparation"
+	PHASE_SNAPSHOT_RESTORE      string = "snapshot_restore"
+	PHASE_BLUE_GREEN_DEPLOYMENT string = "blue_green_deployment"
+	PHASE_INITIAL_SYNC          string = "initial_sync"
+	PHASE_READ_REPLICAS         string = "read_replicas"
+	PHASE_POST_UPGRADE          string = "post_upgrade"
+	PHASE_REPLICATING           string = "replicating"
+	PHASE_SWITCHOVER            string = "switchover"
+	PHASE_COMPLETED             string = "completed"
+)
+
+// Values of the RelocationPhase metric. Both strategies share the numbers, so the same dashboard fits them.
+var relocationPhases = map[string]int{
+	PHASE_PRE_FLIGHT_CHECKS:     1,
+	PHASE_PREPARATION:           2,
+	PHASE_SNAPSHOT_RESTORE:      3,
+	PHASE_BLUE_GREEN_DEPLOYMENT: 3,
+	PHASE_INITIAL_SYNC:          4,
+	PHASE_READ_REPLICAS:         5,
+	PHASE_POST_UPGRADE:          6,
+	PHASE_REPLICATING:           7,
+	PHASE_SWITCHOVER:            8,
+	PHASE_COMPLETED:             9,
+}
+
+// Failures are only logged, a relocation must not be stopped because its metrics could not be published.
+func (c *Controller) publishMetrics() {
+	c.progress.mutex.Lock()
+	phase := c.progress.phase
+	phaseStartTime := c.progress.phaseStartTime
+	c.progress.mutex.Unlock()
+
+	if phase == "" {
+		return
+	}
+
+	metrics := &aws.RelocationMetrics{
+		Phase:            relocationPhases[phase],
+		PhaseName:        phase,
+		PhaseElapsedTime: time.Since(phaseStartTime),
+	}
+
+	replicationLag, err := c.databaseController.GetUpgradeReplicationLag()
+	if err != nil {
+		log.Warnf("Failed to fetch the replication lag for metrics. Received an error: '%s'", err)
+	} else if replicationLag != nil {
+		metrics.ReplicationByteLag = &replicationLag.ByteLag
+		metrics.ReplicationTimeLag = &replicationLag.TimeLag
+		metrics.RetainedWAL = &replicationLag.RetainedWAL
+	}
+
+	metrics.HeartbeatsSent, err = c.databaseController.CountSentHeartBeatRecords()
+	if err != nil {
+		log.Warnf("Failed to count sent heartbeat records for metrics. Received an error: '%s'", err)
+	}
+
+	metrics.HeartbeatsReceived, err = c.databaseController.CountReceivedHeartBeatRecords()
+	if err != nil {
+		log.Warnf("Failed to count received heartbeat records for metrics. Received an error: '%s'", err)
+	}
+
+	err = c.awsController.PublishRelocationMetrics(metrics)
+	if err != nil {
+		log.Warnf("Failed to publish relocation metrics. Received an error: '%s'", err)
+	}
+}
+
+// The last values of the previous phase are published before switching, so its elapsed time is complete.
+func (c *Controller) enterPhase(phase string) {
+	if !c.awsController.MetricsEnabled() {
+		return
+	}
+
+	c.publishMetrics()
+
+	c.progress.mutex.Lock()
+	c.progress.phase = phase
+	c.progress.phaseStartTime = time.Now().UTC()
+	c.progress.mutex.Unlock()
+
+	log.Debugf("Entering relocation phase: '%s'", phase)
+
+	c.publishMetrics()
+}
+
+// Metrics are published on every phase change and every interval in between. Returns a function which stops the process.
+func (c *Controller) beginMetricsProcess(phase string) func() {
+	if !c.awsController.MetricsEnabled() {
+		return func() {}
+	}
+
+	log.Infof("Publishing relocation metrics to CloudWatch namespace: '%s'", c.configuration.AWSMetrics.Namespace)
+
+	c.enterPhase(phase)
+
+	interval := c.configuration.AWSMetrics.Interval
+	if interval <= 0 {
+		return c.publishMetrics
+	}
+
+	metricsTicker := time.NewTicker(interval)
+	metricsDoneChannel := make(chan bool)
+
+	go func() {
+		for {
+			select {
+			case <-metricsDoneChannel:
+				return
+			case <-metricsTicker.C:
+				c.publishMetrics()
+			}
+		}
+	}()
+
+	return func() {
+		metricsTicker.Stop()
+		metricsDoneChannel <- true
+		c.publishMetrics()
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/types"
+	"errors"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReportsProgress(t *testing.T) {
+	tests := []struct {
+		name             string
+		progressInterval time.Duration
+		timeouts         map[string]string
+		expectedError    bool
+		reported         bool
+	}{
+		{
+			name:             "progress is reported",
+			progressInterval: time.Hour,
+			reported:         true,
+		},
+		{
+			name:             "progress report is disabled",
+			progressInterval: 0,
+			reported:         false,
+		},
+		{
+			name:             "timeout is overridden",
+			progressInterval: 0,
+			timeouts:         map[string]string{aws.OPERATION_SNAPSHOT_RESTORE: "2h"},
+			reported:         false,
+		},
+		{
+			name:             "timeout of an unknown operation",
+			progressInterval: 0,
+			timeouts:         map[string]string{"snapshot_delete": "2h"},
+			expectedError:    true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			cloud.Events = []rdsTypes.Event{
+				{
+					Date:             a.Time(time.Now().UTC().Add(time.Hour)),
+					Message:          a.String("Restored from snapshot"),
+					SourceIdentifier: a.String(TEST_DST_INSTANCE_ID),
+					SourceType:       rdsTypes.SourceTypeDbInstance,
+				},
+			}
+			c, _ := setupUpgradeController(t, cloud, nil)
+			c.configuration.AWSProgressInterval = test.progressInterval
+			c.configuration.AWSTimeouts = test.timeouts
+
+			err := c.Run()
+			if test.expectedError {
+				assert.Error(t, err)
+				assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+				return
+			}
+			assert.NoError(t, err)
+
+			if test.reported {
+				assert.Contains(t, cloud.Calls(), "DescribeEvents")
+			} else {
+				assert.NotContains(t, cloud.Calls(), "DescribeEvents")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestRunPublishesMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		failOn    string
+		published bool
+	}{
+		{
+			name:      "metrics are published",
+			published: true,
+		},
+		{
+			name:      "failure to publish metrics is not fatal",
+			failOn:    "PutMetricData",
+			published: false,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			if test.failOn != "" {
+				cloud.FailOn(test.failOn, errors.New("throttled"))
+			}
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			c.configuration.AWSMetrics = &types.MetricsDetails{Enabled: true, Namespace: "db_relocate"}
+			databaseController.replicationLag = &types.ReplicationLag{ByteLag: 1024, TimeLag: 2.5, RetainedWAL: 4096}
+			databaseController.heartBeatsSent = a.Int(10)
+			databaseController.heartBeatsReceived = a.Int(8)
+
+			err := c.Run()
+			assert.NoError(t, err)
+
+			metricData := cloud.MetricData["db_relocate"]
+			if !test.published {
+				assert.Empty(t, metricData)
+				return
+			}
+
+			phases := []float64{}
+			values := map[string]float64{}
+			for _, datum := range metricData {
+				values[*datum.MetricName] = *datum.Value
+				if *datum.MetricName != aws.RELOCATION_PHASE_METRIC {
+					continue
+				}
+
+				assert.Equal(t, []cwTypes.Dimension{
+					{Name: a.String(aws.SRC_DB_INSTANCE_METRIC_DIMENSION), Value: a.String(TEST_SRC_INSTANCE_ID)},
+					{Name: a.String(aws.DST_DB_INSTANCE_METRIC_DIMENSION), Value: a.String(TEST_DST_INSTANCE_ID)},
+				}, datum.Dimensions)
+
+				if len(phases) == 0 || phases[len(phases)-1] != *datum.Value {
+					phases = append(phases, *datum.Value)
+				}
+			}
+
+			assert.Equal(t, []float64{1, 2, 3, 4, 5, 6, 7}, phases, "every phase must be published in order")
+			assert.Equal(t, 1024.0, values[aws.REPLICATION_BYTE_LAG_METRIC])
+			assert.Equal(t, 2.5, values[aws.REPLICATION_TIME_LAG_METRIC])
+			assert.Equal(t, 4096.0, values[aws.RETAINED_WAL_METRIC])
+			assert.Equal(t, 10.0, values[aws.HEARTBEATS_SENT_METRIC])
+			assert.Equal(t, 8.0, values[aws.HEARTBEATS_RECEIVED_METRIC])
+			assert.Equal(t, 2.0, values[aws.HEARTBEATS_MISSING_METRIC])
+		}
+		t.Run(test.name, testFunction)
+	}
+}
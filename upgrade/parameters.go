@@ -16,6 +16,23 @@ import (
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 )
 
+// Aurora keeps the custom parameters in the cluster parameter group,
+// so its instances use the default parameter group unless it is set.
+func (c *Controller) generateTargetParameterGroups(instance *rdsTypes.DBInstance) error {
+	if c.awsController.IsAuroraTarget() {
+		if c.configuration.Items.Upgrade.ClusterParameterGroup != "" {
+			return nil
+		}
+		return c.awsController.GenerateTargetDBClusterParameterGroup(instance)
+	}
+
+	if c.configuration.Items.Upgrade.ParameterGroup != "" {
+		return nil
+	}
+
+	return c.awsController.GenerateTargetDBParameterGroup(instance)
+}
+
 func (c *Controller) ensureParametersOnSrcDB(instance *rdsTypes.DBInstance) error {
 	requiredParametersOnSrcDBInstance := map[string]*rdsTypes.Parameter{
 		"rds.logical_replication": {
@@ -49,11 +66,28 @@ func (c *Controller) ensureParametersOnDstDB(instance *rdsTypes.DBInstance) erro
 		},
 	}
 
+	// Reverse replication is enabled in an irreversible switchover step, so its prerequisites are ensured upfront.
+	if c.configuration.Items.Upgrade.ReverseReplication {
+		requiredParametersOnDstDBInstance["rds.logical_replication"] = &rdsTypes.Parameter{
+			ParameterName:  a.String("rds.logical_replication"),
+			ParameterValue: a.String("1"),
+			ApplyMethod:    rdsTypes.ApplyMethodPendingReboot,
+		}
+	}
+
 	err := c.awsController.EnsureParameters(instance, requiredParametersOnDstDBInstance)
 	if err != nil {
 		return err
 	}
 	// TODO: migrate to https://github.com/jackc/pgx
-	err = c.databaseController.InitDestinationDatabaseConnection(instance.Endpoint.Address)
-	return err
+	err = c.databaseController.InitDestinationDatabaseConnection(instance.DBInstanceIdentifier, instance.Endpoint.Address, instance.Endpoint.Port)
+	if err != nil {
+		return err
+	}
+
+	if c.configuration.Items.Upgrade.ReverseReplication {
+		return c.databaseController.EnsureLogicalReplicationOnDstDatabase()
+	}
+
+	return nil
 }
@@ -0,0 +1,133 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/testing/fakeaws"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunGeneratesParameterGroup(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	cloud.ParameterGroups["test-db-pg13"].Parameters["work_mem"] = rdsTypes.Parameter{
+		ParameterName:  a.String("work_mem"),
+		ParameterValue: a.String("8192"),
+		AllowedValues:  a.String("64-2147483647"),
+		Source:         a.String("user"),
+		IsModifiable:   true,
+	}
+	cloud.ParameterGroups["test-db-pg13"].Parameters["removed_parameter"] = rdsTypes.Parameter{
+		ParameterName:  a.String("removed_parameter"),
+		ParameterValue: a.String("1"),
+		Source:         a.String("user"),
+		IsModifiable:   true,
+	}
+	cloud.EngineDefaults["postgres14"] = []rdsTypes.Parameter{
+		{
+			ParameterName:  a.String("work_mem"),
+			ParameterValue: a.String("4096"),
+			AllowedValues:  a.String("64-2147483647"),
+			ApplyType:      a.String("dynamic"),
+			Source:         a.String("engine-default"),
+			IsModifiable:   true,
+		},
+		{
+			ParameterName:  a.String("track_commit_timestamp"),
+			ParameterValue: a.String("0"),
+			AllowedValues:  a.String("0,1"),
+			ApplyType:      a.String("static"),
+			Source:         a.String("engine-default"),
+			IsModifiable:   true,
+		},
+	}
+
+	c, _ := setupUpgradeController(t, cloud, nil)
+	c.configuration.Items.Upgrade.ParameterGroup = ""
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	parameterGroup, ok := cloud.ParameterGroups["test-db-postgres14"]
+	if assert.True(t, ok, "parameter group must be generated") {
+		assert.Equal(t, "postgres14", *parameterGroup.Group.DBParameterGroupFamily)
+		assert.Equal(t, "8192", *parameterGroup.Parameters["work_mem"].ParameterValue)
+		assert.Equal(t, "1", *parameterGroup.Parameters["track_commit_timestamp"].ParameterValue)
+		assert.NotContains(t, parameterGroup.Parameters, "removed_parameter")
+	}
+
+	assert.Equal(t, "test-db-postgres14", *cloud.Instances[TEST_DST_INSTANCE_ID].DBParameterGroups[0].DBParameterGroupName)
+}
+
+func TestRunPreparesDstDBForReverseReplication(t *testing.T) {
+	tests := []struct {
+		name                     string
+		targetEngine             string
+		failingStep              string
+		expectedParameterGroup   func(cloud *fakeaws.Cloud) map[string]rdsTypes.Parameter
+		expectedReverseSupported bool
+	}{
+		{
+			name: "logical replication is enabled in the generated parameter group",
+			expectedParameterGroup: func(cloud *fakeaws.Cloud) map[string]rdsTypes.Parameter {
+				return cloud.ParameterGroups["test-db-postgres14"].Parameters
+			},
+			expectedReverseSupported: true,
+		},
+		{
+			name:         "logical replication is enabled in the generated cluster parameter group",
+			targetEngine: aws.TARGET_ENGINE_AURORA_POSTGRESQL,
+			expectedParameterGroup: func(cloud *fakeaws.Cloud) map[string]rdsTypes.Parameter {
+				return cloud.ClusterParameterGroups["test-db-aurora-postgresql14-cluster"].Parameters
+			},
+			expectedReverseSupported: true,
+		},
+		{
+			name:        "run fails if the WAL of the new instance can not be decoded",
+			failingStep: "EnsureLogicalReplicationOnDstDatabase",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			cloud.EngineVersions = append(cloud.EngineVersions, rdsTypes.DBEngineVersion{
+				Engine:        a.String(aws.TARGET_ENGINE_AURORA_POSTGRESQL),
+				EngineVersion: a.String("14.7"),
+			})
+
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Upgrade.ReverseReplication = true
+			c.configuration.Items.Upgrade.ParameterGroup = ""
+			if test.targetEngine != "" {
+				c.configuration.Items.Upgrade.TargetEngine = test.targetEngine
+			}
+			databaseController.failOn = test.failingStep
+
+			err := c.Run()
+			if !test.expectedReverseSupported {
+				assert.Error(t, err)
+				assert.NotContains(t, databaseController.calls, "PrepareDstDatabaseForUpgrade", "replication must not start")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Contains(t, databaseController.calls, "EnsureLogicalReplicationOnDstDatabase")
+			assert.Equal(t, "1", *test.expectedParameterGroup(cloud)["rds.logical_replication"].ParameterValue)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
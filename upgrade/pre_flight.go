@@ -11,10 +11,13 @@
 package upgrade
 
 import (
+	"db_relocate/aws"
 	"db_relocate/log"
 	"errors"
+	"fmt"
 	"time"
 
+	a "github.com/aws/aws-sdk-go-v2/aws"
 	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 )
 
@@ -69,7 +72,7 @@ func (c *Controller) srcDatabaseInstanceExistsCheck(pfc *preFlightChecks) (*rdsT
 }
 
 func (c *Controller) dstDatabaseInstanceExistsCheck(pfc *preFlightChecks) (*rdsTypes.DBInstance, error) {
-	instance, err := c.awsController.DescribeDBInstance(&c.configuration.Items.Dst.InstanceID)
+	instance, err := c.awsController.DescribeDBInstanceInDstRegion(&c.configuration.Items.Dst.InstanceID)
 	if err != nil {
 		var apiError *rdsTypes.DBInstanceNotFoundFault
 		if errors.As(err, &apiError) {
@@ -147,7 +150,45 @@ func (c *Controller) validSubnetGroupCheck(pfc *preFlightChecks, instance *rdsTy
 	return nil
 }
 
+// The subscription of the new instance connects to the source one. Blue/green deployments replicate on their own.
+// Relies on valid security groups and subnet group, so it is skipped if their checks have failed.
+func (c *Controller) replicationNetworkCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance) error {
+	if c.awsController.IsBlueGreenStrategy() || !pfc.preFlightChecks["SecurityGroups"] || !pfc.preFlightChecks["SubnetGroup"] {
+		return nil
+	}
+
+	problems, analyzed, err := c.awsController.FindReplicationNetworkProblems(instance)
+	if err != nil {
+		return err
+	}
+
+	if !analyzed {
+		log.Warnln("Failed to find the subnets of the source or the destination, the replication network was not analyzed.")
+		return nil
+	}
+
+	if len(problems) > 0 {
+		for idx := range problems {
+			log.Errorf("Replication connection to the source instance would be blocked: %s.", problems[idx])
+		}
+		pfc.preFlightChecks["ReplicationNetwork"] = false
+		pfc.passed = false
+
+		return nil
+	}
+
+	pfc.preFlightChecks["ReplicationNetwork"] = true
+
+	return nil
+}
+
 func (c *Controller) validParameterGroupCheck(pfc *preFlightChecks) error {
+	// If empty, the parameter group will be generated from the source one.
+	if c.configuration.Items.Upgrade.ParameterGroup == "" {
+		pfc.preFlightChecks["ParameterGroup"] = true
+		return nil
+	}
+
 	ok, err := c.awsController.IsValidDBParameterGroup(&c.configuration.Items.Upgrade.ParameterGroup, &c.configuration.Items.Upgrade.EngineVersion)
 	if err != nil {
 		return err
@@ -166,6 +207,96 @@ func (c *Controller) validParameterGroupCheck(pfc *preFlightChecks) error {
 	return nil
 }
 
+func (c *Controller) validClusterParameterGroupCheck(pfc *preFlightChecks) error {
+	// If empty, the cluster parameter group will be generated from the source parameter group.
+	if !c.awsController.IsAuroraTarget() || c.configuration.Items.Upgrade.ClusterParameterGroup == "" {
+		pfc.preFlightChecks["ClusterParameterGroup"] = true
+		return nil
+	}
+
+	ok, err := c.awsController.IsValidDBClusterParameterGroup(
+		&c.configuration.Items.Upgrade.ClusterParameterGroup,
+		&c.configuration.Items.Upgrade.EngineVersion,
+	)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		pfc.preFlightChecks["ClusterParameterGroup"] = false
+		pfc.passed = false
+
+		return nil
+
+	}
+
+	pfc.preFlightChecks["ClusterParameterGroup"] = true
+
+	return nil
+}
+
+func (c *Controller) validTargetEngineCheck(pfc *preFlightChecks) {
+	if !c.awsController.IsValidTargetEngine() {
+		pfc.preFlightChecks["TargetEngine"] = false
+		pfc.passed = false
+
+		return
+	}
+
+	pfc.preFlightChecks["TargetEngine"] = true
+}
+
+func (c *Controller) validStrategyCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance) error {
+	ok, err := c.awsController.IsValidStrategy(instance)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		pfc.preFlightChecks["Strategy"] = false
+		pfc.passed = false
+
+		return nil
+	}
+
+	pfc.preFlightChecks["Strategy"] = true
+
+	return nil
+}
+
+func (c *Controller) validSnapshotRetentionCheck(pfc *preFlightChecks) {
+	if !c.awsController.IsValidSnapshotRetention() {
+		pfc.preFlightChecks["SnapshotRetention"] = false
+		pfc.passed = false
+
+		return
+	}
+
+	pfc.preFlightChecks["SnapshotRetention"] = true
+}
+
+func (c *Controller) validTimeoutsCheck(pfc *preFlightChecks) {
+	if !c.awsController.IsValidTimeouts() {
+		pfc.preFlightChecks["Timeouts"] = false
+		pfc.passed = false
+
+		return
+	}
+
+	pfc.preFlightChecks["Timeouts"] = true
+}
+
+func (c *Controller) validStorageConfigurationCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance) {
+	if !c.awsController.IsValidStorageConfiguration(instance) {
+		pfc.preFlightChecks["StorageConfiguration"] = false
+		pfc.passed = false
+
+		return
+	}
+
+	pfc.preFlightChecks["StorageConfiguration"] = true
+}
+
 func (c *Controller) validUpgradeTargetCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance) error {
 	ok, err := c.awsController.IsValidUpgradeTarget(instance)
 	if err != nil {
@@ -262,7 +393,7 @@ func (c *Controller) validStorageThroughputCheck(pfc *preFlightChecks) error {
 }
 
 func (c *Controller) validInstanceClassCheck(pfc *preFlightChecks) error {
-	ok, err := c.awsController.IsValidInstanceClass(&c.configuration.Items.Upgrade.InstanceClass)
+	ok, err := c.awsController.IsValidInstanceClass(&c.configuration.Items.Upgrade.EngineVersion)
 	if err != nil {
 		return err
 	}
@@ -299,6 +430,24 @@ func (c *Controller) validCAIdentifier(pfc *preFlightChecks) error {
 	return nil
 }
 
+// Only warns, since the peaks may not be representative, e.g. after a batch job which has been retired.
+func (c *Controller) instanceClassSizingCheck(instance *rdsTypes.DBInstance, now *time.Time) {
+	instanceClass := c.configuration.Items.Upgrade.InstanceClass
+	if instanceClass == "" || instanceClass == a.ToString(instance.DBInstanceClass) {
+		return
+	}
+
+	shortfalls, err := c.awsController.GetInstanceClassShortfalls(instance, instanceClass, now)
+	if err != nil {
+		log.Warnf("Failed to compare instance class: '%s' against the peak usage: %v", instanceClass, err)
+		return
+	}
+
+	for idx := range shortfalls {
+		log.Warnf("Instance class: '%s' is smaller than the peak usage of the source instance: %s.", instanceClass, shortfalls[idx])
+	}
+}
+
 func (c *Controller) backupWindowCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance, now *time.Time) error {
 	isBackupWindow, err := c.awsController.IsDBInstanceInBackupWindow(instance, now)
 	if err != nil {
@@ -337,6 +486,55 @@ func (c *Controller) maintenanceWindowCheck(pfc *preFlightChecks, instance *rdsT
 	return nil
 }
 
+// Actions can be applied right before the upgrade or deferred, unless their forced apply date can not be avoided.
+// Validated up front, so a typo is not mistaken for one of the modes once an urgent action shows up.
+func (c *Controller) pendingMaintenanceActionsCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance, now *time.Time) error {
+	mode := c.configuration.Items.Upgrade.PendingMaintenance
+	if mode != aws.PENDING_MAINTENANCE_FAIL && mode != aws.PENDING_MAINTENANCE_APPLY && mode != aws.PENDING_MAINTENANCE_DEFER {
+		return errors.New(fmt.Sprintf(
+			"Unsupported 'upgrade.pending_maintenance' value: '%s'! Use one of: '%s', '%s' or '%s'.",
+			mode,
+			aws.PENDING_MAINTENANCE_FAIL,
+			aws.PENDING_MAINTENANCE_APPLY,
+			aws.PENDING_MAINTENANCE_DEFER,
+		))
+	}
+
+	actions, err := c.awsController.GetUrgentPendingMaintenanceActions(instance, now)
+	if err != nil {
+		return err
+	}
+
+	deadline := now.Add(c.configuration.Items.Upgrade.ExpectedDuration)
+	passed := true
+	for idx := range actions {
+		c.logPendingMaintenanceAction(&actions[idx])
+
+		switch mode {
+		case aws.PENDING_MAINTENANCE_FAIL:
+			passed = false
+		case aws.PENDING_MAINTENANCE_DEFER:
+			// The risk of an automatically applied action is accepted, unless the action is forced.
+			if actions[idx].ForcedApplyDate != nil && actions[idx].ForcedApplyDate.Before(deadline) {
+				log.Errorf("Pending maintenance action: '%s' is forced and can not be deferred!", a.ToString(actions[idx].Action))
+				passed = false
+			}
+		}
+	}
+
+	if !passed {
+		pfc.preFlightChecks["PendingMaintenance"] = false
+		pfc.passed = false
+
+		return nil
+
+	}
+
+	pfc.preFlightChecks["PendingMaintenance"] = true
+
+	return nil
+}
+
 func (c *Controller) availableDiskSpaceCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance, now *time.Time) error {
 	ok, err := c.awsController.IsEnoughOfAvailableDiskSpaceForDBInstance(instance, now)
 	if err != nil {
@@ -375,6 +573,25 @@ func (c *Controller) validKMSKeyIDCheck(pfc *preFlightChecks) error {
 	return nil
 }
 
+func (c *Controller) targetAccountCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance) error {
+	ok, err := c.awsController.IsValidTargetAccount(instance)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		pfc.preFlightChecks["TargetAccount"] = false
+		pfc.passed = false
+
+		return nil
+
+	}
+
+	pfc.preFlightChecks["TargetAccount"] = true
+
+	return nil
+}
+
 func (c *Controller) databaseUserCheck(pfc *preFlightChecks) error {
 	// Current user MUST have superuser privilege and be an owner of the selected database.
 	ok, err := c.databaseController.CurrentUserCanProceed()
@@ -395,12 +612,68 @@ func (c *Controller) databaseUserCheck(pfc *preFlightChecks) error {
 	return nil
 }
 
+// Both the instance and the user have to allow IAM database authentication. The new instance takes it over from the old one.
+func (c *Controller) iamAuthCheck(pfc *preFlightChecks, instance *rdsTypes.DBInstance) error {
+	if !c.configuration.Items.Src.IAMAuth {
+		return nil
+	}
+
+	if !instance.IAMDatabaseAuthenticationEnabled {
+		log.Errorf("IAM database authentication is not enabled on DB instance: '%s'!", *instance.DBInstanceIdentifier)
+		pfc.preFlightChecks["IAMAuthentication"] = false
+		pfc.passed = false
+
+		return nil
+	}
+
+	ok, err := c.databaseController.CurrentUserHasIAMRole()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		pfc.preFlightChecks["IAMAuthentication"] = false
+		pfc.passed = false
+
+		return nil
+	}
+
+	pfc.preFlightChecks["IAMAuthentication"] = true
+
+	return nil
+}
+
+// The password has no default, so it is never shared between installations. Blue/green deployments don't create the user.
+func (c *Controller) upgradePasswordCheck(pfc *preFlightChecks) {
+	if c.awsController.IsBlueGreenStrategy() {
+		return
+	}
+
+	if c.configuration.Items.Upgrade.Password == "" {
+		log.Errorln("The password of the upgrade user is not set, e.g. 'upgrade.password: env:UPGRADE_PASSWORD'.")
+		pfc.preFlightChecks["UpgradePassword"] = false
+		pfc.passed = false
+
+		return
+	}
+
+	pfc.preFlightChecks["UpgradePassword"] = true
+}
+
 func (c *Controller) logicalReplicationSlotsCheck(pfc *preFlightChecks) error {
 	ok, err := c.databaseController.UpgradeLogicalReplicationSlotExists()
 	if err != nil {
 		return err
 	}
 
+	// The slot of a previous run is needed to reuse its snapshot.
+	if ok && c.configuration.Items.Upgrade.ReuseSnapshot {
+		log.Infoln("Found a replication slot of a previous run, it is kept to reuse the snapshot.")
+		pfc.preFlightChecks["LogicalReplicationSlot"] = true
+
+		return nil
+	}
+
 	if ok {
 		pfc.preFlightChecks["LogicalReplicationSlot"] = false
 		pfc.passed = false
@@ -463,6 +736,22 @@ func (c *Controller) runPreFlightChecks(now *time.Time) (*rdsTypes.DBInstance, e
 		return nil, err
 	}
 
+	err = c.replicationNetworkCheck(preFlightChecks, srcDatabaseInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	c.validTargetEngineCheck(preFlightChecks)
+
+	err = c.validStrategyCheck(preFlightChecks, srcDatabaseInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	c.validSnapshotRetentionCheck(preFlightChecks)
+
+	c.validTimeoutsCheck(preFlightChecks)
+
 	err = c.validUpgradeTargetCheck(preFlightChecks, srcDatabaseInstance)
 	if err != nil {
 		return nil, err
@@ -473,6 +762,17 @@ func (c *Controller) runPreFlightChecks(now *time.Time) (*rdsTypes.DBInstance, e
 		return nil, err
 	}
 
+	err = c.validClusterParameterGroupCheck(preFlightChecks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recommended values go through the same checks as the configured ones.
+	err = c.applyStorageRecommendation(srcDatabaseInstance, now)
+	if err != nil {
+		return nil, err
+	}
+
 	err = c.validStorageTypeCheck(preFlightChecks, srcDatabaseInstance)
 	if err != nil {
 		return nil, err
@@ -493,6 +793,8 @@ func (c *Controller) runPreFlightChecks(now *time.Time) (*rdsTypes.DBInstance, e
 		return nil, err
 	}
 
+	c.validStorageConfigurationCheck(preFlightChecks, srcDatabaseInstance)
+
 	err = c.validCAIdentifier(preFlightChecks)
 	if err != nil {
 		return nil, err
@@ -503,6 +805,8 @@ func (c *Controller) runPreFlightChecks(now *time.Time) (*rdsTypes.DBInstance, e
 		return nil, err
 	}
 
+	c.instanceClassSizingCheck(srcDatabaseInstance, now)
+
 	err = c.backupWindowCheck(preFlightChecks, srcDatabaseInstance, now)
 	if err != nil {
 		return nil, err
@@ -513,6 +817,11 @@ func (c *Controller) runPreFlightChecks(now *time.Time) (*rdsTypes.DBInstance, e
 		return nil, err
 	}
 
+	err = c.pendingMaintenanceActionsCheck(preFlightChecks, srcDatabaseInstance, now)
+	if err != nil {
+		return nil, err
+	}
+
 	err = c.availableDiskSpaceCheck(preFlightChecks, srcDatabaseInstance, now)
 	if err != nil {
 		return nil, err
@@ -523,11 +832,23 @@ func (c *Controller) runPreFlightChecks(now *time.Time) (*rdsTypes.DBInstance, e
 		return nil, err
 	}
 
+	err = c.targetAccountCheck(preFlightChecks, srcDatabaseInstance)
+	if err != nil {
+		return nil, err
+	}
+
 	err = c.databaseUserCheck(preFlightChecks)
 	if err != nil {
 		return nil, err
 	}
 
+	c.upgradePasswordCheck(preFlightChecks)
+
+	err = c.iamAuthCheck(preFlightChecks, srcDatabaseInstance)
+	if err != nil {
+		return nil, err
+	}
+
 	err = c.logicalReplicationSlotsCheck(preFlightChecks)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,221 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/testing/fakeaws"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunFailsPreFlightWithoutUpgradePassword(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	c, databaseController := setupUpgradeController(t, cloud, nil)
+	c.configuration.Items.Upgrade.Password = ""
+
+	err := c.Run()
+	assert.Error(t, err)
+
+	assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+	assert.NotContains(t, databaseController.calls, "PrepareSrcDatabaseForUpgrade", "the upgrade user must not be created")
+}
+
+func TestRunChecksIAMAuth(t *testing.T) {
+	tests := []struct {
+		name           string
+		iamAuthEnabled bool
+		missingIAMRole bool
+		expectedError  bool
+	}{
+		{
+			name:           "IAM auth is enabled and granted",
+			iamAuthEnabled: true,
+		},
+		{
+			name:           "IAM auth is not enabled on the instance",
+			iamAuthEnabled: false,
+			expectedError:  true,
+		},
+		{
+			name:           "rds_iam is not granted",
+			iamAuthEnabled: true,
+			missingIAMRole: true,
+			expectedError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			cloud.Instances[TEST_SRC_INSTANCE_ID].IAMDatabaseAuthenticationEnabled = test.iamAuthEnabled
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Src.IAMAuth = true
+			databaseController.missingIAMRole = test.missingIAMRole
+
+			err := c.Run()
+			if test.expectedError {
+				assert.Error(t, err)
+				assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+				return
+			}
+
+			assert.NoError(t, err)
+			dstInstance, ok := cloud.Instances[TEST_DST_INSTANCE_ID]
+			if assert.True(t, ok, "destination instance must be restored") {
+				assert.True(t, dstInstance.IAMDatabaseAuthenticationEnabled, "IAM auth must be carried over")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestRunChecksReplicationNetwork(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(cloud *fakeaws.Cloud)
+		expectedError bool
+	}{
+		{
+			name:  "source security group allows the destination one",
+			setup: func(cloud *fakeaws.Cloud) {},
+		},
+		{
+			name: "source security group allows the destination subnets",
+			setup: func(cloud *fakeaws.Cloud) {
+				cloud.SecurityGroups[0].IpPermissions[0].UserIdGroupPairs = nil
+				cloud.SecurityGroups[0].IpPermissions[0].IpRanges = []ec2Types.IpRange{{CidrIp: a.String("10.0.0.0/16")}}
+			},
+		},
+		{
+			name: "source security group allows only a part of a destination subnet",
+			setup: func(cloud *fakeaws.Cloud) {
+				cloud.SecurityGroups[0].IpPermissions[0].UserIdGroupPairs = nil
+				cloud.SecurityGroups[0].IpPermissions[0].IpRanges = []ec2Types.IpRange{{CidrIp: a.String("10.0.1.0/25")}}
+			},
+			expectedError: true,
+		},
+		{
+			name: "source security group allows another port",
+			setup: func(cloud *fakeaws.Cloud) {
+				cloud.SecurityGroups[0].IpPermissions[0].FromPort = a.Int32(5433)
+				cloud.SecurityGroups[0].IpPermissions[0].ToPort = a.Int32(5433)
+			},
+			expectedError: true,
+		},
+		{
+			name: "destination security group does not allow outbound traffic",
+			setup: func(cloud *fakeaws.Cloud) {
+				cloud.SecurityGroups[0].IpPermissionsEgress = nil
+			},
+			expectedError: true,
+		},
+		{
+			name: "network ACL denies the port before allowing everything",
+			setup: func(cloud *fakeaws.Cloud) {
+				cloud.NetworkAcls[0].Entries = append(cloud.NetworkAcls[0].Entries, ec2Types.NetworkAclEntry{
+					RuleNumber: a.Int32(90),
+					Protocol:   a.String("6"),
+					PortRange:  &ec2Types.PortRange{From: a.Int32(5432), To: a.Int32(5432)},
+					RuleAction: ec2Types.RuleActionDeny,
+					Egress:     a.Bool(false),
+					CidrBlock:  a.String("10.0.2.0/24"),
+				})
+			},
+			expectedError: true,
+		},
+		{
+			name: "network ACL does not allow the responses",
+			setup: func(cloud *fakeaws.Cloud) {
+				cloud.NetworkAcls[0].Entries[2] = ec2Types.NetworkAclEntry{
+					RuleNumber: a.Int32(100),
+					Protocol:   a.String("6"),
+					PortRange:  &ec2Types.PortRange{From: a.Int32(5432), To: a.Int32(5432)},
+					RuleAction: ec2Types.RuleActionAllow,
+					Egress:     a.Bool(true),
+					CidrBlock:  a.String("0.0.0.0/0"),
+				}
+			},
+			expectedError: true,
+		},
+		{
+			name: "subnets are unknown",
+			setup: func(cloud *fakeaws.Cloud) {
+				cloud.SecurityGroups[0].IpPermissions = nil
+				cloud.Subnets = nil
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			test.setup(cloud)
+			c, _ := setupUpgradeController(t, cloud, nil)
+
+			err := c.Run()
+			if test.expectedError {
+				assert.Error(t, err)
+				assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Contains(t, cloud.Calls(), "DescribeNetworkAcls")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+// Instance classes are orderable per engine version, so they must be looked up for the target one.
+func TestRunChecksInstanceClass(t *testing.T) {
+	tests := []struct {
+		name          string
+		instanceClass string
+		expectedError bool
+	}{
+		{
+			name:          "instance class is orderable for the target engine version",
+			instanceClass: "db.t3.small",
+		},
+		{
+			name:          "instance class is only orderable for other engine versions",
+			instanceClass: "db.t3.micro",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			cloud.InstanceClasses = nil
+			cloud.InstanceClassesByEngineVersion = map[string][]string{
+				"13.7": {"db.t3.micro", "db.t3.small"},
+				"14.7": {"db.t3.small"},
+			}
+			c, _ := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Upgrade.InstanceClass = test.instanceClass
+
+			err := c.Run()
+			if test.expectedError {
+				assert.Error(t, err)
+				assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+				return
+			}
+
+			assert.NoError(t, err)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
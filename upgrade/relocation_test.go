@@ -0,0 +1,326 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/testing/fakeaws"
+	"fmt"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	kmsTypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Seeds the resources the destination instance needs in another region or account.
+func setupTargetFakeCloud(srcCloud *fakeaws.Cloud, region string, accountID string) *fakeaws.Cloud {
+	targetCloud := fakeaws.NewCloud()
+	targetCloud.Region = region
+	targetCloud.AccountID = accountID
+	targetCloud.Peers = []*fakeaws.Cloud{srcCloud}
+	targetCloud.ParameterGroups["test-db-pg14"] = &fakeaws.ParameterGroup{
+		Group: rdsTypes.DBParameterGroup{
+			DBParameterGroupName:   a.String("test-db-pg14"),
+			DBParameterGroupFamily: a.String("postgres14"),
+		},
+		Parameters: map[string]rdsTypes.Parameter{
+			"track_commit_timestamp": {
+				ParameterName:  a.String("track_commit_timestamp"),
+				ParameterValue: a.String("0"),
+				IsModifiable:   true,
+			},
+		},
+	}
+	targetCloud.SubnetGroups["test-db-subnets-target"] = &rdsTypes.DBSubnetGroup{
+		DBSubnetGroupName: a.String("test-db-subnets-target"),
+		VpcId:             a.String("vpc-target"),
+	}
+	targetCloud.EngineVersions = srcCloud.EngineVersions
+	targetCloud.InstanceClasses = srcCloud.InstanceClasses
+	targetCloud.Certificates = srcCloud.Certificates
+	targetCloud.Vpcs = []ec2Types.Vpc{{VpcId: a.String("vpc-target")}}
+	targetCloud.SecurityGroups = []ec2Types.SecurityGroup{{GroupId: a.String("sg-target"), VpcId: a.String("vpc-target")}}
+	targetCloud.Keys = []kmsTypes.KeyListEntry{
+		{KeyId: a.String("target-key"), KeyArn: a.String(fmt.Sprintf("arn:aws:kms:%s:%s:key/target-key", region, accountID))},
+	}
+
+	return targetCloud
+}
+
+func setupRelocationController(t *testing.T, cloud *fakeaws.Cloud, targetCloud *fakeaws.Cloud) *Controller {
+	c, _ := setupUpgradeControllerWithClients(t, &aws.Clients{
+		RDS:         cloud,
+		CloudWatch:  cloud,
+		EC2:         cloud,
+		KMS:         cloud,
+		Route53:     cloud,
+		TargetRDS:   targetCloud,
+		TargetEC2:   targetCloud,
+		TargetKMS:   targetCloud,
+		WaiterDelay: time.Millisecond,
+	})
+	c.configuration.Items.Upgrade.SubnetGroupName = "test-db-subnets-target"
+	c.configuration.Items.Upgrade.SecurityGroupIDs = []string{"sg-target"}
+	c.configuration.Items.Upgrade.VPCID = "vpc-target"
+	c.configuration.Items.Upgrade.KMSID = *targetCloud.Keys[0].KeyArn
+
+	return c
+}
+
+func TestRunRelocatesAcrossRegions(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	targetCloud := setupTargetFakeCloud(cloud, "eu-west-1", fakeaws.ACCOUNT_ID)
+
+	c := setupRelocationController(t, cloud, targetCloud)
+	c.configuration.Items.Upgrade.TargetRegion = "eu-west-1"
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	assert.NotContains(t, cloud.Instances, TEST_DST_INSTANCE_ID)
+	assert.NotContains(t, cloud.Calls(), "CopyDBSnapshot")
+	assert.NotContains(t, cloud.Calls(), "RestoreDBInstanceFromDBSnapshot")
+	assert.NotContains(t, cloud.Calls(), "ModifyDBSnapshotAttribute")
+	assert.Contains(t, cloud.Calls(), "StopDBInstance")
+	assert.Equal(t, "1", *cloud.ParameterGroups["test-db-pg13"].Parameters["rds.logical_replication"].ParameterValue)
+
+	snapshot, ok := targetCloud.Snapshots[fmt.Sprintf("test-db-upgrade-%s-encrypted", c.awsController.GetRunID())]
+	if assert.True(t, ok, "snapshot must be copied to the target region") {
+		assert.Equal(t, "arn:aws:kms:eu-west-1:123456789012:key/target-key", *snapshot.KmsKeyId)
+		assert.Equal(t, "14.7", *snapshot.EngineVersion)
+	}
+
+	dstInstance, ok := targetCloud.Instances[TEST_DST_INSTANCE_ID]
+	if assert.True(t, ok, "destination instance must be restored in the target region") {
+		assert.Equal(t, "test-db-subnets-target", *dstInstance.DBSubnetGroup.DBSubnetGroupName)
+		assert.Equal(t, "sg-target", *dstInstance.VpcSecurityGroups[0].VpcSecurityGroupId)
+		assert.Equal(t, "rds-ca-rsa2048-g1", *dstInstance.CACertificateIdentifier)
+		assert.Nil(t, dstInstance.PerformanceInsightsKMSKeyId, "KMS key of the source region must not be used")
+		assert.Equal(t, "s3Import", *dstInstance.AssociatedRoles[0].FeatureName)
+	}
+	assert.Equal(t, "1", *targetCloud.ParameterGroups["test-db-pg14"].Parameters["track_commit_timestamp"].ParameterValue)
+
+	dstReplica, ok := targetCloud.Instances[TEST_DST_REPLICA_ID]
+	if assert.True(t, ok, "read replica must move to the target region") {
+		assert.Equal(t, TEST_DST_INSTANCE_ID, *dstReplica.ReadReplicaSourceDBInstanceIdentifier)
+		assert.Equal(t, "test-db-pg14", *dstReplica.DBParameterGroups[0].DBParameterGroupName)
+		assert.Nil(t, dstReplica.AvailabilityZone)
+	}
+}
+
+func TestRunRelocatesAcrossAccounts(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	cloud.Instances[TEST_SRC_INSTANCE_ID].StorageEncrypted = true
+	cloud.Instances[TEST_SRC_INSTANCE_ID].KmsKeyId = a.String(TEST_KMS_KEY_ARN)
+
+	targetCloud := setupTargetFakeCloud(cloud, fakeaws.DEFAULT_REGION, "210987654321")
+	targetCloud.KeyMetadata[TEST_KMS_KEY_ARN] = kmsTypes.KeyMetadata{
+		KeyId:      a.String("test-key"),
+		KeyManager: kmsTypes.KeyManagerTypeCustomer,
+		KeyState:   kmsTypes.KeyStateEnabled,
+	}
+
+	c := setupRelocationController(t, cloud, targetCloud)
+	c.configuration.Items.Upgrade.TargetAccountRoleArn = "arn:aws:iam::210987654321:role/db-relocate"
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	assert.NotContains(t, cloud.Instances, TEST_DST_INSTANCE_ID)
+	assert.Contains(t, cloud.Calls(), "ModifyDBSnapshotAttribute")
+	assert.Empty(t, cloud.SharedSnapshots[fmt.Sprintf("test-db-upgrade-%s", c.awsController.GetRunID())], "snapshot must not stay shared after the copy")
+	assert.Contains(t, cloud.Calls(), "StopDBInstance")
+
+	snapshot, ok := targetCloud.Snapshots[fmt.Sprintf("test-db-upgrade-%s-encrypted", c.awsController.GetRunID())]
+	if assert.True(t, ok, "snapshot must be copied to the target account") {
+		assert.Equal(t, "arn:aws:kms:us-east-1:210987654321:key/target-key", *snapshot.KmsKeyId)
+	}
+
+	dstInstance, ok := targetCloud.Instances[TEST_DST_INSTANCE_ID]
+	if assert.True(t, ok, "destination instance must be restored in the target account") {
+		assert.Equal(t, "arn:aws:rds:us-east-1:210987654321:db:test-db-v14", *dstInstance.DBInstanceArn)
+		assert.Equal(t, "test-db-subnets-target", *dstInstance.DBSubnetGroup.DBSubnetGroupName)
+		assert.Nil(t, dstInstance.MonitoringRoleArn, "monitoring role of the source account must not be used")
+		assert.Empty(t, dstInstance.AssociatedRoles, "IAM roles of the source account must not be used")
+	}
+	assert.Equal(t, "1", *targetCloud.ParameterGroups["test-db-pg14"].Parameters["track_commit_timestamp"].ParameterValue)
+
+	dstReplica, ok := targetCloud.Instances[TEST_DST_REPLICA_ID]
+	if assert.True(t, ok, "read replica must move to the target account") {
+		assert.Equal(t, "sg-target", *dstReplica.VpcSecurityGroups[0].VpcSecurityGroupId)
+	}
+}
+
+func TestRunFailsCrossAccountPreFlight(t *testing.T) {
+	tests := []struct {
+		name        string
+		roleArn     string
+		keyMetadata *kmsTypes.KeyMetadata
+	}{
+		{
+			name:    "Target account role is not an ARN.",
+			roleArn: "db-relocate",
+		},
+		{
+			name:    "Target account can not use the source KMS key.",
+			roleArn: "arn:aws:iam::210987654321:role/db-relocate",
+		},
+		{
+			name:    "Source KMS key is managed by AWS.",
+			roleArn: "arn:aws:iam::210987654321:role/db-relocate",
+			keyMetadata: &kmsTypes.KeyMetadata{
+				KeyManager: kmsTypes.KeyManagerTypeAws,
+				KeyState:   kmsTypes.KeyStateEnabled,
+			},
+		},
+		{
+			name:    "Source KMS key is disabled.",
+			roleArn: "arn:aws:iam::210987654321:role/db-relocate",
+			keyMetadata: &kmsTypes.KeyMetadata{
+				KeyManager: kmsTypes.KeyManagerTypeCustomer,
+				KeyState:   kmsTypes.KeyStateDisabled,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			cloud.Instances[TEST_SRC_INSTANCE_ID].StorageEncrypted = true
+			cloud.Instances[TEST_SRC_INSTANCE_ID].KmsKeyId = a.String(TEST_KMS_KEY_ARN)
+
+			targetCloud := setupTargetFakeCloud(cloud, fakeaws.DEFAULT_REGION, "210987654321")
+			if test.keyMetadata != nil {
+				targetCloud.KeyMetadata[TEST_KMS_KEY_ARN] = *test.keyMetadata
+			}
+
+			c := setupRelocationController(t, cloud, targetCloud)
+			c.configuration.Items.Upgrade.TargetAccountRoleArn = test.roleArn
+
+			err := c.Run()
+			assert.Error(t, err)
+
+			assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+			assert.NotContains(t, cloud.Calls(), "ModifyDBSnapshotAttribute")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestRunFailsCrossRegionPreFlightWithoutTargetResources(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	targetCloud := fakeaws.NewCloud()
+	targetCloud.Region = "eu-west-1"
+
+	c, _ := setupUpgradeControllerWithClients(t, &aws.Clients{
+		RDS:         cloud,
+		CloudWatch:  cloud,
+		EC2:         cloud,
+		KMS:         cloud,
+		Route53:     cloud,
+		TargetRDS:   targetCloud,
+		TargetEC2:   targetCloud,
+		TargetKMS:   targetCloud,
+		WaiterDelay: time.Millisecond,
+	})
+	c.configuration.Items.Upgrade.TargetRegion = "eu-west-1"
+	c.configuration.Items.Upgrade.SubnetGroupName = ""
+	c.configuration.Items.Upgrade.SecurityGroupIDs = []string{}
+	c.configuration.Items.Upgrade.VPCID = ""
+
+	err := c.Run()
+	assert.Error(t, err)
+
+	assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+	assert.NotContains(t, targetCloud.Calls(), "RestoreDBInstanceFromDBSnapshot")
+}
+
+func TestRunRelocatesToAurora(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	cloud.ParameterGroups["test-db-pg13"].Parameters["work_mem"] = rdsTypes.Parameter{
+		ParameterName:  a.String("work_mem"),
+		ParameterValue: a.String("8192"),
+		AllowedValues:  a.String("64-2147483647"),
+		Source:         a.String("user"),
+		IsModifiable:   true,
+	}
+	cloud.EngineVersions = append(cloud.EngineVersions, rdsTypes.DBEngineVersion{
+		Engine:        a.String(aws.TARGET_ENGINE_AURORA_POSTGRESQL),
+		EngineVersion: a.String("14.7"),
+	})
+	cloud.ClusterEngineDefaults["aurora-postgresql14"] = []rdsTypes.Parameter{
+		{
+			ParameterName:  a.String("work_mem"),
+			ParameterValue: a.String("4096"),
+			AllowedValues:  a.String("64-2147483647"),
+			ApplyType:      a.String("dynamic"),
+			IsModifiable:   true,
+		},
+		{
+			ParameterName:  a.String("track_commit_timestamp"),
+			ParameterValue: a.String("0"),
+			AllowedValues:  a.String("0,1"),
+			ApplyType:      a.String("static"),
+			IsModifiable:   true,
+		},
+	}
+
+	c, databaseController := setupUpgradeController(t, cloud, nil)
+	c.configuration.Items.Upgrade.TargetEngine = aws.TARGET_ENGINE_AURORA_POSTGRESQL
+	c.configuration.Items.Upgrade.ParameterGroup = ""
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	assert.NotContains(t, cloud.Calls(), "RestoreDBInstanceFromDBSnapshot")
+	assert.NotContains(t, cloud.Calls(), "CreateDBInstanceReadReplica")
+
+	cluster, ok := cloud.Clusters[TEST_DST_INSTANCE_ID+aws.DB_CLUSTER_IDENTIFIER_SUFFIX]
+	if assert.True(t, ok, "snapshot must be restored to a cluster") {
+		assert.Equal(t, aws.TARGET_ENGINE_AURORA_POSTGRESQL, *cluster.Engine)
+		assert.Equal(t, "14.7", *cluster.EngineVersion)
+		assert.Equal(t, "test-db-aurora-postgresql14-cluster", *cluster.DBClusterParameterGroup)
+		assert.Equal(t, "test-db-subnets", *cluster.DBSubnetGroup)
+		assert.Equal(t, int32(5433), *cluster.Port)
+		assert.Equal(t, int32(7), *cluster.BackupRetentionPeriod)
+		assert.Equal(t, "s3Import", *cluster.AssociatedRoles[0].FeatureName)
+		assert.Equal(t, *cluster.Endpoint, databaseController.dstHost, "connections must go through the cluster endpoint")
+	}
+
+	parameterGroup, ok := cloud.ClusterParameterGroups["test-db-aurora-postgresql14-cluster"]
+	if assert.True(t, ok, "cluster parameter group must be generated") {
+		assert.Equal(t, "aurora-postgresql14", *parameterGroup.Group.DBParameterGroupFamily)
+		assert.Equal(t, "8192", *parameterGroup.Parameters["work_mem"].ParameterValue)
+		assert.Equal(t, "1", *parameterGroup.Parameters["track_commit_timestamp"].ParameterValue)
+	}
+
+	writer, ok := cloud.Instances[TEST_DST_INSTANCE_ID]
+	if assert.True(t, ok, "writer instance must be created") {
+		assert.Equal(t, TEST_DST_INSTANCE_ID+aws.DB_CLUSTER_IDENTIFIER_SUFFIX, *writer.DBClusterIdentifier)
+		assert.Equal(t, "db.t3.small", *writer.DBInstanceClass)
+		assert.Equal(t, "default.aurora-postgresql14", *writer.DBParameterGroups[0].DBParameterGroupName)
+		assert.Equal(t, "rds-ca-rsa2048-g1", *writer.CACertificateIdentifier)
+		assert.Equal(t, int32(30), *writer.MonitoringInterval)
+	}
+
+	reader, ok := cloud.Instances[TEST_DST_REPLICA_ID]
+	if assert.True(t, ok, "read replica must become a reader of the cluster") {
+		assert.Equal(t, TEST_DST_INSTANCE_ID+aws.DB_CLUSTER_IDENTIFIER_SUFFIX, *reader.DBClusterIdentifier)
+		assert.Equal(t, "us-east-1b", *reader.AvailabilityZone)
+	}
+
+	assert.Equal(t, fakeaws.UNHEALTHY_LSN, databaseController.latestUnhealthyLSN)
+	assert.Contains(t, cloud.Calls(), "StopDBInstance")
+}
@@ -0,0 +1,55 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/log"
+
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+func (c *Controller) logReadReplicaEndpoints(readReplicas []*aws.ReadReplica) {
+	for idx := range readReplicas {
+		log.Infof(
+			"Read replica: '%s' is available at: '%s'",
+			readReplicas[idx].Location(),
+			*readReplicas[idx].Instance.Endpoint.Address,
+		)
+	}
+}
+
+func (c *Controller) createReadReplicas(srcInstance *rdsTypes.DBInstance, dstInstance *rdsTypes.DBInstance) error {
+	readReplicas, err := c.awsController.CreateReadReplicas(srcInstance, dstInstance)
+	if err != nil {
+		return err
+	}
+
+	c.logReadReplicaEndpoints(readReplicas)
+
+	return nil
+}
+
+// The switchover has already happened at this point, so a failure here must not be fatal.
+func (c *Controller) reportReadReplicaEndpoints(dstInstance *rdsTypes.DBInstance) {
+	if len(dstInstance.ReadReplicaDBInstanceIdentifiers) == 0 {
+		return
+	}
+
+	readReplicas, err := c.awsController.DescribeReadReplicas(dstInstance)
+	if err != nil {
+		log.Warnf("Failed to describe read replicas of the new instance: %s", err)
+		return
+	}
+
+	log.Infoln("Point read-only traffic to the read replicas of the new instance.")
+	c.logReadReplicaEndpoints(readReplicas)
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/testing/fakeaws"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunRecreatesCrossRegionReadReplica(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	cloud.Instances[TEST_SRC_INSTANCE_ID].ReadReplicaDBInstanceIdentifiers = []string{
+		"arn:aws:rds:eu-west-1:123456789012:db:test-db-replica",
+	}
+	delete(cloud.Instances, TEST_SRC_REPLICA_ID)
+
+	regionalCloud := fakeaws.NewCloud()
+	regionalCloud.Region = "eu-west-1"
+	regionalCloud.Instances[TEST_SRC_REPLICA_ID] = &rdsTypes.DBInstance{
+		DBInstanceIdentifier: a.String(TEST_SRC_REPLICA_ID),
+		DBInstanceClass:      a.String("db.t3.micro"),
+		DBInstanceStatus:     a.String(fakeaws.STATUS_AVAILABLE),
+		KmsKeyId:             a.String("arn:aws:kms:eu-west-1:123456789012:key/regional-key"),
+		DBSubnetGroup: &rdsTypes.DBSubnetGroup{
+			DBSubnetGroupName: a.String("test-db-replica-subnets"),
+		},
+	}
+
+	c, _ := setupUpgradeController(t, cloud, map[string]aws.RDSAPI{"eu-west-1": regionalCloud})
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	assert.NotContains(t, cloud.Calls(), "CreateDBInstanceReadReplica")
+
+	dstReplica, ok := regionalCloud.Instances[TEST_DST_REPLICA_ID]
+	if assert.True(t, ok, "read replica must be recreated in its own region") {
+		assert.Equal(t, *cloud.Instances[TEST_DST_INSTANCE_ID].DBInstanceArn, *dstReplica.ReadReplicaSourceDBInstanceIdentifier)
+		assert.Equal(t, "arn:aws:kms:eu-west-1:123456789012:key/regional-key", *dstReplica.KmsKeyId)
+		assert.Empty(t, dstReplica.DBParameterGroups, "cross-region replica must use the default parameter group")
+	}
+}
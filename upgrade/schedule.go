@@ -0,0 +1,272 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/log"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+const (
+	BLACKOUT_NAME           string        = "blackout"
+	BLACKOUT_ALL_WEEKDAYS   string        = "*"
+	SCHEDULE_TIME_LAYOUT    string        = "2006-01-02 15:04 MST"
+	SCHEDULE_CRON_LAYOUT    string        = "%d %d %d %d *"
+	SCHEDULE_START_INTERVAL time.Duration = time.Minute
+)
+
+type blackout struct {
+	weekdays    map[time.Weekday]bool
+	startOffset time.Duration
+	endOffset   time.Duration
+}
+
+// Weekdays are given as a list of days or ranges, e.g: 'mon-fri', 'sat,sun' or '*' for every day.
+func parseBlackoutWeekdays(value string) (map[time.Weekday]bool, error) {
+	weekdays := make(map[time.Weekday]bool)
+
+	if value == BLACKOUT_ALL_WEEKDAYS {
+		for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+			weekdays[weekday] = true
+		}
+		return weekdays, nil
+	}
+
+	for _, weekdayRange := range strings.Split(value, ",") {
+		bounds := strings.Split(weekdayRange, "-")
+		if len(bounds) > 2 {
+			return nil, errors.New(fmt.Sprintf("Invalid blackout weekdays: '%s'!", value))
+		}
+
+		first, err := aws.ParseWeekday(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+
+		last, err := aws.ParseWeekday(bounds[len(bounds)-1])
+		if err != nil {
+			return nil, err
+		}
+
+		// Ranges may wrap over the end of the week, e.g: 'fri-mon'.
+		for weekday := first; ; weekday = (weekday + 1) % 7 {
+			weekdays[weekday] = true
+			if weekday == last {
+				break
+			}
+		}
+	}
+
+	return weekdays, nil
+}
+
+// Blackouts are given as '[<weekdays>] HH:MM-HH:MM', e.g: 'mon-fri 09:00-18:00' or '22:00-02:00' for every day.
+func parseBlackout(value string) (*blackout, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 1 {
+		fields = []string{BLACKOUT_ALL_WEEKDAYS, fields[0]}
+	}
+
+	if len(fields) != 2 {
+		return nil, errors.New(fmt.Sprintf("Invalid blackout: '%s'!", value))
+	}
+
+	weekdays, err := parseBlackoutWeekdays(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	timeRange := strings.Split(fields[1], "-")
+	if len(timeRange) != 2 {
+		return nil, errors.New(fmt.Sprintf("Invalid blackout time range: '%s'!", fields[1]))
+	}
+
+	startOffset, err := aws.ParseTimeOfDay(timeRange[0])
+	if err != nil {
+		return nil, err
+	}
+
+	endOffset, err := aws.ParseTimeOfDay(timeRange[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// Blackouts which end before they start, e.g: 22:00-02:00, continue on the next day.
+	if endOffset <= startOffset {
+		endOffset += time.Hour * 24
+	}
+
+	return &blackout{
+		weekdays:    weekdays,
+		startOffset: startOffset,
+		endOffset:   endOffset,
+	}, nil
+}
+
+// Days are built in the given location, so blackouts follow its daylight saving time changes.
+func atTimeOfDay(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(offset.Minutes()), 0, 0, day.Location())
+}
+
+func (b *blackout) occurrences(location *time.Location, from time.Time, to time.Time) []aws.ServiceWindow {
+	occurrences := []aws.ServiceWindow{}
+
+	localFrom := from.In(location)
+	day := time.Date(localFrom.Year(), localFrom.Month(), localFrom.Day()-1, 0, 0, 0, 0, location)
+	for ; !day.After(to); day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, location) {
+		if !b.weekdays[day.Weekday()] {
+			continue
+		}
+
+		occurrence := aws.ServiceWindow{
+			Name:  BLACKOUT_NAME,
+			Start: atTimeOfDay(day, b.startOffset),
+			End:   atTimeOfDay(day, b.endOffset),
+		}
+		if occurrence.End.Before(from) || occurrence.Start.After(to) {
+			continue
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	return occurrences
+}
+
+// Service windows are extended by the same margins the pre-flight checks use.
+func padServiceWindows(serviceWindows []aws.ServiceWindow) []aws.ServiceWindow {
+	paddedServiceWindows := []aws.ServiceWindow{}
+	for idx := range serviceWindows {
+		paddedServiceWindows = append(paddedServiceWindows, aws.ServiceWindow{
+			Name:  serviceWindows[idx].Name,
+			Start: serviceWindows[idx].Start.Add(-time.Hour * time.Duration(aws.SERVICE_WINDOW_LOW_THRESHOLD)),
+			End:   serviceWindows[idx].End.Add(time.Minute * time.Duration(aws.SERVICE_WINDOW_HIGH_THRESHOLD)),
+		})
+	}
+
+	return paddedServiceWindows
+}
+
+// Returns the earliest start time, so [start, start + duration] does not overlap any of the busy windows.
+func findNextStartTime(busyWindows []aws.ServiceWindow, earliest time.Time, latest time.Time, duration time.Duration) (*time.Time, error) {
+	sort.Slice(busyWindows, func(i, j int) bool {
+		return busyWindows[i].Start.Before(busyWindows[j].Start)
+	})
+
+	start := earliest
+	for idx := range busyWindows {
+		if !busyWindows[idx].End.After(start) {
+			continue
+		}
+
+		if !busyWindows[idx].Start.Before(start.Add(duration)) {
+			break
+		}
+
+		log.Debugf(
+			"Start time: %s overlaps a %s: %s - %s",
+			start.Format(SCHEDULE_TIME_LAYOUT),
+			busyWindows[idx].Name,
+			busyWindows[idx].Start.Format(SCHEDULE_TIME_LAYOUT),
+			busyWindows[idx].End.Format(SCHEDULE_TIME_LAYOUT),
+		)
+		start = busyWindows[idx].End
+	}
+
+	if start.Add(duration).After(latest) {
+		return nil, errors.New(fmt.Sprintf(
+			"Failed to find a start time before: %s which keeps the whole run clear of service windows and blackouts!",
+			latest.Format(SCHEDULE_TIME_LAYOUT),
+		))
+	}
+
+	return &start, nil
+}
+
+func (c *Controller) findNextSafeStartTime(instance *rdsTypes.DBInstance, now time.Time, location *time.Location) (*time.Time, error) {
+	// Cron jobs fire at the beginning of a minute, so the start time is aligned to it.
+	earliest := now.Truncate(SCHEDULE_START_INTERVAL)
+	if earliest.Before(now) {
+		earliest = earliest.Add(SCHEDULE_START_INTERVAL)
+	}
+	latest := earliest.Add(c.configuration.Items.Schedule.Horizon)
+
+	serviceWindows, err := c.awsController.GetDBInstanceServiceWindows(instance, &earliest, &latest)
+	if err != nil {
+		return nil, err
+	}
+	busyWindows := padServiceWindows(serviceWindows)
+
+	for idx := range c.configuration.Items.Schedule.Blackouts {
+		blackout, err := parseBlackout(c.configuration.Items.Schedule.Blackouts[idx])
+		if err != nil {
+			return nil, err
+		}
+		busyWindows = append(busyWindows, blackout.occurrences(location, earliest, latest)...)
+	}
+
+	return findNextStartTime(busyWindows, earliest, latest, c.configuration.Items.Upgrade.ExpectedDuration)
+}
+
+func formatCronSchedule(startTime time.Time) string {
+	return fmt.Sprintf(SCHEDULE_CRON_LAYOUT, startTime.Minute(), startTime.Hour(), startTime.Day(), int(startTime.Month()))
+}
+
+// Finds the next start time which keeps the whole run clear of service windows and blackouts.
+// Either waits for it and starts the relocation, or only reports it, e.g: to be used by a cron job.
+func (c *Controller) Schedule(wait bool) error {
+	instances, err := c.awsController.DescribeDBInstance(&c.configuration.Items.Src.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	if len(instances) == 0 {
+		return errors.New("Failed to find source DB instance!")
+	}
+
+	location, err := time.LoadLocation(c.configuration.Items.Schedule.Timezone)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	startTime, err := c.findNextSafeStartTime(&instances[0], now, location)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"Next safe start time: %s (%s) for an expected duration of %s.",
+		startTime.In(location).Format(SCHEDULE_TIME_LAYOUT),
+		startTime.UTC().Format(SCHEDULE_TIME_LAYOUT),
+		c.configuration.Items.Upgrade.ExpectedDuration,
+	)
+	log.Infof("Cron schedule in UTC: '%s'", formatCronSchedule(startTime.UTC()))
+
+	if !wait {
+		return nil
+	}
+
+	log.Infof("Waiting %s until the start.", startTime.Sub(now).Round(time.Second))
+	select {
+	case <-time.After(time.Until(*startTime)):
+	case <-(*c.configuration.Context).Done():
+		return (*c.configuration.Context).Err()
+	}
+
+	return c.Run()
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 2000-01-03 is a Monday.
+var scheduleTestTimestamp = time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+
+func TestParseBlackout(t *testing.T) {
+	tests := []struct {
+		name          string
+		blackout      string
+		from          time.Time
+		to            time.Time
+		expected      []aws.ServiceWindow
+		expectedError bool
+	}{
+		{
+			name:     "Blackout without weekdays applies to every day.",
+			blackout: "09:00-18:00",
+			from:     scheduleTestTimestamp,
+			to:       scheduleTestTimestamp.Add(time.Hour * 34),
+			expected: []aws.ServiceWindow{
+				{Name: BLACKOUT_NAME, Start: scheduleTestTimestamp.Add(time.Hour * 9), End: scheduleTestTimestamp.Add(time.Hour * 18)},
+				{Name: BLACKOUT_NAME, Start: scheduleTestTimestamp.Add(time.Hour * 33), End: scheduleTestTimestamp.Add(time.Hour * 42)},
+			},
+		},
+		{
+			name:     "Blackout crossing midnight continues on the next day.",
+			blackout: "sun 22:00-02:00",
+			from:     scheduleTestTimestamp,
+			to:       scheduleTestTimestamp.Add(time.Hour * 24),
+			expected: []aws.ServiceWindow{
+				{Name: BLACKOUT_NAME, Start: scheduleTestTimestamp.Add(-time.Hour * 2), End: scheduleTestTimestamp.Add(time.Hour * 2)},
+			},
+		},
+		{
+			name:     "Weekday range wraps over the end of the week.",
+			blackout: "sat-mon 10:00-11:00",
+			from:     scheduleTestTimestamp,
+			to:       scheduleTestTimestamp.Add(time.Hour * 24 * 7),
+			expected: []aws.ServiceWindow{
+				{Name: BLACKOUT_NAME, Start: scheduleTestTimestamp.Add(time.Hour * 10), End: scheduleTestTimestamp.Add(time.Hour * 11)},
+				{Name: BLACKOUT_NAME, Start: scheduleTestTimestamp.Add(time.Hour * (24*5 + 10)), End: scheduleTestTimestamp.Add(time.Hour * (24*5 + 11))},
+				{Name: BLACKOUT_NAME, Start: scheduleTestTimestamp.Add(time.Hour * (24*6 + 10)), End: scheduleTestTimestamp.Add(time.Hour * (24*6 + 11))},
+			},
+		},
+		{
+			name:          "Invalid weekday is rejected.",
+			blackout:      "mon-fryday 09:00-18:00",
+			expectedError: true,
+		},
+		{
+			name:          "Invalid time range is rejected.",
+			blackout:      "mon 09:00",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			blackout, err := parseBlackout(test.blackout)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, blackout.occurrences(time.UTC, test.from, test.to))
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestFindNextStartTime(t *testing.T) {
+	window := func(start time.Duration, end time.Duration) aws.ServiceWindow {
+		return aws.ServiceWindow{Name: BLACKOUT_NAME, Start: scheduleTestTimestamp.Add(start), End: scheduleTestTimestamp.Add(end)}
+	}
+
+	tests := []struct {
+		name          string
+		busyWindows   []aws.ServiceWindow
+		duration      time.Duration
+		expected      time.Time
+		expectedError bool
+	}{
+		{
+			name:     "Start right away when nothing is busy.",
+			duration: time.Hour,
+			expected: scheduleTestTimestamp,
+		},
+		{
+			name:        "Start after the window which is in progress.",
+			busyWindows: []aws.ServiceWindow{window(-time.Hour, time.Hour)},
+			duration:    time.Hour,
+			expected:    scheduleTestTimestamp.Add(time.Hour),
+		},
+		{
+			name:        "Skip a gap which is too short for the whole run.",
+			busyWindows: []aws.ServiceWindow{window(time.Hour*5, time.Hour*6), window(time.Hour*2, time.Hour*3)},
+			duration:    time.Hour * 3,
+			expected:    scheduleTestTimestamp.Add(time.Hour * 6),
+		},
+		{
+			name:        "Use a gap which fits the whole run.",
+			busyWindows: []aws.ServiceWindow{window(time.Hour, time.Hour*2), window(time.Hour*5, time.Hour*6)},
+			duration:    time.Hour * 2,
+			expected:    scheduleTestTimestamp.Add(time.Hour * 2),
+		},
+		{
+			name:        "Overlapping windows are handled.",
+			busyWindows: []aws.ServiceWindow{window(0, time.Hour*4), window(time.Hour, time.Hour*2)},
+			duration:    time.Hour,
+			expected:    scheduleTestTimestamp.Add(time.Hour * 4),
+		},
+		{
+			name:          "No start time within the horizon.",
+			busyWindows:   []aws.ServiceWindow{window(0, time.Hour*23)},
+			duration:      time.Hour * 2,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			startTime, err := findNextStartTime(test.busyWindows, scheduleTestTimestamp, scheduleTestTimestamp.Add(time.Hour*24), test.duration)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, *startTime)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	tests := []struct {
+		name          string
+		blackouts     []string
+		expectedError bool
+	}{
+		{
+			name:      "Start time is found around service windows and blackouts.",
+			blackouts: []string{"mon-fri 09:00-18:00"},
+		},
+		{
+			name:          "Blackouts leave no room for the whole run.",
+			blackouts:     []string{"00:00-12:00", "12:00-00:00"},
+			expectedError: true,
+		},
+		{
+			name:          "Invalid blackout is rejected.",
+			blackouts:     []string{"someday 09:00-18:00"},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Schedule.Blackouts = test.blackouts
+
+			err := c.Schedule(false)
+			if test.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+			assert.Empty(t, databaseController.calls)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/aws"
+	"db_relocate/log"
+	"errors"
+	"time"
+
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+func reportStorageRecommendation(recommendation *aws.StorageRecommendation) {
+	log.Infof(
+		"Recommended storage: type: '%s', size: %d GB, IOPS: %d, throughput: %d MiB/s, max allocated storage: %d GB. 0 means the baseline of the storage type.",
+		recommendation.StorageType,
+		recommendation.StorageSize,
+		recommendation.StorageIOPS,
+		recommendation.StorageThroughput,
+		recommendation.MaxAllocatedStorage,
+	)
+
+	for idx := range recommendation.Justifications {
+		log.Infof("  %s", recommendation.Justifications[idx])
+	}
+}
+
+func reportInstanceClassRecommendation(recommendation *aws.InstanceClassRecommendation) {
+	log.Infof("Recommended instance class: '%s'.", recommendation.InstanceClass)
+
+	for idx := range recommendation.Justifications {
+		log.Infof("  %s", recommendation.Justifications[idx])
+	}
+}
+
+// Only the storage settings which are not set explicitly are taken from the recommendation.
+func (c *Controller) applyStorageRecommendation(instance *rdsTypes.DBInstance, now *time.Time) error {
+	if !c.configuration.Items.Sizing.ApplyStorage || c.awsController.IsAuroraTarget() || c.awsController.IsBlueGreenStrategy() {
+		return nil
+	}
+
+	recommendation, err := c.awsController.RecommendDBInstanceStorage(instance, now)
+	if err != nil {
+		return err
+	}
+	reportStorageRecommendation(recommendation)
+
+	upgradeConfiguration := c.configuration.Items.Upgrade
+	if upgradeConfiguration.StorageType == "" {
+		upgradeConfiguration.StorageType = recommendation.StorageType
+	}
+
+	// Provisioning depends on the type and the size, so it is only taken together with them.
+	if upgradeConfiguration.StorageType != recommendation.StorageType {
+		log.Warnf(
+			"Storage type: '%s' is set explicitly, the rest of the recommendation for: '%s' is not applied.",
+			upgradeConfiguration.StorageType,
+			recommendation.StorageType,
+		)
+		return nil
+	}
+
+	if upgradeConfiguration.StorageSize == 0 {
+		upgradeConfiguration.StorageSize = recommendation.StorageSize
+	}
+
+	if upgradeConfiguration.StorageIOPS == 0 {
+		upgradeConfiguration.StorageIOPS = recommendation.StorageIOPS
+	}
+
+	if upgradeConfiguration.StorageThroughput == 0 {
+		upgradeConfiguration.StorageThroughput = recommendation.StorageThroughput
+	}
+
+	if upgradeConfiguration.MaxAllocatedStorage == nil && recommendation.MaxAllocatedStorage != 0 {
+		upgradeConfiguration.MaxAllocatedStorage = &recommendation.MaxAllocatedStorage
+	}
+
+	log.Infoln("Storage recommendation has been applied to the settings which were not set.")
+
+	return nil
+}
+
+// Reports sizing recommendations for the new instance without changing anything.
+func (c *Controller) Advise() error {
+	instances, err := c.awsController.DescribeDBInstance(&c.configuration.Items.Src.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	if len(instances) == 0 {
+		return errors.New("Failed to find source DB instance!")
+	}
+
+	now := time.Now().UTC()
+	recommendation, err := c.awsController.RecommendDBInstanceStorage(&instances[0], &now)
+	if err != nil {
+		return err
+	}
+	reportStorageRecommendation(recommendation)
+
+	instanceClassRecommendation, err := c.awsController.RecommendDBInstanceClass(&instances[0], &now)
+	if err != nil {
+		return err
+	}
+	reportInstanceClassRecommendation(instanceClassRecommendation)
+
+	return nil
+}
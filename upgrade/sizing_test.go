@@ -0,0 +1,148 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/testing/fakeaws"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Free storage space shrinks by 1GB a day over the last day, while reads and writes peak at 14000 IOPS together.
+func setupStorageMetricHistory(cloud *fakeaws.Cloud) {
+	freeStorageSpace := []float64{}
+	for hour := 0; hour <= 24; hour++ {
+		freeStorageSpace = append(freeStorageSpace, (51-float64(hour)/24)*1024*1024*1024)
+	}
+
+	cloud.MetricHistory = map[string][]float64{
+		"FreeStorageSpace":          freeStorageSpace,
+		"ReadIOPS":                  {4000, 8000},
+		"WriteIOPS":                 {2000, 6000},
+		"ReadThroughput":            {50 * 1024 * 1024},
+		"WriteThroughput":           {50 * 1024 * 1024},
+		"TransactionLogsGeneration": {1024 * 1024},
+	}
+}
+
+func TestRunAppliesStorageRecommendation(t *testing.T) {
+	tests := []struct {
+		name                        string
+		storageSize                 int32
+		expectedStorageSize         int32
+		expectedIOPS                int32
+		expectedMaxAllocatedStorage int32
+	}{
+		{
+			name:                        "recommendation is applied",
+			expectedStorageSize:         400,
+			expectedIOPS:                16800,
+			expectedMaxAllocatedStorage: 500,
+		},
+		{
+			name:                        "storage size set explicitly is kept",
+			storageSize:                 600,
+			expectedStorageSize:         600,
+			expectedIOPS:                16800,
+			expectedMaxAllocatedStorage: 750,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			setupStorageMetricHistory(cloud)
+			c, _ := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Sizing.ApplyStorage = true
+			c.configuration.Items.Upgrade.StorageType = ""
+			c.configuration.Items.Upgrade.StorageSize = test.storageSize
+
+			err := c.Run()
+			assert.NoError(t, err)
+
+			dstInstance, ok := cloud.Instances[TEST_DST_INSTANCE_ID]
+			if assert.True(t, ok, "destination instance must be restored") {
+				assert.Equal(t, "gp3", *dstInstance.StorageType)
+				assert.Equal(t, test.expectedStorageSize, dstInstance.AllocatedStorage)
+				assert.Equal(t, test.expectedIOPS, *dstInstance.Iops)
+				assert.Equal(t, test.expectedMaxAllocatedStorage, *dstInstance.MaxAllocatedStorage)
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func buildInstanceTypeInfo(instanceType string, vCPUs int32, memory int64, networkPerformance string) ec2Types.InstanceTypeInfo {
+	return ec2Types.InstanceTypeInfo{
+		InstanceType: ec2Types.InstanceType(instanceType),
+		VCpuInfo:     &ec2Types.VCpuInfo{DefaultVCpus: a.Int32(vCPUs)},
+		MemoryInfo:   &ec2Types.MemoryInfo{SizeInMiB: a.Int64(memory)},
+		NetworkInfo:  &ec2Types.NetworkInfo{NetworkPerformance: a.String(networkPerformance)},
+	}
+}
+
+func setupInstanceClasses(cloud *fakeaws.Cloud) {
+	cloud.InstanceClasses = []string{
+		"db.t3.micro",
+		"db.t3.small",
+		"db.m5.large",
+		"db.m5.xlarge",
+		"db.m7g.large",
+		"db.m7gd.large",
+		"db.m7g.xlarge",
+		"db.r7g.large",
+	}
+	cloud.InstanceTypes = []ec2Types.InstanceTypeInfo{
+		buildInstanceTypeInfo("t3.micro", 2, 1024, "Up to 5 Gigabit"),
+		buildInstanceTypeInfo("t3.small", 2, 2048, "Up to 5 Gigabit"),
+		buildInstanceTypeInfo("m5.large", 2, 8192, "Up to 10 Gigabit"),
+		buildInstanceTypeInfo("m5.xlarge", 4, 16384, "Up to 10 Gigabit"),
+		buildInstanceTypeInfo("m7g.large", 2, 8192, "Up to 12.5 Gigabit"),
+		buildInstanceTypeInfo("m7gd.large", 2, 8192, "Up to 12.5 Gigabit"),
+		buildInstanceTypeInfo("m7g.xlarge", 4, 16384, "Up to 12.5 Gigabit"),
+		buildInstanceTypeInfo("r7g.large", 2, 16384, "Up to 12.5 Gigabit"),
+	}
+}
+
+func setupInstanceMetricHistory(cloud *fakeaws.Cloud, cpuUtilization float64, freeableMemory float64, connections float64) {
+	if cloud.MetricHistory == nil {
+		cloud.MetricHistory = make(map[string][]float64)
+	}
+
+	cloud.MetricHistory["CPUUtilization"] = []float64{cpuUtilization / 2, cpuUtilization}
+	cloud.MetricHistory["FreeableMemory"] = []float64{freeableMemory * 1024 * 1024 * 1024}
+	cloud.MetricHistory["DatabaseConnections"] = []float64{connections}
+	cloud.MetricHistory["NetworkReceiveThroughput"] = []float64{10 * 1024 * 1024}
+	cloud.MetricHistory["NetworkTransmitThroughput"] = []float64{20 * 1024 * 1024}
+}
+
+func TestAdvise(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	setupStorageMetricHistory(cloud)
+	setupInstanceClasses(cloud)
+	setupInstanceMetricHistory(cloud, 50, 0.5, 50)
+	c, _ := setupUpgradeController(t, cloud, nil)
+
+	err := c.Advise()
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{"DescribeDBInstances", "GetMetricData", "DescribeOrderableDBInstanceOptions", "DescribeInstanceTypes", "GetMetricData"},
+		cloud.Calls(),
+		"advice must not change anything",
+	)
+	assert.Equal(t, "gp3", c.configuration.Items.Upgrade.StorageType)
+	assert.Equal(t, int32(0), c.configuration.Items.Upgrade.StorageSize)
+}
@@ -0,0 +1,274 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/input"
+	"db_relocate/log"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Clients are stalled by PgBouncer while waiting, so the wait can not be longer than what is left of the pause.
+func (c *Controller) getSwitchoverSyncTimeout() time.Duration {
+	syncTimeout := c.configuration.Items.Switchover.SyncTimeout
+
+	if c.pgBouncerController.Enabled() {
+		remainingPauseTime := c.pgBouncerController.RemainingPauseTime()
+		if remainingPauseTime < syncTimeout {
+			syncTimeout = remainingPauseTime
+		}
+	}
+
+	return syncTimeout
+}
+
+func (c *Controller) buildSwitchoverSteps(heartBeatRecord *int64) []*switchoverStep {
+	steps := []*switchoverStep{}
+
+	if c.pgBouncerController.Enabled() {
+		steps = append(steps, &switchoverStep{
+			name:     "pause PgBouncer database",
+			action:   c.pgBouncerController.Pause,
+			rollback: c.pgBouncerController.Resume,
+		})
+	}
+
+	steps = append(steps, []*switchoverStep{
+		{
+			name:     "freeze writes on the old instance",
+			action:   c.databaseController.FreezeSrcDatabaseWrites,
+			rollback: c.databaseController.LiftSrcDatabaseWriteFreeze,
+		},
+		{
+			name:   "terminate application sessions on the old instance",
+			action: c.databaseController.TerminateSrcDatabaseSessions,
+		},
+		{
+			name: "send a heartbeat record to the new instance",
+			action: func() error {
+				timestamp, err := c.databaseController.SendHeartBeatRecord()
+				if err != nil {
+					return err
+				}
+				*heartBeatRecord = *timestamp
+				return nil
+			},
+		},
+		{
+			name: "wait until the new instance is in sync",
+			action: func() error {
+				return c.databaseController.WaitUntilSyncWithin(c.getSwitchoverSyncTimeout())
+			},
+		},
+		{
+			name: "verify the heartbeat record on the new instance",
+			action: func() error {
+				return c.databaseController.VerifyHeartBeatRecordReceived(heartBeatRecord)
+			},
+		},
+	}...)
+
+	// Rolling back resumes clients only after the write freeze has been lifted on the old instance.
+	if c.pgBouncerController.Enabled() {
+		steps = append(steps, &switchoverStep{
+			name:   "ensure PgBouncer pause has not expired",
+			action: c.pgBouncerController.EnsurePauseHasNotExpired,
+		})
+	}
+
+	steps = append(steps, &switchoverStep{
+		name:         "increment sequence values on the new instance",
+		action:       c.databaseController.IncrementSequenceValues,
+		irreversible: true,
+	})
+
+	// The forward replication is dropped here, so the old instance would silently diverge if it was made writable again.
+	if c.configuration.Items.Upgrade.ReverseReplication {
+		steps = append(steps, &switchoverStep{
+			name:         "enable reverse replication to the old instance",
+			action:       c.databaseController.EnableReverseReplication,
+			irreversible: true,
+		})
+	}
+
+	if c.pgBouncerController.Enabled() {
+		steps = append(steps, &switchoverStep{
+			name:     "point PgBouncer to the new instance",
+			action:   c.pgBouncerController.SwitchToDestination,
+			rollback: c.pgBouncerController.SwitchToSource,
+		})
+	}
+
+	if c.awsController.Route53Enabled() {
+		steps = append(steps, &switchoverStep{
+			name:     "point DNS record to the new instance",
+			action:   c.awsController.SwitchDNSRecordToDestination,
+			rollback: c.awsController.SwitchDNSRecordToSource,
+		})
+	}
+
+	if c.haproxyController.Enabled() {
+		steps = append(steps, &switchoverStep{
+			name:     "switch HAProxy traffic to the new instance",
+			action:   c.haproxyController.SwitchToDestination,
+			rollback: c.haproxyController.SwitchToSource,
+		})
+	}
+
+	return steps
+}
+
+// Rolls back the failed step together with all of the completed ones in reverse order.
+func (c *Controller) rollbackSwitchoverSteps(steps []*switchoverStep) {
+	for idx := len(steps) - 1; idx >= 0; idx-- {
+		if steps[idx].rollback == nil {
+			continue
+		}
+
+		log.Warnf("Rolling back switchover step: '%s'", steps[idx].name)
+
+		err := steps[idx].rollback()
+		if err != nil {
+			log.Errorf("Failed to roll back switchover step: '%s': %s", steps[idx].name, err)
+		}
+	}
+}
+
+// The old instance is kept read-only, since the new one may have been written to or may no longer receive its changes.
+func (c *Controller) failSwitchoverForward(irreversibleStep *switchoverStep, err error) error {
+	log.Errorf(
+		"Switchover step: '%s' can not be rolled back. Keeping the old instance read-only.",
+		irreversibleStep.name,
+	)
+
+	return errors.New(fmt.Sprintf(
+		"Switchover has failed after step: '%s': %s. Complete the remaining steps manually or use 'fallback' command if reverse replication has been enabled!",
+		irreversibleStep.name,
+		err,
+	))
+}
+
+// Write downtime is measured from the first step, since PgBouncer already holds the writes while it is paused.
+func (c *Controller) runSwitchoverSteps(steps []*switchoverStep) (*time.Duration, error) {
+	writeDowntimeStart := time.Now().UTC()
+
+	var irreversibleStep *switchoverStep
+	for idx := range steps {
+		if steps[idx].irreversible && irreversibleStep == nil {
+			irreversibleStep = steps[idx]
+		}
+
+		log.Infof("Running switchover step: '%s'", steps[idx].name)
+
+		err := steps[idx].action()
+		if err != nil {
+			log.Errorf("Switchover step: '%s' has failed!", steps[idx].name)
+
+			if irreversibleStep != nil {
+				return nil, c.failSwitchoverForward(irreversibleStep, err)
+			}
+
+			c.rollbackSwitchoverSteps(steps[:idx+1])
+			return nil, err
+		}
+	}
+
+	writeDowntime := time.Now().UTC().Sub(writeDowntimeStart)
+
+	return &writeDowntime, nil
+}
+
+func (c *Controller) Switchover() error {
+	if c.awsController.IsBlueGreenStrategy() {
+		return c.switchoverBlueGreenDeployment()
+	}
+
+	_, dstInstance, err := c.describeSrcAndDstDBInstances()
+	if err != nil {
+		return err
+	}
+
+	err = c.databaseController.InitDestinationDatabaseConnection(dstInstance.DBInstanceIdentifier, dstInstance.Endpoint.Address, dstInstance.Endpoint.Port)
+	if err != nil {
+		return err
+	}
+
+	err = c.databaseController.EnsureSwitchoverIsPossible()
+	if err != nil {
+		return err
+	}
+
+	// Checked again, since the parameters of the new instance may have changed after the run.
+	if c.configuration.Items.Upgrade.ReverseReplication {
+		err = c.databaseController.EnsureLogicalReplicationOnDstDatabase()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.haproxyController.Enabled() {
+		err = c.haproxyController.EnsureRuntimeAPIIsReachable()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.pgBouncerController.Enabled() {
+		err = c.pgBouncerController.EnsureAdminConsoleIsReachable()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.awsController.Route53Enabled() {
+		err = c.awsController.EnsureDNSRecordExists()
+		if err != nil {
+			return err
+		}
+	}
+
+	switchoverInput := &input.BinaryInputMetadata{
+		Message:          "Application writes to the old instance will be blocked. Ready to switch over to the new instance: y/n?",
+		PositiveResponse: "y",
+		NegativeResponse: "n",
+	}
+	positiveResponse, err := switchoverInput.ProcessBinaryInput()
+	if err != nil {
+		return err
+	}
+
+	if !positiveResponse {
+		return nil
+	}
+
+	stopMetricsProcess := c.beginMetricsProcess(PHASE_SWITCHOVER)
+	defer stopMetricsProcess()
+
+	var heartBeatRecord int64
+	writeDowntime, err := c.runSwitchoverSteps(c.buildSwitchoverSteps(&heartBeatRecord))
+	if err != nil {
+		return err
+	}
+
+	c.enterPhase(PHASE_COMPLETED)
+
+	log.Infof("Switchover has been completed. Measured write downtime: %s", writeDowntime.Round(time.Millisecond))
+
+	if !c.haproxyController.Enabled() && !c.pgBouncerController.Enabled() && !c.awsController.Route53Enabled() {
+		log.Infoln("Point your application to the new instance.")
+	}
+
+	c.reportReadReplicaEndpoints(dstInstance)
+
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"db_relocate/input"
+	"db_relocate/testing/fakeaws"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	route53Types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	TEST_DNS_RECORD_NAME string = "db.example.com."
+)
+
+func setupDNSRecord(c *Controller, cloud *fakeaws.Cloud, ttl int64) {
+	c.configuration.AWSRoute53.HostedZoneID = "Z1"
+	c.configuration.AWSRoute53.RecordName = TEST_DNS_RECORD_NAME
+	c.configuration.AWSRoute53.LoweredTTL = 60
+
+	cloud.Records[TEST_DNS_RECORD_NAME] = &route53Types.ResourceRecordSet{
+		Name:            a.String(TEST_DNS_RECORD_NAME),
+		Type:            route53Types.RRTypeCname,
+		TTL:             a.Int64(ttl),
+		ResourceRecords: []route53Types.ResourceRecord{{Value: a.String("test-db.fake.rds.amazonaws.com")}},
+	}
+}
+
+// The old instance may only become writable again while the forward replication is intact and sequences are untouched.
+func TestSwitchover(t *testing.T) {
+	tests := []struct {
+		name                 string
+		failingStep          string
+		failingOperation     string
+		expectedRollback     bool
+		expectedDNSRecord    string
+		expectedMissingCalls []string
+	}{
+		{
+			name:              "all steps are completed",
+			expectedDNSRecord: "test-db-v14.fake.rds.amazonaws.com",
+		},
+		{
+			name:                 "freeze fails",
+			failingStep:          "FreezeSrcDatabaseWrites",
+			expectedRollback:     true,
+			expectedDNSRecord:    "test-db.fake.rds.amazonaws.com",
+			expectedMissingCalls: []string{"TerminateSrcDatabaseSessions"},
+		},
+		{
+			name:                 "sync wait fails",
+			failingStep:          "WaitUntilSyncWithin",
+			expectedRollback:     true,
+			expectedDNSRecord:    "test-db.fake.rds.amazonaws.com",
+			expectedMissingCalls: []string{"VerifyHeartBeatRecordReceived"},
+		},
+		{
+			name:                 "heartbeat verification fails",
+			failingStep:          "VerifyHeartBeatRecordReceived",
+			expectedRollback:     true,
+			expectedDNSRecord:    "test-db.fake.rds.amazonaws.com",
+			expectedMissingCalls: []string{"IncrementSequenceValues"},
+		},
+		{
+			name:                 "sequence increment fails",
+			failingStep:          "IncrementSequenceValues",
+			expectedDNSRecord:    "test-db.fake.rds.amazonaws.com",
+			expectedMissingCalls: []string{"EnableReverseReplication"},
+		},
+		{
+			name:              "reverse replication fails",
+			failingStep:       "EnableReverseReplication",
+			expectedDNSRecord: "test-db.fake.rds.amazonaws.com",
+		},
+		{
+			name:              "DNS record switch fails",
+			failingOperation:  "ChangeResourceRecordSets",
+			expectedDNSRecord: "test-db.fake.rds.amazonaws.com",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+
+			err := c.Run()
+			assert.NoError(t, err)
+
+			c.configuration.Items.Upgrade.ReverseReplication = true
+			setupDNSRecord(c, cloud, 60)
+			databaseController.calls = nil
+			databaseController.failOn = test.failingStep
+			if test.failingOperation != "" {
+				cloud.FailOn(test.failingOperation, errors.New("operation has failed"))
+			}
+			input.SetReader(strings.NewReader("y\n"))
+
+			err = c.Switchover()
+			if test.failingStep == "" && test.failingOperation == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			if test.expectedRollback {
+				assert.Contains(t, databaseController.calls, "LiftSrcDatabaseWriteFreeze", "old instance must become writable again")
+			} else {
+				assert.NotContains(t, databaseController.calls, "LiftSrcDatabaseWriteFreeze", "old instance must be kept read-only")
+			}
+
+			for _, call := range test.expectedMissingCalls {
+				assert.NotContains(t, databaseController.calls, call, "no step may run after the failed one")
+			}
+
+			assert.Equal(t, test.expectedDNSRecord, *cloud.Records[TEST_DNS_RECORD_NAME].ResourceRecords[0].Value)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+// Clients are stalled for the whole pause, so every step up to the sequence increment must fit into it.
+func TestSwitchoverWithPgBouncer(t *testing.T) {
+	tests := []struct {
+		name             string
+		pauseTimeout     time.Duration
+		syncDuration     time.Duration
+		expectedRollback bool
+	}{
+		{
+			name:         "sync wait is limited by the remaining pause time",
+			pauseTimeout: time.Minute,
+		},
+		{
+			name:             "pause expires before sequences are incremented",
+			pauseTimeout:     time.Millisecond * 20,
+			syncDuration:     time.Millisecond * 50,
+			expectedRollback: true,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+
+			err := c.Run()
+			assert.NoError(t, err)
+
+			_, mock := setupProxies(t, c)
+			c.configuration.Items.PgBouncer.PauseTimeout = test.pauseTimeout
+			c.configuration.Items.Switchover.SyncTimeout = time.Minute * 5
+			databaseController.calls = nil
+			databaseController.syncDuration = test.syncDuration
+
+			(*mock).ExpectExec(regexp.QuoteMeta("SHOW VERSION;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			(*mock).ExpectExec(regexp.QuoteMeta("PAUSE postgres;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			if !test.expectedRollback {
+				(*mock).ExpectExec(regexp.QuoteMeta("RELOAD;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			(*mock).ExpectExec(regexp.QuoteMeta("RESUME postgres;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			input.SetReader(strings.NewReader("y\n"))
+
+			err = c.Switchover()
+
+			if err := (*mock).ExpectationsWereMet(); err != nil {
+				assert.NoError(t, err, "expectation must be fulfilled")
+			}
+
+			if test.expectedRollback {
+				assert.Error(t, err)
+				assert.Contains(t, databaseController.calls, "LiftSrcDatabaseWriteFreeze", "old instance must become writable again")
+				assert.NotContains(t, databaseController.calls, "IncrementSequenceValues", "switchover must be aborted before it becomes irreversible")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Greater(t, databaseController.syncWaitTimeout, time.Duration(0))
+			assert.LessOrEqual(t, databaseController.syncWaitTimeout, test.pauseTimeout, "sync wait must not outlast the pause")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
@@ -10,9 +10,29 @@
 
 package upgrade
 
+import (
+	"sync"
+	"time"
+)
+
+// The current phase is read by the metrics process, so it is guarded by a mutex.
+type relocationProgress struct {
+	mutex          sync.Mutex
+	phase          string
+	phaseStartTime time.Time
+}
+
 type cleanupOperation struct {
 	message          string
 	positiveResponse string
 	negativeResponse string
 	cleanupFunction  func() error
 }
+
+type switchoverStep struct {
+	name     string
+	action   func() error
+	rollback func() error
+	// Once such a step has been started, the old instance can no longer be made writable again without losing writes.
+	irreversible bool
+}
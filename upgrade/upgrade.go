@@ -11,33 +11,100 @@
 package upgrade
 
 import (
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+
 	"db_relocate/log"
+	"errors"
 	"time"
 )
 
+// A snapshot can only be reused while the replication slot created before it still exists unconsumed,
+// otherwise the changes made between the snapshot and the slot would be lost.
+// The slot is matched to the snapshot by its confirmed flush LSN, which the snapshot is tagged with.
+func (c *Controller) findReusableDBSnapshot(instance *rdsTypes.DBInstance) (*rdsTypes.DBSnapshot, error) {
+	if !c.configuration.Items.Upgrade.ReuseSnapshot {
+		return nil, nil
+	}
+
+	replicationSlotLSN, err := c.databaseController.GetUpgradeLogicalReplicationSlotLSN()
+	if err != nil {
+		return nil, err
+	}
+
+	if replicationSlotLSN == nil {
+		log.Infoln("There is no replication slot of a previous run, so a new snapshot is taken.")
+		return nil, nil
+	}
+
+	return c.awsController.FindReusableDBSnapshot(instance, replicationSlotLSN)
+}
+
 func (c *Controller) Run() error {
+	stopMetricsProcess := c.beginMetricsProcess(PHASE_PRE_FLIGHT_CHECKS)
+	defer stopMetricsProcess()
+
 	now := time.Now().UTC()
 	instance, err := c.runPreFlightChecks(&now)
 	if err != nil {
 		return err
 	}
 
+	c.enterPhase(PHASE_PREPARATION)
+
+	err = c.applyPendingMaintenanceActions(instance, &now)
+	if err != nil {
+		return err
+	}
+
+	err = c.generateTargetParameterGroups(instance)
+	if err != nil {
+		return err
+	}
+
 	err = c.ensureParametersOnSrcDB(instance)
 	if err != nil {
 		return err
 	}
 
+	if c.awsController.IsBlueGreenStrategy() {
+		c.enterPhase(PHASE_BLUE_GREEN_DEPLOYMENT)
+		return c.runBlueGreenDeployment(instance)
+	}
+
+	if c.awsController.Route53Enabled() {
+		err = c.awsController.LowerDNSRecordTTL(instance)
+		if err != nil {
+			return err
+		}
+	}
+
 	heartBeatRecords := []int64{}
 	heartbeatTicker, heartBeatDoneChannel := c.databaseController.BeginHealthCheckProcess(&heartBeatRecords)
 
-	err = c.databaseController.PrepareSrcDatabaseForUpgrade()
+	reusableSnapshot, err := c.findReusableDBSnapshot(instance)
 	if err != nil {
 		return err
 	}
 
+	err = c.databaseController.PrepareSrcDatabaseForUpgrade(reusableSnapshot != nil)
+	if err != nil {
+		return err
+	}
+
+	replicationSlotLSN, err := c.databaseController.GetUpgradeLogicalReplicationSlotLSN()
+	if err != nil {
+		return err
+	}
+
+	if replicationSlotLSN == nil {
+		return errors.New("Replication slot of the upgrade is missing after preparing the source database!")
+	}
+
+	c.enterPhase(PHASE_SNAPSHOT_RESTORE)
+
 	timeBeforeSnapshot := time.Now().UTC()
 
-	newInstance, err := c.awsController.RunDBSnapshotMaintenance(instance)
+	newInstance, err := c.awsController.RunDBSnapshotMaintenance(instance, reusableSnapshot, replicationSlotLSN)
 	if err != nil {
 		return err
 	}
@@ -54,11 +121,13 @@ func (c *Controller) Run() error {
 		return err
 	}
 
-	err = c.databaseController.InitDestinationDatabaseConnection(newInstance.Endpoint.Address)
+	err = c.databaseController.InitDestinationDatabaseConnection(newInstance.DBInstanceIdentifier, newInstance.Endpoint.Address, newInstance.Endpoint.Port)
 	if err != nil {
 		return err
 	}
 
+	c.enterPhase(PHASE_INITIAL_SYNC)
+
 	err = c.databaseController.PrepareDstDatabaseForUpgrade(latestUnhealthyLSN)
 	if err != nil {
 		return err
@@ -77,14 +146,41 @@ func (c *Controller) Run() error {
 		return err
 	}
 
+	c.enterPhase(PHASE_READ_REPLICAS)
+
+	err = c.createReadReplicas(instance, newInstance)
+	if err != nil {
+		return err
+	}
+
+	c.cloneAlarms(instance, newInstance)
+
+	c.enterPhase(PHASE_POST_UPGRADE)
+
 	log.Infoln("Database snapshot has been upgraded and restored.")
 	log.Infoln("Replication is up and running. All health check records have been synced.")
 
+	if c.haproxyController.Enabled() {
+		err = c.haproxyController.GenerateConfiguration()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.pgBouncerController.Enabled() {
+		err = c.pgBouncerController.GenerateIncludeFile()
+		if err != nil {
+			return err
+		}
+	}
+
 	err = c.performPostUpgradeOperations(instance)
 	if err != nil {
 		return err
 	}
 
+	c.enterPhase(PHASE_REPLICATING)
+
 	log.Infoln("Success!")
 
 	return nil
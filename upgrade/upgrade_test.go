@@ -0,0 +1,770 @@
+// Copyright (C) 2023 The db_relocate authors.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 2 as
+// published by the Free Software Foundation;
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT OF THIRD PARTY RIGHTS.
+
+package upgrade
+
+import (
+	"context"
+	"db_relocate/aws"
+	"db_relocate/haproxy"
+	"db_relocate/input"
+	"db_relocate/pgbouncer"
+	"db_relocate/testing/fakeaws"
+	"db_relocate/types"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	a "github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	kmsTypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	TEST_SRC_INSTANCE_ID        string = "test-db"
+	TEST_SRC_INSTANCE_ARN       string = "arn:aws:rds:us-east-1:123456789012:db:test-db"
+	TEST_DST_INSTANCE_ID        string = "test-db-v14"
+	TEST_KMS_KEY_ARN            string = "arn:aws:kms:us-east-1:123456789012:key/test-key"
+	TEST_SRC_REPLICA_ID         string = "test-db-replica"
+	TEST_DST_REPLICA_ID         string = "test-db-replica-v14"
+	TEST_MASTER_USER_SECRET_ARN string = "arn:aws:secretsmanager:us-east-1:123456789012:secret:rds!db-test"
+	// Confirmed flush LSNs of the replication slot a snapshot was taken after and of a slot created by the run.
+	TEST_REPLICATION_SLOT_LSN     string = "0/16B3748"
+	TEST_NEW_REPLICATION_SLOT_LSN string = "0/2A1C5D0"
+)
+
+var (
+	_ aws.RDSAPI        = (*fakeaws.Cloud)(nil)
+	_ aws.CloudWatchAPI = (*fakeaws.Cloud)(nil)
+	_ aws.EC2API        = (*fakeaws.Cloud)(nil)
+	_ aws.KMSAPI        = (*fakeaws.Cloud)(nil)
+	_ aws.Route53API    = (*fakeaws.Cloud)(nil)
+)
+
+type fakeDatabaseController struct {
+	configuration         *types.Configuration
+	calls                 []string
+	latestUnhealthyLSN    string
+	dstHost               string
+	dstPort               int32
+	replicationSlotExists bool
+	replicationSlotLSN    string
+	keptReplicationSlot   bool
+	replicationLag        *types.ReplicationLag
+	heartBeatsSent        *int
+	heartBeatsReceived    *int
+	missingIAMRole        bool
+	failOn                string
+	syncWaitTimeout       time.Duration
+	syncDuration          time.Duration
+	heartBeatWaitTimeout  time.Duration
+}
+
+func (f *fakeDatabaseController) call(name string) error {
+	f.calls = append(f.calls, name)
+
+	if name == f.failOn {
+		return errors.New(fmt.Sprintf("%s has failed", name))
+	}
+
+	return nil
+}
+
+func (f *fakeDatabaseController) InitSourceDatabaseConnection() error {
+	return f.call("InitSourceDatabaseConnection")
+}
+
+func (f *fakeDatabaseController) InitDestinationDatabaseConnection(instanceID *string, host *string, port int32) error {
+	f.dstHost = *host
+	f.dstPort = port
+	f.configuration.Items.Dst.Host = *host
+	f.configuration.Items.Dst.Port = strconv.Itoa(int(port))
+	return f.call("InitDestinationDatabaseConnection")
+}
+
+func (f *fakeDatabaseController) CurrentUserCanProceed() (bool, error) {
+	return true, f.call("CurrentUserCanProceed")
+}
+
+func (f *fakeDatabaseController) CurrentUserHasIAMRole() (bool, error) {
+	return !f.missingIAMRole, f.call("CurrentUserHasIAMRole")
+}
+
+func (f *fakeDatabaseController) UpgradeLogicalReplicationSlotExists() (bool, error) {
+	return f.replicationSlotExists, f.call("UpgradeLogicalReplicationSlotExists")
+}
+
+func (f *fakeDatabaseController) GetUpgradeLogicalReplicationSlotLSN() (*string, error) {
+	err := f.call("GetUpgradeLogicalReplicationSlotLSN")
+	if !f.replicationSlotExists {
+		return nil, err
+	}
+
+	return &f.replicationSlotLSN, err
+}
+
+func (f *fakeDatabaseController) BeginHealthCheckProcess(heartBeatRecords *[]int64) (*time.Ticker, chan bool) {
+	f.call("BeginHealthCheckProcess")
+	return time.NewTicker(time.Hour), make(chan bool, 1)
+}
+
+func (f *fakeDatabaseController) CompareSendAndReceivedHeartbeatRecords(sendHeartBeatRecords []int64) error {
+	return f.call("CompareSendAndReceivedHeartbeatRecords")
+}
+
+func (f *fakeDatabaseController) PrepareSrcDatabaseForUpgrade(keepReplicationSlot bool) error {
+	f.keptReplicationSlot = keepReplicationSlot
+	if !keepReplicationSlot {
+		f.replicationSlotExists = true
+		f.replicationSlotLSN = TEST_NEW_REPLICATION_SLOT_LSN
+	}
+	return f.call("PrepareSrcDatabaseForUpgrade")
+}
+
+func (f *fakeDatabaseController) PrepareDstDatabaseForUpgrade(latestUnhealthyLSN *string) error {
+	f.latestUnhealthyLSN = *latestUnhealthyLSN
+	return f.call("PrepareDstDatabaseForUpgrade")
+}
+
+func (f *fakeDatabaseController) WaitUntilSync() error {
+	return f.call("WaitUntilSync")
+}
+
+func (f *fakeDatabaseController) PerformPostUpgradeOperations() error {
+	return f.call("PerformPostUpgradeOperations")
+}
+
+func (f *fakeDatabaseController) DeleteUpgradeSubscription() error {
+	return f.call("DeleteUpgradeSubscription")
+}
+
+func (f *fakeDatabaseController) DeleteUpgradeUser() error {
+	return f.call("DeleteUpgradeUser")
+}
+
+func (f *fakeDatabaseController) DropHealthCheckTable() error {
+	return f.call("DropHealthCheckTable")
+}
+
+func (f *fakeDatabaseController) DropUpgradeLogicalReplicationSlot() error {
+	return f.call("DropUpgradeLogicalReplicationSlot")
+}
+
+func (f *fakeDatabaseController) DropUpgradePublication() error {
+	return f.call("DropUpgradePublication")
+}
+
+func (f *fakeDatabaseController) EnableReverseReplication() error {
+	return f.call("EnableReverseReplication")
+}
+
+func (f *fakeDatabaseController) EnsureLogicalReplicationOnDstDatabase() error {
+	return f.call("EnsureLogicalReplicationOnDstDatabase")
+}
+
+func (f *fakeDatabaseController) FallbackToSourceDatabase() error {
+	return f.call("FallbackToSourceDatabase")
+}
+
+func (f *fakeDatabaseController) EnsureSwitchoverIsPossible() error {
+	return f.call("EnsureSwitchoverIsPossible")
+}
+
+func (f *fakeDatabaseController) FreezeSrcDatabaseWrites() error {
+	return f.call("FreezeSrcDatabaseWrites")
+}
+
+func (f *fakeDatabaseController) LiftSrcDatabaseWriteFreeze() error {
+	return f.call("LiftSrcDatabaseWriteFreeze")
+}
+
+func (f *fakeDatabaseController) TerminateSrcDatabaseSessions() error {
+	return f.call("TerminateSrcDatabaseSessions")
+}
+
+func (f *fakeDatabaseController) SendHeartBeatRecord() (*int64, error) {
+	timestamp := time.Now().UnixMilli()
+	return &timestamp, f.call("SendHeartBeatRecord")
+}
+
+func (f *fakeDatabaseController) WaitUntilSyncWithin(waitTimeout time.Duration) error {
+	f.syncWaitTimeout = waitTimeout
+	time.Sleep(f.syncDuration)
+	return f.call("WaitUntilSyncWithin")
+}
+
+func (f *fakeDatabaseController) VerifyHeartBeatRecordReceived(timestamp *int64) error {
+	return f.call("VerifyHeartBeatRecordReceived")
+}
+
+func (f *fakeDatabaseController) WaitForHeartBeatRecord(timestamp *int64, waitTimeout time.Duration) error {
+	f.heartBeatWaitTimeout = waitTimeout
+	return f.call("WaitForHeartBeatRecord")
+}
+
+func (f *fakeDatabaseController) IncrementSequenceValues() error {
+	return f.call("IncrementSequenceValues")
+}
+
+// Metrics are collected by a separate goroutine, so these calls are not recorded.
+func (f *fakeDatabaseController) GetUpgradeReplicationLag() (*types.ReplicationLag, error) {
+	return f.replicationLag, nil
+}
+
+func (f *fakeDatabaseController) CountSentHeartBeatRecords() (*int, error) {
+	return f.heartBeatsSent, nil
+}
+
+func (f *fakeDatabaseController) CountReceivedHeartBeatRecords() (*int, error) {
+	return f.heartBeatsReceived, nil
+}
+
+// Both service windows are kept far away from the current time, so the pre-flight checks pass.
+func setupFakeCloud(now time.Time) *fakeaws.Cloud {
+	cloud := fakeaws.NewCloud()
+
+	backupWindowStart := now.Add(time.Hour * 6)
+	maintenanceWindowWeekday := strings.ToLower(now.Add(time.Hour * 24 * 3).Weekday().String()[:3])
+
+	cloud.Instances[TEST_SRC_INSTANCE_ID] = &rdsTypes.DBInstance{
+		DBInstanceIdentifier:               a.String(TEST_SRC_INSTANCE_ID),
+		DBInstanceArn:                      a.String(TEST_SRC_INSTANCE_ARN),
+		DBInstanceClass:                    a.String("db.t3.micro"),
+		DBInstanceStatus:                   a.String(fakeaws.STATUS_AVAILABLE),
+		Engine:                             a.String("postgres"),
+		EngineVersion:                      a.String("13.7"),
+		AllocatedStorage:                   100,
+		StorageType:                        a.String("gp3"),
+		PreferredBackupWindow:              a.String(fmt.Sprintf("%02d:00-%02d:30", backupWindowStart.Hour(), backupWindowStart.Hour())),
+		PreferredMaintenanceWindow:         a.String(fmt.Sprintf("%s:04:00-%s:04:30", maintenanceWindowWeekday, maintenanceWindowWeekday)),
+		BackupRetentionPeriod:              7,
+		MaxAllocatedStorage:                a.Int32(200),
+		MonitoringInterval:                 a.Int32(30),
+		MonitoringRoleArn:                  a.String("arn:aws:iam::123456789012:role/rds-monitoring"),
+		PerformanceInsightsEnabled:         a.Bool(true),
+		PerformanceInsightsKMSKeyId:        a.String(TEST_KMS_KEY_ARN),
+		PerformanceInsightsRetentionPeriod: a.Int32(31),
+		EnabledCloudwatchLogsExports:       []string{"postgresql", "upgrade"},
+		OptionGroupMemberships: []rdsTypes.OptionGroupMembership{
+			{OptionGroupName: a.String("default:postgres-13")},
+		},
+		AssociatedRoles: []rdsTypes.DBInstanceRole{
+			{FeatureName: a.String("s3Import"), RoleArn: a.String("arn:aws:iam::123456789012:role/rds-s3-import")},
+		},
+		Endpoint: &rdsTypes.Endpoint{
+			Address: a.String("test-db.fake.rds.amazonaws.com"),
+			Port:    5433,
+		},
+		DBParameterGroups: []rdsTypes.DBParameterGroupStatus{
+			{
+				DBParameterGroupName: a.String("test-db-pg13"),
+				ParameterApplyStatus: a.String("in-sync"),
+			},
+		},
+		DBSubnetGroup: &rdsTypes.DBSubnetGroup{
+			DBSubnetGroupName: a.String("test-db-subnets"),
+			VpcId:             a.String("vpc-1"),
+			Subnets:           []rdsTypes.Subnet{{SubnetIdentifier: a.String("subnet-1")}, {SubnetIdentifier: a.String("subnet-2")}},
+		},
+		VpcSecurityGroups: []rdsTypes.VpcSecurityGroupMembership{
+			{VpcSecurityGroupId: a.String("sg-1"), Status: a.String("active")},
+		},
+		PendingModifiedValues:            &rdsTypes.PendingModifiedValues{},
+		ReadReplicaDBInstanceIdentifiers: []string{TEST_SRC_REPLICA_ID},
+	}
+
+	cloud.Instances[TEST_SRC_REPLICA_ID] = &rdsTypes.DBInstance{
+		DBInstanceIdentifier:                  a.String(TEST_SRC_REPLICA_ID),
+		DBInstanceClass:                       a.String("db.t3.micro"),
+		DBInstanceStatus:                      a.String(fakeaws.STATUS_AVAILABLE),
+		Engine:                                a.String("postgres"),
+		EngineVersion:                         a.String("13.7"),
+		AvailabilityZone:                      a.String("us-east-1b"),
+		StorageType:                           a.String("gp3"),
+		MonitoringInterval:                    a.Int32(60),
+		MonitoringRoleArn:                     a.String("arn:aws:iam::123456789012:role/rds-monitoring"),
+		ReadReplicaSourceDBInstanceIdentifier: a.String(TEST_SRC_INSTANCE_ID),
+		TagList:                               []rdsTypes.Tag{{Key: a.String("team"), Value: a.String("reporting")}},
+		Endpoint: &rdsTypes.Endpoint{
+			Address: a.String("test-db-replica.fake.rds.amazonaws.com"),
+			Port:    5432,
+		},
+	}
+
+	for _, parameterGroup := range []struct {
+		name   string
+		family string
+	}{
+		{name: "test-db-pg13", family: "postgres13"},
+		{name: "test-db-pg14", family: "postgres14"},
+	} {
+		cloud.ParameterGroups[parameterGroup.name] = &fakeaws.ParameterGroup{
+			Group: rdsTypes.DBParameterGroup{
+				DBParameterGroupName:   a.String(parameterGroup.name),
+				DBParameterGroupFamily: a.String(parameterGroup.family),
+			},
+			Parameters: map[string]rdsTypes.Parameter{
+				"rds.logical_replication": {
+					ParameterName:  a.String("rds.logical_replication"),
+					ParameterValue: a.String("0"),
+					IsModifiable:   true,
+				},
+				"track_commit_timestamp": {
+					ParameterName:  a.String("track_commit_timestamp"),
+					ParameterValue: a.String("0"),
+					IsModifiable:   true,
+				},
+			},
+		}
+	}
+
+	cloud.SubnetGroups["test-db-subnets"] = &rdsTypes.DBSubnetGroup{
+		DBSubnetGroupName: a.String("test-db-subnets"),
+		VpcId:             a.String("vpc-1"),
+		Subnets:           []rdsTypes.Subnet{{SubnetIdentifier: a.String("subnet-1")}, {SubnetIdentifier: a.String("subnet-2")}},
+	}
+	cloud.EngineVersions = []rdsTypes.DBEngineVersion{
+		{
+			Engine:             a.String("postgres"),
+			EngineVersion:      a.String("13.7"),
+			ValidUpgradeTarget: []rdsTypes.UpgradeTarget{{EngineVersion: a.String("14.7")}},
+		},
+	}
+	cloud.InstanceClasses = []string{"db.t3.micro", "db.t3.small"}
+	cloud.StorageTypes = []string{"gp2", "gp3"}
+	cloud.Certificates = []rdsTypes.Certificate{{CertificateIdentifier: a.String("rds-ca-rsa2048-g1")}}
+	cloud.FreeStorageSpace = 50 * 1024 * 1024 * 1024
+	cloud.Vpcs = []ec2Types.Vpc{{VpcId: a.String("vpc-1")}}
+	cloud.SecurityGroups = []ec2Types.SecurityGroup{
+		{
+			GroupId: a.String("sg-1"),
+			VpcId:   a.String("vpc-1"),
+			IpPermissions: []ec2Types.IpPermission{
+				{
+					IpProtocol:       a.String("tcp"),
+					FromPort:         a.Int32(5432),
+					ToPort:           a.Int32(5432),
+					UserIdGroupPairs: []ec2Types.UserIdGroupPair{{GroupId: a.String("sg-1")}},
+				},
+			},
+			IpPermissionsEgress: []ec2Types.IpPermission{
+				{IpProtocol: a.String("-1"), IpRanges: []ec2Types.IpRange{{CidrIp: a.String("0.0.0.0/0")}}},
+			},
+		},
+	}
+	cloud.Subnets = []ec2Types.Subnet{
+		{SubnetId: a.String("subnet-1"), VpcId: a.String("vpc-1"), CidrBlock: a.String("10.0.1.0/24")},
+		{SubnetId: a.String("subnet-2"), VpcId: a.String("vpc-1"), CidrBlock: a.String("10.0.2.0/24")},
+	}
+	cloud.NetworkAcls = []ec2Types.NetworkAcl{
+		{
+			NetworkAclId: a.String("acl-1"),
+			VpcId:        a.String("vpc-1"),
+			Associations: []ec2Types.NetworkAclAssociation{{SubnetId: a.String("subnet-1")}, {SubnetId: a.String("subnet-2")}},
+			Entries: []ec2Types.NetworkAclEntry{
+				{RuleNumber: a.Int32(100), Protocol: a.String("-1"), RuleAction: ec2Types.RuleActionAllow, Egress: a.Bool(false), CidrBlock: a.String("0.0.0.0/0")},
+				{RuleNumber: a.Int32(32767), Protocol: a.String("-1"), RuleAction: ec2Types.RuleActionDeny, Egress: a.Bool(false), CidrBlock: a.String("0.0.0.0/0")},
+				{RuleNumber: a.Int32(100), Protocol: a.String("-1"), RuleAction: ec2Types.RuleActionAllow, Egress: a.Bool(true), CidrBlock: a.String("0.0.0.0/0")},
+				{RuleNumber: a.Int32(32767), Protocol: a.String("-1"), RuleAction: ec2Types.RuleActionDeny, Egress: a.Bool(true), CidrBlock: a.String("0.0.0.0/0")},
+			},
+		},
+	}
+	cloud.Keys = []kmsTypes.KeyListEntry{{KeyId: a.String("test-key"), KeyArn: a.String(TEST_KMS_KEY_ARN)}}
+	cloud.Aliases = []kmsTypes.AliasListEntry{
+		{
+			AliasName:   a.String("alias/aws/rds"),
+			AliasArn:    a.String("arn:aws:kms:us-east-1:123456789012:alias/aws/rds"),
+			TargetKeyId: a.String("test-key"),
+		},
+	}
+
+	return cloud
+}
+
+func setupUpgradeController(t *testing.T, cloud *fakeaws.Cloud, regionalClouds map[string]aws.RDSAPI) (*Controller, *fakeDatabaseController) {
+	return setupUpgradeControllerWithClients(t, &aws.Clients{
+		RDS:            cloud,
+		CloudWatch:     cloud,
+		EC2:            cloud,
+		KMS:            cloud,
+		Route53:        cloud,
+		SecretsManager: cloud,
+		RegionalRDS:    regionalClouds,
+		WaiterDelay:    time.Millisecond,
+	})
+}
+
+func setupUpgradeControllerWithClients(t *testing.T, clients *aws.Clients) (*Controller, *fakeDatabaseController) {
+	cont := context.TODO()
+
+	configuration := &types.Configuration{
+		Context: &cont,
+		Items: &types.Items{
+			Src: &types.DBInstanceDetails{InstanceID: TEST_SRC_INSTANCE_ID, Name: "postgres", Port: "5432"},
+			Dst: &types.DBInstanceDetails{},
+			Upgrade: &types.UpgradeDetails{
+				EngineVersion:      "14.7",
+				ParameterGroup:     "test-db-pg14",
+				SubnetGroupName:    "test-db-subnets",
+				SecurityGroupIDs:   []string{"sg-1"},
+				VPCID:              "vpc-1",
+				InstanceClass:      "db.t3.small",
+				StorageType:        "gp3",
+				Password:           "test-password",
+				CAIdentifier:       "rds-ca-rsa2048-g1",
+				ReadReplicas:       true,
+				ExpectedDuration:   time.Hour * 6,
+				PendingMaintenance: aws.PENDING_MAINTENANCE_FAIL,
+			},
+			Switchover: &types.SwitchoverDetails{},
+			HAProxy:    &types.HAProxyDetails{},
+			PgBouncer:  &types.PgBouncerDetails{},
+			Schedule:   &types.ScheduleDetails{Timezone: "UTC", Horizon: time.Hour * 24 * 14},
+			Sizing:     &types.SizingDetails{Lookback: time.Hour * 24 * 14, Horizon: time.Hour * 24 * 90},
+		},
+		AWSRegion:  fakeaws.DEFAULT_REGION,
+		AWSRoute53: &types.Route53Details{},
+		AWSMetrics: &types.MetricsDetails{},
+	}
+
+	awsController := aws.NewControllerWithClients(configuration, clients, nil)
+
+	haproxyController, err := haproxy.NewController(configuration, nil)
+	assert.NoError(t, err)
+
+	pgBouncerController, err := pgbouncer.NewController(configuration, nil)
+	assert.NoError(t, err)
+
+	databaseController := &fakeDatabaseController{configuration: configuration}
+
+	// Every cleanup operation is confirmed.
+	input.SetReader(strings.NewReader(strings.Repeat("y\n", 7)))
+
+	return NewController(configuration, databaseController, awsController, haproxyController, pgBouncerController, nil), databaseController
+}
+
+func TestRun(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	c, databaseController := setupUpgradeController(t, cloud, nil)
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	dstInstance, ok := cloud.Instances[TEST_DST_INSTANCE_ID]
+	if assert.True(t, ok, "destination instance must be restored") {
+		assert.Equal(t, "14.7", *dstInstance.EngineVersion)
+		assert.Equal(t, "db.t3.small", *dstInstance.DBInstanceClass)
+		assert.Equal(t, "rds-ca-rsa2048-g1", *dstInstance.CACertificateIdentifier)
+		assert.Equal(t, TEST_KMS_KEY_ARN, *dstInstance.KmsKeyId)
+		assert.True(t, dstInstance.StorageEncrypted)
+		assert.Equal(t, int32(5433), dstInstance.Endpoint.Port)
+		assert.Equal(t, "default:postgres-14", *dstInstance.OptionGroupMemberships[0].OptionGroupName)
+		assert.Equal(t, []string{"postgresql", "upgrade"}, dstInstance.EnabledCloudwatchLogsExports)
+		assert.Equal(t, int32(7), dstInstance.BackupRetentionPeriod)
+		assert.Equal(t, *cloud.Instances[TEST_SRC_INSTANCE_ID].PreferredBackupWindow, *dstInstance.PreferredBackupWindow)
+		assert.Equal(t, int32(200), *dstInstance.MaxAllocatedStorage)
+		assert.Equal(t, int32(30), *dstInstance.MonitoringInterval)
+		assert.Equal(t, "arn:aws:iam::123456789012:role/rds-monitoring", *dstInstance.MonitoringRoleArn)
+		assert.True(t, *dstInstance.PerformanceInsightsEnabled)
+		assert.Equal(t, int32(31), *dstInstance.PerformanceInsightsRetentionPeriod)
+		assert.Equal(t, "s3Import", *dstInstance.AssociatedRoles[0].FeatureName)
+	}
+
+	assert.Equal(t, "1", *cloud.ParameterGroups["test-db-pg13"].Parameters["rds.logical_replication"].ParameterValue)
+	assert.Equal(t, "1", *cloud.ParameterGroups["test-db-pg14"].Parameters["track_commit_timestamp"].ParameterValue)
+	dstReplica, ok := cloud.Instances[TEST_DST_REPLICA_ID]
+	if assert.True(t, ok, "read replica must be recreated") {
+		assert.Equal(t, TEST_DST_INSTANCE_ID, *dstReplica.ReadReplicaSourceDBInstanceIdentifier)
+		assert.Equal(t, "14.7", *dstReplica.EngineVersion)
+		assert.Equal(t, "test-db-pg14", *dstReplica.DBParameterGroups[0].DBParameterGroupName)
+		assert.Equal(t, "us-east-1b", *dstReplica.AvailabilityZone)
+		assert.Equal(t, int32(60), *dstReplica.MonitoringInterval)
+		assert.Equal(t, "reporting", *dstReplica.TagList[0].Value)
+	}
+
+	assert.Equal(t, fakeaws.UNHEALTHY_LSN, databaseController.latestUnhealthyLSN)
+	assert.Equal(t, int32(5433), databaseController.dstPort, "the port of the new endpoint must be used")
+	assert.Contains(t, cloud.Calls(), "StopDBInstance")
+	assert.Contains(t, databaseController.calls, "PerformPostUpgradeOperations")
+}
+
+func TestRunAppliesSnapshotRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention string
+		kept      []string
+	}{
+		{
+			name:      "all snapshots are kept",
+			retention: aws.SNAPSHOT_RETENTION_ALL,
+			kept:      []string{"test-db-upgrade-%s", "test-db-upgrade-%s-encrypted"},
+		},
+		{
+			name:      "restored snapshot is kept",
+			retention: aws.SNAPSHOT_RETENTION_RESTORED,
+			kept:      []string{"test-db-upgrade-%s-encrypted"},
+		},
+		{
+			name:      "no snapshot is kept",
+			retention: aws.SNAPSHOT_RETENTION_NONE,
+			kept:      []string{},
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			c, _ := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Upgrade.SnapshotRetention = test.retention
+
+			err := c.Run()
+			assert.NoError(t, err)
+
+			kept := []string{}
+			for _, name := range test.kept {
+				kept = append(kept, fmt.Sprintf(name, c.awsController.GetRunID()))
+			}
+			for identifier, snapshot := range cloud.Snapshots {
+				assert.Contains(t, kept, identifier)
+				assert.Contains(t, snapshot.TagList, rdsTypes.Tag{Key: a.String(aws.SNAPSHOT_RUN_ID_TAG), Value: a.String(c.awsController.GetRunID())})
+			}
+			assert.Len(t, cloud.Snapshots, len(kept))
+
+			for _, tag := range cloud.Instances[TEST_DST_INSTANCE_ID].TagList {
+				assert.NotEqual(t, aws.SNAPSHOT_RUN_ID_TAG, *tag.Key, "run metadata must not be copied to the instance")
+			}
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestRunReusesSnapshot(t *testing.T) {
+	tests := []struct {
+		name                  string
+		replicationSlotExists bool
+		replicationSlotLSN    string
+		engineVersion         string
+		manualSnapshots       int
+		reused                bool
+	}{
+		{
+			name:                  "upgraded snapshot is reused",
+			replicationSlotExists: true,
+			replicationSlotLSN:    TEST_REPLICATION_SLOT_LSN,
+			engineVersion:         "14.7",
+			reused:                true,
+		},
+		{
+			name:                  "upgraded snapshot on a later page is reused",
+			replicationSlotExists: true,
+			replicationSlotLSN:    TEST_REPLICATION_SLOT_LSN,
+			engineVersion:         "14.7",
+			manualSnapshots:       fakeaws.SNAPSHOT_PAGE_SIZE + 50,
+			reused:                true,
+		},
+		{
+			name:                  "snapshot of another engine version is not reused",
+			replicationSlotExists: true,
+			replicationSlotLSN:    TEST_REPLICATION_SLOT_LSN,
+			engineVersion:         "13.7",
+			reused:                false,
+		},
+		{
+			name:                  "snapshot without a replication slot is not reused",
+			replicationSlotExists: false,
+			engineVersion:         "14.7",
+			reused:                false,
+		},
+		{
+			name:                  "snapshot taken before another replication slot is not reused",
+			replicationSlotExists: true,
+			replicationSlotLSN:    "0/1F00000",
+			engineVersion:         "14.7",
+			reused:                false,
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			cloud.Snapshots["test-db-upgrade-20260101000000-encrypted"] = &rdsTypes.DBSnapshot{
+				DBSnapshotIdentifier: a.String("test-db-upgrade-20260101000000-encrypted"),
+				DBInstanceIdentifier: a.String(TEST_SRC_INSTANCE_ID),
+				Engine:               a.String("postgres"),
+				EngineVersion:        a.String(test.engineVersion),
+				Encrypted:            true,
+				KmsKeyId:             a.String(TEST_KMS_KEY_ARN),
+				Status:               a.String(fakeaws.STATUS_AVAILABLE),
+				TagList: []rdsTypes.Tag{
+					{Key: a.String(aws.SNAPSHOT_RUN_ID_TAG), Value: a.String("20260101000000")},
+					{Key: a.String(aws.SNAPSHOT_SOURCE_INSTANCE_TAG), Value: a.String(TEST_SRC_INSTANCE_ID)},
+					{Key: a.String(aws.SNAPSHOT_REPLICATION_SLOT_LSN_TAG), Value: a.String(TEST_REPLICATION_SLOT_LSN)},
+				},
+			}
+			for idx := 0; idx < test.manualSnapshots; idx++ {
+				snapshotID := fmt.Sprintf("test-db-manual-%03d", idx)
+				cloud.Snapshots[snapshotID] = &rdsTypes.DBSnapshot{
+					DBSnapshotIdentifier: a.String(snapshotID),
+					DBInstanceIdentifier: a.String(TEST_SRC_INSTANCE_ID),
+					Status:               a.String(fakeaws.STATUS_AVAILABLE),
+				}
+			}
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			c.configuration.Items.Upgrade.ReuseSnapshot = true
+			databaseController.replicationSlotExists = test.replicationSlotExists
+			databaseController.replicationSlotLSN = test.replicationSlotLSN
+
+			err := c.Run()
+			assert.NoError(t, err)
+
+			assert.Equal(t, test.reused, databaseController.keptReplicationSlot)
+			assert.Contains(t, cloud.Snapshots, "test-db-upgrade-20260101000000-encrypted", "snapshot of a previous run must never be deleted")
+			if test.reused {
+				assert.NotContains(t, cloud.Calls(), "CreateDBSnapshot")
+				assert.Len(t, cloud.Snapshots, test.manualSnapshots+1)
+			} else {
+				assert.Contains(t, cloud.Calls(), "CreateDBSnapshot")
+				for identifier, snapshot := range cloud.Snapshots {
+					if strings.Contains(identifier, c.awsController.GetRunID()) {
+						assert.Contains(t, snapshot.TagList, rdsTypes.Tag{Key: a.String(aws.SNAPSHOT_REPLICATION_SLOT_LSN_TAG), Value: a.String(TEST_NEW_REPLICATION_SLOT_LSN)})
+					}
+				}
+			}
+			assert.Contains(t, cloud.Instances, TEST_DST_INSTANCE_ID)
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func TestRunFailsOnAWSError(t *testing.T) {
+	// Describe calls made by the waiters are not listed, since waiters keep retrying on errors.
+	operations := []string{
+		"DescribeDBInstances",
+		"DescribeVpcs",
+		"DescribeSecurityGroups",
+		"DescribeDBSubnetGroups",
+		"DescribeSubnets",
+		"DescribeNetworkAcls",
+		"DescribeDBEngineVersions",
+		"DescribeDBParameterGroups",
+		"DescribeValidDBInstanceModifications",
+		"DescribeCertificates",
+		"DescribeOrderableDBInstanceOptions",
+		"GetMetricData",
+		"ListAliases",
+		"DescribePendingMaintenanceActions",
+		"DescribeDBParameters",
+		"ModifyDBParameterGroup",
+		"RebootDBInstance",
+		"CreateDBSnapshot",
+		"CopyDBSnapshot",
+		"ModifyDBSnapshot",
+		"RestoreDBInstanceFromDBSnapshot",
+		"ModifyDBInstance",
+		"AddRoleToDBInstance",
+		"DescribeDBLogFiles",
+		"DownloadDBLogFilePortion",
+		"CreateDBInstanceReadReplica",
+		"StopDBInstance",
+	}
+
+	for _, operation := range operations {
+		testFunction := func(t *testing.T) {
+			injectedError := errors.New(fmt.Sprintf("%s has failed", operation))
+
+			cloud := setupFakeCloud(time.Now().UTC())
+			cloud.FailOn(operation, injectedError)
+			c, _ := setupUpgradeController(t, cloud, nil)
+
+			err := c.Run()
+			assert.ErrorIs(t, err, injectedError, "injected error must be returned")
+			assert.Contains(t, cloud.Calls(), operation)
+		}
+		t.Run(operation, testFunction)
+	}
+}
+
+func TestRunFailsOnStateTransition(t *testing.T) {
+	tests := []struct {
+		name            string
+		identifier      string
+		expectedMissing string
+	}{
+		{
+			name:            "snapshot creation has failed",
+			identifier:      "test-db-upgrade-{run_id}",
+			expectedMissing: "CopyDBSnapshot",
+		},
+		{
+			name:            "snapshot encryption has failed",
+			identifier:      "test-db-upgrade-{run_id}-encrypted",
+			expectedMissing: "RestoreDBInstanceFromDBSnapshot",
+		},
+		{
+			name:            "snapshot restore has failed",
+			identifier:      TEST_DST_INSTANCE_ID,
+			expectedMissing: "ModifyDBInstance",
+		},
+		{
+			name:            "read replica creation has failed",
+			identifier:      TEST_DST_REPLICA_ID,
+			expectedMissing: "StopDBInstance",
+		},
+	}
+
+	for _, test := range tests {
+		testFunction := func(t *testing.T) {
+			cloud := setupFakeCloud(time.Now().UTC())
+			c, databaseController := setupUpgradeController(t, cloud, nil)
+			cloud.FailStateTransition(strings.ReplaceAll(test.identifier, "{run_id}", c.awsController.GetRunID()))
+
+			err := c.Run()
+			assert.Error(t, err)
+			assert.NotContains(t, cloud.Calls(), test.expectedMissing)
+			assert.NotContains(t, databaseController.calls, "PerformPostUpgradeOperations")
+		}
+		t.Run(test.name, testFunction)
+	}
+}
+
+func setupMasterUserSecret(cloud *fakeaws.Cloud, password string) {
+	cloud.Instances[TEST_SRC_INSTANCE_ID].MasterUsername = a.String("postgres")
+	cloud.Instances[TEST_SRC_INSTANCE_ID].MasterUserSecret = &rdsTypes.MasterUserSecret{
+		SecretArn:    a.String(TEST_MASTER_USER_SECRET_ARN),
+		KmsKeyId:     a.String(TEST_KMS_KEY_ARN),
+		SecretStatus: a.String("active"),
+	}
+	cloud.Secrets[TEST_MASTER_USER_SECRET_ARN] = fmt.Sprintf(`{"username":"postgres","password":"%s"}`, password)
+}
+
+func TestRunManagesMasterUserPassword(t *testing.T) {
+	cloud := setupFakeCloud(time.Now().UTC())
+	setupMasterUserSecret(cloud, "initial-password")
+	c, _ := setupUpgradeController(t, cloud, nil)
+
+	err := c.Run()
+	assert.NoError(t, err)
+
+	dstInstance, ok := cloud.Instances[TEST_DST_INSTANCE_ID]
+	if assert.True(t, ok, "destination instance must be restored") && assert.NotNil(t, dstInstance.MasterUserSecret, "managed password must be carried over") {
+		assert.Equal(t, TEST_KMS_KEY_ARN, *dstInstance.MasterUserSecret.KmsKeyId)
+		assert.NotEqual(t, TEST_MASTER_USER_SECRET_ARN, *dstInstance.MasterUserSecret.SecretArn)
+	}
+
+	password, managed, err := c.awsController.ReadDestinationMasterUserPassword(TEST_DST_INSTANCE_ID, "postgres")
+	assert.NoError(t, err)
+	assert.True(t, managed)
+	assert.Equal(t, "generated-"+TEST_DST_INSTANCE_ID, password, "the secret of the new instance must be read")
+}